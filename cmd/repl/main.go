@@ -2,9 +2,10 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"justasimpletoydb/internal/executor"
+	"io"
+	"justasimpletoydb/internal/protocol"
 	"log"
 	"net"
 	"os"
@@ -12,43 +13,130 @@ import (
 )
 
 func main() {
-	conn, err := net.Dial("tcp", "localhost:4000")
+	nc, err := net.Dial("tcp", "localhost:4000")
 	if err != nil {
 		log.Fatalf("failed to connect to server: %v", err)
 	}
-	defer conn.Close()
+	defer nc.Close()
+	conn := protocol.NewConn(nc)
+	if err := conn.Handshake(); err != nil {
+		log.Fatalf("failed to connect to server: %v", err)
+	}
+	txState, err := awaitReady(conn, "")
+	if err != nil {
+		log.Fatalf("lost connection to server: %v", err)
+	}
 
 	reader := bufio.NewReader(os.Stdin)
-	serverReader := bufio.NewReader(conn)
 
-	fmt.Println("Connected to JustASimpleToyDB. Type queries, or 'exit' to quit.")
+	fmt.Println("Connected to JustASimpleToyDB. End statements with ';', or type 'exit' to quit.")
 
+	var query strings.Builder
 	for {
-		fmt.Print("> ")
-		line, _ := reader.ReadString('\n')
+		fmt.Print(prompt(txState, query.Len() > 0))
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			break
+		}
 		line = strings.TrimSpace(line)
-		if line == "" {
+		if query.Len() == 0 {
+			if line == "" {
+				continue
+			}
+			if line == "exit" {
+				break
+			}
+		}
+
+		// a statement may span lines; it is sent once a line ends it
+		query.WriteString(line)
+		query.WriteString("\n")
+		if !strings.HasSuffix(line, ";") {
 			continue
 		}
-		if line == "exit" {
-			break
+		sql := query.String()
+		query.Reset()
+
+		if err := conn.Send(&protocol.Query{SQL: sql}); err != nil {
+			log.Fatalf("lost connection to server: %v", err)
+		}
+		if err := conn.Flush(); err != nil {
+			log.Fatalf("lost connection to server: %v", err)
+		}
+		if txState, err = awaitReady(conn, sql); err != nil {
+			log.Fatalf("lost connection to server: %v", err)
 		}
+	}
+	conn.Send(&protocol.Terminate{})
+	conn.Flush()
+}
 
-		// Send query to server
-		conn.Write([]byte(line + "\n"))
+// prompt shows whether the session is in a transaction block, and whether
+// a statement is being continued.
+func prompt(txState byte, continued bool) string {
+	mark := ""
+	switch txState {
+	case protocol.TxActive:
+		mark = "*"
+	case protocol.TxFailed:
+		mark = "!"
+	}
+	if continued {
+		return mark + "-> "
+	}
+	return mark + "> "
+}
 
-		// Read response
-		resp, _ := serverReader.ReadString('\n')
-		var result executor.ExecResult
-		if err := json.Unmarshal([]byte(resp), &result); err == nil {
-			fmt.Printf("Message: %s    Affected: %d\n", result.Message, result.Affected)
-			if len(result.Rows) > 0 {
-				prettyPrintTable(result.Columns, result.Rows)
+// awaitReady prints the answers to a query until the server is ready for
+// the next, and returns the session's transaction state.
+func awaitReady(conn *protocol.Conn, sql string) (byte, error) {
+	var columns []string
+	var rows [][]any
+	for {
+		msg, err := conn.Receive()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("server closed the connection")
 			}
-		} else {
-			fmt.Println(resp)
+			return 0, err
 		}
+		switch m := msg.(type) {
+		case *protocol.Header:
+			columns, rows = m.Columns, nil
+		case *protocol.RowBatch:
+			rows = append(rows, m.Rows...)
+		case *protocol.Complete:
+			fmt.Printf("Message: %s    Affected: %d\n", m.Message, m.Affected)
+			if len(rows) > 0 {
+				prettyPrintTable(columns, rows)
+			}
+			columns, rows = nil, nil
+		case *protocol.Notice:
+			fmt.Println("WARNING:", m.Message)
+		case *protocol.Error:
+			printError(m, sql)
+		case *protocol.Ready:
+			return m.TxState, nil
+		}
+	}
+}
+
+// printError prints an error, pointing at the line and column of a syntax
+// error in the query.
+func printError(e *protocol.Error, sql string) {
+	fmt.Printf("ERROR: %s (SQLSTATE %s)\n", e.Message, e.Code)
+	if e.Position < 0 || e.Position > len(sql) {
+		return
+	}
+	lineStart := strings.LastIndex(sql[:e.Position], "\n") + 1
+	lineEnd := strings.IndexByte(sql[e.Position:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(sql)
+	} else {
+		lineEnd += e.Position
 	}
+	fmt.Println(sql[lineStart:lineEnd])
+	fmt.Println(strings.Repeat(" ", e.Position-lineStart) + "^")
 }
 
 func prettyPrintTable(columns []string, rows [][]any) {
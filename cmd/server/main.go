@@ -1,49 +1,159 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"justasimpletoydb/internal/engine"
 	"justasimpletoydb/internal/executor"
-	"justasimpletoydb/internal/processor"
+	"justasimpletoydb/internal/parser"
+	"justasimpletoydb/internal/pgwire"
+	"justasimpletoydb/internal/protocol"
+	"justasimpletoydb/internal/sqlstate"
 	"log"
 	"net"
-	"strings"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
-func handleConnection(conn net.Conn, qp *processor.QueryProcessor) {
+// rowsPerBatch is the most rows sent in one RowBatch message.
+const rowsPerBatch = 100
+
+func handleConnection(nc net.Conn, e *engine.Engine) {
 	log.Println("client connected")
-	defer conn.Close()
-	reader := bufio.NewReader(conn)
-	writer := bufio.NewWriter(conn)
+	defer nc.Close()
+	conn := protocol.NewConn(nc)
+	if err := conn.Accept(); err != nil {
+		log.Println("handshake failed:", err)
+		return
+	}
+	ex := executor.NewExecutor(e)
+	defer func() {
+		// a transaction block left open by the client is rolled back
+		if err := ex.Close(); err != nil {
+			log.Println("closing session:", err)
+		}
+	}()
+	ready(conn, ex)
+	if err := conn.Flush(); err != nil {
+		return
+	}
 
 	for {
-		line, err := reader.ReadString('\n')
+		msg, err := conn.Receive()
 		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Println("client error:", err)
+			}
 			log.Println("client disconnected")
 			return
 		}
-
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+		switch m := msg.(type) {
+		case *protocol.Query:
+			runQuery(conn, ex, m.SQL)
+		case *protocol.Terminate:
+			log.Println("client disconnected")
+			return
+		default:
+			conn.Send(&protocol.Error{
+				Code:     sqlstate.ProtocolViolation,
+				Message:  fmt.Sprintf("unexpected message %q", m.Type()),
+				Position: -1,
+			})
+			ready(conn, ex)
 		}
-		if line == "exit" {
+		if err := conn.Flush(); err != nil {
 			return
 		}
+	}
+}
 
-		result, err := qp.RunQuery(line)
+// runQuery runs the statements of a query in order, stopping at the first
+// error.
+func runQuery(conn *protocol.Conn, ex *executor.Executor, sql string) {
+	defer ready(conn, ex)
+	stmts, err := parser.ParseAll(sql)
+	if err != nil {
+		sendError(conn, err)
+		return
+	}
+	for _, stmt := range stmts {
+		res, err := ex.Execute(stmt)
 		if err != nil {
-			writer.WriteString(fmt.Sprintf("parse error: %v\n", err))
-			writer.Flush()
-			continue
-		} else {
-			data, _ := result.ToJSON()
-			writer.Write(data)
-			writer.WriteString("\n")
+			sendError(conn, err)
+			return
+		}
+		if res.Notice != "" {
+			conn.Send(&protocol.Notice{Message: res.Notice})
 		}
-		writer.Flush()
+		// Types is set for the statements returning rows
+		if res.Types != nil {
+			conn.Send(&protocol.Header{Columns: res.Columns, Types: res.Types})
+			for i := 0; i < len(res.Rows); i += rowsPerBatch {
+				conn.Send(&protocol.RowBatch{Rows: res.Rows[i:min(i+rowsPerBatch, len(res.Rows))]})
+			}
+		}
+		conn.Send(&protocol.Complete{Message: res.Message, Affected: res.Affected})
+	}
+}
+
+func sendError(conn *protocol.Conn, err error) {
+	conn.Send(&protocol.Error{Code: sqlstate.Of(err), Message: err.Error(), Position: sqlstate.Position(err)})
+}
+
+func ready(conn *protocol.Conn, ex *executor.Executor) {
+	state := byte(protocol.TxIdle)
+	switch ex.TxState() {
+	case executor.TxActive:
+		state = protocol.TxActive
+	case executor.TxFailed:
+		state = protocol.TxFailed
+	}
+	conn.Send(&protocol.Ready{TxState: state})
+}
+
+// sessions tracks the connections of the native protocol being served,
+// so that shutdown can close them and wait for their sessions to end.
+type sessions struct {
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	shutdown bool
+	wg       sync.WaitGroup
+}
+
+// serve serves a connection in a goroutine of its own, or closes it if
+// shutting down.
+func (s *sessions) serve(nc net.Conn, e *engine.Engine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		nc.Close()
+		return
+	}
+	s.conns[nc] = struct{}{}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		handleConnection(nc, e)
+		s.mu.Lock()
+		delete(s.conns, nc)
+		s.mu.Unlock()
+	}()
+}
+
+// close closes the connections and waits for their sessions to end: a
+// running statement finishes first, and an open transaction block is
+// rolled back.
+func (s *sessions) close() {
+	s.mu.Lock()
+	s.shutdown = true
+	for nc := range s.conns {
+		nc.Close()
 	}
+	s.mu.Unlock()
+	s.wg.Wait()
 }
 
 func main() {
@@ -52,18 +162,50 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to start server: %v", err)
 	}
-	defer ln.Close()
+	pgln, err := net.Listen("tcp", ":5432")
+	if err != nil {
+		log.Fatalf("failed to start server: %v", err)
+	}
 
 	e := engine.NewEngine("data")
-	exec := executor.NewExecutor(e)
-	qp := processor.QueryProcessor{Exec: exec}
+	pg := pgwire.NewServer(e)
+	go servePostgres(pg, pgln)
 
+	// on SIGINT or SIGTERM the listeners are closed, which ends the
+	// accept loop; the tables are flushed and closed once the sessions
+	// have ended
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Printf("received %v, shutting down", <-sig)
+		ln.Close()
+		pgln.Close()
+	}()
+
+	s := &sessions{conns: make(map[net.Conn]struct{})}
 	for {
 		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			break
+		}
 		if err != nil {
 			log.Println("failed to accept connection:", err)
 			continue
 		}
-		go handleConnection(conn, &qp)
+		s.serve(conn, e)
+	}
+	s.close()
+	pg.Shutdown()
+	if err := e.Close(); err != nil {
+		log.Fatalf("closing tables: %v", err)
+	}
+}
+
+// servePostgres serves the PostgreSQL wire protocol, for psql and
+// PostgreSQL drivers, until ln is closed.
+func servePostgres(pg *pgwire.Server, ln net.Listener) {
+	fmt.Printf("Serving the PostgreSQL protocol on %s...\n", ln.Addr())
+	if err := pg.Serve(ln); err != nil {
+		log.Fatalf("postgres server: %v", err)
 	}
 }
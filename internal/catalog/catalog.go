@@ -1,23 +1,46 @@
 package catalog
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
 )
 
+// Catalog holds the schemas of the tables, sequences and views. It is
+// shared by every session and its methods may be called concurrently. A
+// table's schema is changed in place only by sessions holding the table's
+// exclusive lock, so other sessions read the schemas handed out to them
+// under a lock on the table.
 type Catalog struct {
-	path   string
-	Tables map[string]*TableSchema
+	mu        sync.RWMutex
+	path      string
+	seqPath   string
+	viewPath  string
+	Tables    map[string]*TableSchema
+	Sequences map[string]*Sequence
+	Views     map[string]*View
 }
 
 func NewCatalog(path string) *Catalog {
 	c := &Catalog{
-		path:   path,
-		Tables: make(map[string]*TableSchema),
+		path:      path,
+		seqPath:   filepath.Join(filepath.Dir(path), "sequences.json"),
+		viewPath:  filepath.Join(filepath.Dir(path), "views.json"),
+		Tables:    make(map[string]*TableSchema),
+		Sequences: make(map[string]*Sequence),
+		Views:     make(map[string]*View),
 	}
 	c.load()
+	c.loadSequences()
+	c.loadViews()
+	// owned sequences whose table was dropped just before a crash
+	_ = c.pruneSequences()
 	return c
 }
 
@@ -29,7 +52,25 @@ func (c *Catalog) load() {
 	if err != nil {
 		panic(fmt.Sprintf("failed to read catalog: %v", err))
 	}
-	_ = json.Unmarshal(data, &c.Tables)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	_ = dec.Decode(&c.Tables)
+	for _, schema := range c.Tables {
+		normalizeMissing(schema.Columns)
+		for _, cols := range schema.Layouts {
+			normalizeMissing(cols)
+		}
+	}
+}
+
+// normalizeMissing converts JSON numbers back to the column's Go type.
+func normalizeMissing(cols []Column) {
+	for i, col := range cols {
+		if n, ok := col.Missing.(json.Number); ok {
+			v, _ := strconv.Atoi(n.String())
+			cols[i].Missing = v
+		}
+	}
 }
 
 func (c *Catalog) save() error {
@@ -37,20 +78,71 @@ func (c *Catalog) save() error {
 	if err != nil {
 		return err
 	}
-	dir := filepath.Dir(c.path)
-	_ = os.MkdirAll(dir, 0755)
-	return os.WriteFile(c.path, data, 0644)
+	return writeFileAtomic(c.path, data)
 }
 
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so a failed write never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CreateTable adds a table along with the sequences its SERIAL columns
+// own. The sequences are saved first; if the table can't be saved they are
+// pruned again.
 func (c *Catalog) CreateTable(schema *TableSchema) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if _, exists := c.Tables[schema.Name]; exists {
 		return fmt.Errorf("table %s already exists", schema.Name)
 	}
+	if _, exists := c.Sequences[schema.Name]; exists {
+		return fmt.Errorf("sequence %s already exists", schema.Name)
+	}
+	if view, exists := c.Views[schema.Name]; exists && !view.Materialized {
+		return fmt.Errorf("view %s already exists", schema.Name)
+	}
+	if err := c.checkForeignKeys(schema); err != nil {
+		return err
+	}
+	if err := c.createOwnedSequences(schema); err != nil {
+		return err
+	}
 	c.Tables[schema.Name] = schema
-	return c.save()
+	if err := c.save(); err != nil {
+		delete(c.Tables, schema.Name)
+		_ = c.pruneSequences()
+		return err
+	}
+	return nil
 }
 
 func (c *Catalog) GetTable(name string) (*TableSchema, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	schema, ok := c.Tables[name]
 	if !ok {
 		return nil, fmt.Errorf("table %s not found", name)
@@ -59,22 +151,306 @@ func (c *Catalog) GetTable(name string) (*TableSchema, error) {
 }
 
 func (c *Catalog) CreateIndex(tableName string, indexName string, indexColumn string) error {
+	return c.addIndex(tableName, &Index{Name: indexName, ColumnName: indexColumn})
+}
+
+// CreateUniqueIndex adds an index that rejects duplicate keys.
+func (c *Catalog) CreateUniqueIndex(tableName string, indexName string, indexColumn string) error {
+	return c.addIndex(tableName, &Index{Name: indexName, ColumnName: indexColumn, Unique: true})
+}
+
+func (c *Catalog) addIndex(tableName string, index *Index) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	schema, ok := c.Tables[tableName]
+	if !ok {
+		return fmt.Errorf("table %s not found", tableName)
+	}
+	if _, exists := schema.Indexes[index.Name]; exists {
+		return fmt.Errorf("index %s already exists on table %s", index.Name, tableName)
+	}
+	schema.Indexes[index.Name] = index
+	if err := c.save(); err != nil {
+		delete(schema.Indexes, index.Name)
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	return nil
+}
+
+// DropTable removes a table, its indexes and owned sequences from the
+// catalog. Tables referenced by the foreign keys of others or read by
+// views can't be dropped, nor can the table of a materialized view while
+// the view exists. If the catalog can't be written the table is kept.
+func (c *Catalog) DropTable(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	schema, ok := c.Tables[name]
+	if !ok {
+		return fmt.Errorf("table %s not found", name)
+	}
+	if _, ok := c.Views[name]; ok {
+		return fmt.Errorf("%s is a materialized view, use DROP MATERIALIZED VIEW", name)
+	}
+	if deps := c.dependents(name); len(deps) > 0 {
+		return fmt.Errorf("cannot drop table %s because view %s depends on it", name, deps[0])
+	}
+	for _, ref := range c.referencedBy(name) {
+		if ref.Table != name {
+			return fmt.Errorf("cannot drop table %s because foreign key %s on table %s references it", name, ref.Name, ref.Table)
+		}
+	}
+	delete(c.Tables, name)
+	if err := c.save(); err != nil {
+		c.Tables[name] = schema
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	_ = c.pruneSequences() // retried on the next load if it can't be saved
+	return nil
+}
+
+// DropIndex removes an index from a table. The last unique index on a
+// column referenced by a foreign key can't be dropped. If the catalog
+// can't be written the index is kept.
+func (c *Catalog) DropIndex(tableName string, indexName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	schema, ok := c.Tables[tableName]
 	if !ok {
 		return fmt.Errorf("table %s not found", tableName)
 	}
-	if _, exists := schema.Indexes[indexName]; exists {
-		return fmt.Errorf("index %s already exists on table %s", indexName, tableName)
+	index, ok := schema.Indexes[indexName]
+	if !ok {
+		return fmt.Errorf("index %s not found on table %s", indexName, tableName)
+	}
+	delete(schema.Indexes, indexName)
+	if index.Unique && schema.UniqueIndexOn(index.ColumnName) == nil {
+		for _, ref := range c.referencedBy(tableName) {
+			if ref.RefColumn == index.ColumnName {
+				schema.Indexes[indexName] = index
+				return fmt.Errorf("cannot drop index %s because foreign key %s on table %s needs it", indexName, ref.Name, ref.Table)
+			}
+		}
+	}
+	if err := c.save(); err != nil {
+		schema.Indexes[indexName] = index
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	return nil
+}
+
+// TablesWithIndex returns the names of the tables having an index of the
+// given name, sorted. Index names are only unique per table.
+func (c *Catalog) TablesWithIndex(indexName string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var names []string
+	for name, schema := range c.Tables {
+		if _, ok := schema.Indexes[indexName]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// alter applies fn to a copy of a table's schema and saves the catalog.
+// The schema is updated in place, so holders of the pointer see the
+// change; if fn or the save fails the schema is left as it was.
+func (c *Catalog) alter(tableName string, fn func(s *TableSchema) error) error {
+	schema, ok := c.Tables[tableName]
+	if !ok {
+		return fmt.Errorf("table %s not found", tableName)
+	}
+	if err := c.checkAlterable(tableName); err != nil {
+		return err
+	}
+	updated := schema.clone()
+	if err := fn(updated); err != nil {
+		return err
+	}
+	backup := *schema
+	*schema = *updated
+	if err := c.save(); err != nil {
+		*schema = backup
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	return nil
+}
+
+// AddColumn appends a column in a new schema version. Rows written before
+// read col.Missing for it.
+func (c *Catalog) AddColumn(tableName string, col Column) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.alter(tableName, func(s *TableSchema) error {
+		if s.ColumnIndex(col.Name) >= 0 {
+			return fmt.Errorf("column %s already exists in table %s", col.Name, tableName)
+		}
+		if err := s.newVersion(); err != nil {
+			return err
+		}
+		col.ID = s.NextColumnID
+		s.NextColumnID++
+		s.Columns = append(s.Columns, col)
+		return nil
+	})
+}
+
+// DropColumn removes a column in a new schema version, along with the
+// indexes, CHECK constraints and foreign keys on it. Columns referenced by
+// foreign keys can't be dropped. It returns the names of the dropped indexes.
+func (c *Catalog) DropColumn(tableName string, columnName string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var dropped []string
+	err := c.alter(tableName, func(s *TableSchema) error {
+		i := s.ColumnIndex(columnName)
+		if i < 0 {
+			return fmt.Errorf("column %s not found in table %s", columnName, tableName)
+		}
+		if len(s.Columns) == 1 {
+			return fmt.Errorf("cannot drop column %s, the only column of table %s", columnName, tableName)
+		}
+		if ref := c.columnReferrer(tableName, columnName); ref != nil {
+			return fmt.Errorf("cannot drop column %s of table %s because foreign key %s on table %s references it", columnName, tableName, ref.Name, ref.Table)
+		}
+		if err := s.newVersion(); err != nil {
+			return err
+		}
+		s.Columns = append(s.Columns[:i:i], s.Columns[i+1:]...)
+		for name, idx := range s.Indexes {
+			if idx.ColumnName == columnName {
+				delete(s.Indexes, name)
+				dropped = append(dropped, name)
+			}
+		}
+		checks := s.Checks[:0]
+		for _, chk := range s.Checks {
+			if !slices.Contains(chk.Columns, columnName) {
+				checks = append(checks, chk)
+			}
+		}
+		s.Checks = checks
+		fks := s.ForeignKeys[:0]
+		for _, fk := range s.ForeignKeys {
+			if fk.Column != columnName {
+				fks = append(fks, fk)
+			}
+		}
+		s.ForeignKeys = fks
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dropped)
+	_ = c.pruneSequences() // retried on the next load if it can't be saved
+	return dropped, nil
+}
+
+// RenameColumn renames a column and updates the indexes, CHECK constraints
+// and foreign keys on it, including the foreign keys of other tables that
+// reference it. The catalog does not parse SQL, so rewrite is called to
+// rename the column in the text of each affected CHECK expression. The row
+// layout is unchanged, so no new schema version is needed.
+func (c *Catalog) RenameColumn(tableName string, oldName string, newName string, rewrite func(expr string) (string, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	renameRef := func(fk *ForeignKey) bool {
+		if fk.RefTable != tableName || fk.RefColumn != oldName {
+			return false
+		}
+		fk.RefColumn = newName
+		return true
+	}
+	var undo func()
+	err := c.alter(tableName, func(s *TableSchema) error {
+		i := s.ColumnIndex(oldName)
+		if i < 0 {
+			return fmt.Errorf("column %s not found in table %s", oldName, tableName)
+		}
+		if s.ColumnIndex(newName) >= 0 {
+			return fmt.Errorf("column %s already exists in table %s", newName, tableName)
+		}
+		s.Columns[i].Name = newName
+		for _, idx := range s.Indexes {
+			if idx.ColumnName == oldName {
+				idx.ColumnName = newName
+			}
+		}
+		for i, chk := range s.Checks {
+			j := slices.Index(chk.Columns, oldName)
+			if j < 0 {
+				continue
+			}
+			expr, err := rewrite(chk.Expr)
+			if err != nil {
+				return fmt.Errorf("check constraint %s: %w", chk.Name, err)
+			}
+			cols := slices.Clone(chk.Columns)
+			cols[j] = newName
+			s.Checks[i] = Check{Name: chk.Name, Expr: expr, Columns: cols}
+		}
+		for i := range s.ForeignKeys {
+			fk := &s.ForeignKeys[i]
+			if fk.Column == oldName {
+				fk.Column = newName
+			}
+			renameRef(fk)
+		}
+		undo = c.retarget(tableName, renameRef)
+		return nil
+	})
+	if err != nil && undo != nil {
+		undo()
+	}
+	return err
+}
+
+// RenameTable moves a table to a new name, updating the foreign keys that
+// reference it. If the catalog can't be written the table keeps its old name.
+func (c *Catalog) RenameTable(oldName string, newName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	schema, ok := c.Tables[oldName]
+	if !ok {
+		return fmt.Errorf("table %s not found", oldName)
+	}
+	if _, exists := c.Tables[newName]; exists {
+		return fmt.Errorf("table %s already exists", newName)
+	}
+	if _, exists := c.Sequences[newName]; exists {
+		return fmt.Errorf("sequence %s already exists", newName)
+	}
+	if _, exists := c.Views[newName]; exists {
+		return fmt.Errorf("view %s already exists", newName)
+	}
+	if err := c.checkAlterable(oldName); err != nil {
+		return err
 	}
-	schema.Indexes[indexName] = &Index{
-		Name:       indexName,
-		ColumnName: indexColumn,
+	delete(c.Tables, oldName)
+	schema.Name = newName
+	c.Tables[newName] = schema
+	undo := c.retarget("", func(fk *ForeignKey) bool {
+		if fk.RefTable != oldName {
+			return false
+		}
+		fk.RefTable = newName
+		return true
+	})
+	if err := c.save(); err != nil {
+		undo()
+		delete(c.Tables, newName)
+		schema.Name = oldName
+		c.Tables[oldName] = schema
+		return fmt.Errorf("save catalog: %w", err)
 	}
-	c.save()
 	return nil
 }
 
 func (c *Catalog) ListTables() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	names := make([]string, 0, len(c.Tables))
 	for name := range c.Tables {
 		names = append(names, name)
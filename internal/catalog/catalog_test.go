@@ -1,8 +1,11 @@
 package catalog
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -438,3 +441,378 @@ func TestCatalog_Save_Load_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestCatalog_DropTable(t *testing.T) {
+	tmpDir := t.TempDir()
+	catalogPath := filepath.Join(tmpDir, "catalog.json")
+	catalog := NewCatalog(catalogPath)
+
+	for _, name := range []string{"users", "orders"} {
+		schema := &TableSchema{
+			Name:    name,
+			Columns: []Column{{Name: "id", Type: TypeInt}},
+			Indexes: make(map[string]*Index),
+		}
+		if err := catalog.CreateTable(schema); err != nil {
+			t.Fatalf("Failed to create table %s: %v", name, err)
+		}
+	}
+
+	if err := catalog.DropTable("users"); err != nil {
+		t.Fatalf("Failed to drop table: %v", err)
+	}
+	if _, err := catalog.GetTable("users"); err == nil {
+		t.Error("Expected dropped table to be gone")
+	}
+
+	// The drop must be persisted
+	reloaded := NewCatalog(catalogPath)
+	if _, ok := reloaded.Tables["users"]; ok {
+		t.Error("Dropped table found after reload")
+	}
+	if _, ok := reloaded.Tables["orders"]; !ok {
+		t.Error("Other table missing after reload")
+	}
+}
+
+func TestCatalog_DropTable_NotFound(t *testing.T) {
+	catalog, _ := setupTestCatalog(t)
+
+	if err := catalog.DropTable("nonexistent"); err == nil {
+		t.Error("Expected error when dropping non-existent table")
+	}
+}
+
+func TestCatalog_DropTable_SaveFails_KeepsTable(t *testing.T) {
+	catalog, tmpDir := setupTestCatalog(t)
+
+	schema := &TableSchema{
+		Name:    "users",
+		Columns: []Column{{Name: "id", Type: TypeInt}},
+		Indexes: make(map[string]*Index),
+	}
+	if err := catalog.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// A regular file where the catalog directory should be makes saving fail
+	blocker := filepath.Join(tmpDir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	catalog.path = filepath.Join(blocker, "catalog.json")
+
+	if err := catalog.DropTable("users"); err == nil {
+		t.Fatal("Expected error when catalog can't be saved")
+	}
+	if _, err := catalog.GetTable("users"); err != nil {
+		t.Errorf("Table should be kept after failed drop: %v", err)
+	}
+}
+
+func TestCatalog_DropIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	catalogPath := filepath.Join(tmpDir, "catalog.json")
+	catalog := NewCatalog(catalogPath)
+
+	schema := &TableSchema{
+		Name:    "users",
+		Columns: []Column{{Name: "id", Type: TypeInt}, {Name: "name", Type: TypeText}},
+		Indexes: make(map[string]*Index),
+	}
+	if err := catalog.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := catalog.CreateIndex("users", "id_idx", "id"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := catalog.CreateIndex("users", "name_idx", "name"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	if err := catalog.DropIndex("users", "id_idx"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if err := catalog.DropIndex("users", "id_idx"); err == nil {
+		t.Error("Expected error when dropping index twice")
+	}
+
+	reloaded := NewCatalog(catalogPath)
+	table, err := reloaded.GetTable("users")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+	if _, ok := table.Indexes["id_idx"]; ok {
+		t.Error("Dropped index found after reload")
+	}
+	if _, ok := table.Indexes["name_idx"]; !ok {
+		t.Error("Other index missing after reload")
+	}
+}
+
+func TestCatalog_TablesWithIndex(t *testing.T) {
+	catalog, _ := setupTestCatalog(t)
+
+	for _, name := range []string{"b", "a", "c"} {
+		schema := &TableSchema{
+			Name:    name,
+			Columns: []Column{{Name: "id", Type: TypeInt}},
+			Indexes: make(map[string]*Index),
+		}
+		if err := catalog.CreateTable(schema); err != nil {
+			t.Fatalf("Failed to create table %s: %v", name, err)
+		}
+	}
+	catalog.CreateIndex("b", "id_idx", "id")
+	catalog.CreateIndex("a", "id_idx", "id")
+
+	got := catalog.TablesWithIndex("id_idx")
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected [a b], got %v", got)
+	}
+	if got := catalog.TablesWithIndex("missing"); len(got) != 0 {
+		t.Errorf("Expected no tables, got %v", got)
+	}
+}
+
+func TestCatalog_AlterColumns_Versions(t *testing.T) {
+	tmpDir := t.TempDir()
+	catalogPath := filepath.Join(tmpDir, "catalog.json")
+	catalog := NewCatalog(catalogPath)
+
+	schema := &TableSchema{
+		Name: "users",
+		Columns: []Column{
+			{Name: "id", Type: TypeInt},
+			{Name: "name", Type: TypeText},
+		},
+		Indexes: make(map[string]*Index),
+	}
+	if err := catalog.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := catalog.CreateIndex("users", "name_idx", "name"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	if err := catalog.AddColumn("users", Column{Name: "age", Type: TypeInt, Missing: 18}); err != nil {
+		t.Fatalf("Failed to add column: %v", err)
+	}
+	if err := catalog.AddColumn("users", Column{Name: "age", Type: TypeInt}); err == nil {
+		t.Error("Expected error when adding duplicate column")
+	}
+	dropped, err := catalog.DropColumn("users", "name")
+	if err != nil {
+		t.Fatalf("Failed to drop column: %v", err)
+	}
+	if len(dropped) != 1 || dropped[0] != "name_idx" {
+		t.Errorf("Expected name_idx to be dropped, got %v", dropped)
+	}
+	if err := catalog.RenameColumn("users", "age", "years", nil); err != nil {
+		t.Fatalf("Failed to rename column: %v", err)
+	}
+
+	reloaded := NewCatalog(catalogPath)
+	table, err := reloaded.GetTable("users")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+	if table.Version != 2 {
+		t.Errorf("Expected version 2, got %d", table.Version)
+	}
+	if len(table.Columns) != 2 || table.Columns[0].Name != "id" || table.Columns[1].Name != "years" {
+		t.Fatalf("Unexpected columns after reload: %+v", table.Columns)
+	}
+	if table.Columns[1].Missing != 18 {
+		t.Errorf("Expected missing value 18 (int), got %#v", table.Columns[1].Missing)
+	}
+	if _, ok := table.Indexes["name_idx"]; ok {
+		t.Error("Index on dropped column found after reload")
+	}
+
+	v0, err := table.Layout(0)
+	if err != nil {
+		t.Fatalf("Failed to get layout 0: %v", err)
+	}
+	if len(v0) != 2 || v0[1].Name != "name" || v0[0].ID != table.Columns[0].ID {
+		t.Errorf("Unexpected layout 0: %+v", v0)
+	}
+}
+
+func TestCatalog_RenameTable(t *testing.T) {
+	tmpDir := t.TempDir()
+	catalogPath := filepath.Join(tmpDir, "catalog.json")
+	catalog := NewCatalog(catalogPath)
+
+	for _, name := range []string{"a", "b"} {
+		schema := &TableSchema{
+			Name:    name,
+			Columns: []Column{{Name: "id", Type: TypeInt}},
+			Indexes: make(map[string]*Index),
+		}
+		if err := catalog.CreateTable(schema); err != nil {
+			t.Fatalf("Failed to create table %s: %v", name, err)
+		}
+	}
+
+	if err := catalog.RenameTable("a", "b"); err == nil {
+		t.Error("Expected error when renaming onto an existing table")
+	}
+	if err := catalog.RenameTable("a", "c"); err != nil {
+		t.Fatalf("Failed to rename table: %v", err)
+	}
+
+	reloaded := NewCatalog(catalogPath)
+	if _, ok := reloaded.Tables["a"]; ok {
+		t.Error("Old table name found after reload")
+	}
+	table, err := reloaded.GetTable("c")
+	if err != nil {
+		t.Fatalf("Failed to get renamed table: %v", err)
+	}
+	if table.Name != "c" {
+		t.Errorf("Expected schema name 'c', got '%s'", table.Name)
+	}
+}
+
+func TestCatalog_AlterColumn_SaveFails_KeepsSchema(t *testing.T) {
+	catalog, tmpDir := setupTestCatalog(t)
+
+	schema := &TableSchema{
+		Name:    "users",
+		Columns: []Column{{Name: "id", Type: TypeInt}},
+		Indexes: make(map[string]*Index),
+	}
+	if err := catalog.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	blocker := filepath.Join(tmpDir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	catalog.path = filepath.Join(blocker, "catalog.json")
+
+	if err := catalog.AddColumn("users", Column{Name: "age", Type: TypeInt}); err == nil {
+		t.Fatal("Expected error when catalog can't be saved")
+	}
+	if len(schema.Columns) != 1 || schema.Version != 0 {
+		t.Errorf("Schema changed after failed alter: %+v", schema)
+	}
+}
+
+func TestCatalog_Checks_FollowColumnChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	catalogPath := filepath.Join(tmpDir, "catalog.json")
+	catalog := NewCatalog(catalogPath)
+
+	schema := &TableSchema{
+		Name: "accounts",
+		Columns: []Column{
+			{Name: "id", Type: TypeInt},
+			{Name: "balance", Type: TypeInt, Default: "0"},
+			{Name: "owner", Type: TypeText},
+		},
+		Indexes: make(map[string]*Index),
+		Checks: []Check{
+			{Name: "balance_check", Expr: "balance >= 0", Columns: []string{"balance"}},
+			{Name: "owner_check", Expr: "owner <> ''", Columns: []string{"owner"}},
+		},
+	}
+	if err := catalog.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	rewrite := func(expr string) (string, error) {
+		return strings.ReplaceAll(expr, "balance", "amount"), nil
+	}
+	if err := catalog.RenameColumn("accounts", "balance", "amount", rewrite); err != nil {
+		t.Fatalf("Failed to rename column: %v", err)
+	}
+	if _, err := catalog.DropColumn("accounts", "owner"); err != nil {
+		t.Fatalf("Failed to drop column: %v", err)
+	}
+
+	reloaded := NewCatalog(catalogPath)
+	table, err := reloaded.GetTable("accounts")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+	if len(table.Checks) != 1 {
+		t.Fatalf("Expected 1 check after dropping owner, got %+v", table.Checks)
+	}
+	chk := table.Checks[0]
+	if chk.Name != "balance_check" || chk.Expr != "amount >= 0" || len(chk.Columns) != 1 || chk.Columns[0] != "amount" {
+		t.Errorf("Unexpected check after rename: %+v", chk)
+	}
+	if table.Columns[1].Default != "0" {
+		t.Errorf("Expected default to survive reload, got %q", table.Columns[1].Default)
+	}
+}
+
+// TestCatalog_ConcurrentUse changes and reads the catalog from many
+// goroutines, as sessions do; run it with -race.
+func TestCatalog_ConcurrentUse(t *testing.T) {
+	catalog, _ := setupTestCatalog(t)
+	if err := catalog.CreateSequence(&Sequence{Name: "seq", Start: 1, Increment: 1}); err != nil {
+		t.Fatalf("Failed to create sequence: %v", err)
+	}
+
+	const workers, perWorker = 8, 10
+	var wg sync.WaitGroup
+	vals := make(chan int, workers*perWorker)
+	errs := make(chan error, workers*perWorker*2)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				name := fmt.Sprintf("t%d_%d", w, i)
+				schema := &TableSchema{
+					Name:    name,
+					Columns: []Column{{Name: "id", Type: TypeInt}},
+					Indexes: make(map[string]*Index),
+				}
+				if err := catalog.CreateTable(schema); err != nil {
+					errs <- err
+				}
+				if err := catalog.CreateUniqueIndex(name, "id_idx", "id"); err != nil {
+					errs <- err
+				}
+				if err := catalog.AddColumn(name, Column{Name: "extra", Type: TypeText}); err != nil {
+					errs <- err
+				}
+				v, err := catalog.NextVal("seq")
+				if err != nil {
+					errs <- err
+				}
+				vals <- v
+				catalog.ListTables()
+				catalog.ReferencedBy(name)
+				catalog.TablesWithIndex("id_idx")
+				if i%2 == 0 {
+					if err := catalog.DropTable(name); err != nil {
+						errs <- err
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(vals)
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	seen := make(map[int]bool)
+	for v := range vals {
+		if seen[v] {
+			t.Errorf("nextval returned %d twice", v)
+		}
+		seen[v] = true
+	}
+	reloaded := NewCatalog(catalog.path)
+	if got := len(reloaded.ListTables()); got != workers*perWorker/2 {
+		t.Errorf("Expected %d tables after reload, got %d", workers*perWorker/2, got)
+	}
+}
@@ -0,0 +1,117 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ForeignKeyRef is a foreign key together with the table it belongs to.
+type ForeignKeyRef struct {
+	Table string
+	ForeignKey
+}
+
+// ReferencedBy returns the foreign keys referencing the named table,
+// including its own, sorted by table and name.
+func (c *Catalog) ReferencedBy(table string) []ForeignKeyRef {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.referencedBy(table)
+}
+
+func (c *Catalog) referencedBy(table string) []ForeignKeyRef {
+	var refs []ForeignKeyRef
+	for name, schema := range c.Tables {
+		for _, fk := range schema.ForeignKeys {
+			if fk.RefTable == table {
+				refs = append(refs, ForeignKeyRef{Table: name, ForeignKey: fk})
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Table != refs[j].Table {
+			return refs[i].Table < refs[j].Table
+		}
+		return refs[i].Name < refs[j].Name
+	})
+	return refs
+}
+
+// checkForeignKeys validates the foreign keys of a new table. A key may
+// reference the table itself, whose schema is not in the catalog yet.
+func (c *Catalog) checkForeignKeys(schema *TableSchema) error {
+	names := make(map[string]bool)
+	for _, fk := range schema.ForeignKeys {
+		if names[fk.Name] {
+			return fmt.Errorf("constraint %s for relation %s already exists", fk.Name, schema.Name)
+		}
+		names[fk.Name] = true
+		i := schema.ColumnIndex(fk.Column)
+		if i < 0 {
+			return fmt.Errorf("column %s referenced in foreign key constraint does not exist", fk.Column)
+		}
+		ref := schema
+		if fk.RefTable != schema.Name {
+			var ok bool
+			if ref, ok = c.Tables[fk.RefTable]; !ok {
+				return fmt.Errorf("table %s referenced by foreign key %s not found", fk.RefTable, fk.Name)
+			}
+		}
+		if _, ok := c.Views[fk.RefTable]; ok {
+			return fmt.Errorf("foreign key %s cannot reference materialized view %s", fk.Name, fk.RefTable)
+		}
+		j := ref.ColumnIndex(fk.RefColumn)
+		if j < 0 {
+			return fmt.Errorf("column %s referenced in foreign key constraint does not exist in table %s", fk.RefColumn, fk.RefTable)
+		}
+		if ref.UniqueIndexOn(fk.RefColumn) == nil {
+			return fmt.Errorf("there is no unique index on column %s of referenced table %s", fk.RefColumn, fk.RefTable)
+		}
+		if schema.Columns[i].Type != ref.Columns[j].Type {
+			return fmt.Errorf("foreign key %s cannot be implemented: columns %s and %s are of incompatible types", fk.Name, fk.Column, fk.RefColumn)
+		}
+	}
+	return nil
+}
+
+// columnReferrer returns a foreign key of another column referencing the
+// given column, or nil if there is none.
+func (c *Catalog) columnReferrer(table, column string) *ForeignKeyRef {
+	for _, ref := range c.referencedBy(table) {
+		if ref.RefColumn == column && !(ref.Table == table && ref.Column == column) {
+			return &ref
+		}
+	}
+	return nil
+}
+
+// retarget applies fn to the foreign keys of every table except skip and
+// returns a function undoing the changes fn reported. The tables whose
+// keys change get an updated copy of their schema: sessions may be
+// reading the schema, locked only against changes to their own table.
+func (c *Catalog) retarget(skip string, fn func(fk *ForeignKey) bool) (undo func()) {
+	replaced := make(map[string]*TableSchema)
+	for name, schema := range c.Tables {
+		if name == skip {
+			continue
+		}
+		var updated *TableSchema
+		for i, fk := range schema.ForeignKeys {
+			if fn(&fk) {
+				if updated == nil {
+					updated = schema.clone()
+				}
+				updated.ForeignKeys[i] = fk
+			}
+		}
+		if updated != nil {
+			replaced[name] = schema
+			c.Tables[name] = updated
+		}
+	}
+	return func() {
+		for name, schema := range replaced {
+			c.Tables[name] = schema
+		}
+	}
+}
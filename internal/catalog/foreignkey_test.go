@@ -0,0 +1,125 @@
+package catalog
+
+import (
+	"testing"
+)
+
+func setupForeignKeyTables(t *testing.T) *Catalog {
+	catalog, _ := setupTestCatalog(t)
+	users := &TableSchema{
+		Name:    "users",
+		Columns: []Column{{Name: "id", Type: TypeInt}, {Name: "name", Type: TypeText}},
+		Indexes: map[string]*Index{"users_id_key": {Name: "users_id_key", ColumnName: "id", Unique: true}},
+	}
+	if err := catalog.CreateTable(users); err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+	orders := &TableSchema{
+		Name:    "orders",
+		Columns: []Column{{Name: "id", Type: TypeInt}, {Name: "user_id", Type: TypeInt}},
+		Indexes: make(map[string]*Index),
+		ForeignKeys: []ForeignKey{
+			{Name: "orders_user_id_fkey", Column: "user_id", RefTable: "users", RefColumn: "id", OnDelete: FKCascade},
+		},
+	}
+	if err := catalog.CreateTable(orders); err != nil {
+		t.Fatalf("Failed to create orders: %v", err)
+	}
+	return catalog
+}
+
+func TestCatalog_ForeignKey_Validation(t *testing.T) {
+	catalog := setupForeignKeyTables(t)
+
+	tests := []struct {
+		name string
+		fk   ForeignKey
+		typ  ColumnType
+	}{
+		{"missing table", ForeignKey{Name: "fk", Column: "ref", RefTable: "nope", RefColumn: "id"}, TypeInt},
+		{"missing column", ForeignKey{Name: "fk", Column: "ref", RefTable: "users", RefColumn: "nope"}, TypeInt},
+		{"no unique index", ForeignKey{Name: "fk", Column: "ref", RefTable: "users", RefColumn: "name"}, TypeText},
+		{"type mismatch", ForeignKey{Name: "fk", Column: "ref", RefTable: "users", RefColumn: "id"}, TypeText},
+	}
+	for _, tt := range tests {
+		schema := &TableSchema{
+			Name:        "bad",
+			Columns:     []Column{{Name: "ref", Type: tt.typ}},
+			Indexes:     make(map[string]*Index),
+			ForeignKeys: []ForeignKey{tt.fk},
+		}
+		if err := catalog.CreateTable(schema); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+	if _, err := catalog.GetTable("bad"); err == nil {
+		t.Error("Table with an invalid foreign key was created")
+	}
+
+	// a table may reference its own unique index
+	tree := &TableSchema{
+		Name:        "tree",
+		Columns:     []Column{{Name: "id", Type: TypeInt}, {Name: "parent", Type: TypeInt}},
+		Indexes:     map[string]*Index{"tree_id_key": {Name: "tree_id_key", ColumnName: "id", Unique: true}},
+		ForeignKeys: []ForeignKey{{Name: "tree_parent_fkey", Column: "parent", RefTable: "tree", RefColumn: "id"}},
+	}
+	if err := catalog.CreateTable(tree); err != nil {
+		t.Fatalf("Failed to create self-referencing table: %v", err)
+	}
+	if err := catalog.DropTable("tree"); err != nil {
+		t.Errorf("Failed to drop self-referencing table: %v", err)
+	}
+}
+
+func TestCatalog_ForeignKey_BlocksDrops(t *testing.T) {
+	catalog := setupForeignKeyTables(t)
+
+	if err := catalog.DropTable("users"); err == nil {
+		t.Error("Expected error dropping a referenced table")
+	}
+	if err := catalog.DropIndex("users", "users_id_key"); err == nil {
+		t.Error("Expected error dropping the index of a referenced key")
+	}
+	if _, ok := catalog.Tables["users"].Indexes["users_id_key"]; !ok {
+		t.Error("Index was dropped")
+	}
+	if _, err := catalog.DropColumn("users", "id"); err == nil {
+		t.Error("Expected error dropping a referenced column")
+	}
+
+	// dropping the referencing column drops its foreign key
+	if _, err := catalog.DropColumn("orders", "user_id"); err != nil {
+		t.Fatalf("Failed to drop column: %v", err)
+	}
+	if len(catalog.Tables["orders"].ForeignKeys) != 0 {
+		t.Errorf("Expected foreign key to be dropped, got %v", catalog.Tables["orders"].ForeignKeys)
+	}
+	if err := catalog.DropTable("users"); err != nil {
+		t.Errorf("Failed to drop table no longer referenced: %v", err)
+	}
+}
+
+func TestCatalog_ForeignKey_FollowsRenames(t *testing.T) {
+	catalog := setupForeignKeyTables(t)
+
+	if err := catalog.RenameColumn("users", "id", "uid", nil); err != nil {
+		t.Fatalf("Failed to rename column: %v", err)
+	}
+	if err := catalog.RenameTable("users", "people"); err != nil {
+		t.Fatalf("Failed to rename table: %v", err)
+	}
+	if err := catalog.RenameColumn("orders", "user_id", "person_id", nil); err != nil {
+		t.Fatalf("Failed to rename column: %v", err)
+	}
+
+	reloaded := NewCatalog(catalog.path)
+	fks := reloaded.Tables["orders"].ForeignKeys
+	want := ForeignKey{Name: "orders_user_id_fkey", Column: "person_id", RefTable: "people", RefColumn: "uid", OnDelete: FKCascade}
+	if len(fks) != 1 || fks[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, fks)
+	}
+	refs := reloaded.ReferencedBy("people")
+	if len(refs) != 1 || refs[0].Table != "orders" {
+		t.Errorf("Expected people to be referenced by orders, got %+v", refs)
+	}
+}
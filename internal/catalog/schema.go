@@ -1,5 +1,7 @@
 package catalog
 
+import "fmt"
+
 type ColumnType int
 
 const (
@@ -10,15 +12,154 @@ const (
 type Column struct {
 	Name string
 	Type ColumnType
+	// ID identifies the column across renames and layout changes. Zero for
+	// tables that were never altered.
+	ID int `json:",omitempty"`
+	// Missing is the value of the column in rows written before it was
+	// added by ALTER TABLE; nil reads as NULL.
+	Missing any `json:",omitempty"`
+	// Default is the SQL text of the DEFAULT expression, empty for NULL.
+	Default string `json:",omitempty"`
+	// Sequence names the sequence owned by a SERIAL column.
+	Sequence string `json:",omitempty"`
 }
 
 type TableSchema struct {
 	Name    string
 	Columns []Column // TODO: change to map for cleaner lookup
 	Indexes map[string]*Index
+	Checks  []Check `json:",omitempty"`
+	// ForeignKeys are the foreign keys of this table, referencing others.
+	ForeignKeys []ForeignKey `json:",omitempty"`
+
+	// Version is the layout new rows are written with; rows carry the
+	// version they were written with. Layouts keeps the columns of every
+	// earlier version so old rows stay readable. Both are empty until the
+	// table is first altered.
+	Version      int              `json:",omitempty"`
+	Layouts      map[int][]Column `json:",omitempty"`
+	NextColumnID int              `json:",omitempty"`
 }
 
 type Index struct {
 	Name       string
 	ColumnName string
+	Unique     bool `json:",omitempty"` // no two rows may share a non-NULL key
+}
+
+// Check is a CHECK constraint; Expr is its SQL text. Rows for which it
+// evaluates to false are rejected.
+type Check struct {
+	Name    string
+	Expr    string
+	Columns []string // columns the expression references
+}
+
+// FKAction is what happens to referencing rows when the row they
+// reference is deleted.
+type FKAction int
+
+const (
+	FKRestrict FKAction = iota // the delete fails
+	FKCascade                  // the referencing rows are deleted too
+	FKSetNull                  // the referencing column is set to NULL
+)
+
+func (a FKAction) String() string {
+	switch a {
+	case FKCascade:
+		return "CASCADE"
+	case FKSetNull:
+		return "SET NULL"
+	default:
+		return "RESTRICT"
+	}
+}
+
+// ForeignKey makes every non-NULL value of Column exist in RefColumn of
+// RefTable, which may be the table itself. RefColumn must have a unique
+// index, through which the referenced rows are found.
+type ForeignKey struct {
+	Name      string
+	Column    string
+	RefTable  string
+	RefColumn string
+	OnDelete  FKAction `json:",omitempty"`
+}
+
+// MaxSchemaVersion is the highest layout version a row header can hold.
+const MaxSchemaVersion = 1<<16 - 1
+
+// Layout returns the columns rows of the given version were written with.
+func (s *TableSchema) Layout(version int) ([]Column, error) {
+	if version == s.Version {
+		return s.Columns, nil
+	}
+	cols, ok := s.Layouts[version]
+	if !ok {
+		return nil, fmt.Errorf("table %s has no schema version %d", s.Name, version)
+	}
+	return cols, nil
+}
+
+// ColumnIndex returns the position of the named column or -1.
+func (s *TableSchema) ColumnIndex(name string) int {
+	for i, c := range s.Columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// UniqueIndexOn returns the unique index on the named column with the
+// lowest name, or nil if the column has none.
+func (s *TableSchema) UniqueIndexOn(column string) *Index {
+	var found *Index
+	for _, idx := range s.Indexes {
+		if idx.Unique && idx.ColumnName == column && (found == nil || idx.Name < found.Name) {
+			found = idx
+		}
+	}
+	return found
+}
+
+// newVersion records the current layout and starts a new one, assigning
+// column IDs first if the table has never been versioned.
+func (s *TableSchema) newVersion() error {
+	if s.Version >= MaxSchemaVersion {
+		return fmt.Errorf("table %s has reached the maximum of %d schema versions", s.Name, MaxSchemaVersion)
+	}
+	if s.NextColumnID == 0 {
+		for i := range s.Columns {
+			s.Columns[i].ID = i + 1
+		}
+		s.NextColumnID = len(s.Columns) + 1
+	}
+	if s.Layouts == nil {
+		s.Layouts = make(map[int][]Column)
+	}
+	s.Layouts[s.Version] = append([]Column(nil), s.Columns...)
+	s.Version++
+	return nil
+}
+
+// clone returns a copy of s that shares nothing mutable with it.
+func (s *TableSchema) clone() *TableSchema {
+	c := *s
+	c.Columns = append([]Column(nil), s.Columns...)
+	c.Checks = append([]Check(nil), s.Checks...)
+	c.ForeignKeys = append([]ForeignKey(nil), s.ForeignKeys...)
+	c.Indexes = make(map[string]*Index, len(s.Indexes))
+	for name, idx := range s.Indexes {
+		copied := *idx
+		c.Indexes[name] = &copied
+	}
+	if s.Layouts != nil {
+		c.Layouts = make(map[int][]Column, len(s.Layouts))
+		for v, cols := range s.Layouts {
+			c.Layouts[v] = cols // layouts are never modified once recorded
+		}
+	}
+	return &c
 }
@@ -0,0 +1,197 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SequenceCache is how many values nextval reserves with each write of the
+// sequence file.
+const SequenceCache = 32
+
+// Sequence generates integers for nextval. Its state lives in a file next
+// to the catalog so that nextval does not rewrite the table definitions.
+type Sequence struct {
+	Name      string
+	Start     int
+	Increment int
+	// Owned sequences belong to a SERIAL column, which names them in
+	// Column.Sequence; they are dropped when no column refers to them.
+	Owned bool `json:",omitempty"`
+	// Reserved is the furthest value nextval may have returned. It is saved
+	// before values up to it are handed out, so after a crash the sequence
+	// continues past it: values may be skipped but never repeated.
+	Reserved int  `json:",omitempty"`
+	Called   bool `json:",omitempty"`
+
+	last int // last value returned since load
+}
+
+func (c *Catalog) loadSequences() {
+	data, err := os.ReadFile(c.seqPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		panic(fmt.Sprintf("failed to read sequences: %v", err))
+	}
+	_ = json.NewDecoder(bytes.NewReader(data)).Decode(&c.Sequences)
+	for _, seq := range c.Sequences {
+		seq.last = seq.Reserved
+	}
+}
+
+func (c *Catalog) saveSequences() error {
+	data, err := json.MarshalIndent(c.Sequences, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.seqPath, data)
+}
+
+// CreateSequence adds a sequence. Sequences share the namespace of tables.
+func (c *Catalog) CreateSequence(seq *Sequence) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.Sequences[seq.Name]; exists {
+		return fmt.Errorf("sequence %s already exists", seq.Name)
+	}
+	if _, exists := c.Tables[seq.Name]; exists {
+		return fmt.Errorf("table %s already exists", seq.Name)
+	}
+	if _, exists := c.Views[seq.Name]; exists {
+		return fmt.Errorf("view %s already exists", seq.Name)
+	}
+	if seq.Increment == 0 {
+		return fmt.Errorf("INCREMENT must not be zero")
+	}
+	c.Sequences[seq.Name] = seq
+	if err := c.saveSequences(); err != nil {
+		delete(c.Sequences, seq.Name)
+		return fmt.Errorf("save sequences: %w", err)
+	}
+	return nil
+}
+
+func (c *Catalog) GetSequence(name string) (*Sequence, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	seq, ok := c.Sequences[name]
+	if !ok {
+		return nil, fmt.Errorf("sequence %s not found", name)
+	}
+	return seq, nil
+}
+
+// DropSequence removes a sequence. Sequences owned by a column can only
+// go away with the column.
+func (c *Catalog) DropSequence(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq, ok := c.Sequences[name]
+	if !ok {
+		return fmt.Errorf("sequence %s not found", name)
+	}
+	if table, col := c.sequenceOwner(name); table != "" {
+		return fmt.Errorf("cannot drop sequence %s because column %s of table %s uses it", name, col, table)
+	}
+	delete(c.Sequences, name)
+	if err := c.saveSequences(); err != nil {
+		c.Sequences[name] = seq
+		return fmt.Errorf("save sequences: %w", err)
+	}
+	return nil
+}
+
+// NextVal advances a sequence and returns the new value. The sequence file
+// is written only when the reserved block is used up.
+func (c *Catalog) NextVal(name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq, ok := c.Sequences[name]
+	if !ok {
+		return 0, fmt.Errorf("sequence %s not found", name)
+	}
+	next := seq.Start
+	if seq.Called {
+		next = seq.last + seq.Increment
+	}
+	if !seq.Called || (seq.Increment > 0 && next > seq.Reserved) || (seq.Increment < 0 && next < seq.Reserved) {
+		backup := *seq
+		seq.Called = true
+		seq.Reserved = next + seq.Increment*(SequenceCache-1)
+		if err := c.saveSequences(); err != nil {
+			*seq = backup
+			return 0, fmt.Errorf("save sequences: %w", err)
+		}
+	}
+	seq.last = next
+	return next, nil
+}
+
+// createOwnedSequences creates the sequences named by the SERIAL columns
+// of a new table.
+func (c *Catalog) createOwnedSequences(schema *TableSchema) error {
+	var created []string
+	for _, col := range schema.Columns {
+		if col.Sequence == "" {
+			continue
+		}
+		if _, exists := c.Sequences[col.Sequence]; exists {
+			return fmt.Errorf("sequence %s already exists", col.Sequence)
+		}
+		if _, exists := c.Tables[col.Sequence]; exists {
+			return fmt.Errorf("table %s already exists", col.Sequence)
+		}
+		if _, exists := c.Views[col.Sequence]; exists {
+			return fmt.Errorf("view %s already exists", col.Sequence)
+		}
+		c.Sequences[col.Sequence] = &Sequence{Name: col.Sequence, Start: 1, Increment: 1, Owned: true}
+		created = append(created, col.Sequence)
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	if err := c.saveSequences(); err != nil {
+		for _, name := range created {
+			delete(c.Sequences, name)
+		}
+		return fmt.Errorf("save sequences: %w", err)
+	}
+	return nil
+}
+
+// sequenceOwner returns the table and column owning a sequence, if any.
+func (c *Catalog) sequenceOwner(name string) (string, string) {
+	for _, schema := range c.Tables {
+		for _, col := range schema.Columns {
+			if col.Sequence == name {
+				return schema.Name, col.Name
+			}
+		}
+	}
+	return "", ""
+}
+
+// pruneSequences drops owned sequences whose column is gone. Dropping a
+// table or column only rewrites the catalog, so an owned sequence may stay
+// in the sequence file until the next prune, even across a crash. It is
+// removed from memory even if the file can't be written.
+func (c *Catalog) pruneSequences() error {
+	pruned := false
+	for name, seq := range c.Sequences {
+		if table, _ := c.sequenceOwner(name); seq.Owned && table == "" {
+			delete(c.Sequences, name)
+			pruned = true
+		}
+	}
+	if !pruned {
+		return nil
+	}
+	if err := c.saveSequences(); err != nil {
+		return fmt.Errorf("save sequences: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package catalog
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCatalog_NextVal_SkipsReservedAfterReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	catalogPath := filepath.Join(tmpDir, "catalog.json")
+	catalog := NewCatalog(catalogPath)
+
+	if err := catalog.CreateSequence(&Sequence{Name: "ids", Start: 10, Increment: 2}); err != nil {
+		t.Fatalf("Failed to create sequence: %v", err)
+	}
+	for _, want := range []int{10, 12, 14} {
+		got, err := catalog.NextVal("ids")
+		if err != nil {
+			t.Fatalf("Failed to get next value: %v", err)
+		}
+		if got != want {
+			t.Errorf("Expected %d, got %d", want, got)
+		}
+	}
+
+	// a reload acts like a crash: values of the reserved block are skipped
+	reloaded := NewCatalog(catalogPath)
+	got, err := reloaded.NextVal("ids")
+	if err != nil {
+		t.Fatalf("Failed to get next value after reload: %v", err)
+	}
+	if want := 10 + 2*SequenceCache; got != want {
+		t.Errorf("Expected %d after reload, got %d", want, got)
+	}
+}
+
+func TestCatalog_CreateSequence_NameTaken(t *testing.T) {
+	catalog, _ := setupTestCatalog(t)
+
+	schema := &TableSchema{
+		Name:    "users",
+		Columns: []Column{{Name: "id", Type: TypeInt}},
+		Indexes: make(map[string]*Index),
+	}
+	if err := catalog.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := catalog.CreateSequence(&Sequence{Name: "users", Start: 1, Increment: 1}); err == nil {
+		t.Error("Expected error when a table has the sequence's name")
+	}
+	if err := catalog.CreateSequence(&Sequence{Name: "zero", Start: 1}); err == nil {
+		t.Error("Expected error for a zero increment")
+	}
+	if _, err := catalog.NextVal("missing"); err == nil {
+		t.Error("Expected error for a missing sequence")
+	}
+}
+
+func TestCatalog_OwnedSequence_DroppedWithTable(t *testing.T) {
+	tmpDir := t.TempDir()
+	catalogPath := filepath.Join(tmpDir, "catalog.json")
+	catalog := NewCatalog(catalogPath)
+
+	schema := &TableSchema{
+		Name:    "users",
+		Columns: []Column{{Name: "id", Type: TypeInt, Sequence: "users_id_seq"}},
+		Indexes: make(map[string]*Index),
+	}
+	if err := catalog.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	seq, err := catalog.GetSequence("users_id_seq")
+	if err != nil {
+		t.Fatalf("Owned sequence not created: %v", err)
+	}
+	if !seq.Owned {
+		t.Error("Expected sequence to be owned")
+	}
+	if err := catalog.DropSequence("users_id_seq"); err == nil {
+		t.Error("Expected error when dropping a sequence in use")
+	}
+	if err := catalog.DropTable("users"); err != nil {
+		t.Fatalf("Failed to drop table: %v", err)
+	}
+
+	reloaded := NewCatalog(catalogPath)
+	if _, err := reloaded.GetSequence("users_id_seq"); err == nil {
+		t.Error("Owned sequence found after dropping its table")
+	}
+}
+
+func TestCatalog_OwnedSequence_PrunedOnLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+	catalogPath := filepath.Join(tmpDir, "catalog.json")
+	catalog := NewCatalog(catalogPath)
+
+	// as left by a crash between creating the sequence and the table
+	catalog.Sequences["orphan_seq"] = &Sequence{Name: "orphan_seq", Start: 1, Increment: 1, Owned: true}
+	catalog.Sequences["plain"] = &Sequence{Name: "plain", Start: 1, Increment: 1}
+	if err := catalog.saveSequences(); err != nil {
+		t.Fatalf("Failed to save sequences: %v", err)
+	}
+
+	reloaded := NewCatalog(catalogPath)
+	if _, ok := reloaded.Sequences["orphan_seq"]; ok {
+		t.Error("Orphaned owned sequence survived reload")
+	}
+	if _, ok := reloaded.Sequences["plain"]; !ok {
+		t.Error("Standalone sequence missing after reload")
+	}
+}
@@ -0,0 +1,135 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+)
+
+// View is a named query; Query is its SQL text, expanded wherever the view
+// is read. A materialized view also has a table of the same name holding
+// the query's rows as of its creation or last refresh.
+type View struct {
+	Name    string
+	Query   string
+	Columns []string `json:",omitempty"` // explicit column names, empty to use the query's
+	// Depends lists the tables and views the query reads. They can't be
+	// dropped or have their columns changed while the view exists.
+	Depends      []string
+	Materialized bool `json:",omitempty"`
+}
+
+func (c *Catalog) loadViews() {
+	data, err := os.ReadFile(c.viewPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		panic(fmt.Sprintf("failed to read views: %v", err))
+	}
+	_ = json.Unmarshal(data, &c.Views)
+}
+
+func (c *Catalog) saveViews() error {
+	data, err := json.MarshalIndent(c.Views, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.viewPath, data)
+}
+
+// CreateView adds a view. Views share the namespace of tables; the table
+// of a materialized view must be created first.
+func (c *Catalog) CreateView(view *View) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.Views[view.Name]; exists {
+		return fmt.Errorf("view %s already exists", view.Name)
+	}
+	if _, exists := c.Tables[view.Name]; exists != view.Materialized {
+		if exists {
+			return fmt.Errorf("table %s already exists", view.Name)
+		}
+		return fmt.Errorf("table of materialized view %s not found", view.Name)
+	}
+	if _, exists := c.Sequences[view.Name]; exists {
+		return fmt.Errorf("sequence %s already exists", view.Name)
+	}
+	for _, dep := range view.Depends {
+		_, isTable := c.Tables[dep]
+		_, isView := c.Views[dep]
+		if !isTable && !isView {
+			return fmt.Errorf("table %s not found", dep)
+		}
+	}
+	c.Views[view.Name] = view
+	if err := c.saveViews(); err != nil {
+		delete(c.Views, view.Name)
+		return fmt.Errorf("save views: %w", err)
+	}
+	return nil
+}
+
+func (c *Catalog) GetView(name string) (*View, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	view, ok := c.Views[name]
+	if !ok {
+		return nil, fmt.Errorf("view %s not found", name)
+	}
+	return view, nil
+}
+
+// DropView removes a view that no other view depends on. The table of a
+// materialized view is left for the caller to drop.
+func (c *Catalog) DropView(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	view, ok := c.Views[name]
+	if !ok {
+		return fmt.Errorf("view %s not found", name)
+	}
+	if deps := c.dependents(name); len(deps) > 0 {
+		return fmt.Errorf("cannot drop view %s because view %s depends on it", name, deps[0])
+	}
+	delete(c.Views, name)
+	if err := c.saveViews(); err != nil {
+		c.Views[name] = view
+		return fmt.Errorf("save views: %w", err)
+	}
+	return nil
+}
+
+// Dependents returns the names of the views reading the named table or
+// view, sorted.
+func (c *Catalog) Dependents(name string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dependents(name)
+}
+
+func (c *Catalog) dependents(name string) []string {
+	var names []string
+	for _, view := range c.Views {
+		if slices.Contains(view.Depends, name) {
+			names = append(names, view.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkAlterable refuses changes to the columns or name of a table that
+// views depend on, since their stored SQL would no longer match it, and to
+// the table of a materialized view, which follows its query.
+func (c *Catalog) checkAlterable(name string) error {
+	if view, ok := c.Views[name]; ok && view.Materialized {
+		return fmt.Errorf("%s is a materialized view", name)
+	}
+	if deps := c.dependents(name); len(deps) > 0 {
+		return fmt.Errorf("cannot alter table %s because view %s depends on it", name, deps[0])
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package catalog
+
+import (
+	"testing"
+)
+
+func setupViewTables(t *testing.T) *Catalog {
+	catalog, _ := setupTestCatalog(t)
+	animals := &TableSchema{
+		Name:    "animals",
+		Columns: []Column{{Name: "id", Type: TypeInt}, {Name: "name", Type: TypeText}},
+		Indexes: make(map[string]*Index),
+	}
+	if err := catalog.CreateTable(animals); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	view := &View{Name: "named", Query: "SELECT name FROM animals", Depends: []string{"animals"}}
+	if err := catalog.CreateView(view); err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+	return catalog
+}
+
+func TestCatalog_CreateView_Names(t *testing.T) {
+	catalog := setupViewTables(t)
+
+	if err := catalog.CreateView(&View{Name: "animals", Query: "SELECT 1"}); err == nil {
+		t.Error("Expected error creating a view named like a table")
+	}
+	if err := catalog.CreateView(&View{Name: "named", Query: "SELECT 1"}); err == nil {
+		t.Error("Expected error creating a view twice")
+	}
+	if err := catalog.CreateView(&View{Name: "other", Query: "SELECT id FROM nope", Depends: []string{"nope"}}); err == nil {
+		t.Error("Expected error creating a view on a missing table")
+	}
+	if err := catalog.CreateView(&View{Name: "snap", Query: "SELECT 1", Materialized: true}); err == nil {
+		t.Error("Expected error creating a materialized view without its table")
+	}
+	schema := &TableSchema{Name: "named", Columns: []Column{{Name: "id", Type: TypeInt}}, Indexes: make(map[string]*Index)}
+	if err := catalog.CreateTable(schema); err == nil {
+		t.Error("Expected error creating a table named like a view")
+	}
+	if err := catalog.CreateSequence(&Sequence{Name: "named", Start: 1, Increment: 1}); err == nil {
+		t.Error("Expected error creating a sequence named like a view")
+	}
+}
+
+func TestCatalog_View_BlocksBaseTableChanges(t *testing.T) {
+	catalog := setupViewTables(t)
+	nested := &View{Name: "nested", Query: "SELECT name FROM named", Depends: []string{"named"}}
+	if err := catalog.CreateView(nested); err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	if err := catalog.DropTable("animals"); err == nil {
+		t.Error("Expected error dropping a table a view depends on")
+	}
+	if _, err := catalog.DropColumn("animals", "name"); err == nil {
+		t.Error("Expected error dropping a column of a table a view depends on")
+	}
+	if err := catalog.RenameTable("animals", "beasts"); err == nil {
+		t.Error("Expected error renaming a table a view depends on")
+	}
+	if err := catalog.DropView("named"); err == nil {
+		t.Error("Expected error dropping a view another view depends on")
+	}
+
+	if err := catalog.DropView("nested"); err != nil {
+		t.Fatalf("Failed to drop view: %v", err)
+	}
+	if err := catalog.DropView("named"); err != nil {
+		t.Fatalf("Failed to drop view: %v", err)
+	}
+	if err := catalog.DropTable("animals"); err != nil {
+		t.Errorf("Failed to drop table no view depends on: %v", err)
+	}
+}
+
+func TestCatalog_MaterializedView_OwnsTable(t *testing.T) {
+	catalog := setupViewTables(t)
+	schema := &TableSchema{Name: "snap", Columns: []Column{{Name: "name", Type: TypeText}}, Indexes: make(map[string]*Index)}
+	if err := catalog.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	view := &View{Name: "snap", Query: "SELECT name FROM animals", Depends: []string{"animals"}, Materialized: true}
+	if err := catalog.CreateView(view); err != nil {
+		t.Fatalf("Failed to create materialized view: %v", err)
+	}
+
+	if err := catalog.DropTable("snap"); err == nil {
+		t.Error("Expected error dropping the table of a materialized view")
+	}
+	if err := catalog.AddColumn("snap", Column{Name: "x", Type: TypeInt}); err == nil {
+		t.Error("Expected error altering the table of a materialized view")
+	}
+
+	reloaded := NewCatalog(catalog.path)
+	got, err := reloaded.GetView("snap")
+	if err != nil {
+		t.Fatalf("View not found after reload: %v", err)
+	}
+	if !got.Materialized || got.Query != view.Query || len(got.Depends) != 1 {
+		t.Errorf("Unexpected view after reload: %+v", got)
+	}
+	if deps := reloaded.Dependents("animals"); len(deps) != 2 || deps[0] != "named" || deps[1] != "snap" {
+		t.Errorf("Expected named and snap to depend on animals, got %v", deps)
+	}
+
+	if err := reloaded.DropView("snap"); err != nil {
+		t.Fatalf("Failed to drop view: %v", err)
+	}
+	if err := reloaded.DropTable("snap"); err != nil {
+		t.Errorf("Failed to drop table of a dropped materialized view: %v", err)
+	}
+}
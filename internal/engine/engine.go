@@ -1,16 +1,39 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sync"
 
 	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
 	"justasimpletoydb/internal/storage"
 )
 
+// ErrClosed is returned for tables asked of a closed engine.
+var ErrClosed = errors.New("engine is closed")
+
 type Engine struct {
 	DataDir string
 	Catalog *catalog.Catalog
+	Locks   *lock.Manager // table locks of the sessions
+
+	// mu guards the tables open, which statements share: GetTable hands
+	// out handles on them and each is closed once the last handle is
+	// released after it was dropped from the map
+	mu     sync.Mutex
+	open   map[string]*openTable
+	closed bool
+}
+
+// openTable is a table whose files are open.
+type openTable struct {
+	table  *storage.Table
+	schema *catalog.TableSchema // the catalog's when the table was opened
+	refs   int                  // handles not released yet
+	stale  bool                 // dropped from the map: closed once unused
 }
 
 func NewEngine(dataDir string) *Engine {
@@ -18,30 +41,115 @@ func NewEngine(dataDir string) *Engine {
 	return &Engine{
 		DataDir: dataDir,
 		Catalog: catalog.NewCatalog(catPath),
+		Locks:   lock.NewManager(),
+		open:    make(map[string]*openTable),
 	}
 }
 
+// GetTable returns a handle on a table for a statement, which closes it
+// when done. The files of a table stay open between statements; the
+// handles of concurrent statements share them. A table whose schema the
+// catalog replaced, for example when a table it references was renamed,
+// is opened anew.
 func (e *Engine) GetTable(name string) (*storage.Table, error) {
 	schema, err := e.Catalog.GetTable(name)
 	if err != nil {
 		return nil, fmt.Errorf("table %s not found in catalog: %w", name, err)
 	}
 
-	tablePath := filepath.Join(e.DataDir, name+".tbl")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil, ErrClosed
+	}
+	ot, ok := e.open[name]
+	if ok && ot.schema != schema {
+		e.evict(name)
+		ok = false
+	}
+	if !ok {
+		tablePath := filepath.Join(e.DataDir, name+".tbl")
+		table, err := storage.NewTable(name, tablePath, schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open table %s: %w", name, err)
+		}
+		ot = &openTable{table: table, schema: schema}
+		e.open[name] = ot
+	}
+	ot.refs++
+	return ot.table.Handle(func() { e.release(ot) }), nil
+}
 
-	table, err := storage.NewTable(name, tablePath, schema)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open table %s: %w", name, err)
+func (e *Engine) release(ot *openTable) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ot.refs--
+	if ot.refs == 0 && ot.stale {
+		ot.table.Close()
 	}
+}
 
-	return table, nil
+// evict drops a table from the open tables, closing its files once the
+// handles on it are released. Schema changes evict the tables they change,
+// so that the next statement opens the files the catalog now describes.
+func (e *Engine) evict(name string) {
+	ot, ok := e.open[name]
+	if !ok {
+		return
+	}
+	delete(e.open, name)
+	ot.stale = true
+	if ot.refs == 0 {
+		ot.table.Close()
+	}
+}
+
+func (e *Engine) invalidate(names ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, name := range names {
+		e.evict(name)
+	}
+}
+
+// Close flushes the files of the open tables to disk and closes them.
+// Tables still used by running statements are closed once released; no
+// tables are handed out afterwards.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	var errs []error
+	for name, ot := range e.open {
+		if err := ot.table.Sync(); err != nil {
+			errs = append(errs, fmt.Errorf("flush table %s: %w", name, err))
+		}
+		delete(e.open, name)
+		ot.stale = true
+		if ot.refs == 0 {
+			if err := ot.table.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close table %s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (e *Engine) CreateTable(schema *catalog.TableSchema) error {
 	if err := e.Catalog.CreateTable(schema); err != nil {
 		return fmt.Errorf("create table: %w", err)
 	}
+	e.invalidate(schema.Name)
 	tablePath := filepath.Join(e.DataDir, schema.Name+".tbl")
+	// a file left behind by an interrupted DROP TABLE must not reappear as data
+	if err := os.Remove(tablePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove stale table file: %w", err)
+	}
+	for name := range schema.Indexes {
+		if err := os.Remove(storage.IndexPath(e.DataDir, schema.Name, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove stale index file: %w", err)
+		}
+	}
 	table, err := storage.NewTable(schema.Name, tablePath, schema)
 	if err != nil {
 		return fmt.Errorf("create table file: %w", err)
@@ -50,8 +158,21 @@ func (e *Engine) CreateTable(schema *catalog.TableSchema) error {
 	return nil
 }
 
-func (e *Engine) CreateIndex(tableName, columnName, indexName string) error {
-	if err := e.Catalog.CreateIndex(tableName, indexName, columnName); err != nil {
+// CreateIndex adds an index to the catalog and builds it from the rows of
+// the table. If building fails, for example on duplicate keys of a unique
+// index, the index is dropped again.
+func (e *Engine) CreateIndex(tableName, columnName, indexName string, unique bool) error {
+	// a file left behind by an interrupted DROP INDEX must not be reused
+	if schema, err := e.Catalog.GetTable(tableName); err == nil && schema.Indexes[indexName] == nil {
+		if err := os.Remove(storage.IndexPath(e.DataDir, tableName, indexName)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove stale index file: %w", err)
+		}
+	}
+	create := e.Catalog.CreateIndex
+	if unique {
+		create = e.Catalog.CreateUniqueIndex
+	}
+	if err := create(tableName, indexName, columnName); err != nil {
 		return fmt.Errorf("create index: %w", err)
 	}
 	table, err := e.GetTable(tableName)
@@ -59,8 +180,145 @@ func (e *Engine) CreateIndex(tableName, columnName, indexName string) error {
 		return fmt.Errorf("get table for index creation: %w", err)
 	}
 	defer table.Close()
+	defer e.invalidate(tableName)
 	if err := table.CreateIndex(indexName, columnName); err != nil {
+		if dropErr := e.Catalog.DropIndex(tableName, indexName); dropErr == nil {
+			table.DropIndex(indexName)
+		}
 		return fmt.Errorf("create index: %w", err)
 	}
 	return nil
 }
+
+// DropTable removes a table from the catalog, then deletes its data and
+// index files. If the catalog can't be updated nothing is deleted; files
+// left behind by a failed delete are replaced when the name is reused.
+func (e *Engine) DropTable(name string) error {
+	table, err := e.GetTable(name)
+	if err != nil {
+		return err
+	}
+	if err := e.Catalog.DropTable(name); err != nil {
+		table.Close()
+		return fmt.Errorf("drop table: %w", err)
+	}
+	e.invalidate(name)
+	if err := table.Drop(); err != nil {
+		return fmt.Errorf("remove files of table %s: %w", name, err)
+	}
+	return nil
+}
+
+// DropIndex removes an index from the catalog, then deletes its file.
+func (e *Engine) DropIndex(tableName, indexName string) error {
+	table, err := e.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+	defer e.invalidate(tableName)
+	if err := e.Catalog.DropIndex(tableName, indexName); err != nil {
+		return fmt.Errorf("drop index: %w", err)
+	}
+	if err := table.DropIndex(indexName); err != nil {
+		return fmt.Errorf("remove file of index %s: %w", indexName, err)
+	}
+	return nil
+}
+
+// AddColumn adds a column to a table. Existing rows are not rewritten;
+// they read col.Missing for the new column.
+func (e *Engine) AddColumn(tableName string, col catalog.Column) error {
+	if err := e.Catalog.AddColumn(tableName, col); err != nil {
+		return fmt.Errorf("add column: %w", err)
+	}
+	e.invalidate(tableName)
+	return nil
+}
+
+// DropColumn removes a column from a table and deletes the files of the
+// indexes on it. Existing rows are not rewritten; the column is skipped
+// when they are read.
+func (e *Engine) DropColumn(tableName, columnName string) error {
+	table, err := e.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+	defer e.invalidate(tableName)
+	dropped, err := e.Catalog.DropColumn(tableName, columnName)
+	if err != nil {
+		return fmt.Errorf("drop column: %w", err)
+	}
+	for _, name := range dropped {
+		if err := table.DropIndex(name); err != nil {
+			return fmt.Errorf("remove file of index %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// RenameColumn renames a column; rewrite renames it in the text of the
+// CHECK constraints that reference it.
+func (e *Engine) RenameColumn(tableName, oldName, newName string, rewrite func(expr string) (string, error)) error {
+	if err := e.Catalog.RenameColumn(tableName, oldName, newName, rewrite); err != nil {
+		return fmt.Errorf("rename column: %w", err)
+	}
+	e.invalidate(tableName)
+	return nil
+}
+
+// RenameTable moves a table's files to the new name, then updates the
+// catalog. If the catalog can't be written the files are moved back.
+func (e *Engine) RenameTable(oldName, newName string) error {
+	schema, err := e.Catalog.GetTable(oldName)
+	if err != nil {
+		return fmt.Errorf("rename table: %w", err)
+	}
+	if _, err := e.Catalog.GetTable(newName); err == nil {
+		return fmt.Errorf("rename table: table %s already exists", newName)
+	}
+	indexes := make([]string, 0, len(schema.Indexes))
+	for name := range schema.Indexes {
+		indexes = append(indexes, name)
+	}
+	// the files are closed before they are moved
+	e.invalidate(oldName, newName)
+	if err := storage.RenameTableFiles(e.DataDir, oldName, newName, indexes); err != nil {
+		return fmt.Errorf("rename table files: %w", err)
+	}
+	if err := e.Catalog.RenameTable(oldName, newName); err != nil {
+		err = fmt.Errorf("rename table: %w", err)
+		if moveErr := storage.RenameTableFiles(e.DataDir, newName, oldName, indexes); moveErr != nil {
+			err = errors.Join(err, fmt.Errorf("move files back to %s: %w", oldName, moveErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// DropView removes a view from the catalog. A materialized view's table is
+// dropped along with it; if the catalog can't be updated the view is
+// restored.
+func (e *Engine) DropView(name string) error {
+	view, err := e.Catalog.GetView(name)
+	if err != nil {
+		return fmt.Errorf("drop view: %w", err)
+	}
+	if err := e.Catalog.DropView(name); err != nil {
+		return fmt.Errorf("drop view: %w", err)
+	}
+	if !view.Materialized {
+		return nil
+	}
+	if err := e.DropTable(name); err != nil {
+		if _, getErr := e.Catalog.GetTable(name); getErr != nil {
+			return err // only removing the files failed
+		}
+		if restoreErr := e.Catalog.CreateView(view); restoreErr != nil {
+			return fmt.Errorf("%w (restoring view %s also failed: %v)", err, name, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
@@ -41,5 +41,49 @@ func DecodeRow(schema *catalog.TableSchema, data []byte) ([]any, error) {
 		}
 	}
 
+	// anything after the values is the NULL bitmap
+	if buf.Len() > 0 {
+		nulls := make([]byte, buf.Len())
+		buf.Read(nulls)
+		if len(nulls) != nullBitmapSize(len(schema.Columns)) {
+			return nil, fmt.Errorf("decode row: %d unexpected trailing bytes", len(nulls))
+		}
+		for i := range result {
+			if nulls[i/8]&(1<<(i%8)) != 0 {
+				result[i] = nil
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// DecodeRowVersion decodes a row written with an earlier schema version and
+// maps it onto the current columns: dropped columns are skipped and columns
+// added since read their Missing value.
+func DecodeRowVersion(schema *catalog.TableSchema, version int, data []byte) ([]any, error) {
+	if version == schema.Version {
+		return DecodeRow(schema, data)
+	}
+	layout, err := schema.Layout(version)
+	if err != nil {
+		return nil, err
+	}
+	old, err := DecodeRow(&catalog.TableSchema{Name: schema.Name, Columns: layout}, data)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]any, len(layout))
+	for i, col := range layout {
+		byID[col.ID] = old[i]
+	}
+	result := make([]any, len(schema.Columns))
+	for i, col := range schema.Columns {
+		if v, ok := byID[col.ID]; ok {
+			result[i] = v
+		} else {
+			result[i] = col.Missing
+		}
+	}
 	return result, nil
 }
@@ -1,6 +1,7 @@
 package rowcodec
 
 import (
+	"fmt"
 	"justasimpletoydb/internal/catalog"
 	"testing"
 )
@@ -402,3 +403,100 @@ func TestDecodeRow_AllTextColumns(t *testing.T) {
 	}
 }
 
+func TestDecodeRowVersion_OldLayout(t *testing.T) {
+	// version 0 had (id, name); version 1 dropped name and added score
+	v0 := []catalog.Column{
+		{Name: "id", Type: catalog.TypeInt, ID: 1},
+		{Name: "name", Type: catalog.TypeText, ID: 2},
+	}
+	schema := &catalog.TableSchema{
+		Name: "test",
+		Columns: []catalog.Column{
+			{Name: "id", Type: catalog.TypeInt, ID: 1},
+			{Name: "score", Type: catalog.TypeInt, ID: 3, Missing: 7},
+		},
+		Indexes:      make(map[string]*catalog.Index),
+		Version:      1,
+		Layouts:      map[int][]catalog.Column{0: v0},
+		NextColumnID: 4,
+	}
+
+	encoded, err := EncodeRow(&catalog.TableSchema{Name: "test", Columns: v0}, []any{5, "Alice"})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	decoded, err := DecodeRowVersion(schema, 0, encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(decoded) != 2 || decoded[0] != 5 || decoded[1] != 7 {
+		t.Errorf("Expected [5 7], got %v", decoded)
+	}
+
+	// rows of the current version decode as usual
+	encoded, err = EncodeRow(schema, []any{6, 8})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoded, err = DecodeRowVersion(schema, 1, encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if decoded[0] != 6 || decoded[1] != 8 {
+		t.Errorf("Expected [6 8], got %v", decoded)
+	}
+}
+
+func TestDecodeRowVersion_UnknownVersion(t *testing.T) {
+	schema := &catalog.TableSchema{
+		Name:    "test",
+		Columns: []catalog.Column{{Name: "id", Type: catalog.TypeInt}},
+		Indexes: make(map[string]*catalog.Index),
+	}
+	if _, err := DecodeRowVersion(schema, 3, make([]byte, 8)); err == nil {
+		t.Error("Expected error for unknown schema version")
+	}
+}
+
+func TestDecodeRow_Nulls_RoundTrip(t *testing.T) {
+	columns := make([]catalog.Column, 10)
+	values := make([]any, 10)
+	for i := range columns {
+		columns[i] = catalog.Column{Name: fmt.Sprintf("c%d", i), Type: catalog.ColumnType(i % 2)}
+		if i%3 != 0 {
+			if i%2 == 0 {
+				values[i] = i
+			} else {
+				values[i] = fmt.Sprintf("v%d", i)
+			}
+		}
+	}
+	schema := &catalog.TableSchema{Name: "test", Columns: columns, Indexes: make(map[string]*catalog.Index)}
+
+	encoded, err := EncodeRow(schema, values)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoded, err := DecodeRow(schema, encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	for i := range values {
+		if decoded[i] != values[i] {
+			t.Errorf("Column %d: expected %#v, got %#v", i, values[i], decoded[i])
+		}
+	}
+}
+
+func TestDecodeRow_TrailingGarbage(t *testing.T) {
+	schema := &catalog.TableSchema{
+		Name:    "test",
+		Columns: []catalog.Column{{Name: "id", Type: catalog.TypeInt}},
+		Indexes: make(map[string]*catalog.Index),
+	}
+	data := append(make([]byte, 8), 1, 2, 3)
+	if _, err := DecodeRow(schema, data); err == nil {
+		t.Error("Expected error for trailing bytes")
+	}
+}
@@ -8,14 +8,34 @@ import (
 	"justasimpletoydb/internal/catalog"
 )
 
+// EncodeRow encodes values in column order. A NULL is written as the zero
+// value of its column, and rows with NULLs get a trailing bitmap marking
+// them; rows without NULLs carry no bitmap.
 func EncodeRow(schema *catalog.TableSchema, values []any) ([]byte, error) {
 	if len(values) != len(schema.Columns) {
 		return nil, fmt.Errorf("expected %d values, got %d", len(schema.Columns), len(values))
 	}
 
 	buf := &bytes.Buffer{}
+	var nulls []byte
 
 	for i, col := range schema.Columns {
+		if values[i] == nil {
+			if nulls == nil {
+				nulls = make([]byte, nullBitmapSize(len(schema.Columns)))
+			}
+			nulls[i/8] |= 1 << (i % 8)
+			switch col.Type {
+			case catalog.TypeInt:
+				buf.Write(make([]byte, 8))
+			case catalog.TypeText:
+				buf.Write(make([]byte, 4))
+			default:
+				return nil, fmt.Errorf("unsupported type for column %s", col.Name)
+			}
+			continue
+		}
+
 		switch col.Type {
 		case catalog.TypeInt:
 			v, ok := values[i].(int)
@@ -40,9 +60,14 @@ func EncodeRow(schema *catalog.TableSchema, values []any) ([]byte, error) {
 		}
 	}
 
+	buf.Write(nulls)
 	return buf.Bytes(), nil
 }
 
+func nullBitmapSize(columns int) int {
+	return (columns + 7) / 8
+}
+
 func EncodeValue(schema *catalog.TableSchema, columnIndex int, value any) ([]byte, error) {
 	col := schema.Columns[columnIndex]
 	buf := &bytes.Buffer{}
@@ -337,3 +337,25 @@ func TestEncodeRow_UnsupportedType(t *testing.T) {
 	}
 }
 
+func TestEncodeRow_NullsAddBitmap(t *testing.T) {
+	schema := &catalog.TableSchema{
+		Name: "test",
+		Columns: []catalog.Column{
+			{Name: "id", Type: catalog.TypeInt},
+			{Name: "name", Type: catalog.TypeText},
+		},
+		Indexes: make(map[string]*catalog.Index),
+	}
+
+	encoded, err := EncodeRow(schema, []any{1, nil})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	// 8 (int) + 4 (empty text placeholder) + 1 (bitmap)
+	if len(encoded) != 13 {
+		t.Errorf("Expected 13 bytes, got %d", len(encoded))
+	}
+	if encoded[12] != 0b10 {
+		t.Errorf("Expected bitmap 0b10, got %b", encoded[12])
+	}
+}
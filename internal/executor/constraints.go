@@ -0,0 +1,237 @@
+package executor
+
+import (
+	"fmt"
+	"slices"
+
+	"justasimpletoydb/internal/catalog"
+)
+
+// ParseExpr parses the SQL text of an expression stored in the catalog,
+// such as a DEFAULT or CHECK. It is set by the parser package, which
+// depends on this one.
+var ParseExpr func(sql string) (Expr, error)
+
+// DefaultValue is the DEFAULT keyword used as a value in INSERT or UPDATE.
+type DefaultValue struct{}
+
+func (*DefaultValue) String() string {
+	return "DEFAULT"
+}
+
+// tableRules holds the parsed DEFAULT and CHECK expressions of a table.
+type tableRules struct {
+	schema   *catalog.TableSchema
+	cols     []colRef // the table's columns, for evaluating checks
+	defaults []Expr   // per column, nil for NULL
+	checks   []Expr
+}
+
+func (ctx *execContext) rulesFor(schema *catalog.TableSchema) (*tableRules, error) {
+	r := &tableRules{
+		schema:   schema,
+		cols:     tableCols(schema),
+		defaults: make([]Expr, len(schema.Columns)),
+		checks:   make([]Expr, len(schema.Checks)),
+	}
+	for i, c := range schema.Columns {
+		if c.Default == "" {
+			continue
+		}
+		e, err := ParseExpr(c.Default)
+		if err != nil {
+			return nil, fmt.Errorf("default of column %s: %w", c.Name, err)
+		}
+		r.defaults[i] = e
+	}
+	for i, chk := range schema.Checks {
+		e, err := ParseExpr(chk.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("check constraint %s: %w", chk.Name, err)
+		}
+		r.checks[i] = e
+	}
+	return r, nil
+}
+
+// tableCols returns the columns of a table as seen by expressions in
+// statements that write to it.
+func tableCols(schema *catalog.TableSchema) []colRef {
+	cols := make([]colRef, len(schema.Columns))
+	for i, c := range schema.Columns {
+		cols[i] = colRef{table: schema.Name, name: c.Name, typ: c.Type}
+	}
+	return cols
+}
+
+// defaultValue evaluates the DEFAULT of column i; columns without one are NULL.
+func (ctx *execContext) defaultValue(r *tableRules, i int) (any, error) {
+	if r.defaults[i] == nil {
+		return nil, nil
+	}
+	v, err := ctx.eval(r.defaults[i], nil)
+	if err != nil {
+		return nil, fmt.Errorf("default of column %s: %w", r.schema.Columns[i].Name, err)
+	}
+	return v, checkValueType(r.schema.Columns[i], v)
+}
+
+// checkValueType reports whether v can be stored in col.
+func checkValueType(col catalog.Column, v any) error {
+	if v == nil || valueType(v) == col.Type {
+		return nil
+	}
+	return fmt.Errorf("column %s is of type %s but expression is of type %s", col.Name, typeString(col.Type), typeName(v))
+}
+
+// CheckViolation is returned when a row fails a CHECK constraint.
+type CheckViolation struct {
+	Table      string
+	Constraint string
+}
+
+func (e *CheckViolation) Error() string {
+	return fmt.Sprintf("new row for table %s violates check constraint %s", e.Table, e.Constraint)
+}
+
+// checkRow evaluates the CHECK constraints against a new row. A constraint
+// that is unknown (NULL) is satisfied; only false rejects the row.
+func (ctx *execContext) checkRow(r *tableRules, row []any) error {
+	sc := &rowScope{cols: r.cols, row: row}
+	for i, e := range r.checks {
+		ok, err := ctx.evalBool(e, sc)
+		if err != nil {
+			return fmt.Errorf("check constraint %s: %w", r.schema.Checks[i].Name, err)
+		}
+		if ok != nil && !*ok {
+			return &CheckViolation{Table: r.schema.Name, Constraint: r.schema.Checks[i].Name}
+		}
+	}
+	return nil
+}
+
+// validateDefault checks a DEFAULT expression when a column is defined.
+func (ctx *execContext) validateDefault(col catalog.Column, e Expr) error {
+	var bad string
+	walkExpr(e, func(n Expr) bool {
+		switch n := n.(type) {
+		case *ColumnRef:
+			bad = "column references"
+		case *InExpr:
+			if n.Subquery != nil {
+				bad = "subqueries"
+			}
+		case *ExistsExpr, *SubqueryExpr:
+			bad = "subqueries"
+		case *WindowFunc:
+			bad = "window functions"
+		case *DefaultValue:
+			bad = "DEFAULT"
+		}
+		return bad == ""
+	})
+	if bad != "" {
+		return fmt.Errorf("cannot use %s in default expression of column %s", bad, col.Name)
+	}
+	if err := ctx.checkExprs([]Expr{e}, nil); err != nil {
+		return fmt.Errorf("default of column %s: %w", col.Name, err)
+	}
+	if t := ctx.exprType(e, nil); t != typeUnknown && t != col.Type {
+		return fmt.Errorf("default of column %s must be %s, got %s", col.Name, typeString(col.Type), typeString(t))
+	}
+	return nil
+}
+
+// validateCheck checks a CHECK expression against the table's columns and
+// returns the names of the columns it references.
+func (ctx *execContext) validateCheck(name string, e Expr, cols []colRef) ([]string, error) {
+	var refs []string
+	var err error
+	walkExpr(e, func(n Expr) bool {
+		switch n := n.(type) {
+		case *ColumnRef:
+			idx, rerr := resolveColumn(cols, n)
+			switch {
+			case rerr != nil:
+				err = rerr
+			case idx < 0:
+				err = fmt.Errorf("column %s does not exist", n.String())
+			case !slices.Contains(refs, cols[idx].name):
+				refs = append(refs, cols[idx].name)
+			}
+		case *InExpr:
+			if n.Subquery != nil {
+				err = fmt.Errorf("cannot use subqueries in check constraint")
+			}
+		case *ExistsExpr, *SubqueryExpr:
+			err = fmt.Errorf("cannot use subqueries in check constraint")
+		case *WindowFunc:
+			err = fmt.Errorf("cannot use window functions in check constraint")
+		case *DefaultValue:
+			err = fmt.Errorf("cannot use DEFAULT in check constraint")
+		}
+		return err == nil
+	})
+	if err == nil {
+		err = ctx.checkExprs([]Expr{e}, cols)
+	}
+	if err == nil {
+		if t := ctx.exprType(e, cols); t != typeBool && t != typeUnknown {
+			err = fmt.Errorf("argument of CHECK must be boolean, got %s", typeString(t))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("check constraint %s: %w", name, err)
+	}
+	return refs, nil
+}
+
+// checkName picks the default name of a CHECK constraint the way Postgres
+// does: table_column_check or table_check, numbered when taken.
+func checkName(table, column string, taken []catalog.Check) string {
+	base := table + "_check"
+	if column != "" {
+		base = table + "_" + column + "_check"
+	}
+	name := base
+	for n := 1; slices.ContainsFunc(taken, func(c catalog.Check) bool { return c.Name == name }); n++ {
+		name = fmt.Sprintf("%s%d", base, n)
+	}
+	return name
+}
+
+// fkeyName picks the default name of a foreign key on column the same way:
+// table_column_fkey, numbered when a constraint of the table has it.
+func fkeyName(schema *catalog.TableSchema, column string) string {
+	base := schema.Name + "_" + column + "_fkey"
+	name := base
+	for n := 1; hasConstraint(schema, name); n++ {
+		name = fmt.Sprintf("%s%d", base, n)
+	}
+	return name
+}
+
+// hasConstraint reports whether a CHECK constraint or foreign key of a
+// table is named name.
+func hasConstraint(schema *catalog.TableSchema, name string) bool {
+	return slices.ContainsFunc(schema.Checks, func(c catalog.Check) bool { return c.Name == name }) ||
+		slices.ContainsFunc(schema.ForeignKeys, func(fk catalog.ForeignKey) bool { return fk.Name == name })
+}
+
+// renameColumnRefs returns a function rewriting the SQL text of a stored
+// expression so that references to oldName use newName.
+func renameColumnRefs(oldName, newName string) func(string) (string, error) {
+	return func(sql string) (string, error) {
+		e, err := ParseExpr(sql)
+		if err != nil {
+			return "", err
+		}
+		walkExpr(e, func(n Expr) bool {
+			if ref, ok := n.(*ColumnRef); ok && ref.Name == oldName {
+				ref.Name = newName
+			}
+			return true
+		})
+		return e.String(), nil
+	}
+}
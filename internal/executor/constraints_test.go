@@ -0,0 +1,77 @@
+package executor_test
+
+import (
+	"errors"
+	"testing"
+
+	"justasimpletoydb/internal/executor"
+)
+
+const zooSchema = `CREATE TABLE zoo (
+	id INT CHECK (id > 0),
+	name TEXT DEFAULT 'unnamed',
+	size INT DEFAULT 1 + 1,
+	born TEXT DEFAULT SUBSTR(NOW(), 1, 4),
+	CONSTRAINT small CHECK (size < 100 AND size <> id)
+)`
+
+func TestConstraints_Default(t *testing.T) {
+	s := setupSession(t, zooSchema)
+	// omitted columns
+	s.wantRows("INSERT INTO zoo (id) VALUES (1); SELECT id, name, size FROM zoo WHERE id = 1", "[[1 unnamed 2]]")
+	// DEFAULT keyword
+	s.wantRows("INSERT INTO zoo (id, name, size) VALUES (3, DEFAULT, DEFAULT); SELECT name, size FROM zoo WHERE id = 3", "[[unnamed 2]]")
+	// explicit NULL is kept
+	s.wantRows("INSERT INTO zoo (id, name) VALUES (4, NULL); SELECT name FROM zoo WHERE id = 4", "[[<nil>]]")
+	// default evaluated per statement
+	s.wantRows("SELECT COUNT(*) OVER () FROM zoo WHERE born = SUBSTR(NOW(), 1, 4)", "[[3] [3] [3]]")
+	// UPDATE to DEFAULT
+	s.wantRows("UPDATE zoo SET size = 50 WHERE id = 1; UPDATE zoo SET size = DEFAULT WHERE id = 1; SELECT size FROM zoo WHERE id = 1", "[[2]]")
+	// added column fills existing rows
+	s.wantRows("ALTER TABLE zoo ADD COLUMN legs INT DEFAULT 4; SELECT DISTINCT legs FROM zoo", "[[4]]")
+	// wrong type
+	s.wantErr("CREATE TABLE bad (id INT DEFAULT 'one')", "default of column id must be INT, got TEXT")
+	// column reference
+	s.wantErr("CREATE TABLE bad (id INT, n INT DEFAULT id)", "cannot use column references in default expression of column n")
+	// subquery
+	s.wantErr("CREATE TABLE bad (id INT DEFAULT (SELECT 1))", "cannot use subqueries in default expression of column id")
+}
+
+func TestConstraints_Check(t *testing.T) {
+	s := setupSession(t, zooSchema+"; INSERT INTO zoo (id, size) VALUES (1, 10), (2, NULL)")
+	// column check
+	s.wantErr("INSERT INTO zoo (id) VALUES (0)", "new row for table zoo violates check constraint zoo_id_check")
+	// named table check
+	s.wantErr("INSERT INTO zoo (id, size) VALUES (5, 100)", "new row for table zoo violates check constraint small")
+	// check across columns
+	s.wantErr("INSERT INTO zoo (id, size) VALUES (7, 7)", "violates check constraint small")
+	// checked on UPDATE
+	s.wantErr("UPDATE zoo SET size = size * 10 WHERE id = 1", "violates check constraint small")
+	// failed statements change nothing
+	s.wantRows("SELECT id, size FROM zoo", "[[1 10] [2 <nil>]]")
+	// one bad row rejects the batch
+	s.wantErr("INSERT INTO zoo (id) VALUES (8), (-1)", "zoo_id_check")
+	// batch left nothing behind
+	s.wantRows("SELECT id FROM zoo WHERE id = 8", "[]")
+	// NULL satisfies a check
+	s.wantRows("INSERT INTO zoo (id, size) VALUES (NULL, NULL); SELECT id FROM zoo WHERE id IS NULL", "[[<nil>]]")
+	// renamed column keeps its check
+	s.wantRows("ALTER TABLE zoo RENAME COLUMN size TO weight; UPDATE zoo SET weight = 99 WHERE id = 1; SELECT weight FROM zoo WHERE id = 1", "[[99]]")
+	// renamed column still checked
+	s.wantErr("UPDATE zoo SET weight = 100 WHERE id = 1", "violates check constraint small")
+	// unknown column
+	s.wantErr("CREATE TABLE bad (id INT CHECK (size > 0))", "column size does not exist")
+	// not boolean
+	s.wantErr("CREATE TABLE bad (id INT CHECK (id + 1))", "argument of CHECK must be boolean, got INT")
+	// subquery
+	s.wantErr("CREATE TABLE bad (id INT CHECK (id IN (SELECT 1)))", "cannot use subqueries in check constraint")
+}
+
+func TestConstraints_CheckViolationType(t *testing.T) {
+	s := setupSession(t, zooSchema)
+	_, err := s.exec("INSERT INTO zoo (id) VALUES (-1)")
+	var violation *executor.CheckViolation
+	if !errors.As(err, &violation) || violation.Table != "zoo" || violation.Constraint != "zoo_id_check" {
+		t.Errorf("Expected a CheckViolation of zoo_id_check, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxRecursion bounds the iterations of a recursive CTE under UNION ALL,
+// which keeps rows it has already produced and would loop forever on a
+// cycle in the data. UNION discards them and ends once an iteration adds
+// no new row, so it is not bounded.
+const maxRecursion = 1000
+
+// CTE is one "name [(columns)] AS (query)" entry of a WITH clause.
+// Under WITH RECURSIVE a query of the form "anchor UNION [ALL] term" may
+// reference the CTE itself in term.
+type CTE struct {
+	Name    string
+	Columns []string // optional explicit column names
+	Query   Query
+}
+
+func (c *CTE) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	if len(c.Columns) > 0 {
+		b.WriteString(" (" + strings.Join(c.Columns, ", ") + ")")
+	}
+	b.WriteString(" AS (" + c.Query.String() + ")")
+	return b.String()
+}
+
+func withString(recursive bool, ctes []*CTE) string {
+	if len(ctes) == 0 {
+		return ""
+	}
+	parts := make([]string, len(ctes))
+	for i, c := range ctes {
+		parts[i] = c.String()
+	}
+	if recursive {
+		return "WITH RECURSIVE " + strings.Join(parts, ", ") + " "
+	}
+	return "WITH " + strings.Join(parts, ", ") + " "
+}
+
+// recursiveParts splits "anchor UNION [ALL] term" for iterative evaluation.
+func (c *CTE) recursiveParts() (anchor, term Query, all bool, ok bool) {
+	op, isSetOp := c.Query.(*SetOpStmt)
+	if !isSetOp || op.Op != "UNION" || len(op.With) > 0 {
+		return nil, nil, false, false
+	}
+	return op.Left, op.Right, op.All, true
+}
+
+// cteScope holds the CTEs visible to a query; inner WITH clauses shadow outer ones.
+type cteScope struct {
+	defs   map[string]*cteState
+	parent *cteScope
+}
+
+type cteState struct {
+	def       *CTE
+	recursive bool
+	// rel is the materialized result, or the working table while the
+	// recursive term is being evaluated. nil until evaluation starts.
+	rel       *relation
+	resolving bool // guards cteCols against self reference
+}
+
+func (ctx *execContext) lookupCTE(name string) *cteState {
+	for sc := ctx.ctes; sc != nil; sc = sc.parent {
+		// a non-recursive CTE does not see itself while its columns are resolved
+		if st, ok := sc.defs[name]; ok && !(st.resolving && !st.recursive) {
+			return st
+		}
+	}
+	return nil
+}
+
+func (ctx *execContext) pushCTEs(recursive bool, ctes []*CTE) {
+	sc := &cteScope{defs: make(map[string]*cteState), parent: ctx.ctes}
+	ctx.ctes = sc
+	for _, c := range ctes {
+		sc.defs[c.Name] = &cteState{def: c, recursive: recursive}
+	}
+}
+
+func (ctx *execContext) popCTEs() {
+	ctx.ctes = ctx.ctes.parent
+}
+
+// enterWith brings the CTEs of a WITH clause into scope and materializes
+// them. The returned function leaves the scope again.
+func (ctx *execContext) enterWith(recursive bool, ctes []*CTE) (func(), error) {
+	if len(ctes) == 0 {
+		return func() {}, nil
+	}
+	ctx.pushCTEs(recursive, ctes)
+	if err := ctx.evalCTEs(recursive, ctes); err != nil {
+		ctx.popCTEs()
+		return nil, err
+	}
+	return ctx.popCTEs, nil
+}
+
+// cteCols names the columns of a CTE before it is evaluated. For recursive
+// CTEs the anchor decides the column types.
+func (ctx *execContext) cteCols(st *cteState) ([]colRef, error) {
+	if st.rel != nil {
+		return st.rel.cols, nil
+	}
+	if st.resolving {
+		return nil, fmt.Errorf("recursive reference to query %q must not appear within its non-recursive term", st.def.Name)
+	}
+	st.resolving = true
+	defer func() { st.resolving = false }()
+
+	q := st.def.Query
+	if anchor, _, _, ok := st.def.recursiveParts(); ok && st.recursive {
+		q = anchor
+	}
+	cols, err := ctx.queryCols(q)
+	if err != nil {
+		return nil, err
+	}
+	return st.def.rename(cols)
+}
+
+// rename applies the explicit column list of the CTE, if any.
+func (c *CTE) rename(cols []colRef) ([]colRef, error) {
+	if len(c.Columns) == 0 {
+		return cols, nil
+	}
+	if len(c.Columns) != len(cols) {
+		return nil, fmt.Errorf("WITH query %q has %d columns available but %d columns specified", c.Name, len(cols), len(c.Columns))
+	}
+	out := make([]colRef, len(cols))
+	for i, name := range c.Columns {
+		out[i] = colRef{name: name, typ: cols[i].typ}
+	}
+	return out, nil
+}
+
+// evalCTEs materializes the CTEs of a WITH clause in order, so that each one
+// can reference those defined before it.
+func (ctx *execContext) evalCTEs(recursive bool, ctes []*CTE) error {
+	for _, c := range ctes {
+		st := ctx.ctes.defs[c.Name]
+		// hide the CTE from its own body unless WITH RECURSIVE was given
+		if !recursive {
+			delete(ctx.ctes.defs, c.Name)
+		}
+		rel, err := ctx.evalCTE(st)
+		ctx.ctes.defs[c.Name] = st
+		if err != nil {
+			return fmt.Errorf("WITH %s: %w", c.Name, err)
+		}
+		st.rel = rel
+	}
+	return nil
+}
+
+// evalCTE runs the anchor once, then repeatedly runs the recursive term
+// against the working table (the rows produced by the previous iteration)
+// until it yields no new rows.
+func (ctx *execContext) evalCTE(st *cteState) (*relation, error) {
+	def := st.def
+	anchorQuery, term, unionAll, ok := def.recursiveParts()
+	if !st.recursive || !ok {
+		rel, err := def.Query.run(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		cols, err := def.rename(rel.cols)
+		if err != nil {
+			return nil, err
+		}
+		return &relation{cols: cols, rows: rel.rows}, nil
+	}
+
+	anchor, err := anchorQuery.run(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := def.rename(anchor.cols)
+	if err != nil {
+		return nil, err
+	}
+	result := &relation{cols: cols}
+
+	seen := make(map[string]struct{})
+	add := func(rows [][]any) [][]any {
+		if unionAll {
+			result.rows = append(result.rows, rows...)
+			return rows
+		}
+		var fresh [][]any
+		for _, row := range rows {
+			key := rowKey(row)
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+			fresh = append(fresh, row)
+		}
+		result.rows = append(result.rows, fresh...)
+		return fresh
+	}
+
+	working := add(anchor.rows)
+	for iter := 0; len(working) > 0; iter++ {
+		if unionAll && iter >= maxRecursion {
+			return nil, fmt.Errorf("recursive query did not finish after %d iterations; the data may contain a cycle (use UNION instead of UNION ALL)", maxRecursion)
+		}
+		st.rel = &relation{cols: cols, rows: working}
+		// subquery results cached in a previous iteration saw another working table
+		rel, err := term.run(ctx.withFreshSubplans(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := unifyCols("UNION", cols, rel.cols); err != nil {
+			return nil, err
+		}
+		working = add(rel.rows)
+	}
+	return result, nil
+}
+
+// rowKey encodes a row for hash-based duplicate elimination.
+func rowKey(row []any) string {
+	var b strings.Builder
+	for _, v := range row {
+		switch v := v.(type) {
+		case nil:
+			b.WriteString("n;")
+		case string:
+			fmt.Fprintf(&b, "s%d:%s;", len(v), v)
+		default:
+			fmt.Fprintf(&b, "%T:%v;", v, v)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package executor_test
+
+import "testing"
+
+// newEmpSession has a reporting hierarchy: ceo <- vp <- dev <- intern and
+// ceo <- ops, where the ceo's manager 0 is nobody.
+func newEmpSession(t *testing.T) *session {
+	s := newSession(t, newTestEngine(t))
+	s.mustExec(
+		"CREATE TABLE emp (id INT, name TEXT, manager_id INT)",
+		"INSERT INTO emp VALUES (1, 'ceo', 0)",
+		"INSERT INTO emp VALUES (2, 'vp', 1)",
+		"INSERT INTO emp VALUES (3, 'dev', 2)",
+		"INSERT INTO emp VALUES (4, 'ops', 1)",
+		"INSERT INTO emp VALUES (5, 'intern', 3)",
+	)
+	return s
+}
+
+func TestCTE(t *testing.T) {
+	s := newEmpSession(t)
+	s.wantRows("WITH top AS (SELECT name FROM emp WHERE manager_id = 0) SELECT * FROM top", "[[ceo]]")
+	s.wantRows("WITH t (n) AS (SELECT name FROM emp WHERE id = 2) SELECT n FROM t", "[[vp]]")
+	// later CTEs see earlier ones
+	s.wantRows("WITH a AS (SELECT id FROM emp WHERE id > 3), b AS (SELECT id AS x FROM a WHERE id < 5) SELECT x FROM b", "[[4]]")
+	// the body of a non-recursive CTE sees the table it shadows
+	s.wantRows("WITH emp AS (SELECT id, name FROM emp WHERE id = 1) SELECT name FROM emp", "[[ceo]]")
+	// an inner WITH shadows an outer one
+	s.wantRows(`WITH t AS (SELECT id FROM emp WHERE id = 1)
+		SELECT id FROM t WHERE id IN (WITH t AS (SELECT manager_id AS id FROM emp WHERE id = 2) SELECT id FROM t)`, "[[1]]")
+	// a UNION runs once without RECURSIVE
+	s.wantRows("WITH t AS (SELECT id FROM emp WHERE id = 1 UNION SELECT id FROM emp WHERE id = 1) SELECT * FROM t", "[[1]]")
+}
+
+func TestCTE_Errors(t *testing.T) {
+	s := newEmpSession(t)
+	s.wantErr("WITH t (a, b) AS (SELECT name FROM emp) SELECT * FROM t", `WITH query "t" has 1 columns available but 2 columns specified`)
+	s.wantErr("WITH t AS (SELECT id FROM t) SELECT * FROM t", "table not found: t")
+	s.wantErr("WITH RECURSIVE t AS (SELECT id FROM t UNION SELECT id FROM emp) SELECT * FROM t",
+		`recursive reference to query "t" must not appear within its non-recursive term`)
+	s.wantErr("WITH RECURSIVE t AS (SELECT id FROM emp WHERE id = 1 UNION SELECT id, name FROM emp WHERE id IN (SELECT id FROM t)) SELECT * FROM t",
+		"each UNION query must have the same number of columns: 1 vs 2")
+}
+
+func TestCTE_Recursive(t *testing.T) {
+	s := newEmpSession(t)
+	// reports of vp, level by level
+	s.wantRows(`WITH RECURSIVE chain AS (SELECT * FROM emp WHERE id = 2
+		UNION ALL SELECT e.* FROM emp e JOIN chain c ON e.manager_id = c.id)
+		SELECT name FROM chain`, "[[vp] [dev] [intern]]")
+	s.wantRows(`WITH RECURSIVE chain AS (SELECT * FROM emp WHERE id = 1
+		UNION ALL SELECT e.* FROM emp e INNER JOIN chain c ON e.manager_id = c.id)
+		SELECT name FROM chain`, "[[ceo] [vp] [ops] [dev] [intern]]")
+	// managers of intern, through a subquery on the working table
+	s.wantRows(`WITH RECURSIVE up (id) AS (SELECT id FROM emp WHERE id = 5
+		UNION SELECT manager_id FROM emp WHERE id IN (SELECT id FROM up) AND manager_id > 0)
+		SELECT * FROM up`, "[[5] [3] [2] [1]]")
+	// each iteration sees only the rows of the one before
+	s.wantRows(`WITH RECURSIVE chain AS (SELECT * FROM emp WHERE id = 1
+		UNION ALL SELECT e.* FROM emp e JOIN chain c ON e.manager_id = c.id WHERE c.id = 1)
+		SELECT name FROM chain`, "[[ceo] [vp] [ops]]")
+}
+
+func TestCTE_RecursiveCycles(t *testing.T) {
+	s := newSession(t, newTestEngine(t))
+	s.mustExec(
+		"CREATE TABLE edge (src INT, dst INT)",
+		"INSERT INTO edge VALUES (1, 2)",
+		"INSERT INTO edge VALUES (2, 3)",
+		"INSERT INTO edge VALUES (3, 1)",
+	)
+	// UNION stops at the rows it has already produced
+	s.wantRows(`WITH RECURSIVE reach AS (SELECT 1 AS node
+		UNION SELECT e.dst FROM edge e JOIN reach r ON e.src = r.node)
+		SELECT * FROM reach`, "[[1] [2] [3]]")
+	s.wantErr(`WITH RECURSIVE reach AS (SELECT 1 AS node
+		UNION ALL SELECT e.dst FROM edge e JOIN reach r ON e.src = r.node)
+		SELECT * FROM reach`, "recursive query did not finish after 1000 iterations")
+}
+
+func TestCTE_RecursiveDepth(t *testing.T) {
+	s := newSession(t, newTestEngine(t))
+	// UNION runs for as long as every iteration adds a row
+	s.wantRows(`WITH RECURSIVE n AS (SELECT 1 AS i UNION SELECT i + 1 FROM n WHERE i < 1500)
+		SELECT i FROM n WHERE i > 1498`, "[[1499] [1500]]")
+	s.wantErr(`WITH RECURSIVE n AS (SELECT 1 AS i UNION ALL SELECT i + 1 FROM n WHERE i < 1500)
+		SELECT i FROM n WHERE i > 1498`, "recursive query did not finish after 1000 iterations")
+}
@@ -0,0 +1,487 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"justasimpletoydb/internal/catalog"
+)
+
+// Expression types beyond the storable catalog.ColumnType values.
+const (
+	typeUnknown catalog.ColumnType = -1 // NULL, or not known before execution
+	typeBool    catalog.ColumnType = -2
+)
+
+func typeString(t catalog.ColumnType) string {
+	switch t {
+	case catalog.TypeInt:
+		return "INT"
+	case catalog.TypeText:
+		return "TEXT"
+	case typeBool:
+		return "BOOLEAN"
+	default:
+		return "unknown"
+	}
+}
+
+// colRef names one column of a relation as seen by expressions.
+type colRef struct {
+	table string // table name or alias the column is reachable through
+	name  string
+	typ   catalog.ColumnType
+}
+
+// relation is an intermediate result: named columns and their rows.
+type relation struct {
+	cols []colRef
+	rows [][]any
+}
+
+func (r *relation) columnNames() []string {
+	names := make([]string, len(r.cols))
+	for i, c := range r.cols {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (r *relation) columnTypes() []string {
+	types := make([]string, len(r.cols))
+	for i, c := range r.cols {
+		types[i] = typeString(c.typ)
+	}
+	return types
+}
+
+// rowScope binds column references to the values of the current row.
+// Correlated subqueries see the row of the enclosing query through outer.
+type rowScope struct {
+	cols  []colRef
+	row   []any
+	outer *rowScope
+
+	pos      int   // position among the filtered rows, indexes window results
+	orderKey []any // ORDER BY key of the window being computed
+}
+
+func (s *rowScope) lookup(ref *ColumnRef) (any, error) {
+	for sc := s; sc != nil; sc = sc.outer {
+		idx, err := resolveColumn(sc.cols, ref)
+		if err != nil {
+			return nil, err
+		}
+		if idx >= 0 {
+			return sc.row[idx], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown column %q", ref.String())
+}
+
+// resolveColumn returns the position of ref in cols or -1 if it is not there.
+func resolveColumn(cols []colRef, ref *ColumnRef) (int, error) {
+	found := -1
+	for i, c := range cols {
+		if c.name != ref.Name || (ref.Table != "" && c.table != ref.Table) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("column reference %q is ambiguous", ref.String())
+		}
+		found = i
+	}
+	return found, nil
+}
+
+// execContext carries state shared by all parts of one statement execution.
+type execContext struct {
+	ex       *Executor
+	subplans map[Query]*subplan
+	ctes     *cteScope
+
+	windowValues map[*WindowFunc][]any
+	now          time.Time // statement start, returned by NOW()
+	params       *params   // values of a prepared statement's parameters
+}
+
+func newExecContext(ex *Executor) *execContext {
+	return &execContext{
+		ex:           ex,
+		subplans:     make(map[Query]*subplan),
+		windowValues: make(map[*WindowFunc][]any),
+		now:          time.Now(),
+		params:       ex.params,
+	}
+}
+
+// withFreshSubplans returns a context sharing ctx's state except for cached
+// subquery results, for re-running queries whose inputs have changed.
+func (ctx *execContext) withFreshSubplans() *execContext {
+	c := *ctx
+	c.subplans = make(map[Query]*subplan)
+	return &c
+}
+
+// eval computes the value of e for the row in scope. Boolean expressions
+// follow SQL three-valued logic: the result is true, false or nil (unknown).
+func (ctx *execContext) eval(e Expr, sc *rowScope) (any, error) {
+	switch n := e.(type) {
+	case *Literal:
+		return n.Value, nil
+
+	case *ColumnRef:
+		if sc == nil {
+			return nil, fmt.Errorf("unknown column %q", n.String())
+		}
+		return sc.lookup(n)
+
+	case *Param:
+		if ctx.params == nil || n.Index > len(ctx.params.values) {
+			return nil, fmt.Errorf("there is no parameter %s", n.String())
+		}
+		return ctx.params.values[n.Index-1], nil
+
+	case *UnaryExpr:
+		v, err := ctx.eval(n.Operand, sc)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, nil
+		}
+		switch n.Op {
+		case "NOT":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("argument of NOT must be boolean, got %s", typeName(v))
+			}
+			return !b, nil
+		case "-":
+			i, ok := v.(int)
+			if !ok {
+				return nil, fmt.Errorf("operator - expects INT, got %s", typeName(v))
+			}
+			return -i, nil
+		default:
+			return nil, fmt.Errorf("unsupported unary operator %s", n.Op)
+		}
+
+	case *BinaryExpr:
+		return ctx.evalBinary(n, sc)
+
+	case *IsNullExpr:
+		v, err := ctx.eval(n.Operand, sc)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != n.Not, nil
+
+	case *CaseExpr:
+		return ctx.evalCase(n, sc)
+
+	case *FuncCall:
+		return ctx.evalFunc(n, sc)
+
+	case *CastExpr:
+		return ctx.evalCast(n, sc)
+
+	case *InExpr:
+		return ctx.evalIn(n, sc)
+
+	case *ExistsExpr:
+		return ctx.evalExists(n, sc)
+
+	case *SubqueryExpr:
+		return ctx.evalScalarSubquery(n, sc)
+
+	case *WindowFunc:
+		values, ok := ctx.windowValues[n]
+		if !ok || sc == nil {
+			return nil, fmt.Errorf("window function %s is only allowed in the select list", n.String())
+		}
+		return values[sc.pos], nil
+
+	default:
+		return nil, fmt.Errorf("unsupported expression %T", e)
+	}
+}
+
+func (ctx *execContext) evalBinary(n *BinaryExpr, sc *rowScope) (any, error) {
+	switch n.Op {
+	case "AND", "OR":
+		l, err := ctx.evalBool(n.Left, sc)
+		if err != nil {
+			return nil, err
+		}
+		// short-circuit when the left side decides the result
+		if l != nil && *l == (n.Op == "OR") {
+			return *l, nil
+		}
+		r, err := ctx.evalBool(n.Right, sc)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && *r == (n.Op == "OR") {
+			return *r, nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return n.Op == "AND", nil
+	}
+
+	l, err := ctx.eval(n.Left, sc)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ctx.eval(n.Right, sc)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	switch n.Op {
+	case "+", "-", "*", "/", "%":
+		return arithmetic(n.Op, l, r)
+	case "||":
+		return toText(l) + toText(r), nil
+	}
+
+	cmp, err := compareValues(l, r)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case "=":
+		return cmp == 0, nil
+	case "<>", "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	default:
+		return nil, fmt.Errorf("unsupported operator %s", n.Op)
+	}
+}
+
+func arithmetic(op string, l, r any) (any, error) {
+	a, ok1 := l.(int)
+	b, ok2 := r.(int)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("operator %s expects INT operands, got %s and %s", op, typeName(l), typeName(r))
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	if op == "/" {
+		return a / b, nil
+	}
+	return a % b, nil
+}
+
+// toText renders a non-NULL value for string concatenation.
+func toText(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func (ctx *execContext) evalCase(n *CaseExpr, sc *rowScope) (any, error) {
+	var operand any
+	if n.Operand != nil {
+		v, err := ctx.eval(n.Operand, sc)
+		if err != nil {
+			return nil, err
+		}
+		operand = v
+	}
+	for _, w := range n.Whens {
+		var hit bool
+		if n.Operand != nil {
+			v, err := ctx.eval(w.Cond, sc)
+			if err != nil {
+				return nil, err
+			}
+			if operand != nil && v != nil {
+				cmp, err := compareValues(operand, v)
+				if err != nil {
+					return nil, err
+				}
+				hit = cmp == 0
+			}
+		} else {
+			var err error
+			hit, err = ctx.matches(w.Cond, sc)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if hit {
+			return ctx.eval(w.Result, sc)
+		}
+	}
+	if n.Else == nil {
+		return nil, nil
+	}
+	return ctx.eval(n.Else, sc)
+}
+
+// evalBool evaluates a boolean expression; nil means unknown.
+func (ctx *execContext) evalBool(e Expr, sc *rowScope) (*bool, error) {
+	v, err := ctx.eval(e, sc)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("expected boolean expression, got %s in %s", typeName(v), e.String())
+	}
+	return &b, nil
+}
+
+// matches reports whether a WHERE-like predicate holds; unknown counts as false.
+func (ctx *execContext) matches(e Expr, sc *rowScope) (bool, error) {
+	if e == nil {
+		return true, nil
+	}
+	b, err := ctx.evalBool(e, sc)
+	if err != nil {
+		return false, err
+	}
+	return b != nil && *b, nil
+}
+
+func (ctx *execContext) evalIn(n *InExpr, sc *rowScope) (any, error) {
+	left, err := ctx.eval(n.Left, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *bool
+	if n.Subquery != nil {
+		res, err = ctx.inSubquery(n, left, sc)
+	} else {
+		res, err = ctx.inList(n.List, left, sc)
+	}
+	if err != nil || res == nil {
+		return nil, err
+	}
+	return *res != n.Not, nil
+}
+
+func (ctx *execContext) inList(list []Expr, left any, sc *rowScope) (*bool, error) {
+	if left == nil {
+		return nil, nil
+	}
+	sawNull := false
+	for _, it := range list {
+		v, err := ctx.eval(it, sc)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			sawNull = true
+			continue
+		}
+		cmp, err := compareValues(left, v)
+		if err != nil {
+			return nil, err
+		}
+		if cmp == 0 {
+			t := true
+			return &t, nil
+		}
+	}
+	if sawNull {
+		return nil, nil
+	}
+	f := false
+	return &f, nil
+}
+
+// compareValues orders two non-NULL values of the same type.
+func compareValues(a, b any) (int, error) {
+	switch av := a.(type) {
+	case int:
+		bv, ok := b.(int)
+		if !ok {
+			break
+		}
+		switch {
+		case av < bv:
+			return -1, nil
+		case av > bv:
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			break
+		}
+		switch {
+		case av < bv:
+			return -1, nil
+		case av > bv:
+			return 1, nil
+		}
+		return 0, nil
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			break
+		}
+		switch {
+		case av == bv:
+			return 0, nil
+		case !av:
+			return -1, nil
+		}
+		return 1, nil
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(a), typeName(b))
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "NULL"
+	case int:
+		return "INT"
+	case string:
+		return "TEXT"
+	case bool:
+		return "BOOLEAN"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
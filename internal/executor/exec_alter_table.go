@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"fmt"
+	"slices"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
+)
+
+// ALTER TABLE actions.
+const (
+	AlterAddColumn = iota
+	AlterDropColumn
+	AlterRenameColumn
+	AlterRenameTable
+)
+
+type AlterTableStmt struct {
+	Table   string
+	Action  int
+	Column  catalog.Column // for AlterAddColumn
+	Default Expr           // DEFAULT of an added column, nil if not given
+	Name    string         // column to drop or rename
+	NewName string         // new column or table name
+}
+
+func (s *AlterTableStmt) Execute(ex *Executor) (*ExecResult, error) {
+	names := []string{s.Table}
+	if s.Action == AlterRenameTable {
+		names = append(names, s.NewName)
+		slices.Sort(names) // tables are locked in order
+	}
+	for _, name := range names {
+		if err := ex.lockTable(name, lock.Exclusive); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	switch s.Action {
+	case AlterAddColumn:
+		err = s.addColumn(ex)
+	case AlterDropColumn:
+		err = ex.engine.DropColumn(s.Table, s.Name)
+	case AlterRenameColumn:
+		err = ex.engine.RenameColumn(s.Table, s.Name, s.NewName, renameColumnRefs(s.Name, s.NewName))
+	case AlterRenameTable:
+		err = ex.engine.RenameTable(s.Table, s.NewName)
+	default:
+		err = fmt.Errorf("unsupported ALTER TABLE action %d", s.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{Message: fmt.Sprintf("Table %s altered", s.Table)}, nil
+}
+
+// addColumn evaluates the DEFAULT once; its value is what existing rows
+// read for the new column. New rows evaluate it again on insert.
+func (s *AlterTableStmt) addColumn(ex *Executor) error {
+	col := s.Column
+	if s.Default != nil {
+		ctx := newExecContext(ex)
+		if err := ctx.validateDefault(col, s.Default); err != nil {
+			return err
+		}
+		v, err := ctx.eval(s.Default, nil)
+		if err != nil {
+			return fmt.Errorf("default of column %s: %w", col.Name, err)
+		}
+		if err := checkValueType(col, v); err != nil {
+			return err
+		}
+		col.Missing = v
+		col.Default = s.Default.String()
+	}
+	return ex.engine.AddColumn(s.Table, col)
+}
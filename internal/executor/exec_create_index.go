@@ -2,16 +2,28 @@ package executor
 
 import (
 	"fmt"
+
+	"justasimpletoydb/internal/lock"
 )
 
 type CreateIndexStmt struct {
-	Name      string
-	TableName string
-	Column    string
+	Name        string
+	TableName   string
+	Column      string
+	Unique      bool
+	IfNotExists bool
 }
 
 func (s *CreateIndexStmt) Execute(ex *Executor) (*ExecResult, error) {
-	err := ex.engine.CreateIndex(s.TableName, s.Column, s.Name)
+	if err := ex.lockTable(s.TableName, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	if schema, err := ex.engine.Catalog.GetTable(s.TableName); err == nil && s.IfNotExists {
+		if _, exists := schema.Indexes[s.Name]; exists {
+			return &ExecResult{Message: fmt.Sprintf("Index %s already exists on table %s, skipping", s.Name, s.TableName)}, nil
+		}
+	}
+	err := ex.engine.CreateIndex(s.TableName, s.Column, s.Name, s.Unique)
 	if err != nil {
 		return nil, fmt.Errorf("create index: %w", err)
 	}
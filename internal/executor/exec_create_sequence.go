@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"fmt"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
+)
+
+type CreateSequenceStmt struct {
+	Name        string
+	Start       *int // nil for the default: 1 counting up, -1 counting down
+	Increment   int
+	IfNotExists bool
+}
+
+func (s *CreateSequenceStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if err := ex.lockTable(s.Name, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	if _, err := ex.engine.Catalog.GetSequence(s.Name); err == nil && s.IfNotExists {
+		return &ExecResult{Message: fmt.Sprintf("Sequence %s already exists, skipping", s.Name)}, nil
+	}
+	seq := &catalog.Sequence{Name: s.Name, Start: 1, Increment: s.Increment}
+	if s.Increment < 0 {
+		seq.Start = -1
+	}
+	if s.Start != nil {
+		seq.Start = *s.Start
+	}
+	if err := ex.engine.Catalog.CreateSequence(seq); err != nil {
+		return nil, fmt.Errorf("create sequence: %w", err)
+	}
+	return &ExecResult{Message: fmt.Sprintf("Sequence %s created", s.Name)}, nil
+}
+
+// nextval advances a sequence and remembers the value for currval.
+func (ctx *execContext) nextval(name string) (int, error) {
+	v, err := ctx.ex.engine.Catalog.NextVal(name)
+	if err != nil {
+		return 0, err
+	}
+	ctx.ex.currval[name] = v
+	return v, nil
+}
+
+// currval returns the value nextval last returned for a sequence through
+// this executor.
+func (ctx *execContext) currval(name string) (int, error) {
+	if _, err := ctx.ex.engine.Catalog.GetSequence(name); err != nil {
+		return 0, err
+	}
+	v, ok := ctx.ex.currval[name]
+	if !ok {
+		return 0, fmt.Errorf("currval of sequence %s is not yet defined", name)
+	}
+	return v, nil
+}
+
+// serialColumn turns col into a SERIAL column: it owns a sequence, which
+// the catalog creates along with the table, and defaults to its nextval.
+func serialColumn(table string, col *catalog.Column) {
+	col.Sequence = table + "_" + col.Name + "_seq"
+	col.Default = fmt.Sprintf("nextval(%s)", formatLiteral(col.Sequence))
+}
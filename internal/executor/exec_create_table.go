@@ -1,18 +1,69 @@
 package executor
 
-import "justasimpletoydb/internal/catalog"
+import (
+	"fmt"
+	"slices"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
+)
+
+// CheckDef is a CHECK constraint as written in CREATE TABLE.
+type CheckDef struct {
+	Name   string // empty to generate one
+	Column string // column the constraint was attached to, empty for a table constraint
+	Expr   Expr
+}
+
+// ForeignKeyDef is a REFERENCES column constraint or FOREIGN KEY table
+// constraint as written in CREATE TABLE.
+type ForeignKeyDef struct {
+	Name      string // empty to generate one
+	Column    string
+	RefTable  string
+	RefColumn string
+	OnDelete  catalog.FKAction
+}
+
+// ColumnDef is a column as written in CREATE TABLE.
+type ColumnDef struct {
+	Column  catalog.Column
+	Default Expr // nil without DEFAULT
+	Serial  bool // SERIAL: INT with a sequence of its own as default
+	Unique  bool
+}
 
 type CreateTableStmt struct {
-	Name    string
-	Columns []catalog.Column
+	Name        string
+	Columns     []ColumnDef
+	Checks      []CheckDef
+	ForeignKeys []ForeignKeyDef
+	IfNotExists bool
+	// Query is set for CREATE TABLE ... AS SELECT; the columns are then
+	// taken from its output and its rows are loaded into the new table.
+	Query Query
 }
 
 func (s *CreateTableStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if err := ex.lockTable(s.Name, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	if _, err := ex.engine.Catalog.GetTable(s.Name); err == nil && s.IfNotExists {
+		return &ExecResult{Message: fmt.Sprintf("Table %s already exists, skipping", s.Name)}, nil
+	}
+	if s.Query != nil {
+		return s.createAs(ex)
+	}
 	schema := &catalog.TableSchema{
 		Name:    s.Name,
-		Columns: s.Columns,
 		Indexes: make(map[string]*catalog.Index),
 	}
+	for _, def := range s.Columns {
+		schema.Columns = append(schema.Columns, def.Column)
+	}
+	if err := s.addConstraints(newExecContext(ex), schema); err != nil {
+		return nil, err
+	}
 	err := ex.engine.CreateTable(schema)
 	if err != nil {
 		return nil, err
@@ -22,3 +73,128 @@ func (s *CreateTableStmt) Execute(ex *Executor) (*ExecResult, error) {
 		Affected: 1,
 	}, nil
 }
+
+// addConstraints validates the DEFAULT and CHECK expressions and stores
+// their SQL text in the schema. UNIQUE columns get a unique index, which
+// starts out empty along with the table. Foreign keys are validated by the
+// catalog, which knows the referenced tables.
+func (s *CreateTableStmt) addConstraints(ctx *execContext, schema *catalog.TableSchema) error {
+	for i, def := range s.Columns {
+		col := &schema.Columns[i]
+		if def.Serial {
+			if def.Default != nil {
+				return fmt.Errorf("multiple default values specified for column %s", col.Name)
+			}
+			serialColumn(schema.Name, col)
+		}
+		if def.Default != nil {
+			if err := ctx.validateDefault(*col, def.Default); err != nil {
+				return err
+			}
+			col.Default = def.Default.String()
+		}
+		if def.Unique {
+			name := schema.Name + "_" + col.Name + "_key"
+			schema.Indexes[name] = &catalog.Index{Name: name, ColumnName: col.Name, Unique: true}
+		}
+	}
+	cols := tableCols(schema)
+	for _, def := range s.Checks {
+		name := def.Name
+		if name == "" {
+			name = checkName(schema.Name, def.Column, schema.Checks)
+		} else if slices.ContainsFunc(schema.Checks, func(c catalog.Check) bool { return c.Name == name }) {
+			return fmt.Errorf("constraint %s for relation %s already exists", name, schema.Name)
+		}
+		refs, err := ctx.validateCheck(name, def.Expr, cols)
+		if err != nil {
+			return err
+		}
+		schema.Checks = append(schema.Checks, catalog.Check{Name: name, Expr: def.Expr.String(), Columns: refs})
+	}
+	for _, def := range s.ForeignKeys {
+		name := def.Name
+		if name == "" {
+			name = fkeyName(schema, def.Column)
+		} else if hasConstraint(schema, name) {
+			return fmt.Errorf("constraint %s for relation %s already exists", name, schema.Name)
+		}
+		schema.ForeignKeys = append(schema.ForeignKeys, catalog.ForeignKey{
+			Name:      name,
+			Column:    def.Column,
+			RefTable:  def.RefTable,
+			RefColumn: def.RefColumn,
+			OnDelete:  def.OnDelete,
+		})
+	}
+	return nil
+}
+
+// createAs runs the query before creating the table, so a failing query
+// leaves nothing behind, and drops the table again if loading fails.
+func (s *CreateTableStmt) createAs(ex *Executor) (*ExecResult, error) {
+	ctx := newExecContext(ex)
+	if _, err := ctx.queryCols(s.Query); err != nil {
+		return nil, err
+	}
+	rel, err := s.Query.run(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := storedSchema(s.Name, rel.cols)
+	if err != nil {
+		return nil, err
+	}
+	if err := ex.engine.CreateTable(schema); err != nil {
+		return nil, err
+	}
+	if err := loadTable(ex, s.Name, rel.rows, ex.engine.DropTable); err != nil {
+		return nil, err
+	}
+	return &ExecResult{
+		Message:  fmt.Sprintf("SELECT %d", len(rel.rows)),
+		Affected: len(rel.rows),
+	}, nil
+}
+
+// storedSchema builds the schema of a table holding the output of a query.
+func storedSchema(name string, rel []colRef) (*catalog.TableSchema, error) {
+	cols := make([]catalog.Column, len(rel))
+	seen := make(map[string]struct{})
+	for i, c := range rel {
+		if _, dup := seen[c.name]; dup {
+			return nil, fmt.Errorf("column %s specified more than once, use an alias", c.name)
+		}
+		seen[c.name] = struct{}{}
+		switch c.typ {
+		case catalog.TypeInt, catalog.TypeText:
+		case typeUnknown:
+			return nil, fmt.Errorf("cannot infer the type of column %s, use CAST", c.name)
+		default:
+			return nil, fmt.Errorf("column %s has type %s, which cannot be stored", c.name, typeString(c.typ))
+		}
+		cols[i] = catalog.Column{Name: c.name, Type: c.typ}
+	}
+	return &catalog.TableSchema{
+		Name:    name,
+		Columns: cols,
+		Indexes: make(map[string]*catalog.Index),
+	}, nil
+}
+
+// loadTable inserts rows into a table just created, calling drop to remove
+// it again if that fails.
+func loadTable(ex *Executor, name string, rows [][]any, drop func(name string) error) error {
+	table, err := ex.openTable(name, lock.Exclusive)
+	if err == nil {
+		err = table.InsertRows(rows)
+		table.Close()
+	}
+	if err != nil {
+		if dropErr := drop(name); dropErr != nil {
+			return fmt.Errorf("%w (dropping %s also failed: %v)", err, name, dropErr)
+		}
+		return fmt.Errorf("load table %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package executor
+
+import (
+	"fmt"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
+	"justasimpletoydb/internal/storage"
+)
+
+// CreateViewStmt is "CREATE [MATERIALIZED] VIEW name [(columns)] AS query".
+// A view stores the text of its query, which runs whenever the view is
+// read; a materialized view stores the query's rows in a table of its own
+// until refreshed.
+type CreateViewStmt struct {
+	Name         string
+	Columns      []string // optional explicit column names
+	Query        Query
+	Materialized bool
+	IfNotExists  bool
+}
+
+func (s *CreateViewStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if err := ex.lockTable(s.Name, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	if _, err := ex.engine.Catalog.GetView(s.Name); err == nil && s.IfNotExists {
+		return &ExecResult{Message: fmt.Sprintf("View %s already exists, skipping", s.Name)}, nil
+	}
+	ctx := newExecContext(ex)
+	cols, err := ctx.queryCols(s.Query)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := renameViewCols(s.Name, s.Columns, cols); err != nil {
+		return nil, err
+	}
+	view := &catalog.View{
+		Name:         s.Name,
+		Query:        s.Query.String(),
+		Columns:      s.Columns,
+		Depends:      relationsOf(s.Query),
+		Materialized: s.Materialized,
+	}
+	if !s.Materialized {
+		if err := ex.engine.Catalog.CreateView(view); err != nil {
+			return nil, fmt.Errorf("create view: %w", err)
+		}
+		return &ExecResult{Message: fmt.Sprintf("View %s created", s.Name)}, nil
+	}
+
+	// like CREATE TABLE AS, the query runs before anything is created
+	rel, err := s.Query.run(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cols, err = renameViewCols(s.Name, s.Columns, rel.cols); err != nil {
+		return nil, err
+	}
+	schema, err := storedSchema(s.Name, cols)
+	if err != nil {
+		return nil, err
+	}
+	if err := ex.engine.CreateTable(schema); err != nil {
+		return nil, err
+	}
+	if err := ex.engine.Catalog.CreateView(view); err != nil {
+		if dropErr := ex.engine.DropTable(s.Name); dropErr != nil {
+			return nil, fmt.Errorf("create view: %w (dropping table %s also failed: %v)", err, s.Name, dropErr)
+		}
+		return nil, fmt.Errorf("create view: %w", err)
+	}
+	if err := loadTable(ex, s.Name, rel.rows, ex.engine.DropView); err != nil {
+		return nil, err
+	}
+	return &ExecResult{
+		Message:  fmt.Sprintf("SELECT %d", len(rel.rows)),
+		Affected: len(rel.rows),
+	}, nil
+}
+
+// RefreshViewStmt is "REFRESH MATERIALIZED VIEW name". The query runs
+// before the table is touched; its rows then replace the stored ones.
+type RefreshViewStmt struct {
+	Name string
+}
+
+func (s *RefreshViewStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if err := ex.lockTable(s.Name, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	view, err := ex.engine.Catalog.GetView(s.Name)
+	if err != nil || !view.Materialized {
+		return nil, fmt.Errorf("refresh: %s is not a materialized view", s.Name)
+	}
+	schema, err := ex.engine.Catalog.GetTable(s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("refresh: %w", err)
+	}
+	rel, err := newExecContext(ex).scanView(view)
+	if err != nil {
+		return nil, err
+	}
+	if len(rel.cols) != len(schema.Columns) {
+		return nil, fmt.Errorf("refresh: query of view %s returns %d columns, its table has %d", s.Name, len(rel.cols), len(schema.Columns))
+	}
+	for _, row := range rel.rows {
+		for i, v := range row {
+			if err := checkValueType(schema.Columns[i], v); err != nil {
+				return nil, fmt.Errorf("refresh: %w", err)
+			}
+		}
+	}
+
+	table, err := ex.openTable(s.Name, lock.Exclusive)
+	if err != nil {
+		return nil, err
+	}
+	defer table.Close()
+	old, err := table.ScanRows()
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]storage.TID, len(old))
+	for i, r := range old {
+		tids[i] = r.TID
+	}
+	if err := table.ReplaceRows(tids, rel.rows); err != nil {
+		return nil, err
+	}
+	return &ExecResult{
+		Message:  "REFRESH MATERIALIZED VIEW",
+		Affected: len(rel.rows),
+	}, nil
+}
@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"fmt"
+
+	"justasimpletoydb/internal/lock"
+)
+
+type DeleteStmt struct {
+	Table     string
+	Where     Expr         // nil deletes every row
+	Returning []SelectItem // nil without RETURNING; sees the deleted rows
+}
+
+// Execute finds and locks all matching rows, evaluates RETURNING over them
+// and plans the ON DELETE actions of the foreign keys referencing them
+// before deleting any, so an error in WHERE or RETURNING or a restricted
+// delete leaves every table unchanged.
+func (s *DeleteStmt) Execute(ex *Executor) (*ExecResult, error) {
+	schema, err := targetTable(ex, s.Table)
+	if err != nil {
+		return nil, err
+	}
+	ctx := newExecContext(ex)
+	cols := tableCols(schema)
+	if s.Where != nil {
+		if containsWindowFunc(s.Where) {
+			return nil, fmt.Errorf("window functions are not allowed in WHERE")
+		}
+		if err := ctx.checkExprs([]Expr{s.Where}, cols); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.checkReturning(s.Returning, cols); err != nil {
+		return nil, err
+	}
+
+	table, err := ex.openTable(s.Table, lock.IntentionExclusive)
+	if err != nil {
+		return nil, err
+	}
+	defer table.Close()
+	matched, err := ctx.lockRows(table, s.Table, func(row []any) (bool, error) {
+		return ctx.matches(s.Where, &rowScope{cols: cols, row: row})
+	}, lock.Block)
+	if err != nil {
+		return nil, err
+	}
+	deleted := make([][]any, len(matched))
+	for i, r := range matched {
+		deleted[i] = r.Values
+	}
+	refs := newRefActions(ctx, schema, table)
+	defer refs.close()
+	if err := refs.delete(schema, matched); err != nil {
+		return nil, err
+	}
+
+	res := &ExecResult{
+		Message:  fmt.Sprintf("DELETE %d", len(deleted)),
+		Affected: len(deleted),
+	}
+	if s.Returning != nil {
+		if err := ctx.returning(s.Returning, cols, deleted, res); err != nil {
+			return nil, err
+		}
+	}
+	if err := refs.apply(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
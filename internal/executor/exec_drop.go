@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"justasimpletoydb/internal/lock"
+)
+
+type DropTableStmt struct {
+	Name     string
+	IfExists bool
+}
+
+func (s *DropTableStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if err := ex.lockTable(s.Name, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	if _, err := ex.engine.Catalog.GetTable(s.Name); err != nil {
+		if s.IfExists {
+			return &ExecResult{Message: fmt.Sprintf("Table %s does not exist, skipping", s.Name)}, nil
+		}
+		return nil, fmt.Errorf("drop table: table %s not found", s.Name)
+	}
+	if err := ex.engine.DropTable(s.Name); err != nil {
+		return nil, err
+	}
+	return &ExecResult{Message: fmt.Sprintf("Table %s dropped", s.Name)}, nil
+}
+
+// DropViewStmt is "DROP [MATERIALIZED] VIEW [IF EXISTS] name". A
+// materialized view's table is dropped with it.
+type DropViewStmt struct {
+	Name         string
+	Materialized bool
+	IfExists     bool
+}
+
+func (s *DropViewStmt) Execute(ex *Executor) (*ExecResult, error) {
+	kind := "View"
+	if s.Materialized {
+		kind = "Materialized view"
+	}
+	if err := ex.lockTable(s.Name, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	view, err := ex.engine.Catalog.GetView(s.Name)
+	if err != nil || view.Materialized != s.Materialized {
+		if s.IfExists {
+			return &ExecResult{Message: fmt.Sprintf("%s %s does not exist, skipping", kind, s.Name)}, nil
+		}
+		return nil, fmt.Errorf("drop view: %s is not a %s", s.Name, strings.ToLower(kind))
+	}
+	if err := ex.engine.DropView(s.Name); err != nil {
+		return nil, err
+	}
+	return &ExecResult{Message: fmt.Sprintf("%s %s dropped", kind, s.Name)}, nil
+}
+
+type DropSequenceStmt struct {
+	Name     string
+	IfExists bool
+}
+
+func (s *DropSequenceStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if err := ex.lockTable(s.Name, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	if _, err := ex.engine.Catalog.GetSequence(s.Name); err != nil && s.IfExists {
+		return &ExecResult{Message: fmt.Sprintf("Sequence %s does not exist, skipping", s.Name)}, nil
+	}
+	if err := ex.engine.Catalog.DropSequence(s.Name); err != nil {
+		return nil, fmt.Errorf("drop sequence: %w", err)
+	}
+	delete(ex.currval, s.Name)
+	return &ExecResult{Message: fmt.Sprintf("Sequence %s dropped", s.Name)}, nil
+}
+
+// DropIndexStmt is "DROP INDEX [IF EXISTS] name [ON table]". Index names are
+// unique per table only, so the table may be left out when just one table
+// has an index of that name.
+type DropIndexStmt struct {
+	Name      string
+	TableName string // empty if not given
+	IfExists  bool
+}
+
+func (s *DropIndexStmt) Execute(ex *Executor) (*ExecResult, error) {
+	tableName := s.TableName
+	if tableName == "" {
+		tables := ex.engine.Catalog.TablesWithIndex(s.Name)
+		switch len(tables) {
+		case 0:
+		case 1:
+			tableName = tables[0]
+		default:
+			return nil, fmt.Errorf("drop index: index %s exists on tables %s, use DROP INDEX %s ON <table>", s.Name, strings.Join(tables, ", "), s.Name)
+		}
+	}
+
+	exists := false
+	if err := ex.lockTable(tableName, lock.Exclusive); err != nil {
+		return nil, err
+	}
+	if schema, err := ex.engine.Catalog.GetTable(tableName); err == nil {
+		_, exists = schema.Indexes[s.Name]
+	}
+	if !exists {
+		if s.IfExists {
+			return &ExecResult{Message: fmt.Sprintf("Index %s does not exist, skipping", s.Name)}, nil
+		}
+		if s.TableName != "" {
+			return nil, fmt.Errorf("drop index: index %s not found on table %s", s.Name, s.TableName)
+		}
+		return nil, fmt.Errorf("drop index: index %s not found", s.Name)
+	}
+
+	if err := ex.engine.DropIndex(tableName, s.Name); err != nil {
+		return nil, err
+	}
+	return &ExecResult{Message: fmt.Sprintf("Index %s dropped from table %s", s.Name, tableName)}, nil
+}
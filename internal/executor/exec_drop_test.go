@@ -0,0 +1,54 @@
+package executor_test
+
+import (
+	"os"
+	"testing"
+
+	"justasimpletoydb/internal/storage"
+)
+
+func TestDropIndex(t *testing.T) {
+	e := newTestEngine(t)
+	s := newSession(t, e)
+	s.mustExec("CREATE TABLE tags (id INT, name TEXT); CREATE UNIQUE INDEX tags_name ON tags (name); INSERT INTO tags VALUES (1, 'red')")
+	path := storage.IndexPath(e.DataDir, "tags", "tags_name")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected the index file: %v", err)
+	}
+	s.wantErr("INSERT INTO tags VALUES (2, 'red')", "duplicate key value violates unique constraint")
+
+	res := s.mustExec("DROP INDEX tags_name")
+	if res.Message != "Index tags_name dropped from table tags" {
+		t.Errorf("Unexpected message %q", res.Message)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the index file to be removed, got %v", err)
+	}
+	// the values are no longer unique, in this session and others
+	s.mustExec("INSERT INTO tags VALUES (2, 'red')")
+	newSession(t, e).mustExec("INSERT INTO tags VALUES (3, 'red')")
+	s.wantRows("SELECT id FROM tags WHERE name = 'red'", "[[1] [2] [3]]")
+	s.wantErr("DROP INDEX tags_name", "drop index: index tags_name not found")
+}
+
+func TestDropIndex_Missing(t *testing.T) {
+	s := setupSession(t, "CREATE TABLE tags (id INT, name TEXT); CREATE INDEX tags_id ON tags (id)")
+	s.wantErr("DROP INDEX nope", "drop index: index nope not found")
+	s.wantErr("DROP INDEX nope ON tags", "drop index: index nope not found on table tags")
+	s.wantErr("DROP INDEX tags_id ON missing", "drop index: index tags_id not found on table missing")
+	if res := s.mustExec("DROP INDEX IF EXISTS nope"); res.Message != "Index nope does not exist, skipping" {
+		t.Errorf("Unexpected message %q", res.Message)
+	}
+	// the index on the table is untouched
+	s.mustExec("DROP INDEX tags_id ON tags")
+}
+
+func TestDropIndex_SameNameOnTwoTables(t *testing.T) {
+	s := setupSession(t, `CREATE TABLE a (id INT); CREATE INDEX by_id ON a (id);
+CREATE TABLE b (id INT); CREATE INDEX by_id ON b (id)`)
+	s.wantErr("DROP INDEX by_id", "drop index: index by_id exists on tables a, b, use DROP INDEX by_id ON <table>")
+	s.mustExec("DROP INDEX by_id ON a")
+	// just one table is left with the name
+	s.mustExec("DROP INDEX by_id")
+	s.wantErr("DROP INDEX by_id ON b", "drop index: index by_id not found on table b")
+}
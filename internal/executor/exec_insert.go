@@ -1,23 +1,236 @@
 package executor
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
+	"justasimpletoydb/internal/storage"
+)
 
 type InsertStmt struct {
-	Table  string
-	Values []any
+	Table   string
+	Columns []string // target columns, nil for the table's columns in order
+	// Rows are the VALUES lists, one expression per target column;
+	// DefaultValue asks for the column's default.
+	Rows [][]Expr
+	// Query is set for INSERT ... SELECT instead of Rows.
+	Query      Query
+	OnConflict *OnConflict  // nil without ON CONFLICT
+	Returning  []SelectItem // nil without RETURNING
 }
 
+// Execute builds and checks every row, including its foreign keys, and
+// evaluates RETURNING before writing, then stores them with a single call
+// into the table, so a bad row leaves the table unchanged.
 func (s *InsertStmt) Execute(ex *Executor) (*ExecResult, error) {
-	table, err := ex.engine.GetTable(s.Table)
+	schema, err := targetTable(ex, s.Table)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := targetColumns(schema.Columns, s.Table, s.Columns)
+	if err != nil {
+		return nil, err
+	}
+	ctx := newExecContext(ex)
+	rules, err := ctx.rulesFor(schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.checkReturning(s.Returning, rules.cols); err != nil {
+		return nil, err
+	}
+	if s.OnConflict != nil {
+		if err := s.OnConflict.check(ctx, schema, rules.cols); err != nil {
+			return nil, err
+		}
+	}
+
+	var values [][]any
+	if s.Query != nil {
+		values, err = s.queryValues(ctx, schema, targets)
+	} else {
+		values, err = s.rowValues(ctx, schema, targets)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]any, len(values))
+	for n, vals := range values {
+		row := make([]any, len(schema.Columns))
+		given := make([]bool, len(schema.Columns))
+		for i, v := range vals {
+			if _, ok := v.(*DefaultValue); ok {
+				continue
+			}
+			row[targets[i]] = v
+			given[targets[i]] = true
+		}
+		for i := range row {
+			if given[i] {
+				continue
+			}
+			if row[i], err = ctx.defaultValue(rules, i); err != nil {
+				return nil, err
+			}
+		}
+		rows[n] = row
+	}
+
+	table, err := ex.openTable(s.Table, lock.IntentionExclusive)
+	if err != nil {
+		return nil, err
+	}
+	defer table.Close()
+
+	// without ON CONFLICT every row is inserted and nothing replaced
+	var replaced []storage.Row
+	var updates [][]any
+	if s.OnConflict != nil {
+		rows, replaced, updates, err = s.OnConflict.resolve(ctx, rules, table, rows)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, row := range rows {
+			if err := ctx.checkRow(rules, row); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	refs := newRefActions(ctx, schema, table)
+	defer refs.close()
+	tids := make([]storage.TID, len(replaced))
+	old := make([][]any, len(replaced))
+	for i, r := range replaced {
+		tids[i], old[i] = r.TID, r.Values
+	}
+	refs.rewrite(tids, updates)
+	if err := refs.checkReferences(schema, rows); err != nil {
+		return nil, err
+	}
+	if err := refs.removed(schema, old, rows, false); err != nil {
+		return nil, err
+	}
+	res := &ExecResult{
+		Message:  fmt.Sprintf("INSERT 0 %d", len(rows)),
+		Affected: len(rows),
+	}
+	if s.Returning != nil {
+		if err := ctx.returning(s.Returning, rules.cols, rows, res); err != nil {
+			return nil, err
+		}
+	}
+	if err := table.ReplaceRows(tids, rows); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// rowValues evaluates the VALUES lists. Values for columns that take their
+// default are left as *DefaultValue.
+func (s *InsertStmt) rowValues(ctx *execContext, schema *catalog.TableSchema, targets []int) ([][]any, error) {
+	var exprs []Expr
+	for _, r := range s.Rows {
+		if len(r) != len(s.Rows[0]) {
+			return nil, fmt.Errorf("VALUES lists must all be the same length")
+		}
+		exprs = append(exprs, r...)
+	}
+	if err := checkTargetCount(len(s.Rows[0]), targets, s.Columns); err != nil {
+		return nil, err
+	}
+	if err := ctx.checkExprs(exprs, nil); err != nil {
+		return nil, err
+	}
+
+	values := make([][]any, len(s.Rows))
+	for n, r := range s.Rows {
+		vals := make([]any, len(r))
+		for i, e := range r {
+			if d, ok := e.(*DefaultValue); ok {
+				vals[i] = d
+				continue
+			}
+			v, err := ctx.eval(e, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkValueType(schema.Columns[targets[i]], v); err != nil {
+				return nil, err
+			}
+			vals[i] = v
+		}
+		values[n] = vals
+	}
+	return values, nil
+}
+
+// queryValues runs the query of INSERT ... SELECT, checking its column
+// types against the target columns before reading any rows.
+func (s *InsertStmt) queryValues(ctx *execContext, schema *catalog.TableSchema, targets []int) ([][]any, error) {
+	cols, err := ctx.queryCols(s.Query)
 	if err != nil {
-		return nil, fmt.Errorf("table not found: %s", s.Table)
+		return nil, err
+	}
+	if err := checkTargetCount(len(cols), targets, s.Columns); err != nil {
+		return nil, err
+	}
+	for i, c := range cols {
+		col := schema.Columns[targets[i]]
+		if c.typ != typeUnknown && c.typ != col.Type {
+			return nil, fmt.Errorf("column %s is of type %s but expression is of type %s", col.Name, typeString(col.Type), typeString(c.typ))
+		}
 	}
-	err = table.InsertRow(s.Values)
+	rel, err := s.Query.run(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	return &ExecResult{
-		Message:  "OK",
-		Affected: 1,
-	}, nil
+	for _, row := range rel.rows {
+		for i, v := range row {
+			if err := checkValueType(schema.Columns[targets[i]], v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rel.rows, nil
+}
+
+// checkTargetCount compares the number of values per row with the target
+// columns. Without a column list, trailing columns may be left out.
+func checkTargetCount(n int, targets []int, columns []string) error {
+	if n > len(targets) {
+		return fmt.Errorf("INSERT has more expressions than target columns")
+	}
+	if len(columns) > 0 && n < len(targets) {
+		return fmt.Errorf("INSERT has more target columns than expressions")
+	}
+	return nil
+}
+
+// targetColumns maps the column list of an INSERT to positions in the
+// table. An empty list means all columns in table order.
+func targetColumns(cols []catalog.Column, table string, names []string) ([]int, error) {
+	if len(names) == 0 {
+		targets := make([]int, len(cols))
+		for i := range targets {
+			targets[i] = i
+		}
+		return targets, nil
+	}
+	targets := make([]int, len(names))
+	for i, name := range names {
+		idx := slices.IndexFunc(cols, func(c catalog.Column) bool { return c.Name == name })
+		if idx < 0 {
+			return nil, fmt.Errorf("column %s of relation %s does not exist", name, table)
+		}
+		if slices.Contains(targets[:i], idx) {
+			return nil, fmt.Errorf("column %s specified more than once", name)
+		}
+		targets[i] = idx
+	}
+	return targets, nil
 }
@@ -0,0 +1,69 @@
+package executor_test
+
+import "testing"
+
+const parcelsSchema = `CREATE TABLE parcels (id INT UNIQUE, dest TEXT, weight INT DEFAULT 1, CHECK (weight > 0));
+INSERT INTO parcels VALUES (1, 'oslo', 5)`
+
+func TestInsert_MultiRow(t *testing.T) {
+	s := setupSession(t, parcelsSchema)
+	res := s.mustExec("INSERT INTO parcels VALUES (2, 'rome', 3), (3, 'lima', 2), (4, 'kiev', 7)")
+	if res.Message != "INSERT 0 3" || res.Affected != 3 {
+		t.Errorf("Expected INSERT 0 3 with 3 affected, got %q with %d", res.Message, res.Affected)
+	}
+	s.wantRows("SELECT id, dest, weight FROM parcels", "[[1 oslo 5] [2 rome 3] [3 lima 2] [4 kiev 7]]")
+	// a column list and DEFAULT apply to every row
+	s.wantRows("INSERT INTO parcels (dest, id) VALUES ('baku', 5), ('doha', 6) RETURNING id, dest, weight", "[[5 baku 1] [6 doha 1]]")
+	s.wantRows("INSERT INTO parcels VALUES (7, 'pisa', DEFAULT), (8, 'nice', 4) RETURNING weight", "[[1] [4]]")
+	s.wantErr("INSERT INTO parcels VALUES (9, 'oslo'), (10)", "VALUES lists must all be the same length")
+	s.wantErr("INSERT INTO parcels (id) VALUES (9, 'oslo'), (10, 'rome')", "INSERT has more expressions than target columns")
+}
+
+func TestInsert_MultiRowFailureLeavesNone(t *testing.T) {
+	s := setupSession(t, parcelsSchema)
+	// the bad row comes last, after rows that were fine on their own
+	s.wantErr("INSERT INTO parcels VALUES (2, 'rome', 3), (3, 'lima', 'heavy')", "column weight is of type INT but expression is of type TEXT")
+	s.wantErr("INSERT INTO parcels VALUES (2, 'rome', 3), (3, 'lima', 0)", "violates check constraint")
+	s.wantErr("INSERT INTO parcels VALUES (2, 'rome', 3), (1, 'lima', 2)", "duplicate key value violates unique constraint")
+	s.wantErr("INSERT INTO parcels VALUES (2, 'rome', 3), (2, 'lima', 2)", "duplicate key value violates unique constraint")
+	s.wantErr("INSERT INTO parcels VALUES (2, 'rome', 3), (3, 'lima', 1 / 0)", "division by zero")
+	s.wantRows("SELECT id, dest, weight FROM parcels", "[[1 oslo 5]]")
+	// the keys of the failed rows are free
+	s.wantRows("INSERT INTO parcels VALUES (2, 'rome', 3), (3, 'lima', 2) RETURNING id", "[[2] [3]]")
+}
+
+func TestInsert_Select(t *testing.T) {
+	s := setupSession(t, parcelsSchema+`;
+CREATE TABLE orders (ref INT, city TEXT, kg INT);
+INSERT INTO orders VALUES (10, 'rome', 2), (11, 'lima', 4), (12, 'oslo', 9)`)
+	res := s.mustExec("INSERT INTO parcels SELECT ref, city, kg FROM orders WHERE kg < 5")
+	if res.Message != "INSERT 0 2" || res.Affected != 2 {
+		t.Errorf("Expected INSERT 0 2 with 2 affected, got %q with %d", res.Message, res.Affected)
+	}
+	s.wantRows("SELECT id, dest, weight FROM parcels", "[[1 oslo 5] [10 rome 2] [11 lima 4]]")
+	// a column list, with defaults for the other columns
+	s.wantRows("INSERT INTO parcels (id, dest) SELECT ref + 10, city FROM orders WHERE ref = 12 RETURNING id, dest, weight", "[[22 oslo 1]]")
+	// no rows is not an error
+	s.wantRows("INSERT INTO parcels SELECT ref, city, kg FROM orders WHERE kg > 100 RETURNING id", "[]")
+	// the query reads the table before any row is written to it
+	s.wantRows("INSERT INTO parcels SELECT id + 100, dest, weight FROM parcels RETURNING id", "[[101] [110] [111] [122]]")
+	s.wantRows("SELECT id FROM parcels", "[[1] [10] [11] [22] [101] [110] [111] [122]]")
+
+	s.wantErr("INSERT INTO parcels (id) SELECT ref, city FROM orders", "INSERT has more expressions than target columns")
+	s.wantErr("INSERT INTO parcels (id, dest) SELECT ref FROM orders", "INSERT has more target columns than expressions")
+	s.wantErr("INSERT INTO parcels SELECT city, ref FROM orders", "column id is of type INT but expression is of type TEXT")
+	s.wantErr("INSERT INTO parcels SELECT ref FROM missing", "table not found: missing")
+}
+
+func TestInsert_SelectFailureLeavesNone(t *testing.T) {
+	s := setupSession(t, parcelsSchema+`;
+CREATE TABLE orders (ref INT, city TEXT, kg INT);
+INSERT INTO orders VALUES (10, 'rome', 2), (11, 'lima', 4), (1, 'oslo', 9), (12, 'kiev', 0)`)
+	// the third row of the query takes a key already in the table
+	s.wantErr("INSERT INTO parcels SELECT ref, city, kg FROM orders WHERE ref <> 12", "duplicate key value violates unique constraint")
+	// the fourth fails the check
+	s.wantErr("INSERT INTO parcels SELECT ref + 100, city, kg FROM orders", "violates check constraint")
+	// two rows of the query take the same key
+	s.wantErr("INSERT INTO parcels (id, dest) SELECT 50, city FROM orders", "duplicate key value violates unique constraint")
+	s.wantRows("SELECT id, dest, weight FROM parcels", "[[1 oslo 5]]")
+}
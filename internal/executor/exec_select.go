@@ -2,60 +2,426 @@ package executor
 
 import (
 	"fmt"
+	"strings"
+
+	"justasimpletoydb/internal/lock"
 )
 
-type Condition struct {
-	Column   string
-	Operator string
-	Value    any
+// SelectItem is one entry of the select list: either "*" / "t.*" or an expression.
+type SelectItem struct {
+	Star      bool
+	StarTable string // qualifier of "t.*", empty for plain "*"
+	Expr      Expr
+	Alias     string
+}
+
+func (it SelectItem) String() string {
+	if it.Star {
+		if it.StarTable != "" {
+			return it.StarTable + ".*"
+		}
+		return "*"
+	}
+	if it.Alias != "" {
+		return it.Expr.String() + " AS " + it.Alias
+	}
+	return it.Expr.String()
+}
+
+// TableRef is a table in the FROM clause, optionally aliased, and the
+// tables joined to it.
+type TableRef struct {
+	Name  string
+	Alias string
+	Joins []*Join
+}
+
+// Join is an "[INNER] JOIN table ON condition" following a FROM table.
+type Join struct {
+	Table *TableRef
+	On    Expr
+}
+
+func (j *Join) String() string {
+	return "JOIN " + j.Table.String() + " ON " + j.On.String()
+}
+
+// tables lists r and the tables joined to it.
+func (r *TableRef) tables() []*TableRef {
+	out := []*TableRef{r}
+	for _, j := range r.Joins {
+		out = append(out, j.Table)
+	}
+	return out
+}
+
+// binding is the name columns of the table are qualified with.
+func (r *TableRef) binding() string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+	return r.Name
+}
+
+func (r *TableRef) String() string {
+	s := r.Name
+	if r.Alias != "" {
+		s += " " + r.Alias
+	}
+	for _, j := range r.Joins {
+		s += " " + j.String()
+	}
+	return s
 }
 
 type SelectStmt struct {
-	Table   string
-	Columns []string
-	Where   *Condition // nil if no WHERE
+	With          []*CTE // WITH clause, evaluated before the query
+	WithRecursive bool
+	Distinct      bool
+	Items         []SelectItem
+	From          *TableRef // nil for SELECT without FROM
+	Where         Expr      // nil if no WHERE
+	Locking       *Locking  // nil without FOR UPDATE
+}
+
+func (s *SelectStmt) String() string {
+	items := make([]string, len(s.Items))
+	for i, it := range s.Items {
+		items[i] = it.String()
+	}
+	var b strings.Builder
+	b.WriteString(withString(s.WithRecursive, s.With))
+	b.WriteString("SELECT ")
+	if s.Distinct {
+		b.WriteString("DISTINCT ")
+	}
+	b.WriteString(strings.Join(items, ", "))
+	if s.From != nil {
+		b.WriteString(" FROM ")
+		b.WriteString(s.From.String())
+	}
+	if s.Where != nil {
+		b.WriteString(" WHERE ")
+		b.WriteString(s.Where.String())
+	}
+	if s.Locking != nil {
+		b.WriteString(" ")
+		b.WriteString(s.Locking.String())
+	}
+	return b.String()
 }
 
 func (s *SelectStmt) Execute(ex *Executor) (*ExecResult, error) {
-	table, err := ex.engine.GetTable(s.Table)
+	ctx := newExecContext(ex)
+	if _, err := ctx.queryCols(s); err != nil {
+		return nil, err
+	}
+	rel, err := s.run(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("table not found: %s", s.Table)
+		return nil, err
 	}
+	return &ExecResult{
+		Columns:  rel.columnNames(),
+		Types:    rel.columnTypes(),
+		Rows:     rel.rows,
+		Affected: 0,
+		Message:  "OK",
+	}, nil
+}
 
-	rows, err := table.ReadAllRows()
+// exprs lists the expressions of the statement, used when analyzing subqueries.
+func (s *SelectStmt) exprs() []Expr {
+	out := make([]Expr, 0, len(s.Items)+1)
+	for _, it := range s.Items {
+		if it.Expr != nil {
+			out = append(out, it.Expr)
+		}
+	}
+	if s.From != nil {
+		for _, j := range s.From.Joins {
+			out = append(out, j.On)
+		}
+	}
+	if s.Where != nil {
+		out = append(out, s.Where)
+	}
+	return out
+}
+
+// run evaluates the query. outer is the row of the enclosing query when
+// s is a correlated subquery, nil otherwise.
+func (s *SelectStmt) run(ctx *execContext, outer *rowScope) (*relation, error) {
+	leave, err := ctx.enterWith(s.WithRecursive, s.With)
 	if err != nil {
 		return nil, err
 	}
-	colIndexes, colNames, err := table.ResolveColumns(s.Columns)
-
-	result := make([][]any, 0, len(rows))
-	for _, row := range rows {
+	defer leave()
 
-		// Handle conditions
-		include := true
-		if s.Where != nil {
-			idx, err := table.ResolveColumn(s.Where.Column)
-			if err != nil {
-				return nil, err
+	if containsWindowFunc(s.Where) {
+		return nil, fmt.Errorf("window functions are not allowed in WHERE")
+	}
+	if s.From != nil {
+		for _, j := range s.From.Joins {
+			if containsWindowFunc(j.On) {
+				return nil, fmt.Errorf("window functions are not allowed in JOIN conditions")
 			}
-			include = row[idx] == s.Where.Value
+		}
+	}
+
+	// FOR UPDATE matches the rows as it locks them
+	var src *relation
+	where := s.Where
+	if s.Locking != nil && s.From != nil {
+		src, err = ctx.scanLocked(s.From, s.Where, outer, s.Locking.Wait)
+		where = nil
+	} else {
+		src, err = ctx.scan(s.From, outer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cols, err := ctx.outputCols(s, src.cols)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := make([]*rowScope, 0, len(src.rows))
+	for _, row := range src.rows {
+		sc := &rowScope{cols: src.cols, row: row, outer: outer, pos: len(scopes)}
+
+		include, err := ctx.matches(where, sc)
+		if err != nil {
+			return nil, err
 		}
 		if !include {
 			continue
 		}
+		scopes = append(scopes, sc)
+	}
 
-		// Handle selecting specific columns
-		selected := make([]any, len(colIndexes))
-		for i, idx := range colIndexes {
-			selected[i] = row[idx]
+	// window functions see all filtered rows; output follows the window order
+	if funcs := windowFuncsOf(s.Items); len(funcs) > 0 {
+		order, err := ctx.computeWindows(funcs, scopes)
+		if err != nil {
+			return nil, err
+		}
+		sorted := make([]*rowScope, len(order))
+		for i, idx := range order {
+			sorted[i] = scopes[idx]
 		}
+		scopes = sorted
+	}
 
+	result := make([][]any, 0, len(scopes))
+	seen := make(map[string]struct{})
+	for _, sc := range scopes {
+		selected, err := s.project(ctx, sc)
+		if err != nil {
+			return nil, err
+		}
+		if s.Distinct {
+			key := rowKey(selected)
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+		}
 		result = append(result, selected)
 	}
-	return &ExecResult{
-		Columns:  colNames,
-		Rows:     result,
-		Affected: 0,
-		Message:  "OK",
-	}, nil
+	return &relation{cols: cols, rows: result}, nil
+}
+
+// outputCols names and types the result columns. Names are the alias if
+// given, else the column name, else the expression text.
+func (ctx *execContext) outputCols(s *SelectStmt, src []colRef) ([]colRef, error) {
+	var cols []colRef
+	for _, it := range s.Items {
+		if it.Star {
+			matched := false
+			for _, c := range src {
+				if it.StarTable == "" || it.StarTable == c.table {
+					cols = append(cols, colRef{name: c.name, typ: c.typ})
+					matched = true
+				}
+			}
+			if it.StarTable != "" && !matched {
+				return nil, fmt.Errorf("missing FROM-clause entry for table %q", it.StarTable)
+			}
+			continue
+		}
+		cols = append(cols, colRef{name: itemName(it), typ: ctx.exprType(it.Expr, src)})
+	}
+	return cols, nil
+}
+
+func itemName(it SelectItem) string {
+	if it.Alias != "" {
+		return it.Alias
+	}
+	if ref, ok := it.Expr.(*ColumnRef); ok {
+		return ref.Name
+	}
+	return it.Expr.String()
+}
+
+func (s *SelectStmt) project(ctx *execContext, sc *rowScope) ([]any, error) {
+	selected := make([]any, 0, len(s.Items))
+	for _, it := range s.Items {
+		if it.Star {
+			for i, c := range sc.cols {
+				if it.StarTable == "" || it.StarTable == c.table {
+					selected = append(selected, sc.row[i])
+				}
+			}
+			continue
+		}
+		v, err := ctx.eval(it.Expr, sc)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, v)
+	}
+	return selected, nil
+}
+
+// sourceCols returns the columns a FROM entry exposes, without reading rows.
+// CTEs in scope take precedence over views and catalog tables.
+func (ctx *execContext) sourceCols(ref *TableRef) ([]colRef, error) {
+	if ref == nil {
+		return nil, nil
+	}
+	var cols []colRef
+	seen := make(map[string]bool)
+	for _, t := range ref.tables() {
+		if seen[t.binding()] {
+			return nil, fmt.Errorf("table name %q specified more than once", t.binding())
+		}
+		seen[t.binding()] = true
+		tcols, err := ctx.tableCols(t)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, tcols...)
+	}
+	return cols, nil
+}
+
+// tableCols returns the columns of a single FROM table, ignoring its joins.
+func (ctx *execContext) tableCols(ref *TableRef) ([]colRef, error) {
+	if st := ctx.lookupCTE(ref.Name); st != nil {
+		cols, err := ctx.cteCols(st)
+		if err != nil {
+			return nil, err
+		}
+		return rebind(cols, ref.binding()), nil
+	}
+	if view := ctx.plainView(ref.Name); view != nil {
+		cols, err := ctx.viewCols(view)
+		if err != nil {
+			return nil, err
+		}
+		return rebind(cols, ref.binding()), nil
+	}
+	if err := ctx.ex.lockTable(ref.Name, lock.IntentionShared); err != nil {
+		return nil, err
+	}
+	schema, err := ctx.ex.engine.Catalog.GetTable(ref.Name)
+	if err != nil {
+		return nil, fmt.Errorf("table not found: %s", ref.Name)
+	}
+	cols := make([]colRef, len(schema.Columns))
+	for i, c := range schema.Columns {
+		cols[i] = colRef{table: ref.binding(), name: c.Name, typ: c.Type}
+	}
+	return cols, nil
+}
+
+// scan reads all rows of a FROM entry, joined with the tables joined to it.
+// A missing FROM yields a single empty row.
+func (ctx *execContext) scan(ref *TableRef, outer *rowScope) (*relation, error) {
+	if ref == nil {
+		return &relation{rows: [][]any{{}}}, nil
+	}
+	if len(ref.Joins) > 0 {
+		// rejects joined tables bound to the same name
+		if _, err := ctx.sourceCols(ref); err != nil {
+			return nil, err
+		}
+	}
+	rel, err := ctx.scanTable(ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range ref.Joins {
+		right, err := ctx.scanTable(j.Table)
+		if err != nil {
+			return nil, err
+		}
+		if rel, err = ctx.join(rel, right, j.On, outer); err != nil {
+			return nil, err
+		}
+	}
+	return rel, nil
+}
+
+// join pairs every row of left with every row of right and keeps the
+// pairs for which on holds.
+func (ctx *execContext) join(left, right *relation, on Expr, outer *rowScope) (*relation, error) {
+	cols := append(append([]colRef{}, left.cols...), right.cols...)
+	out := &relation{cols: cols}
+	for _, l := range left.rows {
+		for _, r := range right.rows {
+			row := append(append(make([]any, 0, len(cols)), l...), r...)
+			ok, err := ctx.matches(on, &rowScope{cols: cols, row: row, outer: outer})
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				out.rows = append(out.rows, row)
+			}
+		}
+	}
+	return out, nil
+}
+
+// scanTable reads all rows of a single FROM table, ignoring its joins.
+func (ctx *execContext) scanTable(ref *TableRef) (*relation, error) {
+	if st := ctx.lookupCTE(ref.Name); st != nil {
+		if st.rel == nil {
+			return nil, fmt.Errorf("recursive reference to query %q must not appear within its non-recursive term", ref.Name)
+		}
+		return &relation{cols: rebind(st.rel.cols, ref.binding()), rows: st.rel.rows}, nil
+	}
+	if view := ctx.plainView(ref.Name); view != nil {
+		rel, err := ctx.scanView(view)
+		if err != nil {
+			return nil, err
+		}
+		return &relation{cols: rebind(rel.cols, ref.binding()), rows: rel.rows}, nil
+	}
+	cols, err := ctx.tableCols(ref)
+	if err != nil {
+		return nil, err
+	}
+	table, err := ctx.ex.openTable(ref.Name, lock.IntentionShared)
+	if err != nil {
+		return nil, err
+	}
+	defer table.Close()
+
+	rows, err := table.ReadAllRows()
+	if err != nil {
+		return nil, err
+	}
+	return &relation{cols: cols, rows: rows}, nil
+}
+
+// rebind qualifies cols with the given table name or alias.
+func rebind(cols []colRef, table string) []colRef {
+	out := make([]colRef, len(cols))
+	for i, c := range cols {
+		out[i] = colRef{table: table, name: c.name, typ: c.typ}
+	}
+	return out
 }
@@ -0,0 +1,100 @@
+package executor_test
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newDeptSession adds departments headed by emp rows to newEmpSession;
+// department 30 has no head.
+func newDeptSession(t *testing.T) *session {
+	s := newEmpSession(t)
+	s.mustExec(
+		"CREATE TABLE dept (id INT, title TEXT, head INT)",
+		"INSERT INTO dept VALUES (10, 'eng', 2)",
+		"INSERT INTO dept VALUES (20, 'ops', 4)",
+		"INSERT INTO dept VALUES (30, 'empty', 0)",
+	)
+	return s
+}
+
+func TestSelect_Join(t *testing.T) {
+	s := newDeptSession(t)
+	s.wantRows("SELECT d.title, e.name FROM dept d JOIN emp e ON d.head = e.id", "[[eng vp] [ops ops]]")
+	s.wantRows("SELECT title, name FROM dept INNER JOIN emp ON head = emp.id WHERE title = 'ops'", "[[ops ops]]")
+	s.wantRows("SELECT d.* FROM dept d JOIN emp e ON d.head = e.id WHERE e.name = 'vp'", "[[10 eng 2]]")
+	// every pair, as a cross join
+	s.wantRows("SELECT d.id, e.id FROM dept d JOIN emp e ON e.id > 4", "[[10 5] [20 5] [30 5]]")
+}
+
+func TestSelect_JoinSelf(t *testing.T) {
+	s := newDeptSession(t)
+	s.wantRows("SELECT e.name, m.name FROM emp e JOIN emp m ON e.manager_id = m.id WHERE m.id = 1", "[[vp ceo] [ops ceo]]")
+	s.wantErr("SELECT name FROM emp e JOIN emp m ON id = 1", `column reference "id" is ambiguous`)
+	s.wantErr("SELECT * FROM emp JOIN emp ON emp.id = emp.manager_id", `table name "emp" specified more than once`)
+}
+
+func TestSelect_JoinChain(t *testing.T) {
+	s := newDeptSession(t)
+	// the second ON sees the columns of both earlier tables
+	s.wantRows(`SELECT d.title, h.name, m.name FROM dept d
+		JOIN emp h ON d.head = h.id JOIN emp m ON h.manager_id = m.id`, "[[eng vp ceo] [ops ops ceo]]")
+	s.wantRows(`SELECT d.title, m.name FROM dept d
+		JOIN emp h ON d.head = h.id JOIN emp m ON m.id = d.head`, "[[eng vp] [ops ops]]")
+}
+
+func TestSelect_JoinSubqueries(t *testing.T) {
+	s := newDeptSession(t)
+	s.wantRows(`SELECT e.name FROM emp e JOIN dept d
+		ON d.head = e.id AND EXISTS (SELECT id FROM emp r WHERE r.manager_id = e.id)`, "[[vp]]")
+	s.wantRows("SELECT name FROM emp WHERE id IN (SELECT e.manager_id FROM emp e JOIN dept d ON d.head = e.id)", "[[ceo]]")
+	// ON of a join in a subquery refers to the outer query
+	s.wantRows(`SELECT title FROM dept o WHERE EXISTS
+		(SELECT e.id FROM emp e JOIN emp m ON e.manager_id = m.id AND e.id = o.head WHERE m.name = 'ceo')`, "[[eng] [ops]]")
+}
+
+func TestSelect_JoinSyntax(t *testing.T) {
+	s := newDeptSession(t)
+	s.wantErr("SELECT * FROM emp e JOIN dept d", "ON")
+	s.wantErr("SELECT * FROM emp e JOIN missing m ON m.id = e.id", "missing")
+}
+
+func TestSelect_Distinct(t *testing.T) {
+	s := newItemsSession(t)
+	s.mustExec("INSERT INTO items VALUES (5, 'pen', 2, 1)")
+	s.wantRows("SELECT DISTINCT price FROM items", "[[2] [5] [0]]")
+	s.wantRows("SELECT DISTINCT name, price FROM items", "[[pen 2] [ink 5] [pad 2] [cap 0]]")
+	s.wantRows("SELECT DISTINCT price * 2 AS double FROM items WHERE price > 0", "[[4] [10]]")
+	// NULLs are not distinct from each other
+	s.wantRows("SELECT DISTINCT NULL, price FROM items WHERE price = 2", "[[<nil> 2]]")
+	// window functions are computed before duplicates are removed
+	s.wantRows("SELECT DISTINCT price, RANK() OVER (ORDER BY price) FROM items", "[[0 1] [2 2] [5 5]]")
+}
+
+func TestSelect_ColumnNames(t *testing.T) {
+	s := newItemsSession(t)
+	res := s.mustExec("SELECT price * qty AS total, name, i.id, price + 1, 'x' FROM items i WHERE id = 1")
+	want := "[total name id price + 1 'x']"
+	if got := fmt.Sprint(res.Columns); got != want {
+		t.Errorf("Got columns %s, want %s", got, want)
+	}
+}
+
+func TestSelect_JoinInView(t *testing.T) {
+	s := newDeptSession(t)
+	s.mustExec("CREATE VIEW reports AS SELECT e.name AS who, m.name AS boss FROM emp e JOIN emp m ON e.manager_id = m.id")
+	s.wantRows("SELECT who FROM reports WHERE boss = 'ceo'", "[[vp] [ops]]")
+	s.wantRows("SELECT r.who, d.title FROM reports r JOIN dept d ON d.head = 2 WHERE r.boss = 'vp'", "[[dev eng]]")
+	// every joined table is a dependency of the view
+	s.mustExec("DROP VIEW reports", "CREATE VIEW heads AS SELECT d.title FROM dept d JOIN emp e ON d.head = e.id")
+	s.wantErr("DROP TABLE emp", "heads")
+}
+
+func TestSelect_ForUpdateRejected(t *testing.T) {
+	s := newDeptSession(t)
+	s.wantErr("SELECT e.id FROM emp e JOIN dept d ON d.head = e.id FOR UPDATE", "FOR UPDATE is not supported with JOIN")
+	s.wantErr("SELECT DISTINCT manager_id FROM emp FOR UPDATE", "FOR UPDATE is not allowed with DISTINCT clause")
+	s.wantErr("SELECT id, ROW_NUMBER() OVER (ORDER BY id) FROM emp FOR UPDATE", "FOR UPDATE is not allowed with window functions")
+	s.wantErr("WITH top AS (SELECT id FROM emp WHERE id = 1) SELECT id FROM top FOR UPDATE", "FOR UPDATE cannot be applied to WITH query top")
+	s.wantErr("SELECT id FROM emp UNION SELECT id FROM dept FOR UPDATE", "FOR UPDATE is not allowed with UNION/INTERSECT/EXCEPT")
+}
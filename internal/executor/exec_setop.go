@@ -0,0 +1,275 @@
+package executor
+
+import (
+	"fmt"
+
+	"justasimpletoydb/internal/catalog"
+)
+
+// Query is a statement producing rows: a SELECT or a set operation over
+// two queries. Queries also appear nested as subqueries and CTE bodies.
+type Query interface {
+	Statement
+	String() string
+	run(ctx *execContext, outer *rowScope) (*relation, error)
+}
+
+// SetOpStmt combines the rows of two queries with UNION, INTERSECT or EXCEPT.
+// Without ALL duplicates are removed; with ALL they are kept (UNION) or
+// matched by count (INTERSECT, EXCEPT).
+type SetOpStmt struct {
+	With          []*CTE
+	WithRecursive bool
+	Op            string // UNION, INTERSECT or EXCEPT
+	All           bool
+	Left          Query
+	Right         Query
+}
+
+func (s *SetOpStmt) String() string {
+	op := s.Op
+	if s.All {
+		op += " ALL"
+	}
+	return fmt.Sprintf("%s(%s) %s (%s)", withString(s.WithRecursive, s.With), s.Left.String(), op, s.Right.String())
+}
+
+func (s *SetOpStmt) Execute(ex *Executor) (*ExecResult, error) {
+	ctx := newExecContext(ex)
+	if _, err := ctx.queryCols(s); err != nil {
+		return nil, err
+	}
+	rel, err := s.run(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{
+		Columns:  rel.columnNames(),
+		Types:    rel.columnTypes(),
+		Rows:     rel.rows,
+		Affected: 0,
+		Message:  "OK",
+	}, nil
+}
+
+func (s *SetOpStmt) run(ctx *execContext, outer *rowScope) (*relation, error) {
+	leave, err := ctx.enterWith(s.WithRecursive, s.With)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	left, err := s.Left.run(ctx, outer)
+	if err != nil {
+		return nil, err
+	}
+	right, err := s.Right.run(ctx, outer)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := unifyCols(s.Op, left.cols, right.cols)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]any
+	switch s.Op {
+	case "UNION":
+		if s.All {
+			rows = append(append(rows, left.rows...), right.rows...)
+			break
+		}
+		seen := make(map[string]struct{})
+		for _, part := range [][][]any{left.rows, right.rows} {
+			for _, row := range part {
+				key := rowKey(row)
+				if _, dup := seen[key]; dup {
+					continue
+				}
+				seen[key] = struct{}{}
+				rows = append(rows, row)
+			}
+		}
+
+	case "INTERSECT", "EXCEPT":
+		// count the right side, then let each left row consume a match
+		counts := make(map[string]int)
+		for _, row := range right.rows {
+			counts[rowKey(row)]++
+		}
+		emitted := make(map[string]struct{})
+		for _, row := range left.rows {
+			key := rowKey(row)
+			matched := counts[key] > 0
+			if s.All && matched {
+				counts[key]--
+			}
+			if matched != (s.Op == "INTERSECT") {
+				continue
+			}
+			if !s.All {
+				if _, dup := emitted[key]; dup {
+					continue
+				}
+				emitted[key] = struct{}{}
+			}
+			rows = append(rows, row)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported set operation %s", s.Op)
+	}
+	return &relation{cols: cols, rows: rows}, nil
+}
+
+// unifyCols checks that both inputs of a set operation have the same number
+// of columns with compatible types. Names come from the left input; NULL
+// columns take the type of the other side.
+func unifyCols(op string, left, right []colRef) ([]colRef, error) {
+	if len(left) != len(right) {
+		return nil, fmt.Errorf("each %s query must have the same number of columns: %d vs %d", op, len(left), len(right))
+	}
+	cols := make([]colRef, len(left))
+	for i := range left {
+		lt, rt := left[i].typ, right[i].typ
+		switch {
+		case lt == typeUnknown:
+			lt = rt
+		case rt == typeUnknown || lt == rt:
+		default:
+			return nil, fmt.Errorf("%s types %s and %s cannot be matched for column %d (%s)", op, typeString(lt), typeString(rt), i+1, left[i].name)
+		}
+		cols[i] = colRef{name: left[i].name, typ: lt}
+	}
+	return cols, nil
+}
+
+// queryCols returns the output columns of q with their types, checking set
+// operations for compatibility, without running the query.
+func (ctx *execContext) queryCols(q Query) ([]colRef, error) {
+	switch q := q.(type) {
+	case *SelectStmt:
+		if len(q.With) > 0 {
+			ctx.pushCTEs(q.WithRecursive, q.With)
+			defer ctx.popCTEs()
+		}
+		if err := ctx.checkLocking(q); err != nil {
+			return nil, err
+		}
+		src, err := ctx.sourceCols(q.From)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.checkExprs(q.exprs(), src); err != nil {
+			return nil, err
+		}
+		return ctx.outputCols(q, src)
+
+	case *SetOpStmt:
+		if len(q.With) > 0 {
+			ctx.pushCTEs(q.WithRecursive, q.With)
+			defer ctx.popCTEs()
+		}
+		left, err := ctx.queryCols(q.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := ctx.queryCols(q.Right)
+		if err != nil {
+			return nil, err
+		}
+		return unifyCols(q.Op, left, right)
+
+	default:
+		return nil, fmt.Errorf("unsupported query %T", q)
+	}
+}
+
+// exprType infers the result type of e over the columns of src. Columns of
+// enclosing queries and NULLs are typeUnknown.
+func (ctx *execContext) exprType(e Expr, src []colRef) catalog.ColumnType {
+	switch n := e.(type) {
+	case *Literal:
+		switch n.Value.(type) {
+		case int:
+			return catalog.TypeInt
+		case string:
+			return catalog.TypeText
+		case bool:
+			return typeBool
+		}
+		return typeUnknown
+
+	case *Param:
+		return ctx.params.typeOf(n.Index)
+
+	case *ColumnRef:
+		if idx, err := resolveColumn(src, n); err == nil && idx >= 0 {
+			return src[idx].typ
+		}
+		return typeUnknown
+
+	case *BinaryExpr:
+		switch n.Op {
+		case "+", "-", "*", "/", "%":
+			return catalog.TypeInt
+		case "||":
+			return catalog.TypeText
+		}
+		return typeBool
+
+	case *UnaryExpr:
+		if n.Op == "-" {
+			return catalog.TypeInt
+		}
+		return typeBool
+
+	case *IsNullExpr, *InExpr, *ExistsExpr:
+		return typeBool
+
+	case *CaseExpr:
+		results := []Expr{n.Else}
+		for _, w := range n.Whens {
+			results = append(results, w.Result)
+		}
+		for _, r := range results {
+			if r == nil {
+				continue
+			}
+			if t := ctx.exprType(r, src); t != typeUnknown {
+				return t
+			}
+		}
+		return typeUnknown
+
+	case *FuncCall:
+		fn, ok := scalarFuncs[n.Name]
+		if !ok {
+			return typeUnknown
+		}
+		args := make([]catalog.ColumnType, len(n.Args))
+		for i, a := range n.Args {
+			args[i] = ctx.exprType(a, src)
+		}
+		t, _ := fn.checkArgs(n.Name, args)
+		return t
+
+	case *CastExpr:
+		return n.Type
+
+	case *SubqueryExpr:
+		cols, err := ctx.queryCols(n.Subquery)
+		if err != nil || len(cols) != 1 {
+			return typeUnknown
+		}
+		return cols[0].typ
+
+	case *WindowFunc:
+		switch n.Name {
+		case "LAG", "LEAD", "MIN", "MAX":
+			return ctx.exprType(n.Args[0], src)
+		}
+		return catalog.TypeInt
+	}
+	return typeUnknown
+}
@@ -0,0 +1,82 @@
+package executor_test
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newSetOpSession has tables a and b which share rows and each hold a
+// duplicate of their own.
+func newSetOpSession(t *testing.T) *session {
+	s := newSession(t, newTestEngine(t))
+	s.mustExec(
+		"CREATE TABLE a (id INT, name TEXT)",
+		"INSERT INTO a VALUES (1, 'x')",
+		"INSERT INTO a VALUES (2, 'y')",
+		"INSERT INTO a VALUES (2, 'y')",
+		"INSERT INTO a VALUES (3, 'w')",
+		"CREATE TABLE b (id INT, name TEXT)",
+		"INSERT INTO b VALUES (2, 'y')",
+		"INSERT INTO b VALUES (3, 'w')",
+		"INSERT INTO b VALUES (3, 'w')",
+		"INSERT INTO b VALUES (4, 'z')",
+	)
+	return s
+}
+
+func TestSetOp_Union(t *testing.T) {
+	s := newSetOpSession(t)
+	// duplicates within one side go as well
+	s.wantRows("SELECT * FROM a UNION SELECT * FROM b", "[[1 x] [2 y] [3 w] [4 z]]")
+	s.wantRows("SELECT id FROM a UNION ALL SELECT id FROM b", "[[1] [2] [2] [3] [2] [3] [3] [4]]")
+	s.wantRows("SELECT NULL UNION SELECT NULL", "[[<nil>]]")
+}
+
+func TestSetOp_Intersect(t *testing.T) {
+	s := newSetOpSession(t)
+	s.wantRows("SELECT * FROM a INTERSECT SELECT * FROM b", "[[2 y] [3 w]]")
+	// ALL keeps a row as often as it is on both sides
+	s.wantRows("SELECT id FROM b INTERSECT ALL SELECT id FROM a", "[[2] [3]]")
+	s.wantRows("SELECT id FROM a INTERSECT ALL SELECT id FROM a WHERE id = 2", "[[2] [2]]")
+	// NULLs are equal to each other
+	s.wantRows("SELECT id, NULL FROM a INTERSECT SELECT id, NULL FROM b", "[[2 <nil>] [3 <nil>]]")
+}
+
+func TestSetOp_Except(t *testing.T) {
+	s := newSetOpSession(t)
+	s.wantRows("SELECT id FROM a EXCEPT SELECT id FROM b", "[[1]]")
+	// ALL removes one row for each on the right
+	s.wantRows("SELECT id FROM a EXCEPT ALL SELECT id FROM b WHERE id > 2", "[[1] [2] [2]]")
+	s.wantRows("SELECT id FROM a EXCEPT ALL SELECT id FROM b", "[[1] [2]]")
+	s.wantRows("SELECT id FROM a EXCEPT SELECT id FROM a", "[]")
+}
+
+func TestSetOp_Precedence(t *testing.T) {
+	s := newSetOpSession(t)
+	// INTERSECT binds tighter than UNION and EXCEPT
+	s.wantRows("SELECT id FROM a WHERE id = 1 UNION SELECT id FROM a INTERSECT SELECT id FROM b", "[[1] [2] [3]]")
+	s.wantRows("(SELECT id FROM a WHERE id = 1 UNION SELECT id FROM a) INTERSECT SELECT id FROM b", "[[2] [3]]")
+	// UNION and EXCEPT go left to right
+	s.wantRows("SELECT id FROM a UNION SELECT id FROM b EXCEPT SELECT id FROM b", "[[1]]")
+	s.wantRows("SELECT id FROM a EXCEPT SELECT id FROM b UNION SELECT id FROM b", "[[1] [2] [3] [4]]")
+}
+
+func TestSetOp_Columns(t *testing.T) {
+	s := newSetOpSession(t)
+	// names come from the left, NULL columns take the other side's type
+	res := s.mustExec("SELECT NULL, name AS n FROM a WHERE id = 1 UNION SELECT id, name FROM b WHERE id = 4")
+	if got := fmt.Sprint(res.Columns, res.Rows); got != "[NULL n] [[<nil> x] [4 z]]" {
+		t.Errorf("Got %s", got)
+	}
+	s.wantErr("SELECT id FROM a UNION SELECT id, name FROM b", "each UNION query must have the same number of columns: 1 vs 2")
+	s.wantErr("SELECT id FROM a EXCEPT SELECT name FROM b", "EXCEPT types INT and TEXT cannot be matched for column 1 (id)")
+	s.wantErr("SELECT NULL, id FROM a INTERSECT SELECT 'x', name FROM b", "INTERSECT types INT and TEXT cannot be matched for column 2 (id)")
+}
+
+func TestSetOp_Nested(t *testing.T) {
+	s := newSetOpSession(t)
+	s.wantRows("SELECT name FROM a WHERE id IN (SELECT id FROM b EXCEPT SELECT 3)", "[[y] [y]]")
+	s.wantRows("WITH ids AS (SELECT id FROM a INTERSECT SELECT id FROM b) SELECT * FROM ids", "[[2] [3]]")
+	// a correlated set operation runs per outer row
+	s.wantRows("SELECT id FROM b o WHERE EXISTS (SELECT id FROM a WHERE id = o.id EXCEPT SELECT 2)", "[[3] [3]]")
+}
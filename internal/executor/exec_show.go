@@ -0,0 +1,22 @@
+package executor
+
+// ShowLockStatsStmt is "SHOW LOCK STATS": one row counting, since the
+// server started, the lock requests that had to wait, those that timed out
+// and the deadlocks detected.
+type ShowLockStatsStmt struct{}
+
+// lockStats describes the row of SHOW LOCK STATS.
+var lockStats = ExecResult{
+	Columns: []string{"waits", "timeouts", "deadlocks"},
+	Types:   []string{"INT", "INT", "INT"},
+}
+
+func (s *ShowLockStatsStmt) Execute(ex *Executor) (*ExecResult, error) {
+	stats := ex.engine.Locks.Stats()
+	return &ExecResult{
+		Columns: lockStats.Columns,
+		Types:   lockStats.Types,
+		Rows:    [][]any{{int(stats.Waits), int(stats.Timeouts), int(stats.Deadlocks)}},
+		Message: "OK",
+	}, nil
+}
@@ -0,0 +1,43 @@
+package executor_test
+
+import (
+	"errors"
+	"testing"
+
+	"justasimpletoydb/internal/executor"
+	"justasimpletoydb/internal/lock"
+)
+
+func TestShowLockStats_CountsWaitsAndDeadlocks(t *testing.T) {
+	e := newTestEngine(t)
+	a, b := newSession(t, e), newSession(t, e)
+	a.mustExec("CREATE TABLE acct (id INT, balance INT); INSERT INTO acct VALUES (1, 100), (2, 100)")
+	if got := a.rows("SHOW LOCK STATS"); got != "[[0 0 0]]" {
+		t.Fatalf("Expected no waits yet, got %s", got)
+	}
+
+	a.mustExec("BEGIN; UPDATE acct SET balance = balance - 10 WHERE id = 1")
+	b.mustExec("BEGIN; UPDATE acct SET balance = balance - 10 WHERE id = 2")
+	done := a.start("UPDATE acct SET balance = balance + 10 WHERE id = 2")
+	waited(t, e, 1)
+	if _, err := b.exec("UPDATE acct SET balance = balance + 10 WHERE id = 1"); !errors.Is(err, lock.ErrDeadlock) {
+		t.Fatalf("Expected the second waiter to be the deadlock victim, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the first waiter to go on once the victim aborted, got %v", err)
+	}
+	a.mustExec("COMMIT")
+	b.exec("ROLLBACK")
+
+	if got := b.rows("SELECT balance FROM acct WHERE id = 1") + b.rows("SELECT balance FROM acct WHERE id = 2"); got != "[[90]][[110]]" {
+		t.Errorf("Expected only the survivor's transfer, got %s", got)
+	}
+	res := b.mustExec("SHOW LOCK STATS")
+	if got := res.Rows[0]; got[0] != 1 || got[1] != 0 || got[2] != 1 {
+		t.Errorf("Expected 1 wait and 1 deadlock, got %v (%v)", got, res.Columns)
+	}
+	desc, err := b.ex.Describe(&executor.ShowLockStatsStmt{})
+	if err != nil || len(desc.Columns) != 3 || desc.Columns[2] != "deadlocks" {
+		t.Errorf("Describe = %+v, %v", desc, err)
+	}
+}
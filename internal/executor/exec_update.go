@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"fmt"
+	"slices"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
+	"justasimpletoydb/internal/storage"
+)
+
+// Assignment is one "col = value" of an UPDATE's SET list.
+type Assignment struct {
+	Column string
+	Value  Expr // DefaultValue sets the column's default
+}
+
+type UpdateStmt struct {
+	Table     string
+	Set       []Assignment
+	Where     Expr         // nil updates every row
+	Returning []SelectItem // nil without RETURNING; sees the new rows
+}
+
+// Execute computes all new rows and their RETURNING list before writing
+// anything, so a failed expression, CHECK, unique index or foreign key
+// leaves the table unchanged. Keys still referenced by foreign keys can't
+// be changed. The new versions are written before the old ones are
+// deleted. The rows matched are locked first, waiting for the sessions
+// holding them.
+func (s *UpdateStmt) Execute(ex *Executor) (*ExecResult, error) {
+	schema, err := targetTable(ex, s.Table)
+	if err != nil {
+		return nil, err
+	}
+	ctx := newExecContext(ex)
+	rules, err := ctx.rulesFor(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]int, len(s.Set))
+	exprs := make([]Expr, 0, len(s.Set)+1)
+	for i, a := range s.Set {
+		idx := slices.IndexFunc(schema.Columns, func(c catalog.Column) bool { return c.Name == a.Column })
+		if idx < 0 {
+			return nil, fmt.Errorf("column %s of relation %s does not exist", a.Column, s.Table)
+		}
+		if slices.Contains(targets[:i], idx) {
+			return nil, fmt.Errorf("multiple assignments to same column %s", a.Column)
+		}
+		targets[i] = idx
+		exprs = append(exprs, a.Value)
+	}
+	if s.Where != nil {
+		exprs = append(exprs, s.Where)
+	}
+	for _, e := range exprs {
+		if containsWindowFunc(e) {
+			return nil, fmt.Errorf("window functions are not allowed in UPDATE")
+		}
+	}
+	if err := ctx.checkExprs(exprs, rules.cols); err != nil {
+		return nil, err
+	}
+	if err := ctx.checkReturning(s.Returning, rules.cols); err != nil {
+		return nil, err
+	}
+
+	table, err := ex.openTable(s.Table, lock.IntentionExclusive)
+	if err != nil {
+		return nil, err
+	}
+	defer table.Close()
+	rows, err := ctx.lockRows(table, s.Table, func(row []any) (bool, error) {
+		return ctx.matches(s.Where, &rowScope{cols: rules.cols, row: row})
+	}, lock.Block)
+	if err != nil {
+		return nil, err
+	}
+
+	var tids []storage.TID
+	var old, updated [][]any
+	for _, r := range rows {
+		sc := &rowScope{cols: rules.cols, row: r.Values}
+		row := slices.Clone(r.Values)
+		for i, a := range s.Set {
+			col := targets[i]
+			var v any
+			if _, isDefault := a.Value.(*DefaultValue); isDefault {
+				v, err = ctx.defaultValue(rules, col)
+			} else {
+				v, err = ctx.eval(a.Value, sc)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := checkValueType(schema.Columns[col], v); err != nil {
+				return nil, err
+			}
+			row[col] = v
+		}
+		if err := ctx.checkRow(rules, row); err != nil {
+			return nil, err
+		}
+		tids = append(tids, r.TID)
+		old = append(old, r.Values)
+		updated = append(updated, row)
+	}
+
+	refs := newRefActions(ctx, schema, table)
+	defer refs.close()
+	refs.rewrite(tids, updated)
+	if err := refs.checkReferences(schema, updated); err != nil {
+		return nil, err
+	}
+	if err := refs.removed(schema, old, updated, false); err != nil {
+		return nil, err
+	}
+
+	res := &ExecResult{
+		Message:  fmt.Sprintf("UPDATE %d", len(updated)),
+		Affected: len(updated),
+	}
+	if s.Returning != nil {
+		if err := ctx.returning(s.Returning, rules.cols, updated, res); err != nil {
+			return nil, err
+		}
+	}
+	if err := table.ReplaceRows(tids, updated); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
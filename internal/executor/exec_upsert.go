@@ -0,0 +1,190 @@
+package executor
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/storage"
+)
+
+// OnConflict is the ON CONFLICT clause of an INSERT. A proposed row
+// conflicts when a unique index of the conflict target already holds its
+// key; the rows holding the key are found through the index.
+type OnConflict struct {
+	Columns   []string // conflict target, empty to use every unique index (DO NOTHING only)
+	DoNothing bool
+	Set       []Assignment // DO UPDATE SET
+	Where     Expr         // DO UPDATE ... WHERE, nil if absent
+
+	arbiters []*catalog.Index // unique indexes checked for conflicts
+	targets  []int            // column position of each assignment
+}
+
+// excludedCols are the columns of the proposed row, reachable in DO UPDATE
+// as excluded.col.
+func excludedCols(cols []colRef) []colRef {
+	out := make([]colRef, len(cols))
+	for i, c := range cols {
+		out[i] = colRef{table: "excluded", name: c.name, typ: c.typ}
+	}
+	return out
+}
+
+// check picks the unique indexes matching the conflict target and plans
+// the DO UPDATE expressions.
+func (oc *OnConflict) check(ctx *execContext, schema *catalog.TableSchema, cols []colRef) error {
+	oc.arbiters = nil
+	names := make([]string, 0, len(schema.Indexes))
+	for name := range schema.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		idx := schema.Indexes[name]
+		if !idx.Unique {
+			continue
+		}
+		if len(oc.Columns) == 0 || (len(oc.Columns) == 1 && oc.Columns[0] == idx.ColumnName) {
+			oc.arbiters = append(oc.arbiters, idx)
+		}
+	}
+	if len(oc.Columns) > 0 && len(oc.arbiters) == 0 {
+		return fmt.Errorf("there is no unique index matching the ON CONFLICT specification")
+	}
+	if oc.DoNothing {
+		return nil
+	}
+	if len(oc.Columns) == 0 {
+		return fmt.Errorf("ON CONFLICT DO UPDATE requires a conflict target")
+	}
+
+	oc.targets = make([]int, len(oc.Set))
+	exprs := make([]Expr, 0, len(oc.Set)+1)
+	for i, a := range oc.Set {
+		idx := schema.ColumnIndex(a.Column)
+		if idx < 0 {
+			return fmt.Errorf("column %s of relation %s does not exist", a.Column, schema.Name)
+		}
+		if slices.Contains(oc.targets[:i], idx) {
+			return fmt.Errorf("multiple assignments to same column %s", a.Column)
+		}
+		oc.targets[i] = idx
+		exprs = append(exprs, a.Value)
+	}
+	if oc.Where != nil {
+		exprs = append(exprs, oc.Where)
+	}
+	for _, e := range exprs {
+		if containsWindowFunc(e) {
+			return fmt.Errorf("window functions are not allowed in ON CONFLICT DO UPDATE")
+		}
+	}
+	excluded := excludedCols(cols)
+	if err := checkColumnRefs(exprs, cols, excluded); err != nil {
+		return err
+	}
+	return ctx.checkExprs(exprs, append(slices.Clone(cols), excluded...))
+}
+
+// resolve decides for each proposed row whether it is inserted, skipped or
+// turns into an update of the row it conflicts with, which is locked. It returns the rows
+// to write, in proposal order, the stored rows they replace and, for each
+// of those, its new version.
+func (oc *OnConflict) resolve(ctx *execContext, rules *tableRules, table *storage.Table, proposed [][]any) ([][]any, []storage.Row, [][]any, error) {
+	excluded := excludedCols(rules.cols)
+	// keys taken by rows inserted earlier in this statement, per arbiter
+	pending := make([]map[any]bool, len(oc.arbiters))
+	for i := range pending {
+		pending[i] = make(map[any]bool)
+	}
+
+	var out, updates [][]any
+	var replaced []storage.Row
+	for _, row := range proposed {
+		existing, inBatch, err := oc.findConflict(rules.schema, table, pending, row)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		switch {
+		case existing == nil && !inBatch:
+			if err := ctx.checkRow(rules, row); err != nil {
+				return nil, nil, nil, err
+			}
+			for i, idx := range oc.arbiters {
+				if v := row[rules.schema.ColumnIndex(idx.ColumnName)]; v != nil {
+					pending[i][v] = true
+				}
+			}
+			out = append(out, row)
+
+		case oc.DoNothing:
+			continue
+
+		case inBatch || slices.ContainsFunc(replaced, func(r storage.Row) bool { return r.TID == existing.TID }):
+			return nil, nil, nil, fmt.Errorf("ON CONFLICT DO UPDATE command cannot affect row a second time")
+
+		default:
+			if err := ctx.lockStored(table, rules.schema.Name, []storage.Row{*existing}); err != nil {
+				return nil, nil, nil, err
+			}
+			sc := &rowScope{cols: rules.cols, row: existing.Values, outer: &rowScope{cols: excluded, row: row}}
+			ok, err := ctx.matches(oc.Where, sc)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if !ok {
+				continue
+			}
+			updated := slices.Clone(existing.Values)
+			for i, a := range oc.Set {
+				col := oc.targets[i]
+				var v any
+				if _, isDefault := a.Value.(*DefaultValue); isDefault {
+					v, err = ctx.defaultValue(rules, col)
+				} else {
+					v, err = ctx.eval(a.Value, sc)
+				}
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				if err := checkValueType(rules.schema.Columns[col], v); err != nil {
+					return nil, nil, nil, err
+				}
+				updated[col] = v
+			}
+			if err := ctx.checkRow(rules, updated); err != nil {
+				return nil, nil, nil, err
+			}
+			replaced = append(replaced, *existing)
+			updates = append(updates, updated)
+			out = append(out, updated)
+		}
+	}
+	return out, replaced, updates, nil
+}
+
+// findConflict looks up the keys of a proposed row in the arbiter indexes,
+// waiting for other transactions writing them. It returns the stored row
+// holding one of them, or reports that a row inserted earlier in the same
+// statement does.
+func (oc *OnConflict) findConflict(schema *catalog.TableSchema, table *storage.Table, pending []map[any]bool, row []any) (*storage.Row, bool, error) {
+	for i, idx := range oc.arbiters {
+		v := row[schema.ColumnIndex(idx.ColumnName)]
+		if v == nil {
+			continue // NULLs never conflict
+		}
+		if pending[i][v] {
+			return nil, true, nil
+		}
+		rows, err := table.LookupKey(idx.Name, v)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(rows) > 0 {
+			return &rows[0], false, nil
+		}
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,88 @@
+package executor_test
+
+import (
+	"errors"
+	"testing"
+
+	"justasimpletoydb/internal/storage"
+)
+
+const badgesSchema = `CREATE TABLE badges (code TEXT UNIQUE, holder TEXT, uses INT DEFAULT 0, CHECK (uses < 10));
+CREATE UNIQUE INDEX badges_holder ON badges (holder);
+INSERT INTO badges VALUES ('gold', 'ann', 1), ('blue', 'ben', 1)`
+
+func TestUpsert(t *testing.T) {
+	s := setupSession(t, badgesSchema)
+	// do nothing skips the conflict
+	s.wantRows("INSERT INTO badges VALUES ('gold', 'cat', 0), ('red', 'dan', 0) ON CONFLICT DO NOTHING RETURNING code", "[[red]]")
+	// do nothing on any unique index
+	s.wantRows("INSERT INTO badges VALUES ('pink', 'ann', 0) ON CONFLICT DO NOTHING RETURNING code", "[]")
+	// do nothing on the target only
+	s.wantErr("INSERT INTO badges VALUES ('pink', 'ann', 0) ON CONFLICT (code) DO NOTHING", `duplicate key value violates unique constraint`)
+	// do update with excluded
+	s.wantRows("INSERT INTO badges VALUES ('gold', 'eve', 5) ON CONFLICT (code) DO UPDATE SET holder = excluded.holder, uses = uses + excluded.uses RETURNING *", "[[gold eve 6]]")
+	// do update inserts rows without a conflict
+	s.wantRows("INSERT INTO badges (code, holder) VALUES ('green', 'fay') ON CONFLICT (code) DO UPDATE SET uses = 9 RETURNING code, uses", "[[green 0]]")
+	// do update WHERE skips the row
+	s.wantRows("INSERT INTO badges VALUES ('blue', 'gus', 0) ON CONFLICT (code) DO UPDATE SET holder = excluded.holder WHERE uses > 5 RETURNING code", "[]")
+	// do update to DEFAULT
+	s.wantRows("INSERT INTO badges VALUES ('gold', 'eve', 0) ON CONFLICT (code) DO UPDATE SET uses = DEFAULT; SELECT uses FROM badges WHERE code = 'gold'", "[[0]]")
+	// NULL keys never conflict
+	s.wantRows("INSERT INTO badges VALUES (NULL, NULL, 0), (NULL, NULL, 0) ON CONFLICT DO NOTHING RETURNING uses", "[[0] [0]]")
+	// same row twice
+	s.wantErr("INSERT INTO badges VALUES ('gold', 'hal', 0), ('gold', 'ivy', 0) ON CONFLICT (code) DO UPDATE SET uses = 1", "ON CONFLICT DO UPDATE command cannot affect row a second time")
+	// update breaks a check
+	s.wantErr("INSERT INTO badges VALUES ('gold', 'eve', 0) ON CONFLICT (code) DO UPDATE SET uses = 10", "violates check constraint")
+	// update breaks another unique index
+	s.wantErr("INSERT INTO badges VALUES ('gold', 'eve', 0) ON CONFLICT (code) DO UPDATE SET holder = 'ben'", `duplicate key value violates unique constraint`)
+	// failed upserts changed nothing
+	s.wantRows("SELECT code, holder, uses FROM badges WHERE code = 'gold'", "[[gold eve 0]]")
+	// target without a unique index
+	s.wantErr("INSERT INTO badges VALUES ('gold', 'eve', 0) ON CONFLICT (uses) DO NOTHING", "there is no unique index matching the ON CONFLICT specification")
+	// do update without a target
+	s.wantErr("INSERT INTO badges VALUES ('gold', 'eve', 0) ON CONFLICT DO UPDATE SET uses = 1", "ON CONFLICT DO UPDATE requires a conflict target")
+	// unknown column
+	s.wantErr("INSERT INTO badges VALUES ('gold', 'eve', 0) ON CONFLICT (code) DO UPDATE SET color = 'x'", "column color of relation badges does not exist")
+	// column twice
+	s.wantErr("INSERT INTO badges VALUES ('gold', 'eve', 0) ON CONFLICT (code) DO UPDATE SET uses = 1, uses = 2", "multiple assignments to same column uses")
+}
+
+func TestUpsert_UncommittedKeyWaits(t *testing.T) {
+	for _, end := range []string{"ROLLBACK", "COMMIT"} {
+		t.Run(end, func(t *testing.T) {
+			e := newTestEngine(t)
+			a, b := newSession(t, e), newSession(t, e)
+			a.mustExec(badgesSchema)
+
+			a.mustExec("BEGIN; INSERT INTO badges VALUES ('red', 'cat', 0)")
+			done := b.start("INSERT INTO badges VALUES ('red', 'dan', 0) ON CONFLICT (code) DO UPDATE SET uses = uses + 1")
+			waited(t, e, 1)
+			a.mustExec(end)
+			if err := <-done; err != nil {
+				t.Fatalf("Failed to upsert: %v", err)
+			}
+			want := map[string]string{"ROLLBACK": "[[red dan 0]]", "COMMIT": "[[red cat 1]]"}[end]
+			if got := b.rows("SELECT * FROM badges WHERE code = 'red'"); got != want {
+				t.Errorf("Got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestUpsert_DoNothingWaitsForUncommittedKey(t *testing.T) {
+	e := newTestEngine(t)
+	a, b := newSession(t, e), newSession(t, e)
+	a.mustExec(badgesSchema)
+
+	a.mustExec("BEGIN; DELETE FROM badges WHERE code = 'gold'")
+	done := b.start("INSERT INTO badges VALUES ('gold', 'cat', 0) ON CONFLICT (holder) DO NOTHING")
+	waited(t, e, 1)
+	a.mustExec("ROLLBACK")
+	var violation *storage.UniqueViolation
+	if err := <-done; !errors.As(err, &violation) {
+		t.Fatalf("Expected the restored key to conflict, got %v", err)
+	}
+	if got := b.rows("SELECT holder FROM badges WHERE code = 'gold'"); got != "[[ann]]" {
+		t.Errorf("Got %s, want [[ann]]", got)
+	}
+}
@@ -3,21 +3,34 @@ package executor
 import (
 	"encoding/json"
 	"justasimpletoydb/internal/engine"
+	"justasimpletoydb/internal/lock"
 )
 
 type Executor struct {
-	engine *engine.Engine
+	engine   *engine.Engine
+	owner    lock.Owner           // holder of the session's table locks
+	currval  map[string]int       // last nextval result per sequence
+	tx       *transaction         // open transaction block, if any
+	prepared map[string]*Prepared // statements prepared by PREPARE
+	params   *params              // parameters of the prepared statement running
 }
 
 func NewExecutor(e *engine.Engine) *Executor {
-	return &Executor{engine: e}
+	return &Executor{
+		engine:   e,
+		owner:    e.Locks.NewOwner(),
+		currval:  make(map[string]int),
+		prepared: make(map[string]*Prepared),
+	}
 }
 
 type ExecResult struct {
 	Columns  []string // names of columns (empty for INSERT/CREATE)
+	Types    []string `json:",omitempty"` // type of each column: INT, TEXT, BOOLEAN or unknown
 	Rows     [][]any  // data rows (empty for non-SELECT)
 	Affected int      // number of affected rows (INSERT/UPDATE)
 	Message  string   // optional message, e.g., "OK" or error
+	Notice   string   `json:",omitempty"` // warning for the client, e.g. COMMIT outside a transaction
 }
 
 func (r *ExecResult) ToJSON() ([]byte, error) {
@@ -27,3 +40,47 @@ func (r *ExecResult) ToJSON() ([]byte, error) {
 type Statement interface {
 	Execute(ex *Executor) (*ExecResult, error)
 }
+
+// Describe returns the columns a statement produces, as the Columns and
+// Types of an empty result, without running it. It returns nil for
+// statements that produce no rows.
+func (ex *Executor) Describe(stmt Statement) (*ExecResult, error) {
+	defer ex.unlock()
+	switch s := stmt.(type) {
+	case *boundStmt:
+		return ex.describe(s.prepared.Stmt, s.params)
+	case *ExecuteStmt:
+		p, err := ex.lookupPrepared(s.Name)
+		if err != nil {
+			return nil, err
+		}
+		return ex.DescribePrepared(p)
+	}
+	return ex.describe(stmt, nil)
+}
+
+func (ex *Executor) describe(stmt Statement, prm *params) (*ExecResult, error) {
+	ctx := newExecContext(ex)
+	ctx.params = prm
+	var cols []colRef
+	var err error
+	switch s := stmt.(type) {
+	case Query:
+		cols, err = ctx.queryCols(s)
+	case *InsertStmt:
+		cols, err = ctx.returningCols(s.Table, s.Returning)
+	case *UpdateStmt:
+		cols, err = ctx.returningCols(s.Table, s.Returning)
+	case *DeleteStmt:
+		cols, err = ctx.returningCols(s.Table, s.Returning)
+	case *ShowLockStatsStmt:
+		return &ExecResult{Columns: lockStats.Columns, Types: lockStats.Types}, nil
+	default:
+		return nil, nil
+	}
+	if err != nil || cols == nil {
+		return nil, err
+	}
+	rel := &relation{cols: cols}
+	return &ExecResult{Columns: rel.columnNames(), Types: rel.columnTypes()}, nil
+}
@@ -0,0 +1,113 @@
+package executor_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"justasimpletoydb/internal/engine"
+	"justasimpletoydb/internal/executor"
+	"justasimpletoydb/internal/parser"
+)
+
+// session runs SQL text for a test through an executor of its own.
+type session struct {
+	t  *testing.T
+	ex *executor.Executor
+}
+
+func newTestEngine(t *testing.T) *engine.Engine {
+	e := engine.NewEngine(t.TempDir())
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+func newSession(t *testing.T, e *engine.Engine) *session {
+	s := &session{t: t, ex: executor.NewExecutor(e)}
+	t.Cleanup(func() { s.ex.Close() })
+	return s
+}
+
+// setupSession returns a session on a new database after running setup.
+func setupSession(t *testing.T, setup string) *session {
+	s := newSession(t, newTestEngine(t))
+	s.mustExec(setup)
+	return s
+}
+
+// exec runs the statements of sql in order and returns the result of the
+// last, stopping at the first error.
+func (s *session) exec(sql string) (*executor.ExecResult, error) {
+	stmts, err := parser.ParseAll(sql)
+	if err != nil {
+		return nil, err
+	}
+	var res *executor.ExecResult
+	for _, stmt := range stmts {
+		if res, err = s.ex.Execute(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// mustExec runs each of sqls in order and returns the result of the last.
+func (s *session) mustExec(sqls ...string) *executor.ExecResult {
+	s.t.Helper()
+	var res *executor.ExecResult
+	for _, sql := range sqls {
+		var err error
+		if res, err = s.exec(sql); err != nil {
+			s.t.Fatalf("Failed to exec %q: %v", sql, err)
+		}
+	}
+	return res
+}
+
+// rows returns the rows of the last statement of sql, formatted like
+// [[1 a] [2 <nil>]].
+func (s *session) rows(sql string) string {
+	s.t.Helper()
+	return fmt.Sprint(s.mustExec(sql).Rows)
+}
+
+// wantRows fails the test unless sql returns want, formatted as by rows.
+func (s *session) wantRows(sql, want string) {
+	s.t.Helper()
+	if got := s.rows(sql); got != want {
+		s.t.Errorf("%s\n got %s\nwant %s", sql, got, want)
+	}
+}
+
+// wantErr fails the test unless sql fails with an error containing want.
+func (s *session) wantErr(sql, want string) {
+	s.t.Helper()
+	_, err := s.exec(sql)
+	if err == nil || !strings.Contains(err.Error(), want) {
+		s.t.Errorf("%s\n got error %v\nwant one containing %q", sql, err, want)
+	}
+}
+
+// start runs sql in the background, for a statement expected to wait for
+// another session's locks; waited blocks until it does.
+func (s *session) start(sql string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.exec(sql)
+		done <- err
+	}()
+	return done
+}
+
+// waited blocks until n lock requests of e have waited in all.
+func waited(t *testing.T, e *engine.Engine, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.Locks.Stats().Waits < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d lock waits, got %d", n, e.Locks.Stats().Waits)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,269 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a node of a scalar expression tree built by the parser.
+// Evaluation happens in the executor (see eval.go).
+type Expr interface {
+	String() string
+}
+
+// ColumnRef references a column, optionally qualified by table name or alias.
+type ColumnRef struct {
+	Table string // empty if unqualified
+	Name  string
+}
+
+func (c *ColumnRef) String() string {
+	if c.Table != "" {
+		return c.Table + "." + c.Name
+	}
+	return c.Name
+}
+
+// Literal is a constant value: int, string, bool or nil for NULL.
+type Literal struct {
+	Value any
+}
+
+func (l *Literal) String() string {
+	return formatLiteral(l.Value)
+}
+
+// Param is a placeholder for the value of parameter $Index of a prepared
+// statement. A ? placeholder is numbered by its position.
+type Param struct {
+	Index int // 1-based
+}
+
+func (p *Param) String() string {
+	return "$" + strconv.Itoa(p.Index)
+}
+
+func formatLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// BinaryExpr is an arithmetic (+, -, *, /, %), concatenation (||),
+// comparison (=, <>, <, <=, >, >=) or logical (AND, OR) operation.
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+func (b *BinaryExpr) String() string {
+	prec := precedence(b.Op)
+	left, right := b.Left.String(), b.Right.String()
+	if l, ok := b.Left.(*BinaryExpr); ok && precedence(l.Op) < prec {
+		left = "(" + left + ")"
+	}
+	// operators are left associative, so equal precedence on the right needs parentheses
+	if r, ok := b.Right.(*BinaryExpr); ok && precedence(r.Op) <= prec {
+		right = "(" + right + ")"
+	}
+	return fmt.Sprintf("%s %s %s", left, b.Op, right)
+}
+
+// precedence mirrors the parser's binding strength of binary operators.
+func precedence(op string) int {
+	switch op {
+	case "OR":
+		return 1
+	case "AND":
+		return 2
+	case "=", "<>", "!=", "<", "<=", ">", ">=":
+		return 4
+	case "||":
+		return 5
+	case "+", "-":
+		return 6
+	case "*", "/", "%":
+		return 7
+	}
+	return 0
+}
+
+// UnaryExpr is a prefix operation: NOT or unary minus.
+type UnaryExpr struct {
+	Op      string
+	Operand Expr
+}
+
+func (u *UnaryExpr) String() string {
+	if u.Op == "-" {
+		if _, ok := u.Operand.(*BinaryExpr); ok {
+			return "-(" + u.Operand.String() + ")"
+		}
+		return "-" + u.Operand.String()
+	}
+	return fmt.Sprintf("%s %s", u.Op, u.Operand.String())
+}
+
+// WhenClause is one "WHEN cond THEN result" branch of a CASE expression.
+type WhenClause struct {
+	Cond   Expr
+	Result Expr
+}
+
+// CaseExpr is "CASE [operand] WHEN ... THEN ... [ELSE ...] END". With an
+// operand each WHEN value is compared to it, otherwise WHEN is a condition.
+type CaseExpr struct {
+	Operand Expr // nil for the searched form
+	Whens   []WhenClause
+	Else    Expr // nil means NULL
+}
+
+func (c *CaseExpr) String() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	if c.Operand != nil {
+		b.WriteString(" " + c.Operand.String())
+	}
+	for _, w := range c.Whens {
+		b.WriteString(" WHEN " + w.Cond.String() + " THEN " + w.Result.String())
+	}
+	if c.Else != nil {
+		b.WriteString(" ELSE " + c.Else.String())
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// IsNullExpr is "expr IS [NOT] NULL".
+type IsNullExpr struct {
+	Operand Expr
+	Not     bool
+}
+
+func (e *IsNullExpr) String() string {
+	if e.Not {
+		return e.Operand.String() + " IS NOT NULL"
+	}
+	return e.Operand.String() + " IS NULL"
+}
+
+// InExpr is "expr [NOT] IN (list)" or "expr [NOT] IN (SELECT ...)".
+// Exactly one of List and Subquery is set.
+type InExpr struct {
+	Left     Expr
+	List     []Expr
+	Subquery Query
+	Not      bool
+}
+
+func (e *InExpr) String() string {
+	op := " IN "
+	if e.Not {
+		op = " NOT IN "
+	}
+	if e.Subquery != nil {
+		return e.Left.String() + op + "(" + e.Subquery.String() + ")"
+	}
+	items := make([]string, len(e.List))
+	for i, it := range e.List {
+		items[i] = it.String()
+	}
+	return e.Left.String() + op + "(" + strings.Join(items, ", ") + ")"
+}
+
+// ExistsExpr is "EXISTS (SELECT ...)". NOT EXISTS is a UnaryExpr around it.
+type ExistsExpr struct {
+	Subquery Query
+}
+
+func (e *ExistsExpr) String() string {
+	return "EXISTS (" + e.Subquery.String() + ")"
+}
+
+// SubqueryExpr is a scalar subquery: it must yield one column and at most one row.
+type SubqueryExpr struct {
+	Subquery Query
+}
+
+func (e *SubqueryExpr) String() string {
+	return "(" + e.Subquery.String() + ")"
+}
+
+// walkExpr calls fn for e and every nested expression, depth first.
+// It does not descend into subqueries; fn receives the subquery node itself.
+// Returning false from fn skips the children of that node.
+func walkExpr(e Expr, fn func(Expr) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+	switch n := e.(type) {
+	case *BinaryExpr:
+		walkExpr(n.Left, fn)
+		walkExpr(n.Right, fn)
+	case *UnaryExpr:
+		walkExpr(n.Operand, fn)
+	case *IsNullExpr:
+		walkExpr(n.Operand, fn)
+	case *CaseExpr:
+		walkExpr(n.Operand, fn)
+		for _, w := range n.Whens {
+			walkExpr(w.Cond, fn)
+			walkExpr(w.Result, fn)
+		}
+		walkExpr(n.Else, fn)
+	case *FuncCall:
+		for _, a := range n.Args {
+			walkExpr(a, fn)
+		}
+	case *CastExpr:
+		walkExpr(n.Operand, fn)
+	case *InExpr:
+		walkExpr(n.Left, fn)
+		for _, it := range n.List {
+			walkExpr(it, fn)
+		}
+	case *WindowFunc:
+		for _, a := range n.Args {
+			walkExpr(a, fn)
+		}
+		for _, e := range n.Window.PartitionBy {
+			walkExpr(e, fn)
+		}
+		for _, o := range n.Window.OrderBy {
+			walkExpr(o.Expr, fn)
+		}
+	}
+}
+
+// subqueriesOf returns the queries directly nested in e.
+func subqueriesOf(e Expr) []Query {
+	var out []Query
+	walkExpr(e, func(n Expr) bool {
+		switch n := n.(type) {
+		case *InExpr:
+			if n.Subquery != nil {
+				out = append(out, n.Subquery)
+			}
+		case *ExistsExpr:
+			out = append(out, n.Subquery)
+		case *SubqueryExpr:
+			out = append(out, n.Subquery)
+		}
+		return true
+	})
+	return out
+}
@@ -0,0 +1,71 @@
+package executor_test
+
+import "testing"
+
+func newItemsSession(t *testing.T) *session {
+	s := newSession(t, newTestEngine(t))
+	s.mustExec(
+		"CREATE TABLE items (id INT, name TEXT, price INT, qty INT)",
+		"INSERT INTO items VALUES (1, 'pen', 2, 10)",
+		"INSERT INTO items VALUES (2, 'ink', 5, 7)",
+		"INSERT INTO items VALUES (3, 'pad', 2, 0)",
+		"INSERT INTO items VALUES (4, 'cap', 0, 3)",
+	)
+	return s
+}
+
+func TestExpr_Arithmetic(t *testing.T) {
+	s := newItemsSession(t)
+	s.wantRows("SELECT price * qty, price + qty * 2, (price + qty) * 2, -price, qty / 3, qty % 3 FROM items WHERE id = 1",
+		"[[20 22 24 -2 3 1]]")
+	// left associative, truncating towards zero
+	s.wantRows("SELECT 10 - 4 - 3, 24 / 4 / 2, -7 / 2, -7 % 2", "[[3 3 -3 -1]]")
+	s.wantRows("SELECT id FROM items WHERE price * qty > 20", "[[2]]")
+	s.wantErr("SELECT price / qty FROM items WHERE id = 3", "division by zero")
+	s.wantErr("SELECT price % qty FROM items WHERE id = 3", "division by zero")
+	s.wantErr("SELECT name + 1 FROM items WHERE id = 1", "operator + expects INT operands, got TEXT and INT")
+	s.wantErr("SELECT -name FROM items WHERE id = 1", "operator - expects INT, got TEXT")
+}
+
+func TestExpr_Null(t *testing.T) {
+	s := newItemsSession(t)
+	s.wantRows("SELECT price * NULL, name || NULL, NULL = NULL, NULL IS NULL FROM items WHERE id = 1",
+		"[[<nil> <nil> <nil> true]]")
+	// AND and OR only yield NULL when the other side does not decide
+	s.wantRows("SELECT id, qty > 5 AND NULL, qty > 5 OR NULL FROM items WHERE id IN (1, 3)",
+		"[[1 <nil> true] [3 false <nil>]]")
+}
+
+func TestExpr_Literals(t *testing.T) {
+	s := newItemsSession(t)
+	s.wantRows("SELECT 1, 'a', TRUE, FALSE, NULL", "[[1 a true false <nil>]]")
+	// || renders every operand as text
+	s.wantRows("SELECT name || ':' || price || ':' || (qty > 5) FROM items WHERE id = 1", "[[pen:2:true]]")
+	s.wantErr("SELECT cost FROM items", `unknown column "cost"`)
+}
+
+func TestExpr_Case(t *testing.T) {
+	s := newItemsSession(t)
+	s.wantRows("SELECT id, CASE WHEN qty = 0 THEN 'out' WHEN qty < 5 THEN 'low' ELSE 'ok' END FROM items",
+		"[[1 ok] [2 ok] [3 out] [4 low]]")
+	// without ELSE a CASE that matches nothing is NULL
+	s.wantRows("SELECT id, CASE price WHEN 2 THEN 'cheap' WHEN 5 THEN 'dear' END FROM items",
+		"[[1 cheap] [2 dear] [3 cheap] [4 <nil>]]")
+	s.wantRows("SELECT id FROM items WHERE CASE WHEN qty > 5 THEN price ELSE 0 END = 2", "[[1]]")
+}
+
+func TestExpr_CaseNull(t *testing.T) {
+	s := newItemsSession(t)
+	// NULL equals no WHEN value, not even NULL
+	s.wantRows("SELECT CASE NULL WHEN NULL THEN 'null' ELSE 'other' END", "[[other]]")
+	// an unknown condition is not true
+	s.wantRows("SELECT CASE WHEN NULL > 1 THEN 'many' ELSE 'few' END", "[[few]]")
+}
+
+func TestExpr_CaseShortCircuits(t *testing.T) {
+	s := newItemsSession(t)
+	// later branches are not evaluated once one matches
+	s.wantRows("SELECT CASE WHEN qty = 0 THEN 0 ELSE price / qty END FROM items WHERE id = 3", "[[0]]")
+	s.wantRows("SELECT CASE qty WHEN 0 THEN 0 WHEN price / qty THEN 1 END FROM items WHERE id = 3", "[[0]]")
+	s.wantErr("SELECT CASE WHEN qty = 1 THEN 0 ELSE price / qty END FROM items WHERE id = 3", "division by zero")
+}
@@ -0,0 +1,371 @@
+package executor
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
+	"justasimpletoydb/internal/storage"
+)
+
+// ForeignKeyViolation is returned when a row references a key that does
+// not exist, or when a key is removed while rows still reference it.
+type ForeignKeyViolation struct {
+	Table      string // table of the foreign key
+	Constraint string
+	Column     string // column holding Value: the foreign key's, or the referenced one
+	Value      any
+	RefTable   string
+	Referenced bool // a referenced key was removed
+}
+
+func (e *ForeignKeyViolation) Error() string {
+	if e.Referenced {
+		return fmt.Sprintf("update or delete on table %q violates foreign key constraint %q on table %q: key (%s)=(%v) is still referenced",
+			e.RefTable, e.Constraint, e.Table, e.Column, e.Value)
+	}
+	return fmt.Sprintf("insert or update on table %q violates foreign key constraint %q: key (%s)=(%v) is not present in table %q",
+		e.Table, e.Constraint, e.Column, e.Value, e.RefTable)
+}
+
+// refActions enforces the foreign keys touched by a statement. Referenced
+// keys are looked up through the unique index on the referenced column.
+// The ON DELETE actions a DELETE causes are planned first and written by
+// apply, so a violation anywhere down a cascade leaves every table
+// unchanged.
+type refActions struct {
+	ctx     *execContext
+	table   string                // the statement's table
+	rows    map[storage.TID][]any // new versions of rows the statement rewrites
+	tables  map[string]*storage.Table
+	opened  []*storage.Table // handles opened here, closed by close
+	deleted map[string]map[storage.TID]bool
+	nulled  map[string]map[storage.TID][]any // rows rewritten by SET NULL
+	order   []string                         // tables in the order actions were planned
+}
+
+// newRefActions starts enforcing foreign keys for a statement writing to
+// table, whose open handle is reused.
+func newRefActions(ctx *execContext, schema *catalog.TableSchema, table *storage.Table) *refActions {
+	return &refActions{
+		ctx:     ctx,
+		table:   schema.Name,
+		rows:    make(map[storage.TID][]any),
+		tables:  map[string]*storage.Table{schema.Name: table},
+		deleted: make(map[string]map[storage.TID]bool),
+		nulled:  make(map[string]map[storage.TID][]any),
+	}
+}
+
+func (a *refActions) close() {
+	for _, t := range a.opened {
+		t.Close()
+	}
+}
+
+func (a *refActions) open(name string) (*storage.Table, error) {
+	if t, ok := a.tables[name]; ok {
+		return t, nil
+	}
+	t, err := a.ctx.ex.openTable(name, lock.IntentionExclusive)
+	if err != nil {
+		return nil, err
+	}
+	a.tables[name] = t
+	a.opened = append(a.opened, t)
+	return t, nil
+}
+
+// rewrite records that the statement replaces the rows at tids with rows.
+func (a *refActions) rewrite(tids []storage.TID, rows [][]any) {
+	for i, tid := range tids {
+		a.rows[tid] = rows[i]
+	}
+}
+
+// current returns the values a stored row has once the statement is done,
+// or nil if it is deleted.
+func (a *refActions) current(table string, r storage.Row) []any {
+	if a.deleted[table][r.TID] {
+		return nil
+	}
+	if table == a.table {
+		if row, ok := a.rows[r.TID]; ok {
+			return row
+		}
+	}
+	if row, ok := a.nulled[table][r.TID]; ok {
+		return row
+	}
+	return r.Values
+}
+
+// checkReferences checks that every non-NULL foreign key value of rows,
+// new rows of schema's table, exists in the referenced table. A table
+// referencing itself may reference rows of the same statement. The
+// referenced rows are locked in shared mode, which waits for a session
+// still writing one and keeps them from being deleted or changed before
+// the statement or transaction block ends.
+func (a *refActions) checkReferences(schema *catalog.TableSchema, rows [][]any) error {
+	cat := a.ctx.ex.engine.Catalog
+	for _, fk := range schema.ForeignKeys {
+		col := schema.ColumnIndex(fk.Column)
+		own := make(map[any]bool)
+		if fk.RefTable == schema.Name {
+			refCol := schema.ColumnIndex(fk.RefColumn)
+			for _, row := range rows {
+				own[row[refCol]] = true
+			}
+		}
+		t, err := a.open(fk.RefTable)
+		if err != nil {
+			return err
+		}
+		ref, err := cat.GetTable(fk.RefTable)
+		if err != nil {
+			return err
+		}
+		idx := ref.UniqueIndexOn(fk.RefColumn)
+		if idx == nil {
+			return fmt.Errorf("foreign key %s: no unique index on %s(%s)", fk.Name, fk.RefTable, fk.RefColumn)
+		}
+		for _, row := range rows {
+			v := row[col]
+			if v == nil || own[v] {
+				continue
+			}
+			present, err := a.referenced(t, ref, idx.Name, fk.RefColumn, v)
+			if err != nil {
+				return err
+			}
+			if !present {
+				return &ForeignKeyViolation{Table: schema.Name, Constraint: fk.Name, Column: fk.Column, Value: v, RefTable: fk.RefTable}
+			}
+		}
+	}
+	return nil
+}
+
+// referenced reports whether a row of ref holds key v in column, found
+// through index, locking it in shared mode.
+func (a *refActions) referenced(t *storage.Table, ref *catalog.TableSchema, index, column string, v any) (bool, error) {
+	found, err := t.LookupKey(index, v)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range found {
+		cur := a.current(ref.Name, r)
+		if cur == nil || cur[ref.ColumnIndex(column)] != v {
+			continue
+		}
+		if err := a.ctx.ex.shareRow(ref.Name, r.TID); err != nil {
+			return false, err
+		}
+		// the row may have been deleted before it was locked
+		if live, err := t.Live([]storage.TID{r.TID}); err != nil || live {
+			return live, err
+		}
+	}
+	return false, nil
+}
+
+// removed handles the referenced keys that leave schema's table when the
+// old rows are deleted or rewritten; kept are the table's new rows, whose
+// keys stay. Rows still referencing a removed key fail the statement
+// unless it deletes and their foreign key cascades or sets NULL.
+func (a *refActions) removed(schema *catalog.TableSchema, old [][]any, kept [][]any, deleting bool) error {
+	cat := a.ctx.ex.engine.Catalog
+	for _, fk := range cat.ReferencedBy(schema.Name) {
+		refCol := schema.ColumnIndex(fk.RefColumn)
+		keep := make(map[any]bool)
+		for _, row := range kept {
+			keep[row[refCol]] = true
+		}
+		keys := make(map[any]bool)
+		for _, row := range old {
+			if v := row[refCol]; v != nil && !keep[v] {
+				keys[v] = true
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if err := a.ctx.ex.lockTable(fk.Table, lock.IntentionExclusive); err != nil {
+			return err
+		}
+		child, err := cat.GetTable(fk.Table)
+		if err != nil {
+			return err
+		}
+		children, err := a.referencing(child, fk.ForeignKey, keys)
+		if err != nil {
+			return err
+		}
+		if len(children) == 0 {
+			continue
+		}
+		if !deleting || fk.OnDelete == catalog.FKRestrict {
+			v := children[0].Values[child.ColumnIndex(fk.Column)]
+			return &ForeignKeyViolation{Table: fk.Table, Constraint: fk.Name, Column: fk.RefColumn, Value: v, RefTable: schema.Name, Referenced: true}
+		}
+		if fk.OnDelete == catalog.FKCascade {
+			if err := a.delete(child, children); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := a.setNull(child, child.ColumnIndex(fk.Column), children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referencing returns the rows of child whose foreign key column holds one
+// of keys, with their values as the statement leaves them. An index on the
+// column is used if there is one. Rows other sessions are still writing
+// are waited for, so that a reference whose delete is rolled back is
+// found.
+func (a *refActions) referencing(child *catalog.TableSchema, fk catalog.ForeignKey, keys map[any]bool) ([]storage.Row, error) {
+	t, err := a.open(child.Name)
+	if err != nil {
+		return nil, err
+	}
+	col := child.ColumnIndex(fk.Column)
+	var candidates []storage.Row
+	if idx := indexOn(child, fk.Column); idx != nil {
+		for k := range keys {
+			found, err := t.LookupKey(idx.Name, k)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, found...)
+		}
+	} else if candidates, err = t.ScanMatching(func(row []any) bool { return keys[row[col]] }); err != nil {
+		return nil, err
+	}
+	var out []storage.Row
+	for _, r := range candidates {
+		cur := a.current(child.Name, r)
+		if cur != nil && cur[col] != nil && keys[cur[col]] {
+			out = append(out, storage.Row{TID: r.TID, Values: cur})
+		}
+	}
+	sortRows(out)
+	return out, nil
+}
+
+// delete plans the cascaded delete of rows of a table.
+func (a *refActions) delete(schema *catalog.TableSchema, rows []storage.Row) error {
+	if err := a.lock(schema.Name, rows); err != nil {
+		return err
+	}
+	a.touch(schema.Name)
+	old := make([][]any, len(rows))
+	for i, r := range rows {
+		a.deleted[schema.Name][r.TID] = true
+		old[i] = r.Values
+	}
+	return a.removed(schema, old, nil, true)
+}
+
+// setNull plans setting column col of rows to NULL. The rows must still
+// pass the table's CHECK constraints.
+func (a *refActions) setNull(schema *catalog.TableSchema, col int, rows []storage.Row) error {
+	rules, err := a.ctx.rulesFor(schema)
+	if err != nil {
+		return err
+	}
+	if err := a.lock(schema.Name, rows); err != nil {
+		return err
+	}
+	a.touch(schema.Name)
+	old := make([][]any, len(rows))
+	updated := make([][]any, len(rows))
+	for i, r := range rows {
+		row := slices.Clone(r.Values)
+		row[col] = nil
+		if err := a.ctx.checkRow(rules, row); err != nil {
+			return err
+		}
+		a.nulled[schema.Name][r.TID] = row
+		old[i] = r.Values
+		updated[i] = row
+	}
+	return a.removed(schema, old, updated, false)
+}
+
+// lock locks the rows of a table an action changes.
+func (a *refActions) lock(table string, rows []storage.Row) error {
+	t, err := a.open(table)
+	if err != nil {
+		return err
+	}
+	return a.ctx.lockStored(t, table, rows)
+}
+
+func (a *refActions) touch(table string) {
+	if _, ok := a.deleted[table]; ok {
+		return
+	}
+	a.deleted[table] = make(map[storage.TID]bool)
+	a.nulled[table] = make(map[storage.TID][]any)
+	a.order = append(a.order, table)
+}
+
+// apply writes the planned actions.
+func (a *refActions) apply() error {
+	for _, name := range a.order {
+		t, err := a.open(name)
+		if err != nil {
+			return err
+		}
+		var nulled []storage.Row
+		for tid, row := range a.nulled[name] {
+			if !a.deleted[name][tid] {
+				nulled = append(nulled, storage.Row{TID: tid, Values: row})
+			}
+		}
+		sortRows(nulled)
+		tids := make([]storage.TID, len(nulled))
+		rows := make([][]any, len(nulled))
+		for i, r := range nulled {
+			tids[i], rows[i] = r.TID, r.Values
+		}
+		if err := t.ReplaceRows(tids, rows); err != nil {
+			return err
+		}
+		var deleted []storage.TID
+		for tid := range a.deleted[name] {
+			deleted = append(deleted, tid)
+		}
+		if err := t.DeleteRows(deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexOn returns an index on the named column with the lowest name, or
+// nil if the column has none.
+func indexOn(schema *catalog.TableSchema, column string) *catalog.Index {
+	var found *catalog.Index
+	for _, idx := range schema.Indexes {
+		if idx.ColumnName == column && (found == nil || idx.Name < found.Name) {
+			found = idx
+		}
+	}
+	return found
+}
+
+// sortRows orders rows by their position in the table.
+func sortRows(rows []storage.Row) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].TID.PageID != rows[j].TID.PageID {
+			return rows[i].TID.PageID < rows[j].TID.PageID
+		}
+		return rows[i].TID.SlotID < rows[j].TID.SlotID
+	})
+}
@@ -0,0 +1,148 @@
+package executor_test
+
+import (
+	"errors"
+	"testing"
+
+	"justasimpletoydb/internal/executor"
+)
+
+const fkSchema = `CREATE TABLE p (id INT UNIQUE);
+CREATE TABLE c (id INT, pid INT REFERENCES p (id));`
+
+func TestForeignKeys_ReferenceToUncommittedRowWaits(t *testing.T) {
+	for _, tt := range []struct {
+		end     string
+		wantErr bool
+		want    string
+	}{
+		{end: "ROLLBACK", wantErr: true, want: "[]"},
+		{end: "COMMIT", want: "[[1 1]]"},
+	} {
+		t.Run(tt.end, func(t *testing.T) {
+			e := newTestEngine(t)
+			a, b := newSession(t, e), newSession(t, e)
+			a.mustExec(fkSchema)
+
+			a.mustExec("BEGIN; INSERT INTO p VALUES (1)")
+			done := b.start("INSERT INTO c VALUES (1, 1)")
+			waited(t, e, 1)
+			a.mustExec(tt.end)
+
+			var fk *executor.ForeignKeyViolation
+			if err := <-done; errors.As(err, &fk) != tt.wantErr {
+				t.Errorf("Expected a foreign key violation: %v, got %v", tt.wantErr, err)
+			}
+			if got := a.rows("SELECT * FROM c"); got != tt.want {
+				t.Errorf("Got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForeignKeys_ReferencedRowIsKeptUntilCommit(t *testing.T) {
+	e := newTestEngine(t)
+	a, b := newSession(t, e), newSession(t, e)
+	a.mustExec(fkSchema + "INSERT INTO p VALUES (1)")
+
+	b.mustExec("BEGIN; INSERT INTO c VALUES (1, 1)")
+	done := a.start("DELETE FROM p WHERE id = 1")
+	waited(t, e, 1)
+	b.mustExec("COMMIT")
+
+	var fk *executor.ForeignKeyViolation
+	if err := <-done; !errors.As(err, &fk) {
+		t.Errorf("Expected the delete to find the committed reference, got %v", err)
+	}
+	if got := a.rows("SELECT * FROM p"); got != "[[1]]" {
+		t.Errorf("Got %s, want [[1]]", got)
+	}
+}
+
+func TestForeignKeys_UncommittedDeleteOfReferenceWaits(t *testing.T) {
+	e := newTestEngine(t)
+	a, b := newSession(t, e), newSession(t, e)
+	a.mustExec(fkSchema + "INSERT INTO p VALUES (1); INSERT INTO c VALUES (1, 1)")
+
+	// c has no index on pid, so the delete scans it for references
+	a.mustExec("BEGIN; DELETE FROM c WHERE id = 1")
+	done := b.start("DELETE FROM p WHERE id = 1")
+	waited(t, e, 1)
+	a.mustExec("ROLLBACK")
+
+	var fk *executor.ForeignKeyViolation
+	if err := <-done; !errors.As(err, &fk) {
+		t.Errorf("Expected the delete to find the restored reference, got %v", err)
+	}
+	if got := a.rows("SELECT * FROM p") + a.rows("SELECT * FROM c"); got != "[[1]][[1 1]]" {
+		t.Errorf("Got %s, want [[1]][[1 1]]", got)
+	}
+}
+
+const shopSchema = `CREATE TABLE users (id INT UNIQUE, name TEXT);
+CREATE TABLE orders (id INT UNIQUE, user_id INT REFERENCES users (id) ON DELETE CASCADE);
+CREATE TABLE notes (id INT, order_id INT, FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE SET NULL);
+CREATE TABLE audits (id INT, user_id INT REFERENCES users (id));
+INSERT INTO users VALUES (1, 'ann'), (2, 'ben'), (3, 'cat');
+INSERT INTO orders VALUES (10, 1), (11, 1), (20, 2), (30, NULL);
+INSERT INTO notes VALUES (100, 10), (101, 11), (102, 20);
+INSERT INTO audits VALUES (1000, 3)`
+
+func TestForeignKeys(t *testing.T) {
+	s := setupSession(t, shopSchema)
+	// insert of a missing key
+	s.wantErr("INSERT INTO orders VALUES (40, 9)", `insert or update on table "orders" violates foreign key constraint`)
+	// update to a missing key
+	s.wantErr("UPDATE orders SET user_id = 9 WHERE id = 10", `key (user_id)=(9) is not present in table "users"`)
+	// NULL references nothing
+	s.wantRows("INSERT INTO orders VALUES (41, NULL); UPDATE orders SET user_id = NULL WHERE id = 41; SELECT id FROM orders WHERE user_id IS NULL", "[[30] [41]]")
+	// a key inserted in the same statement
+	s.wantRows("INSERT INTO users VALUES (4, 'dan'); INSERT INTO orders VALUES (42, 4) RETURNING user_id", "[[4]]")
+	// restrict
+	s.wantErr("DELETE FROM users WHERE id = 3", `update or delete on table "users" violates foreign key constraint`)
+	// update of a referenced key
+	s.wantErr("UPDATE users SET id = 5 WHERE id = 2", `key (id)=(2) is still referenced`)
+	// update keeping a referenced key
+	s.wantRows("UPDATE users SET name = 'BEN' WHERE id = 2; SELECT name FROM users WHERE id = 2", "[[BEN]]")
+	// cascade, then set null
+	s.wantRows("DELETE FROM users WHERE id = 1; SELECT id FROM orders WHERE id < 30", "[[20]]")
+	// set null through the cascade
+	s.wantRows("SELECT id, order_id FROM notes WHERE order_id IS NULL", "[[100 <nil>] [101 <nil>]]")
+	// restrict alongside a cascade
+	s.wantErr("INSERT INTO audits VALUES (1001, 2); DELETE FROM users WHERE id = 2", `violates foreign key constraint`)
+	// failed cascade changed nothing
+	s.wantRows("SELECT id FROM users WHERE id = 2", "[[2]]")
+	// failed cascade kept the children
+	s.wantRows("SELECT id FROM orders WHERE user_id = 2", "[[20]]")
+	// drop of a referenced table
+	s.wantErr("DROP TABLE users", "cannot drop table users because foreign key")
+	// referenced column without a unique index
+	s.wantErr("CREATE TABLE bad (id INT REFERENCES users (name))", "there is no unique index on column name of referenced table users")
+	// incompatible types
+	s.wantErr("CREATE TABLE bad (name TEXT REFERENCES users (id))", "are of incompatible types")
+	// unsupported ON UPDATE action
+	s.wantErr("CREATE TABLE bad (id INT REFERENCES users (id) ON UPDATE CASCADE)", "ON UPDATE CASCADE is not supported")
+}
+
+func TestForeignKeys_ViolationType(t *testing.T) {
+	s := setupSession(t, shopSchema)
+	_, err := s.exec("DELETE FROM users WHERE id = 3")
+	var violation *executor.ForeignKeyViolation
+	if !errors.As(err, &violation) || !violation.Referenced || violation.Table != "audits" || violation.RefTable != "users" || violation.Value != 3 {
+		t.Errorf("Expected a ForeignKeyViolation of audits referencing users, got %#v", err)
+	}
+}
+
+func TestForeignKeys_Names(t *testing.T) {
+	s := setupSession(t, shopSchema)
+	// a default name taken by a CHECK or another foreign key is numbered
+	s.mustExec(`CREATE TABLE gifts (id INT, user_id INT REFERENCES users (id), CONSTRAINT gifts_user_id_fkey CHECK (id > 0));
+CREATE TABLE refunds (id INT, ref INT REFERENCES orders (id), FOREIGN KEY (ref) REFERENCES users (id))`)
+	s.wantErr("INSERT INTO gifts VALUES (1, 9)", `violates foreign key constraint "gifts_user_id_fkey1"`)
+	s.wantErr("INSERT INTO gifts VALUES (-1, 1)", "violates check constraint gifts_user_id_fkey")
+	s.wantErr("INSERT INTO refunds VALUES (1, 3)", `violates foreign key constraint "refunds_ref_fkey"`)
+	s.wantErr("INSERT INTO refunds VALUES (1, 10)", `violates foreign key constraint "refunds_ref_fkey1"`)
+	// a name given twice
+	s.wantErr("CREATE TABLE bad (a INT CONSTRAINT k REFERENCES users (id), b INT CONSTRAINT k REFERENCES users (id))", "constraint k for relation bad already exists")
+	s.wantErr("CREATE TABLE bad (a INT CONSTRAINT k CHECK (a > 0), b INT CONSTRAINT k REFERENCES users (id))", "constraint k for relation bad already exists")
+}
@@ -0,0 +1,376 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"justasimpletoydb/internal/catalog"
+)
+
+// typeAny marks a function parameter accepting any type. All typeAny
+// arguments of one call must share a type, which is also the result type
+// when the function's result is typeAny.
+const typeAny catalog.ColumnType = -3
+
+// timestampLayout is the text form of timestamps returned by NOW() and
+// understood by DATE_PART. There is no timestamp column type; timestamps are TEXT.
+const timestampLayout = "2006-01-02 15:04:05"
+
+// FuncCall is a call of a built-in scalar function, e.g. LOWER(name).
+type FuncCall struct {
+	Name string // upper case
+	Args []Expr
+}
+
+func (f *FuncCall) String() string {
+	parts := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		parts[i] = a.String()
+	}
+	return fmt.Sprintf("%s(%s)", strings.ToLower(f.Name), strings.Join(parts, ", "))
+}
+
+// CastExpr is "CAST(expr AS type)".
+type CastExpr struct {
+	Operand Expr
+	Type    catalog.ColumnType
+}
+
+func (c *CastExpr) String() string {
+	return fmt.Sprintf("CAST(%s AS %s)", c.Operand.String(), typeString(c.Type))
+}
+
+// scalarFunc describes a built-in function: its parameters, result type
+// and implementation.
+type scalarFunc struct {
+	params   []catalog.ColumnType
+	required int  // leading params that must be given; the rest are optional
+	variadic bool // the last param may be repeated
+	result   catalog.ColumnType
+	// strict functions return NULL when any argument is NULL without calling eval
+	strict bool
+	eval   func(ctx *execContext, args []any) (any, error)
+}
+
+var scalarFuncs map[string]*scalarFunc
+
+func init() {
+	text, integer := catalog.TypeText, catalog.TypeInt
+	scalarFuncs = map[string]*scalarFunc{
+		"LOWER": {params: types(text), required: 1, result: text, strict: true,
+			eval: func(_ *execContext, a []any) (any, error) { return strings.ToLower(a[0].(string)), nil }},
+		"UPPER": {params: types(text), required: 1, result: text, strict: true,
+			eval: func(_ *execContext, a []any) (any, error) { return strings.ToUpper(a[0].(string)), nil }},
+		"LENGTH": {params: types(text), required: 1, result: integer, strict: true,
+			eval: func(_ *execContext, a []any) (any, error) { return len([]rune(a[0].(string))), nil }},
+		"SUBSTR":  {params: types(text, integer, integer), required: 2, result: text, strict: true, eval: substr},
+		"TRIM":    {params: types(text, text), required: 1, result: text, strict: true, eval: trim},
+		"REPLACE": {params: types(text, text, text), required: 3, result: text, strict: true, eval: replace},
+		"COALESCE": {params: types(typeAny), required: 1, variadic: true, result: typeAny,
+			eval: coalesce},
+		"NULLIF": {params: types(typeAny, typeAny), required: 2, result: typeAny, eval: nullif},
+		"ABS": {params: types(integer), required: 1, result: integer, strict: true,
+			eval: func(_ *execContext, a []any) (any, error) {
+				if v := a[0].(int); v < 0 {
+					return -v, nil
+				}
+				return a[0], nil
+			}},
+		"ROUND": {params: types(integer, integer), required: 1, result: integer, strict: true, eval: round},
+		"MOD": {params: types(integer, integer), required: 2, result: integer, strict: true,
+			eval: func(_ *execContext, a []any) (any, error) { return arithmetic("%", a[0], a[1]) }},
+		"NOW": {result: text,
+			eval: func(ctx *execContext, _ []any) (any, error) { return ctx.now.Format(timestampLayout), nil }},
+		"DATE_PART": {params: types(text, text), required: 2, result: integer, strict: true, eval: datePart},
+		"NEXTVAL": {params: types(text), required: 1, result: integer, strict: true,
+			eval: func(ctx *execContext, a []any) (any, error) { return ctx.nextval(a[0].(string)) }},
+		"CURRVAL": {params: types(text), required: 1, result: integer, strict: true,
+			eval: func(ctx *execContext, a []any) (any, error) { return ctx.currval(a[0].(string)) }},
+	}
+}
+
+func types(ts ...catalog.ColumnType) []catalog.ColumnType { return ts }
+
+// IsScalarFunction reports whether name is a built-in scalar function.
+func IsScalarFunction(name string) bool {
+	_, ok := scalarFuncs[strings.ToUpper(name)]
+	return ok
+}
+
+// CheckFuncCall validates the name and argument count of a scalar function
+// call. Argument types are checked once the input columns are known.
+func CheckFuncCall(f *FuncCall) error {
+	fn, ok := scalarFuncs[f.Name]
+	if !ok {
+		return fmt.Errorf("unknown function %s", strings.ToLower(f.Name))
+	}
+	n := len(f.Args)
+	switch {
+	case fn.variadic && n >= fn.required:
+		return nil
+	case fn.variadic:
+		return fmt.Errorf("function %s takes at least %d arguments, got %d", strings.ToLower(f.Name), fn.required, n)
+	case n < fn.required || n > len(fn.params):
+		if fn.required == len(fn.params) {
+			return fmt.Errorf("function %s takes %d arguments, got %d", strings.ToLower(f.Name), fn.required, n)
+		}
+		return fmt.Errorf("function %s takes %d to %d arguments, got %d", strings.ToLower(f.Name), fn.required, len(fn.params), n)
+	}
+	return nil
+}
+
+// param returns the declared type of the i-th argument.
+func (fn *scalarFunc) param(i int) catalog.ColumnType {
+	if i >= len(fn.params) {
+		return fn.params[len(fn.params)-1]
+	}
+	return fn.params[i]
+}
+
+// checkArgs matches argument types against the parameters and returns the
+// result type. typeUnknown arguments (NULL, outer columns) match anything.
+func (fn *scalarFunc) checkArgs(name string, args []catalog.ColumnType) (catalog.ColumnType, error) {
+	common := typeUnknown
+	for i, t := range args {
+		if t == typeUnknown {
+			continue
+		}
+		want := fn.param(i)
+		if want == typeAny {
+			if common != typeUnknown && common != t {
+				return typeUnknown, fmt.Errorf("function %s arguments must have the same type, got %s and %s", strings.ToLower(name), typeString(common), typeString(t))
+			}
+			common = t
+			continue
+		}
+		if t != want {
+			return typeUnknown, fmt.Errorf("function %s expects %s for argument %d, got %s", strings.ToLower(name), typeString(want), i+1, typeString(t))
+		}
+	}
+	if fn.result == typeAny {
+		return common, nil
+	}
+	return fn.result, nil
+}
+
+func (ctx *execContext) evalFunc(n *FuncCall, sc *rowScope) (any, error) {
+	fn, ok := scalarFuncs[n.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", strings.ToLower(n.Name))
+	}
+	args := make([]any, len(n.Args))
+	argTypes := make([]catalog.ColumnType, len(n.Args))
+	for i, a := range n.Args {
+		v, err := ctx.eval(a, sc)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil && fn.strict {
+			return nil, nil
+		}
+		args[i] = v
+		argTypes[i] = valueType(v)
+	}
+	// values from outer queries or NULL literals were not typed at plan time
+	if _, err := fn.checkArgs(n.Name, argTypes); err != nil {
+		return nil, err
+	}
+	return fn.eval(ctx, args)
+}
+
+// valueType is the expression type of a runtime value.
+func valueType(v any) catalog.ColumnType {
+	switch v.(type) {
+	case int:
+		return catalog.TypeInt
+	case string:
+		return catalog.TypeText
+	case bool:
+		return typeBool
+	}
+	return typeUnknown
+}
+
+func (ctx *execContext) evalCast(n *CastExpr, sc *rowScope) (any, error) {
+	v, err := ctx.eval(n.Operand, sc)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	switch n.Type {
+	case catalog.TypeText:
+		return toText(v), nil
+	case catalog.TypeInt:
+		switch v := v.(type) {
+		case int:
+			return v, nil
+		case bool:
+			if v {
+				return 1, nil
+			}
+			return 0, nil
+		case string:
+			i, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("invalid input for type INT: %s", formatLiteral(v))
+			}
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot cast %s to %s", typeName(v), typeString(n.Type))
+}
+
+// substr follows SQL semantics: positions start at 1, and a start before
+// the string shortens the result rather than shifting it.
+func substr(_ *execContext, a []any) (any, error) {
+	r := []rune(a[0].(string))
+	from := a[1].(int) - 1
+	to := len(r)
+	if len(a) > 2 {
+		n := a[2].(int)
+		if n < 0 {
+			return nil, fmt.Errorf("negative substring length not allowed")
+		}
+		to = min(from+n, len(r))
+	}
+	from = max(from, 0)
+	if from >= to {
+		return "", nil
+	}
+	return string(r[from:to]), nil
+}
+
+// trim removes spaces, or the characters of the second argument, from both ends.
+func trim(_ *execContext, a []any) (any, error) {
+	cutset := " "
+	if len(a) > 1 {
+		cutset = a[1].(string)
+	}
+	return strings.Trim(a[0].(string), cutset), nil
+}
+
+func replace(_ *execContext, a []any) (any, error) {
+	return strings.ReplaceAll(a[0].(string), a[1].(string), a[2].(string)), nil
+}
+
+func coalesce(_ *execContext, a []any) (any, error) {
+	for _, v := range a {
+		if v != nil {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func nullif(_ *execContext, a []any) (any, error) {
+	if a[0] == nil || a[1] == nil {
+		return a[0], nil
+	}
+	cmp, err := compareValues(a[0], a[1])
+	if err != nil {
+		return nil, err
+	}
+	if cmp == 0 {
+		return nil, nil
+	}
+	return a[0], nil
+}
+
+// round rounds to the given number of decimal digits. Integers have no
+// fractional part, so only negative digits (tens, hundreds, ...) change the
+// value; halves round away from zero.
+func round(_ *execContext, a []any) (any, error) {
+	v := a[0].(int)
+	if len(a) < 2 || a[1].(int) >= 0 {
+		return v, nil
+	}
+	unit := 1
+	for i := a[1].(int); i < 0; i++ {
+		if unit > (1<<62)/10 {
+			return 0, nil
+		}
+		unit *= 10
+	}
+	half := unit / 2
+	if v < 0 {
+		return -((-v + half) / unit * unit), nil
+	}
+	return (v + half) / unit * unit, nil
+}
+
+// dateFields are the fields DATE_PART and EXTRACT can take from a timestamp.
+var dateFields = map[string]func(t time.Time) int{
+	"YEAR":   func(t time.Time) int { return t.Year() },
+	"MONTH":  func(t time.Time) int { return int(t.Month()) },
+	"DAY":    func(t time.Time) int { return t.Day() },
+	"HOUR":   func(t time.Time) int { return t.Hour() },
+	"MINUTE": func(t time.Time) int { return t.Minute() },
+	"SECOND": func(t time.Time) int { return t.Second() },
+	"DOW":    func(t time.Time) int { return int(t.Weekday()) },
+	"DOY":    func(t time.Time) int { return t.YearDay() },
+}
+
+// IsDateField reports whether name is a field EXTRACT supports.
+func IsDateField(name string) bool {
+	_, ok := dateFields[strings.ToUpper(name)]
+	return ok
+}
+
+func datePart(_ *execContext, a []any) (any, error) {
+	field, ok := dateFields[strings.ToUpper(a[0].(string))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported date field %s", formatLiteral(a[0]))
+	}
+	s := a[1].(string)
+	for _, layout := range []string{timestampLayout, time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return field(t), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid timestamp %s, expected format YYYY-MM-DD [HH:MM:SS]", formatLiteral(s))
+}
+
+// checkExprs type checks the function calls in exprs against the input
+// columns and plans the queries nested in them, so that errors surface
+// before any row is read.
+func (ctx *execContext) checkExprs(exprs []Expr, src []colRef) error {
+	var err error
+	for _, e := range exprs {
+		walkExpr(e, func(n Expr) bool {
+			if err != nil {
+				return false
+			}
+			switch n := n.(type) {
+			case *FuncCall:
+				err = ctx.checkFunc(n, src)
+			case *InExpr:
+				if n.Subquery != nil {
+					_, err = ctx.queryCols(n.Subquery)
+				}
+			case *ExistsExpr:
+				_, err = ctx.queryCols(n.Subquery)
+			case *SubqueryExpr:
+				_, err = ctx.queryCols(n.Subquery)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ctx *execContext) checkFunc(n *FuncCall, src []colRef) error {
+	fn, ok := scalarFuncs[n.Name]
+	if !ok {
+		return fmt.Errorf("unknown function %s", strings.ToLower(n.Name))
+	}
+	argTypes := make([]catalog.ColumnType, len(n.Args))
+	for i, a := range n.Args {
+		argTypes[i] = ctx.exprType(a, src)
+	}
+	_, err := fn.checkArgs(n.Name, argTypes)
+	return err
+}
@@ -0,0 +1,113 @@
+package executor_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newWordsSession(t *testing.T) *session {
+	s := newSession(t, newTestEngine(t))
+	s.mustExec(
+		"CREATE TABLE words (id INT, word TEXT, n INT)",
+		"INSERT INTO words VALUES (1, 'Hello', 7)",
+		"INSERT INTO words VALUES (2, '  pad  ', 1250)",
+		"INSERT INTO words VALUES (3, '', 0)",
+	)
+	return s
+}
+
+func TestFunctions_Text(t *testing.T) {
+	s := newWordsSession(t)
+	s.wantRows("SELECT LOWER(word), UPPER(word), LENGTH(word), REPLACE(word, 'l', 'L') FROM words WHERE id = 1",
+		"[[hello HELLO 5 HeLLo]]")
+	s.wantRows("SELECT '[' || TRIM(word) || ']', TRIM('xxhixx', 'x'), LENGTH(word) FROM words WHERE id = 2", "[[[pad] hi 7]]")
+	s.wantRows("SELECT LENGTH(word), UPPER(word) = '' FROM words WHERE id = 3", "[[0 true]]")
+}
+
+func TestFunctions_Substr(t *testing.T) {
+	s := newWordsSession(t)
+	// positions count from 1; a start before that shortens the length
+	s.wantRows("SELECT SUBSTR(word, 2), SUBSTR(word, 2, 3), SUBSTR(word, 0, 2), SUBSTR(word, -1, 3) FROM words WHERE id = 1",
+		"[[ello ell H H]]")
+	s.wantRows("SELECT '[' || SUBSTR(word, 9) || ']', '[' || SUBSTR(word, 1, 0) || ']' FROM words WHERE id = 1", "[[[] []]]")
+	s.wantErr("SELECT SUBSTR(word, 1, -1) FROM words WHERE id = 1", "negative substring length not allowed")
+}
+
+func TestFunctions_Numbers(t *testing.T) {
+	s := newWordsSession(t)
+	// ROUND to a negative precision rounds half away from zero
+	s.wantRows("SELECT ABS(-n), MOD(-n, 4), ROUND(-n, -1), ROUND(n, -2), ROUND(n) FROM words WHERE id < 3",
+		"[[7 -3 -10 0 7] [1250 -2 -1250 1300 1250]]")
+	s.wantErr("SELECT MOD(n, 0) FROM words WHERE id = 1", "division by zero")
+}
+
+func TestFunctions_Null(t *testing.T) {
+	s := newWordsSession(t)
+	s.wantRows("SELECT UPPER(NULL), ABS(NULL), SUBSTR('abc', NULL), ROUND(n, NULL) FROM words WHERE id = 1",
+		"[[<nil> <nil> <nil> <nil>]]")
+	// a NULL argument ends the call before later arguments are evaluated
+	s.wantRows("SELECT SUBSTR(NULL, MOD(n, 0)) FROM words WHERE id = 1", "[[<nil>]]")
+	s.wantRows("SELECT COALESCE(NULL, word), COALESCE(NULL, NULL, n), NULLIF(n, 1250), NULLIF(NULL, 1) FROM words WHERE id < 3",
+		"[[Hello 7 7 <nil>] [  pad   1250 <nil> <nil>]]")
+	s.wantRows("SELECT COALESCE(NULL, NULL)", "[[<nil>]]")
+}
+
+func TestFunctions_Cast(t *testing.T) {
+	s := newWordsSession(t)
+	s.wantRows("SELECT CAST(n AS TEXT) || '!', CAST(' 42 ' AS INT) + 1, CAST(TRUE AS INT), CAST(NULL AS INT) FROM words WHERE id = 1",
+		"[[7! 43 1 <nil>]]")
+	s.wantErr("SELECT CAST(word AS INT) FROM words WHERE id = 1", "invalid input for type INT: 'Hello'")
+}
+
+func TestFunctions_Dates(t *testing.T) {
+	s := newWordsSession(t)
+	s.wantRows("SELECT EXTRACT(YEAR FROM '2024-02-29 13:45:00'), DATE_PART('doy', '2024-02-29'), EXTRACT(MINUTE FROM '2024-02-29 13:45:00')",
+		"[[2024 60 45]]")
+	s.wantErr("SELECT DATE_PART('year', word) FROM words WHERE id = 1", "invalid timestamp 'Hello'")
+	s.wantErr("SELECT DATE_PART('fortnight', '2024-02-29')", "unsupported date field 'fortnight'")
+}
+
+func TestFunctions_Now(t *testing.T) {
+	s := newWordsSession(t)
+	res := s.mustExec("SELECT NOW(), EXTRACT(YEAR FROM NOW()) FROM words")
+	first := res.Rows[0][0]
+	for _, row := range res.Rows {
+		if row[0] != first {
+			t.Errorf("Expected one NOW() per statement, got %v and %v", first, row[0])
+		}
+	}
+	if got, want := res.Rows[0][1], time.Now().Year(); got != want {
+		t.Errorf("Got year %v, want %d", got, want)
+	}
+}
+
+func TestFunctions_Names(t *testing.T) {
+	s := newWordsSession(t)
+	res := s.mustExec("SELECT lower(word), Length(word), UPPER(word) AS up FROM words WHERE id = 1")
+	if got := fmt.Sprint(res.Columns, res.Rows); got != "[lower(word) length(word) up] [[hello 5 HELLO]]" {
+		t.Errorf("Got %s", got)
+	}
+}
+
+func TestFunctions_PlanErrors(t *testing.T) {
+	s := newWordsSession(t)
+	// empty has no rows, so these are raised before anything is evaluated
+	s.mustExec("CREATE TABLE empty (id INT, word TEXT, n INT)")
+	s.wantErr("SELECT REVERSE(word) FROM empty", "unknown function reverse")
+	s.wantErr("SELECT REPLACE(word, 'a') FROM empty", "function replace takes 3 arguments, got 2")
+	s.wantErr("SELECT SUBSTR(word, 1, 2, 3) FROM empty", "function substr takes 2 to 3 arguments, got 4")
+	s.wantErr("SELECT COALESCE() FROM empty", "function coalesce takes at least 1 arguments, got 0")
+	s.wantErr("SELECT UPPER(n) FROM empty", "function upper expects TEXT for argument 1, got INT")
+	s.wantErr("SELECT id FROM empty WHERE ABS(word) > 1", "function abs expects INT for argument 1, got TEXT")
+	s.wantErr("SELECT COALESCE(word, n) FROM empty", "function coalesce arguments must have the same type, got TEXT and INT")
+	s.wantErr("SELECT LENGTH(UPPER(LENGTH(word))) FROM empty", "function upper expects TEXT for argument 1, got INT")
+	s.wantErr("SELECT UPPER(word) OVER () FROM empty", "function upper is not a window function")
+}
+
+func TestFunctions_RuntimeTypes(t *testing.T) {
+	s := newWordsSession(t)
+	// outer columns are typed only once their values are known
+	s.wantErr("SELECT id FROM words o WHERE EXISTS (SELECT id FROM words WHERE UPPER(o.n) = word)",
+		"function upper expects TEXT for argument 1, got INT")
+}
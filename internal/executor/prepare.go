@@ -0,0 +1,466 @@
+package executor
+
+import (
+	"fmt"
+	"slices"
+
+	"justasimpletoydb/internal/catalog"
+)
+
+// params are the values bound to the parameters of a prepared statement,
+// or only their types while the statement is analyzed.
+type params struct {
+	types  []catalog.ColumnType
+	values []any
+}
+
+func (p *params) typeOf(n int) catalog.ColumnType {
+	if p == nil || n > len(p.types) {
+		return typeUnknown
+	}
+	return p.types[n-1]
+}
+
+// PreparedError is returned for PREPARE of a name that is taken, and for
+// EXECUTE or DEALLOCATE of one that is not.
+type PreparedError struct {
+	Name   string
+	Exists bool
+}
+
+func (e *PreparedError) Error() string {
+	if e.Exists {
+		return fmt.Sprintf("prepared statement %q already exists", e.Name)
+	}
+	return fmt.Sprintf("prepared statement %q does not exist", e.Name)
+}
+
+// Prepared is a statement parsed and typed once, to run many times with
+// different parameter values. It is kept by the session that prepared it.
+type Prepared struct {
+	Stmt  Statement
+	types []catalog.ColumnType // of parameters $1, $2, ...
+}
+
+// ParamTypes returns the type of each parameter: INT, TEXT or BOOLEAN.
+func (p *Prepared) ParamTypes() []string {
+	types := make([]string, len(p.types))
+	for i, t := range p.types {
+		types[i] = typeString(t)
+	}
+	return types
+}
+
+// Bind checks args against the parameter types and returns the statement
+// running with them. INT parameters take an int, TEXT a string and
+// BOOLEAN a bool; nil is NULL.
+func (p *Prepared) Bind(args []any) (Statement, error) {
+	if len(args) != len(p.types) {
+		return nil, fmt.Errorf("wrong number of parameters: expected %d, got %d", len(p.types), len(args))
+	}
+	for i, a := range args {
+		if a != nil && valueType(a) != p.types[i] {
+			return nil, fmt.Errorf("parameter $%d is of type %s but argument is of type %s", i+1, typeString(p.types[i]), typeName(a))
+		}
+	}
+	return &boundStmt{prepared: p, params: &params{types: p.types, values: args}}, nil
+}
+
+// boundStmt is a prepared statement with values for its parameters.
+type boundStmt struct {
+	prepared *Prepared
+	params   *params
+}
+
+func (b *boundStmt) Execute(ex *Executor) (*ExecResult, error) {
+	ex.params = b.params
+	defer func() { ex.params = nil }()
+	return b.prepared.Stmt.Execute(ex)
+}
+
+// Prepare types the parameters of stmt against the catalog, so it can be
+// bound and run without being parsed again. Only queries, INSERT, UPDATE
+// and DELETE can have parameters.
+func (ex *Executor) Prepare(stmt Statement) (*Prepared, error) {
+	defer ex.unlock()
+	return ex.prepare(stmt, nil)
+}
+
+// prepare is Prepare with the types of the leading parameters declared.
+func (ex *Executor) prepare(stmt Statement, declared []catalog.ColumnType) (*Prepared, error) {
+	ctx := newExecContext(ex)
+	ctx.params = &params{types: slices.Clone(declared)}
+	in := &inference{ctx: ctx}
+	in.statement(stmt)
+	if in.err != nil {
+		return nil, in.err
+	}
+	// parameters nothing says anything about are TEXT, like a quoted literal
+	types := ctx.params.types
+	for i, t := range types {
+		if t == typeUnknown {
+			types[i] = catalog.TypeText
+		}
+	}
+	p := &Prepared{Stmt: stmt, types: types}
+	if _, err := ex.describe(stmt, &params{types: types}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DescribePrepared is Describe for a prepared statement, whose parameters
+// have their inferred types.
+func (ex *Executor) DescribePrepared(p *Prepared) (*ExecResult, error) {
+	defer ex.unlock()
+	return ex.describe(p.Stmt, &params{types: p.types})
+}
+
+// inference works out the type of each parameter of a statement from the
+// columns, operators and functions it is used with. A parameter used in
+// two ways must get the same type from both.
+type inference struct {
+	ctx *execContext
+	err error
+}
+
+// note records that parameter e, if it is one, is expected to have type t.
+func (in *inference) note(e Expr, t catalog.ColumnType) {
+	p, ok := e.(*Param)
+	if !ok || in.err != nil {
+		return
+	}
+	prm := in.ctx.params
+	for len(prm.types) < p.Index {
+		prm.types = append(prm.types, typeUnknown)
+	}
+	switch cur := prm.types[p.Index-1]; {
+	case t == typeUnknown:
+	case cur == typeUnknown:
+		prm.types[p.Index-1] = t
+	case cur != t:
+		in.err = fmt.Errorf("inconsistent types deduced for parameter %s: %s versus %s", p.String(), typeString(cur), typeString(t))
+	}
+}
+
+func (in *inference) statement(stmt Statement) {
+	switch s := stmt.(type) {
+	case Query:
+		in.query(s)
+
+	case *InsertStmt:
+		schema, err := targetTable(in.ctx.ex, s.Table)
+		if err != nil {
+			in.err = err
+			return
+		}
+		targets, err := targetColumns(schema.Columns, s.Table, s.Columns)
+		if err != nil {
+			in.err = err
+			return
+		}
+		cols := tableCols(schema)
+		for _, row := range s.Rows {
+			for i, e := range row {
+				if i < len(targets) {
+					in.expr(e, nil, schema.Columns[targets[i]].Type)
+				}
+			}
+		}
+		if sel, ok := s.Query.(*SelectStmt); ok {
+			for i, it := range sel.Items {
+				if i < len(targets) {
+					in.note(it.Expr, schema.Columns[targets[i]].Type)
+				}
+			}
+		}
+		if s.Query != nil {
+			in.query(s.Query)
+		}
+		if s.OnConflict != nil {
+			in.assignments(schema, s.OnConflict.Set, append(slices.Clone(cols), excludedCols(cols)...))
+			in.expr(s.OnConflict.Where, cols, typeBool)
+		}
+		in.items(s.Returning, cols)
+
+	case *UpdateStmt:
+		schema, err := targetTable(in.ctx.ex, s.Table)
+		if err != nil {
+			in.err = err
+			return
+		}
+		cols := tableCols(schema)
+		in.assignments(schema, s.Set, cols)
+		in.expr(s.Where, cols, typeBool)
+		in.items(s.Returning, cols)
+
+	case *DeleteStmt:
+		schema, err := targetTable(in.ctx.ex, s.Table)
+		if err != nil {
+			in.err = err
+			return
+		}
+		cols := tableCols(schema)
+		in.expr(s.Where, cols, typeBool)
+		in.items(s.Returning, cols)
+	}
+}
+
+func (in *inference) assignments(schema *catalog.TableSchema, set []Assignment, src []colRef) {
+	for _, a := range set {
+		typ := typeUnknown
+		if i := schema.ColumnIndex(a.Column); i >= 0 {
+			typ = schema.Columns[i].Type
+		}
+		in.expr(a.Value, src, typ)
+	}
+}
+
+func (in *inference) items(items []SelectItem, src []colRef) {
+	for _, it := range items {
+		in.expr(it.Expr, src, typeUnknown)
+	}
+}
+
+func (in *inference) query(q Query) {
+	switch s := q.(type) {
+	case *SelectStmt:
+		in.ctx.pushCTEs(s.WithRecursive, s.With)
+		defer in.ctx.popCTEs()
+		for _, c := range s.With {
+			in.query(c.Query)
+		}
+		src, err := in.ctx.sourceCols(s.From)
+		if err != nil {
+			in.err = err
+			return
+		}
+		in.items(s.Items, src)
+		if s.From != nil {
+			for _, j := range s.From.Joins {
+				in.expr(j.On, src, typeBool)
+			}
+		}
+		in.expr(s.Where, src, typeBool)
+
+	case *SetOpStmt:
+		in.ctx.pushCTEs(s.WithRecursive, s.With)
+		defer in.ctx.popCTEs()
+		for _, c := range s.With {
+			in.query(c.Query)
+		}
+		in.query(s.Left)
+		in.query(s.Right)
+	}
+}
+
+// expr notes the parameters of e, an expression over the columns of src
+// whose value is expected to have type want. Columns of enclosing queries
+// have no known type here.
+func (in *inference) expr(e Expr, src []colRef, want catalog.ColumnType) {
+	if e == nil || in.err != nil {
+		return
+	}
+	typeOf := func(e Expr) catalog.ColumnType { return in.ctx.exprType(e, src) }
+	switch n := e.(type) {
+	case *Param:
+		in.note(n, want)
+
+	case *BinaryExpr:
+		var left, right catalog.ColumnType
+		switch n.Op {
+		case "AND", "OR":
+			left, right = typeBool, typeBool
+		case "+", "-", "*", "/", "%":
+			left, right = catalog.TypeInt, catalog.TypeInt
+		case "||":
+			left, right = catalog.TypeText, catalog.TypeText
+		default:
+			// comparisons: each side is typed like the other
+			left, right = typeOf(n.Right), typeOf(n.Left)
+		}
+		in.expr(n.Left, src, left)
+		in.expr(n.Right, src, right)
+
+	case *UnaryExpr:
+		if n.Op == "-" {
+			in.expr(n.Operand, src, catalog.TypeInt)
+		} else {
+			in.expr(n.Operand, src, typeBool)
+		}
+
+	case *IsNullExpr:
+		in.expr(n.Operand, src, typeUnknown)
+
+	case *CaseExpr:
+		cond := typeBool
+		if n.Operand != nil {
+			cond = typeOf(n.Operand)
+			for _, w := range n.Whens {
+				if cond != typeUnknown {
+					break
+				}
+				cond = typeOf(w.Cond)
+			}
+			in.expr(n.Operand, src, cond)
+		}
+		result := want
+		if result == typeUnknown {
+			result = typeOf(n)
+		}
+		for _, w := range n.Whens {
+			in.expr(w.Cond, src, cond)
+			in.expr(w.Result, src, result)
+		}
+		in.expr(n.Else, src, result)
+
+	case *FuncCall:
+		fn, ok := scalarFuncs[n.Name]
+		if !ok || len(fn.params) == 0 {
+			return
+		}
+		// arguments of typeAny parameters share the type of the known ones
+		common := typeUnknown
+		for i, a := range n.Args {
+			if fn.param(i) == typeAny && common == typeUnknown {
+				common = typeOf(a)
+			}
+		}
+		for i, a := range n.Args {
+			t := fn.param(i)
+			if t == typeAny {
+				t = common
+			}
+			in.expr(a, src, t)
+		}
+
+	case *CastExpr:
+		in.expr(n.Operand, src, typeUnknown)
+
+	case *InExpr:
+		typ := typeOf(n.Left)
+		if n.Subquery != nil {
+			if cols, err := in.ctx.queryCols(n.Subquery); err == nil && len(cols) == 1 && typ == typeUnknown {
+				typ = cols[0].typ
+			}
+			in.query(n.Subquery)
+		}
+		for _, it := range n.List {
+			if typ != typeUnknown {
+				break
+			}
+			typ = typeOf(it)
+		}
+		in.expr(n.Left, src, typ)
+		for _, it := range n.List {
+			in.expr(it, src, typ)
+		}
+
+	case *ExistsExpr:
+		in.query(n.Subquery)
+
+	case *SubqueryExpr:
+		in.query(n.Subquery)
+
+	case *WindowFunc:
+		for _, a := range n.Args {
+			in.expr(a, src, typeUnknown)
+		}
+		for _, e := range n.Window.PartitionBy {
+			in.expr(e, src, typeUnknown)
+		}
+		for _, o := range n.Window.OrderBy {
+			in.expr(o.Expr, src, typeUnknown)
+		}
+	}
+}
+
+// PrepareStmt is "PREPARE name [(type, ...)] AS statement".
+type PrepareStmt struct {
+	Name  string
+	Types []catalog.ColumnType // declared types of the leading parameters
+	Stmt  Statement
+}
+
+func (s *PrepareStmt) Execute(ex *Executor) (*ExecResult, error) {
+	switch s.Stmt.(type) {
+	case Query, *InsertStmt, *UpdateStmt, *DeleteStmt:
+	default:
+		return nil, fmt.Errorf("only SELECT, INSERT, UPDATE and DELETE statements can be prepared")
+	}
+	if _, ok := ex.prepared[s.Name]; ok {
+		return nil, &PreparedError{Name: s.Name, Exists: true}
+	}
+	p, err := ex.prepare(s.Stmt, s.Types)
+	if err != nil {
+		return nil, err
+	}
+	ex.prepared[s.Name] = p
+	return &ExecResult{Message: "PREPARE"}, nil
+}
+
+// ExecuteStmt is "EXECUTE name [(arg, ...)]", running a statement prepared
+// by PREPARE with the values of args for its parameters.
+type ExecuteStmt struct {
+	Name string
+	Args []Expr
+}
+
+func (s *ExecuteStmt) Execute(ex *Executor) (*ExecResult, error) {
+	p, err := ex.lookupPrepared(s.Name)
+	if err != nil {
+		return nil, err
+	}
+	ctx := newExecContext(ex)
+	args := make([]any, len(s.Args))
+	for i, a := range s.Args {
+		if args[i], err = ctx.eval(a, nil); err != nil {
+			return nil, err
+		}
+	}
+	bound, err := p.Bind(args)
+	if err != nil {
+		return nil, fmt.Errorf("prepared statement %q: %w", s.Name, err)
+	}
+	return bound.Execute(ex)
+}
+
+// PreparedStmt returns the statement EXECUTE stmt runs, or stmt itself
+// for other statements.
+func (ex *Executor) PreparedStmt(stmt Statement) Statement {
+	switch s := stmt.(type) {
+	case *ExecuteStmt:
+		if p, ok := ex.prepared[s.Name]; ok {
+			return p.Stmt
+		}
+	case *boundStmt:
+		return s.prepared.Stmt
+	}
+	return stmt
+}
+
+func (ex *Executor) lookupPrepared(name string) (*Prepared, error) {
+	p, ok := ex.prepared[name]
+	if !ok {
+		return nil, &PreparedError{Name: name}
+	}
+	return p, nil
+}
+
+// DeallocateStmt is "DEALLOCATE [PREPARE] name | ALL".
+type DeallocateStmt struct {
+	Name string
+	All  bool
+}
+
+func (s *DeallocateStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if s.All {
+		clear(ex.prepared)
+		return &ExecResult{Message: "DEALLOCATE ALL"}, nil
+	}
+	if _, err := ex.lookupPrepared(s.Name); err != nil {
+		return nil, err
+	}
+	delete(ex.prepared, s.Name)
+	return &ExecResult{Message: "DEALLOCATE"}, nil
+}
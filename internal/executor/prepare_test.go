@@ -0,0 +1,95 @@
+package executor_test
+
+import (
+	"errors"
+	"testing"
+
+	"justasimpletoydb/internal/executor"
+)
+
+const shelfSchema = `CREATE TABLE books (id INT, title TEXT, shelf INT);
+CREATE TABLE shelves (id INT, room TEXT);
+INSERT INTO books VALUES (1, 'dune', 1), (2, 'emma', 2), (3, 'ulysses', 1);
+INSERT INTO shelves VALUES (1, 'hall'), (2, 'study')`
+
+func TestPrepare(t *testing.T) {
+	s := setupSession(t, shelfSchema)
+	if res := s.mustExec("PREPARE byid AS SELECT title FROM books WHERE id = $1"); res.Message != "PREPARE" {
+		t.Errorf("Unexpected message %q", res.Message)
+	}
+	s.wantRows("EXECUTE byid(2)", "[[emma]]")
+	s.wantRows("EXECUTE byid(1 + 2)", "[[ulysses]]")
+	s.wantRows("EXECUTE byid(NULL)", "[]")
+	// ? numbers the parameters in order
+	s.mustExec("PREPARE span AS SELECT id FROM books WHERE id >= ? AND id <= ?")
+	s.wantRows("EXECUTE span(2, 3)", "[[2] [3]]")
+	// parameters in writes and RETURNING
+	s.mustExec("PREPARE addbook AS INSERT INTO books VALUES ($1, $2, $3) RETURNING title")
+	s.wantRows("EXECUTE addbook(4, 'odyssey', 2)", "[[odyssey]]")
+	s.mustExec("PREPARE move (INT) AS UPDATE books SET shelf = $1 WHERE title = $2")
+	if res := s.mustExec("EXECUTE move(1, 'emma')"); res.Affected != 1 {
+		t.Errorf("Expected 1 row updated, got %d", res.Affected)
+	}
+	s.wantRows("SELECT title FROM books WHERE shelf = 2", "[[odyssey]]")
+	// the statement sees the catalog as it is when it runs
+	s.mustExec("INSERT INTO books VALUES (5, 'beloved', 1)")
+	s.wantRows("EXECUTE byid(5)", "[[beloved]]")
+}
+
+func TestPrepare_Join(t *testing.T) {
+	s := setupSession(t, shelfSchema)
+	// $1 is compared with shelves.room in ON, so it is TEXT
+	s.mustExec("PREPARE inroom AS SELECT b.title FROM books b JOIN shelves s ON b.shelf = s.id AND s.room = $1")
+	s.wantRows("EXECUTE inroom('hall')", "[[dune] [ulysses]]")
+	s.wantRows("EXECUTE inroom('attic')", "[]")
+	s.wantErr("EXECUTE inroom(1)", "parameter $1 is of type TEXT but argument is of type INT")
+	s.mustExec("PREPARE onshelf AS SELECT s.room FROM books b JOIN shelves s ON b.shelf = s.id AND b.id = $1")
+	s.wantRows("EXECUTE onshelf(2)", "[[study]]")
+	s.wantErr("EXECUTE onshelf('2')", "parameter $1 is of type INT but argument is of type TEXT")
+}
+
+func TestPrepare_Errors(t *testing.T) {
+	s := setupSession(t, shelfSchema+"; PREPARE byid AS SELECT title FROM books WHERE id = $1")
+	s.wantErr("EXECUTE byid", `prepared statement "byid": wrong number of parameters: expected 1, got 0`)
+	s.wantErr("EXECUTE byid(1, 2)", `prepared statement "byid": wrong number of parameters: expected 1, got 2`)
+	s.wantErr("EXECUTE byid('one')", `prepared statement "byid": parameter $1 is of type INT but argument is of type TEXT`)
+	s.wantErr("EXECUTE nope(1)", `prepared statement "nope" does not exist`)
+	s.wantErr("DEALLOCATE nope", `prepared statement "nope" does not exist`)
+
+	// re-PREPARE fails and keeps the existing statement
+	_, err := s.exec("PREPARE byid AS SELECT id FROM books WHERE title = $1")
+	var perr *executor.PreparedError
+	if !errors.As(err, &perr) || !perr.Exists || perr.Name != "byid" {
+		t.Errorf("Expected prepared statement byid to exist, got %v", err)
+	}
+	s.wantRows("EXECUTE byid(1)", "[[dune]]")
+
+	s.wantErr("PREPARE p AS SELECT title FROM books WHERE id = $1 AND title = $1", "inconsistent types deduced for parameter $1: INT versus TEXT")
+	// a declared type must agree with the one inferred
+	s.wantErr("PREPARE p (TEXT) AS SELECT title FROM books WHERE id = $1", "inconsistent types deduced for parameter $1: TEXT versus INT")
+	s.wantErr("PREPARE p AS SELECT title FROM missing WHERE id = $1", "table not found: missing")
+	s.wantErr("PREPARE p AS CREATE TABLE t (id INT)", "only SELECT, INSERT, UPDATE and DELETE statements can be prepared")
+	s.wantErr("EXECUTE p(1)", `prepared statement "p" does not exist`)
+}
+
+func TestDeallocate(t *testing.T) {
+	e := newTestEngine(t)
+	s := newSession(t, e)
+	s.mustExec(shelfSchema, "PREPARE a AS SELECT title FROM books WHERE id = $1; PREPARE b AS SELECT room FROM shelves WHERE id = $1")
+	if res := s.mustExec("DEALLOCATE a"); res.Message != "DEALLOCATE" {
+		t.Errorf("Unexpected message %q", res.Message)
+	}
+	s.wantErr("EXECUTE a(1)", `prepared statement "a" does not exist`)
+	s.wantRows("EXECUTE b(1)", "[[hall]]")
+	// the name is free again
+	s.mustExec("PREPARE a AS SELECT id FROM books WHERE title = $1")
+	s.wantRows("EXECUTE a('emma')", "[[2]]")
+	if res := s.mustExec("DEALLOCATE ALL"); res.Message != "DEALLOCATE ALL" {
+		t.Errorf("Unexpected message %q", res.Message)
+	}
+	s.wantErr("EXECUTE a('emma')", "does not exist")
+	s.wantErr("EXECUTE b(1)", "does not exist")
+	// prepared statements belong to the session
+	s.mustExec("PREPARE c AS SELECT id FROM books WHERE id = $1")
+	newSession(t, e).wantErr("EXECUTE c(1)", `prepared statement "c" does not exist`)
+}
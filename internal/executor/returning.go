@@ -0,0 +1,96 @@
+package executor
+
+import "fmt"
+
+// checkReturning plans a RETURNING list over the columns of the target
+// table, before anything is written.
+func (ctx *execContext) checkReturning(items []SelectItem, cols []colRef) error {
+	var exprs []Expr
+	for _, it := range items {
+		if it.Expr == nil {
+			continue
+		}
+		if containsWindowFunc(it.Expr) {
+			return fmt.Errorf("window functions are not allowed in RETURNING")
+		}
+		exprs = append(exprs, it.Expr)
+	}
+	// RETURNING is only evaluated per row, so without this a statement
+	// writing no rows would accept unknown columns
+	if err := checkColumnRefs(exprs, cols); err != nil {
+		return err
+	}
+	if err := ctx.checkExprs(exprs, cols); err != nil {
+		return err
+	}
+	_, err := ctx.outputCols(&SelectStmt{Items: items}, cols)
+	return err
+}
+
+// checkColumnRefs reports the first column reference in exprs that can't
+// be resolved. Like a rowScope chain, each reference is looked up in the
+// scopes in order. Subqueries are not entered.
+func checkColumnRefs(exprs []Expr, scopes ...[]colRef) error {
+	var err error
+	for _, e := range exprs {
+		walkExpr(e, func(n Expr) bool {
+			ref, ok := n.(*ColumnRef)
+			if !ok {
+				return true
+			}
+			for _, cols := range scopes {
+				idx, rerr := resolveColumn(cols, ref)
+				if rerr != nil || idx >= 0 {
+					err = rerr
+					return err == nil
+				}
+			}
+			err = fmt.Errorf("unknown column %q", ref.String())
+			return false
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returning evaluates a RETURNING list against the rows a statement is
+// about to write and fills in the result columns and rows. Statements call
+// it before writing, so an error here leaves the table unchanged.
+func (ctx *execContext) returning(items []SelectItem, cols []colRef, rows [][]any, res *ExecResult) error {
+	sel := &SelectStmt{Items: items}
+	out, err := ctx.outputCols(sel, cols)
+	if err != nil {
+		return err
+	}
+	rel := &relation{cols: out, rows: make([][]any, 0, len(rows))}
+	for _, row := range rows {
+		projected, err := sel.project(ctx, &rowScope{cols: cols, row: row})
+		if err != nil {
+			return err
+		}
+		rel.rows = append(rel.rows, projected)
+	}
+	res.Columns = rel.columnNames()
+	res.Types = rel.columnTypes()
+	res.Rows = rel.rows
+	return nil
+}
+
+// returningCols returns the columns of the RETURNING list of a statement
+// writing to table, or nil without RETURNING.
+func (ctx *execContext) returningCols(table string, items []SelectItem) ([]colRef, error) {
+	if items == nil {
+		return nil, nil
+	}
+	schema, err := targetTable(ctx.ex, table)
+	if err != nil {
+		return nil, err
+	}
+	cols := tableCols(schema)
+	if err := ctx.checkReturning(items, cols); err != nil {
+		return nil, err
+	}
+	return ctx.outputCols(&SelectStmt{Items: items}, cols)
+}
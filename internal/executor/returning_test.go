@@ -0,0 +1,78 @@
+package executor_test
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newCountersSession(t *testing.T) *session {
+	return setupSession(t, `CREATE TABLE counters (id INT UNIQUE, a INT);
+		INSERT INTO counters VALUES (1, 1), (2, 2), (3, 3)`)
+}
+
+func TestUpdate_Returning(t *testing.T) {
+	s := newCountersSession(t)
+	res := s.mustExec("UPDATE counters SET a = a * 10 WHERE id > 1 RETURNING id, a AS new")
+	if got := fmt.Sprintf("%s %v %v", res.Message, res.Columns, res.Rows); got != "UPDATE 2 [id new] [[2 20] [3 30]]" {
+		t.Errorf("Got %s", got)
+	}
+	s.wantRows("UPDATE counters SET a = 0 WHERE id = 1 RETURNING *", "[[1 0]]")
+	// a statement matching nothing still checks its RETURNING list
+	s.wantRows("UPDATE counters SET a = 0 WHERE id > 5 RETURNING id", "[]")
+	s.wantErr("UPDATE counters SET a = 0 WHERE id > 5 RETURNING b", `unknown column "b"`)
+}
+
+func TestUpdate_ReturningErrorLeavesRows(t *testing.T) {
+	s := newCountersSession(t)
+	// only the new a of row 1 is 0
+	s.wantErr("UPDATE counters SET a = a - 1 RETURNING id, 10 / a", "division by zero")
+	s.wantRows("SELECT id, a FROM counters", "[[1 1] [2 2] [3 3]]")
+	s.wantErr("UPDATE counters SET a = 0 WHERE a = 1 RETURNING 10 / a", "division by zero")
+	s.wantRows("SELECT a FROM counters WHERE id = 1", "[[1]]")
+}
+
+func TestDelete_Returning(t *testing.T) {
+	s := newCountersSession(t)
+	res := s.mustExec("DELETE FROM counters WHERE a > 1 RETURNING id, a * 2")
+	if got := fmt.Sprintf("%s %v", res.Message, res.Rows); got != "DELETE 2 [[2 4] [3 6]]" {
+		t.Errorf("Got %s", got)
+	}
+	s.wantRows("SELECT id FROM counters", "[[1]]")
+	s.wantRows("DELETE FROM counters WHERE id = 9 RETURNING *", "[]")
+}
+
+func TestDelete_ReturningErrorLeavesRows(t *testing.T) {
+	s := newCountersSession(t)
+	s.wantErr("DELETE FROM counters RETURNING 1 / (a - 2)", "division by zero")
+	s.wantRows("SELECT id FROM counters", "[[1] [2] [3]]")
+
+	// nor are the rows cascaded to deleted
+	s.mustExec(`CREATE TABLE refs (id INT, counter_id INT REFERENCES counters (id) ON DELETE CASCADE);
+		INSERT INTO refs VALUES (10, 1), (20, 2)`)
+	s.wantErr("DELETE FROM counters WHERE id < 3 RETURNING 1 / (a - 2)", "division by zero")
+	s.wantRows("SELECT id FROM refs", "[[10] [20]]")
+	s.wantRows("DELETE FROM counters WHERE id < 3 RETURNING id", "[[1] [2]]")
+	s.wantRows("SELECT id FROM refs", "[]")
+}
+
+func TestInsert_Returning(t *testing.T) {
+	s := newCountersSession(t)
+	res := s.mustExec("INSERT INTO counters VALUES (4, 4), (5, 5) RETURNING id * 10")
+	if got := fmt.Sprintf("%s %v", res.Message, res.Rows); got != "INSERT 0 2 [[40] [50]]" {
+		t.Errorf("Got %s", got)
+	}
+	// rows skipped on conflict are neither counted nor returned
+	res = s.mustExec("INSERT INTO counters VALUES (5, 0), (6, 6) ON CONFLICT DO NOTHING RETURNING id")
+	if got := fmt.Sprintf("%s %v", res.Message, res.Rows); got != "INSERT 0 1 [[6]]" {
+		t.Errorf("Got %s", got)
+	}
+}
+
+func TestInsert_ReturningErrorLeavesRows(t *testing.T) {
+	s := newCountersSession(t)
+	s.wantErr("INSERT INTO counters VALUES (4, 4), (5, 0) RETURNING 5 / a", "division by zero")
+	s.wantRows("SELECT id FROM counters WHERE id > 3", "[]")
+	// nor does the row it would have updated change
+	s.wantErr("INSERT INTO counters VALUES (1, 9) ON CONFLICT (id) DO UPDATE SET a = 0 RETURNING 5 / a", "division by zero")
+	s.wantRows("SELECT a FROM counters WHERE id = 1", "[[1]]")
+}
@@ -0,0 +1,145 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"justasimpletoydb/internal/lock"
+	"justasimpletoydb/internal/storage"
+)
+
+// ErrConcurrentUpdate is returned when a row a statement found was
+// changed or deleted by another session before the statement could lock
+// it, and the statement can't look for its new version.
+var ErrConcurrentUpdate = errors.New("could not serialize access due to concurrent update")
+
+// Locking is the "FOR UPDATE [NOWAIT | SKIP LOCKED]" clause of a SELECT.
+// The rows the query returns are locked like those an UPDATE changes, so
+// that no other session changes or locks them until the transaction block
+// ends; the clause says what to do about rows another session holds.
+type Locking struct {
+	Wait lock.Wait // lock.Block waits for them
+}
+
+func (l *Locking) String() string {
+	switch l.Wait {
+	case lock.NoWait:
+		return "FOR UPDATE NOWAIT"
+	case lock.SkipLocked:
+		return "FOR UPDATE SKIP LOCKED"
+	}
+	return "FOR UPDATE"
+}
+
+// checkLocking rejects FOR UPDATE where the rows returned aren't rows of
+// a table.
+func (ctx *execContext) checkLocking(s *SelectStmt) error {
+	switch {
+	case s.Locking == nil:
+		return nil
+	case s.Distinct:
+		return fmt.Errorf("FOR UPDATE is not allowed with DISTINCT clause")
+	case len(windowFuncsOf(s.Items)) > 0:
+		return fmt.Errorf("FOR UPDATE is not allowed with window functions")
+	case s.From == nil:
+		return nil
+	case len(s.From.Joins) > 0:
+		return fmt.Errorf("FOR UPDATE is not supported with JOIN")
+	case ctx.lookupCTE(s.From.Name) != nil:
+		return fmt.Errorf("FOR UPDATE cannot be applied to WITH query %s", s.From.Name)
+	}
+	if view, err := ctx.ex.engine.Catalog.GetView(s.From.Name); err == nil {
+		if view.Materialized {
+			return fmt.Errorf("cannot lock rows in materialized view %q", s.From.Name)
+		}
+		return fmt.Errorf("cannot lock rows in view %q", s.From.Name)
+	}
+	return nil
+}
+
+// scanLocked reads the rows of a FROM table passing where and locks them
+// for FOR UPDATE.
+func (ctx *execContext) scanLocked(ref *TableRef, where Expr, outer *rowScope, wait lock.Wait) (*relation, error) {
+	cols, err := ctx.sourceCols(ref)
+	if err != nil {
+		return nil, err
+	}
+	table, err := ctx.ex.openTable(ref.Name, lock.IntentionExclusive)
+	if err != nil {
+		return nil, err
+	}
+	defer table.Close()
+
+	locked, err := ctx.lockRows(table, ref.Name, func(row []any) (bool, error) {
+		return ctx.matches(where, &rowScope{cols: cols, row: row, outer: outer})
+	}, wait)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]any, len(locked))
+	for i, r := range locked {
+		rows[i] = r.Values
+	}
+	return &relation{cols: cols, rows: rows}, nil
+}
+
+// lockRows locks the rows of a table that match for the session and
+// returns them, waiting for, skipping or failing on the rows other
+// sessions hold as wait says. Rows are matched before they are locked, so
+// one may be changed or deleted by the session holding it in between;
+// its new version, a new tuple, isn't among those locked. The table is
+// then read and matched again, which finds it.
+func (ctx *execContext) lockRows(table *storage.Table, name string, match func(row []any) (bool, error), wait lock.Wait) ([]storage.Row, error) {
+	for {
+		rows, err := table.ScanRows()
+		if err != nil {
+			return nil, err
+		}
+		var locked []storage.Row
+		var tids []storage.TID
+		for _, r := range rows {
+			ok, err := match(r.Values)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if ok, err = ctx.ex.lockRow(name, r.TID, wait); err != nil {
+				return nil, err
+			}
+			if ok {
+				locked = append(locked, r)
+				tids = append(tids, r.TID)
+			}
+		}
+		live, err := table.Live(tids)
+		if err != nil {
+			return nil, err
+		}
+		if live {
+			return locked, nil
+		}
+	}
+}
+
+// lockStored locks rows a statement found some other way than by reading
+// the whole table, such as through an index, waiting for other sessions.
+// It fails with ErrConcurrentUpdate if a row was changed in the meantime.
+func (ctx *execContext) lockStored(table *storage.Table, name string, rows []storage.Row) error {
+	tids := make([]storage.TID, len(rows))
+	for i, r := range rows {
+		if _, err := ctx.ex.lockRow(name, r.TID, lock.Block); err != nil {
+			return err
+		}
+		tids[i] = r.TID
+	}
+	live, err := table.Live(tids)
+	if err != nil {
+		return err
+	}
+	if !live {
+		return ErrConcurrentUpdate
+	}
+	return nil
+}
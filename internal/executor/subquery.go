@@ -0,0 +1,337 @@
+package executor
+
+import (
+	"fmt"
+)
+
+// subplan records how a nested SELECT is evaluated within one statement.
+//
+// Uncorrelated subqueries run once and their result is reused for every
+// outer row. IN (SELECT ...) and simple correlated EXISTS are turned into
+// hash semi-joins (anti-joins under NOT): the inner side is materialized
+// into a set once and each outer row only probes it.
+type subplan struct {
+	correlated bool
+
+	// materialized result of an uncorrelated subquery
+	result *relation
+
+	// hash set over the first output column (or the decorrelated join key)
+	set     map[any]struct{}
+	hasNull bool
+
+	// probe is the outer side of a decorrelated EXISTS; nil otherwise
+	probe        Expr
+	rewriteTried bool
+}
+
+func (ctx *execContext) subplanFor(q Query) (*subplan, error) {
+	if sp, ok := ctx.subplans[q]; ok {
+		return sp, nil
+	}
+	correlated, err := ctx.correlated(q)
+	if err != nil {
+		return nil, err
+	}
+	sp := &subplan{correlated: correlated}
+	ctx.subplans[q] = sp
+	return sp, nil
+}
+
+// materialize runs an uncorrelated subquery once and caches its rows.
+func (ctx *execContext) materialize(q Query, sp *subplan) error {
+	if sp.result != nil {
+		return nil
+	}
+	rel, err := q.run(ctx, nil)
+	if err != nil {
+		return err
+	}
+	sp.result = rel
+	return nil
+}
+
+// buildSet hashes the first column of rows for semi-join probing.
+func (sp *subplan) buildSet(rows [][]any) {
+	sp.set = make(map[any]struct{}, len(rows))
+	for _, row := range rows {
+		if row[0] == nil {
+			sp.hasNull = true
+			continue
+		}
+		sp.set[row[0]] = struct{}{}
+	}
+}
+
+func (ctx *execContext) inSubquery(n *InExpr, left any, sc *rowScope) (*bool, error) {
+	sp, err := ctx.subplanFor(n.Subquery)
+	if err != nil {
+		return nil, err
+	}
+
+	if sp.correlated {
+		rel, err := n.Subquery.run(ctx, sc)
+		if err != nil {
+			return nil, err
+		}
+		if len(rel.cols) != 1 {
+			return nil, fmt.Errorf("subquery in IN must return exactly one column, got %d", len(rel.cols))
+		}
+		list := make([]Expr, len(rel.rows))
+		for i, row := range rel.rows {
+			list[i] = &Literal{Value: row[0]}
+		}
+		return ctx.inList(list, left, sc)
+	}
+
+	if sp.set == nil {
+		rel, err := n.Subquery.run(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(rel.cols) != 1 {
+			return nil, fmt.Errorf("subquery in IN must return exactly one column, got %d", len(rel.cols))
+		}
+		sp.buildSet(rel.rows)
+	}
+
+	if left == nil {
+		if len(sp.set) == 0 && !sp.hasNull {
+			f := false
+			return &f, nil
+		}
+		return nil, nil
+	}
+	_, found := sp.set[left]
+	if !found && sp.hasNull {
+		return nil, nil
+	}
+	return &found, nil
+}
+
+func (ctx *execContext) evalExists(n *ExistsExpr, sc *rowScope) (any, error) {
+	sp, err := ctx.subplanFor(n.Subquery)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel, ok := n.Subquery.(*SelectStmt); ok && sp.correlated && !sp.rewriteTried {
+		sp.rewriteTried = true
+		if err := ctx.decorrelateExists(sel, sp); err != nil {
+			return nil, err
+		}
+	}
+	if sp.probe != nil {
+		v, err := ctx.eval(sp.probe, sc)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return false, nil
+		}
+		_, found := sp.set[v]
+		return found, nil
+	}
+
+	if sp.correlated {
+		rel, err := n.Subquery.run(ctx, sc)
+		if err != nil {
+			return nil, err
+		}
+		return len(rel.rows) > 0, nil
+	}
+	if err := ctx.materialize(n.Subquery, sp); err != nil {
+		return nil, err
+	}
+	return len(sp.result.rows) > 0, nil
+}
+
+func (ctx *execContext) evalScalarSubquery(n *SubqueryExpr, sc *rowScope) (any, error) {
+	sp, err := ctx.subplanFor(n.Subquery)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := sp.result
+	if sp.correlated {
+		rel, err = n.Subquery.run(ctx, sc)
+	} else {
+		err = ctx.materialize(n.Subquery, sp)
+		rel = sp.result
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rel.cols) != 1 {
+		return nil, fmt.Errorf("subquery must return only one column, got %d", len(rel.cols))
+	}
+	if len(rel.rows) > 1 {
+		return nil, fmt.Errorf("more than one row returned by a subquery used as an expression")
+	}
+	if len(rel.rows) == 0 {
+		return nil, nil
+	}
+	return rel.rows[0][0], nil
+}
+
+// decorrelateExists rewrites EXISTS (SELECT ... FROM t WHERE t.k = outer.x AND rest)
+// into a hash semi-join: the set of t.k over rows satisfying rest is built once,
+// and each outer row probes it with outer.x. If the WHERE clause has no such
+// shape the subplan is left as is and the subquery runs per outer row, as
+// it does with FOR UPDATE, which locks only the rows outer rows match.
+func (ctx *execContext) decorrelateExists(q *SelectStmt, sp *subplan) error {
+	if q.From == nil || q.Locking != nil {
+		return nil
+	}
+	inner, err := ctx.sourceCols(q.From)
+	if err != nil {
+		return err
+	}
+
+	conjuncts := splitAnd(q.Where)
+	for i, c := range conjuncts {
+		eq, ok := c.(*BinaryExpr)
+		if !ok || eq.Op != "=" {
+			continue
+		}
+		for _, side := range [][2]Expr{{eq.Left, eq.Right}, {eq.Right, eq.Left}} {
+			key, probe := side[0], side[1]
+			if !refsOnly(key, inner, true) || !refsOnly(probe, inner, false) {
+				continue
+			}
+			rest := joinAnd(append(append([]Expr{}, conjuncts[:i]...), conjuncts[i+1:]...))
+			keyQuery := &SelectStmt{
+				Items: []SelectItem{{Expr: key}},
+				From:  q.From,
+				Where: rest,
+			}
+			correlated, err := ctx.correlated(keyQuery)
+			if err != nil {
+				return err
+			}
+			if correlated {
+				continue
+			}
+			rel, err := keyQuery.run(ctx, nil)
+			if err != nil {
+				return err
+			}
+			sp.buildSet(rel.rows)
+			sp.probe = probe
+			return nil
+		}
+	}
+	return nil
+}
+
+// refsOnly reports whether e is a plain expression (no subqueries) referencing
+// at least one column, where every column resolves in cols (inner == true)
+// or none does (inner == false).
+func refsOnly(e Expr, cols []colRef, inner bool) bool {
+	ok, seen := true, false
+	walkExpr(e, func(n Expr) bool {
+		switch n := n.(type) {
+		case *ColumnRef:
+			idx, err := resolveColumn(cols, n)
+			if err != nil || (idx >= 0) != inner {
+				ok = false
+			}
+			seen = true
+		case *ExistsExpr, *SubqueryExpr:
+			ok = false
+		case *InExpr:
+			if n.Subquery != nil {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok && seen
+}
+
+func splitAnd(e Expr) []Expr {
+	if e == nil {
+		return nil
+	}
+	if b, ok := e.(*BinaryExpr); ok && b.Op == "AND" {
+		return append(splitAnd(b.Left), splitAnd(b.Right)...)
+	}
+	return []Expr{e}
+}
+
+func joinAnd(exprs []Expr) Expr {
+	var out Expr
+	for _, e := range exprs {
+		if out == nil {
+			out = e
+			continue
+		}
+		out = &BinaryExpr{Op: "AND", Left: out, Right: e}
+	}
+	return out
+}
+
+// correlated reports whether q references columns of an enclosing query.
+func (ctx *execContext) correlated(q Query) (bool, error) {
+	return ctx.refsOutside(q, nil)
+}
+
+// refsOutside reports whether q, or a subquery nested in it, references a
+// column that resolves neither in q's own source nor in the given frames
+// (the sources of queries between q and the one being checked).
+func (ctx *execContext) refsOutside(query Query, frames [][]colRef) (bool, error) {
+	if op, ok := query.(*SetOpStmt); ok {
+		if len(op.With) > 0 {
+			ctx.pushCTEs(op.WithRecursive, op.With)
+			defer ctx.popCTEs()
+		}
+		for _, side := range []Query{op.Left, op.Right} {
+			out, err := ctx.refsOutside(side, frames)
+			if err != nil || out {
+				return out, err
+			}
+		}
+		return false, nil
+	}
+
+	q := query.(*SelectStmt)
+	if len(q.With) > 0 {
+		ctx.pushCTEs(q.WithRecursive, q.With)
+		defer ctx.popCTEs()
+	}
+	cols, err := ctx.sourceCols(q.From)
+	if err != nil {
+		return false, err
+	}
+	frames = append([][]colRef{cols}, frames...)
+
+	for _, e := range q.exprs() {
+		outside := false
+		walkExpr(e, func(n Expr) bool {
+			if ref, ok := n.(*ColumnRef); ok && !resolvesIn(frames, ref) {
+				outside = true
+			}
+			return !outside
+		})
+		if outside {
+			return true, nil
+		}
+		for _, sub := range subqueriesOf(e) {
+			out, err := ctx.refsOutside(sub, frames)
+			if err != nil || out {
+				return out, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func resolvesIn(frames [][]colRef, ref *ColumnRef) bool {
+	for _, cols := range frames {
+		if idx, _ := resolveColumn(cols, ref); idx >= 0 {
+			return true
+		}
+	}
+	return false
+}
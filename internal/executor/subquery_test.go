@@ -0,0 +1,113 @@
+package executor_test
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newOrdersSession has users, their orders (order 13 of a user that does
+// not exist) and refs to orders (99 to one that does not exist).
+func newOrdersSession(t *testing.T) *session {
+	s := newSession(t, newTestEngine(t))
+	s.mustExec(
+		"CREATE TABLE users (id INT, name TEXT)",
+		"INSERT INTO users VALUES (1, 'ann')",
+		"INSERT INTO users VALUES (2, 'ben')",
+		"INSERT INTO users VALUES (3, 'cat')",
+		"CREATE TABLE orders (id INT, user_id INT, amount INT)",
+		"INSERT INTO orders VALUES (10, 1, 5)",
+		"INSERT INTO orders VALUES (11, 1, 7)",
+		"INSERT INTO orders VALUES (12, 2, 3)",
+		"INSERT INTO orders VALUES (13, 9, 4)",
+		"CREATE TABLE refs (order_id INT)",
+		"INSERT INTO refs VALUES (10)",
+		"INSERT INTO refs VALUES (12)",
+		"INSERT INTO refs VALUES (99)",
+	)
+	return s
+}
+
+// refUsers is a subquery whose rows are the users of the orders in refs:
+// 1, 2 and NULL for the missing order 99.
+const refUsers = "SELECT (SELECT user_id FROM orders o WHERE o.id = r.order_id) FROM refs r"
+
+func TestSubquery_In(t *testing.T) {
+	s := newOrdersSession(t)
+	s.wantRows("SELECT name FROM users WHERE id IN (SELECT user_id FROM orders)", "[[ann] [ben]]")
+	s.wantRows("SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders)", "[[cat]]")
+	s.wantRows("SELECT name FROM users u WHERE 7 IN (SELECT amount FROM orders o WHERE o.user_id = u.id)", "[[ann]]")
+}
+
+func TestSubquery_NotInOverNullIsNeverTrue(t *testing.T) {
+	s := newOrdersSession(t)
+	// 3 is not 1 or 2, but it might be the NULL, so the row is not returned
+	s.wantRows("SELECT name FROM users WHERE id NOT IN ("+refUsers+")", "[]")
+	s.wantRows("SELECT name FROM users WHERE id NOT IN ("+refUsers+" WHERE r.order_id < 99)", "[[cat]]")
+	// a match is still true
+	s.wantRows("SELECT name FROM users WHERE id IN ("+refUsers+")", "[[ann] [ben]]")
+}
+
+func TestSubquery_NullInSet(t *testing.T) {
+	s := newOrdersSession(t)
+	owner := "(SELECT user_id FROM orders o WHERE o.id = r.order_id)"
+	// NULL is in no empty set, so NOT IN holds even for order 99
+	s.wantRows("SELECT order_id FROM refs r WHERE "+owner+" NOT IN (SELECT id FROM users WHERE id > 5)", "[[10] [12] [99]]")
+	// against a non-empty set it is unknown either way
+	s.wantRows("SELECT order_id FROM refs r WHERE "+owner+" NOT IN (SELECT id FROM users WHERE id = 3)", "[[10] [12]]")
+	s.wantRows("SELECT order_id FROM refs r WHERE "+owner+" IN (SELECT id FROM users WHERE id = 3)", "[]")
+}
+
+func TestSubquery_Exists(t *testing.T) {
+	s := newOrdersSession(t)
+	for _, tt := range []struct{ cond, want string }{
+		// decorrelated into a hash semi-join on o.user_id
+		{"o.user_id = u.id", "[[ann] [ben]]"},
+		{"u.id = o.user_id", "[[ann] [ben]]"},
+		{"o.user_id = u.id AND o.amount > 4", "[[ann]]"},
+		// no equality to probe with, run per outer row
+		{"o.user_id = u.id OR o.amount = 3", "[[ann] [ben] [cat]]"},
+		// the rest of the condition refers to the outer row as well
+		{"o.user_id = u.id AND o.amount > u.id", "[[ann] [ben]]"},
+		{"o.amount > 100", "[]"},
+	} {
+		s.wantRows("SELECT name FROM users u WHERE EXISTS (SELECT id FROM orders o WHERE "+tt.cond+")", tt.want)
+	}
+}
+
+func TestSubquery_NotExists(t *testing.T) {
+	s := newOrdersSession(t)
+	s.wantRows("SELECT name FROM users u WHERE NOT EXISTS (SELECT id FROM orders o WHERE o.user_id = u.id)", "[[cat]]")
+	// order 13 has no user to match, decorrelated or not
+	s.wantRows("SELECT id FROM orders o WHERE NOT EXISTS (SELECT id FROM users u WHERE u.id = o.user_id)", "[[13]]")
+	s.wantRows("SELECT id FROM orders o WHERE NOT EXISTS (SELECT id FROM users u WHERE u.id = o.user_id OR u.id = 0)", "[[13]]")
+}
+
+func TestSubquery_NestedCorrelation(t *testing.T) {
+	s := newOrdersSession(t)
+	s.wantRows(`SELECT name FROM users u WHERE EXISTS (SELECT id FROM orders o WHERE o.user_id = u.id
+		AND EXISTS (SELECT order_id FROM refs r WHERE r.order_id = o.id))`, "[[ann] [ben]]")
+	// the innermost query refers to the outermost one
+	s.wantRows(`SELECT name FROM users u WHERE EXISTS (SELECT id FROM orders o WHERE o.user_id = u.id
+		AND EXISTS (SELECT order_id FROM refs r WHERE r.order_id = o.id AND u.name = 'ben'))`, "[[ben]]")
+}
+
+func TestSubquery_Scalar(t *testing.T) {
+	s := newOrdersSession(t)
+	res := s.mustExec("SELECT r.order_id, (SELECT user_id FROM orders o WHERE o.id = r.order_id) AS owner FROM refs r")
+	if got := fmt.Sprint(res.Columns, res.Rows); got != "[order_id owner] [[10 1] [12 2] [99 <nil>]]" {
+		t.Errorf("Got %s", got)
+	}
+	s.wantRows("SELECT id FROM orders WHERE user_id = (SELECT id FROM users WHERE name = 'ben')", "[[12]]")
+	// no row is NULL, which equals nothing
+	s.wantRows("SELECT id FROM orders WHERE user_id = (SELECT id FROM users WHERE name = 'dan')", "[]")
+}
+
+func TestSubquery_Errors(t *testing.T) {
+	s := newOrdersSession(t)
+	s.wantErr("SELECT (SELECT id FROM orders WHERE user_id = 1) FROM users", "more than one row returned by a subquery used as an expression")
+	s.wantErr("SELECT (SELECT id, amount FROM orders WHERE id = 10) FROM users", "subquery must return only one column, got 2")
+	s.wantErr("SELECT name FROM users WHERE id IN (SELECT user_id, amount FROM orders)", "subquery in IN must return exactly one column, got 2")
+	s.wantErr("SELECT name FROM users WHERE id IN (SELECT id FROM missing)", "table not found: missing")
+	// a correlated subquery fails only for the rows that make it fail
+	s.wantRows("SELECT name FROM users u WHERE u.id = 3 AND (SELECT id FROM orders o WHERE o.user_id = u.id) = 0", "[]")
+}
@@ -0,0 +1,261 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"justasimpletoydb/internal/lock"
+	"justasimpletoydb/internal/storage"
+)
+
+var (
+	// ErrTxAborted is returned for statements in a failed transaction block.
+	ErrTxAborted = errors.New("current transaction is aborted, commands ignored until end of transaction block")
+	// ErrSchemaChangeInTx is returned for statements changing the catalog
+	// inside a transaction block, which can't be rolled back.
+	ErrSchemaChangeInTx = errors.New("schema changes cannot run inside a transaction block")
+)
+
+// TxState is the transaction state of a session.
+type TxState int
+
+const (
+	TxIdle   TxState = iota // not in a transaction block
+	TxActive                // in a transaction block
+	TxFailed                // in a transaction block a statement failed in
+)
+
+// transaction is an open transaction block. Writes go to the tables as
+// they happen and are undone from the tuples each table recorded; other
+// sessions see them before COMMIT. The record is kept in memory only. The
+// table and row locks the block's statements take are held until it ends.
+type transaction struct {
+	failed  bool
+	changes map[string]*storage.Changes
+	order   []string // tables in the order they were first opened
+}
+
+func (tx *transaction) changesFor(table string) *storage.Changes {
+	c, ok := tx.changes[table]
+	if !ok {
+		c = &storage.Changes{}
+		tx.changes[table] = c
+		tx.order = append(tx.order, table)
+	}
+	return c
+}
+
+// TxState reports whether the session is in a transaction block.
+func (ex *Executor) TxState() TxState {
+	switch {
+	case ex.tx == nil:
+		return TxIdle
+	case ex.tx.failed:
+		return TxFailed
+	default:
+		return TxActive
+	}
+}
+
+// Execute runs a statement in the session's transaction block, if any. A
+// statement failing in the block fails it: further statements are
+// refused until COMMIT or ROLLBACK, both of which roll it back. A block
+// chosen as the victim of a deadlock is rolled back at once, so that the
+// sessions waiting for its locks go on. The locks of a statement outside
+// a block are released once it is done.
+func (ex *Executor) Execute(stmt Statement) (*ExecResult, error) {
+	if ex.tx != nil {
+		switch stmt.(type) {
+		case *BeginStmt, *CommitStmt, *RollbackStmt:
+		default:
+			if ex.tx.failed {
+				return nil, ErrTxAborted
+			}
+			if changesSchema(stmt) {
+				ex.tx.failed = true
+				return nil, ErrSchemaChangeInTx
+			}
+		}
+	}
+	res, err := stmt.Execute(ex)
+	if err != nil && ex.tx != nil {
+		ex.tx.failed = true
+		if errors.Is(err, lock.ErrDeadlock) {
+			err = errors.Join(err, ex.abort())
+		}
+	}
+	ex.unlock()
+	return res, err
+}
+
+func changesSchema(stmt Statement) bool {
+	switch stmt.(type) {
+	case *CreateTableStmt, *CreateIndexStmt, *CreateSequenceStmt, *CreateViewStmt,
+		*DropTableStmt, *DropIndexStmt, *DropSequenceStmt, *DropViewStmt, *AlterTableStmt:
+		return true
+	}
+	return false
+}
+
+// lockTable locks a table for the session. Statements lock a table before
+// reading its schema: rows are read under IS and written under IX, while
+// schema changes take X and so wait for the statements and transaction
+// blocks using the table.
+func (ex *Executor) lockTable(name string, mode lock.Mode) error {
+	return ex.engine.Locks.LockTable(ex.owner, name, mode)
+}
+
+// lockRow locks a row of a table exclusively for the session, reporting
+// whether it did; it doesn't when wait is SkipLocked and another session
+// holds the row.
+func (ex *Executor) lockRow(table string, tid storage.TID, wait lock.Wait) (bool, error) {
+	ok, err := ex.engine.Locks.LockRow(ex.owner, table, tid, lock.Exclusive, wait)
+	if errors.Is(err, lock.ErrNotAvailable) {
+		return false, fmt.Errorf("%w on row in relation %q", err, table)
+	}
+	return ok, err
+}
+
+// shareRow locks a row of a table in shared mode for the session, waiting
+// for the session holding it exclusively, if any, to end its statement or
+// transaction block. Key checks take it on the rows holding the key, which
+// are then kept from changing until the session's own block ends.
+func (ex *Executor) shareRow(table string, tid storage.TID) error {
+	_, err := ex.engine.Locks.LockRow(ex.owner, table, tid, lock.Shared, lock.Block)
+	return err
+}
+
+// unlock releases the session's table and row locks unless a transaction
+// block holds them.
+func (ex *Executor) unlock() {
+	if ex.tx == nil {
+		ex.engine.Locks.ReleaseAll(ex.owner)
+	}
+}
+
+// Close ends the session. An open transaction block is rolled back and
+// the session's locks are released.
+func (ex *Executor) Close() error {
+	var err error
+	if ex.tx != nil {
+		err = ex.rollback()
+	}
+	ex.engine.Locks.ReleaseAll(ex.owner)
+	return err
+}
+
+// openTable locks a table in the given mode and opens it for a statement,
+// recording its writes in the session's transaction block. The rows the
+// statement writes are locked as they are written, so that no other
+// session locks or changes them, or decides on their keys, before the
+// statement or block ends; key checks wait for the rows other sessions
+// hold in turn.
+func (ex *Executor) openTable(name string, mode lock.Mode) (*storage.Table, error) {
+	if err := ex.lockTable(name, mode); err != nil {
+		return nil, err
+	}
+	t, err := ex.engine.GetTable(name)
+	if err != nil {
+		return nil, fmt.Errorf("table not found: %s", name)
+	}
+	changes := &storage.Changes{}
+	if ex.tx != nil {
+		changes = ex.tx.changesFor(name)
+	}
+	changes.OnInsert = func(tids []storage.TID) error {
+		// rows just written can't be locked by anyone else yet; should a
+		// lock fail all the same, the write is undone
+		for _, tid := range tids {
+			if _, err := ex.lockRow(name, tid, lock.NoWait); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	changes.Busy = func(tid storage.TID) bool {
+		return ex.engine.Locks.RowConflicts(ex.owner, name, tid, lock.Shared)
+	}
+	changes.Wait = func(tid storage.TID) error {
+		return ex.shareRow(name, tid)
+	}
+	t.Track(changes)
+	return t, nil
+}
+
+// rollback undoes the writes of the transaction block, last table first,
+// and ends it.
+func (ex *Executor) rollback() error {
+	tx := ex.tx
+	ex.tx = nil
+	return ex.undo(tx)
+}
+
+// abort undoes the writes of a failed transaction block and releases its
+// locks without ending it; its record is emptied, so that ending the
+// block undoes nothing more.
+func (ex *Executor) abort() error {
+	tx := ex.tx
+	err := ex.undo(tx)
+	tx.changes = make(map[string]*storage.Changes)
+	tx.order = nil
+	ex.engine.Locks.ReleaseAll(ex.owner)
+	return err
+}
+
+func (ex *Executor) undo(tx *transaction) error {
+	for i := len(tx.order) - 1; i >= 0; i-- {
+		name := tx.order[i]
+		t, err := ex.engine.GetTable(name)
+		if err != nil {
+			return fmt.Errorf("rollback: %w", err)
+		}
+		err = t.Undo(tx.changes[name])
+		t.Close()
+		if err != nil {
+			return fmt.Errorf("rollback of table %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// BeginStmt is "BEGIN" or "START TRANSACTION".
+type BeginStmt struct{}
+
+func (s *BeginStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if ex.tx != nil {
+		return &ExecResult{Message: "BEGIN", Notice: "there is already a transaction in progress"}, nil
+	}
+	ex.tx = &transaction{changes: make(map[string]*storage.Changes)}
+	return &ExecResult{Message: "BEGIN"}, nil
+}
+
+// CommitStmt is "COMMIT" or "END". Committing a failed transaction block
+// rolls it back.
+type CommitStmt struct{}
+
+func (s *CommitStmt) Execute(ex *Executor) (*ExecResult, error) {
+	switch ex.TxState() {
+	case TxIdle:
+		return &ExecResult{Message: "COMMIT", Notice: "there is no transaction in progress"}, nil
+	case TxFailed:
+		if err := ex.rollback(); err != nil {
+			return nil, err
+		}
+		return &ExecResult{Message: "ROLLBACK"}, nil
+	}
+	ex.tx = nil
+	return &ExecResult{Message: "COMMIT"}, nil
+}
+
+// RollbackStmt is "ROLLBACK" or "ABORT".
+type RollbackStmt struct{}
+
+func (s *RollbackStmt) Execute(ex *Executor) (*ExecResult, error) {
+	if ex.tx == nil {
+		return &ExecResult{Message: "ROLLBACK", Notice: "there is no transaction in progress"}, nil
+	}
+	if err := ex.rollback(); err != nil {
+		return nil, err
+	}
+	return &ExecResult{Message: "ROLLBACK"}, nil
+}
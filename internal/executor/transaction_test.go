@@ -0,0 +1,61 @@
+package executor_test
+
+import (
+	"errors"
+	"testing"
+
+	"justasimpletoydb/internal/storage"
+)
+
+func TestTransaction_UniqueKeyOfUncommittedDeleteWaits(t *testing.T) {
+	for _, tt := range []struct {
+		end     string
+		wantErr bool
+		want    string
+	}{
+		{end: "ROLLBACK", wantErr: true, want: "[[5 orig]]"},
+		{end: "COMMIT", want: "[[5 new]]"},
+	} {
+		t.Run(tt.end, func(t *testing.T) {
+			e := newTestEngine(t)
+			a, b := newSession(t, e), newSession(t, e)
+			a.mustExec("CREATE TABLE u (id INT UNIQUE, v TEXT); INSERT INTO u VALUES (5, 'orig')")
+
+			a.mustExec("BEGIN; DELETE FROM u WHERE id = 5")
+			done := b.start("INSERT INTO u VALUES (5, 'new')")
+			waited(t, e, 1)
+			a.mustExec(tt.end)
+
+			var unique *storage.UniqueViolation
+			if err := <-done; errors.As(err, &unique) != tt.wantErr {
+				t.Errorf("Expected a unique violation: %v, got %v", tt.wantErr, err)
+			}
+			if got := a.rows("SELECT * FROM u"); got != tt.want {
+				t.Errorf("Got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransaction_UniqueKeyOfUncommittedInsertWaits(t *testing.T) {
+	e := newTestEngine(t)
+	a, b := newSession(t, e), newSession(t, e)
+	a.mustExec("CREATE TABLE u (id INT UNIQUE, v TEXT)")
+
+	a.mustExec("BEGIN; INSERT INTO u VALUES (1, 'a')")
+	done := b.start("INSERT INTO u VALUES (1, 'b')")
+	waited(t, e, 1)
+	a.mustExec("ROLLBACK")
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the insert to go on once the other was rolled back, got %v", err)
+	}
+	if got := a.rows("SELECT * FROM u"); got != "[[1 b]]" {
+		t.Errorf("Got %s, want [[1 b]]", got)
+	}
+
+	// the session's own deleted key is free for it to reuse
+	a.mustExec("BEGIN; DELETE FROM u WHERE id = 1; INSERT INTO u VALUES (1, 'c'); COMMIT")
+	if got := a.rows("SELECT * FROM u"); got != "[[1 c]]" {
+		t.Errorf("Got %s, want [[1 c]]", got)
+	}
+}
@@ -0,0 +1,157 @@
+package executor
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/lock"
+)
+
+// ParseQuery parses the SQL text of a query stored in the catalog, such as
+// the body of a view. It is set by the parser package, like ParseExpr.
+var ParseQuery func(sql string) (Query, error)
+
+// targetTable locks the table an INSERT, UPDATE or DELETE writes to and
+// returns its schema. Views can't be written to; materialized views change
+// only when refreshed.
+func targetTable(ex *Executor, name string) (*catalog.TableSchema, error) {
+	if view, err := ex.engine.Catalog.GetView(name); err == nil {
+		if view.Materialized {
+			return nil, fmt.Errorf("cannot change materialized view %s", name)
+		}
+		return nil, fmt.Errorf("cannot change view %s", name)
+	}
+	if err := ex.lockTable(name, lock.IntentionExclusive); err != nil {
+		return nil, err
+	}
+	schema, err := ex.engine.Catalog.GetTable(name)
+	if err != nil {
+		return nil, fmt.Errorf("table not found: %s", name)
+	}
+	return schema, nil
+}
+
+// plainView returns the view of the given name unless it is materialized,
+// whose rows are read from its table instead.
+func (ctx *execContext) plainView(name string) *catalog.View {
+	view, err := ctx.ex.engine.Catalog.GetView(name)
+	if err != nil || view.Materialized {
+		return nil
+	}
+	return view
+}
+
+// viewQuery parses the body of a view. The body sees neither the CTEs nor
+// the columns of the query reading the view, so it is planned and run with
+// an empty scope; the returned function restores the caller's.
+func (ctx *execContext) viewQuery(view *catalog.View) (Query, func(), error) {
+	q, err := ParseQuery(view.Query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("view %s: %w", view.Name, err)
+	}
+	saved := ctx.ctes
+	ctx.ctes = nil
+	return q, func() { ctx.ctes = saved }, nil
+}
+
+// viewCols returns the columns of a view without reading rows.
+func (ctx *execContext) viewCols(view *catalog.View) ([]colRef, error) {
+	q, restore, err := ctx.viewQuery(view)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	cols, err := ctx.queryCols(q)
+	if err != nil {
+		return nil, fmt.Errorf("view %s: %w", view.Name, err)
+	}
+	return renameViewCols(view.Name, view.Columns, cols)
+}
+
+// scanView runs the query of a view.
+func (ctx *execContext) scanView(view *catalog.View) (*relation, error) {
+	q, restore, err := ctx.viewQuery(view)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	rel, err := q.run(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("view %s: %w", view.Name, err)
+	}
+	cols, err := renameViewCols(view.Name, view.Columns, rel.cols)
+	if err != nil {
+		return nil, err
+	}
+	return &relation{cols: cols, rows: rel.rows}, nil
+}
+
+// renameViewCols applies the explicit column list of a view, if any, and
+// rejects duplicate column names.
+func renameViewCols(name string, names []string, cols []colRef) ([]colRef, error) {
+	if len(names) > 0 && len(names) != len(cols) {
+		return nil, fmt.Errorf("view %s has %d columns but its query returns %d", name, len(names), len(cols))
+	}
+	out := make([]colRef, len(cols))
+	for i, c := range cols {
+		if len(names) > 0 {
+			c.name = names[i]
+		}
+		if slices.ContainsFunc(out[:i], func(o colRef) bool { return o.name == c.name }) {
+			return nil, fmt.Errorf("column %s specified more than once, use an alias", c.name)
+		}
+		out[i] = colRef{name: c.name, typ: c.typ}
+	}
+	return out, nil
+}
+
+// relationsOf returns the tables and views a query reads, sorted, leaving
+// out the CTEs it defines.
+func relationsOf(q Query) []string {
+	seen := make(map[string]bool)
+	collectRelations(q, nil, seen)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func collectRelations(query Query, ctes []string, seen map[string]bool) {
+	var with []*CTE
+	switch q := query.(type) {
+	case *SetOpStmt:
+		with = q.With
+	case *SelectStmt:
+		with = q.With
+	}
+	// a CTE may reference those before it, and itself under WITH RECURSIVE
+	for _, c := range with {
+		ctes = append(ctes, c.Name)
+	}
+	for _, c := range with {
+		collectRelations(c.Query, ctes, seen)
+	}
+
+	switch q := query.(type) {
+	case *SetOpStmt:
+		collectRelations(q.Left, ctes, seen)
+		collectRelations(q.Right, ctes, seen)
+	case *SelectStmt:
+		if q.From != nil {
+			for _, t := range q.From.tables() {
+				if !slices.Contains(ctes, t.Name) {
+					seen[t.Name] = true
+				}
+			}
+		}
+		for _, e := range q.exprs() {
+			for _, sub := range subqueriesOf(e) {
+				collectRelations(sub, ctes, seen)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package executor_test
+
+import (
+	"testing"
+
+	"justasimpletoydb/internal/engine"
+)
+
+const viewsSchema = `CREATE TABLE animals (id INT, name TEXT);
+INSERT INTO animals VALUES (1, 'frog'), (2, 'snake'), (3, 'newt');
+CREATE TABLE keepers (id INT, animal_id INT);
+INSERT INTO keepers VALUES (10, 2);
+CREATE VIEW walkers AS SELECT id, UPPER(name) AS name FROM animals WHERE id > 1;
+CREATE VIEW kept (animal) AS SELECT name FROM animals WHERE id IN (SELECT animal_id FROM keepers);
+CREATE VIEW short_walkers AS SELECT name FROM walkers WHERE LENGTH(name) < 5;
+CREATE MATERIALIZED VIEW snapshot AS SELECT id, name FROM animals`
+
+func TestView(t *testing.T) {
+	s := setupSession(t, viewsSchema)
+	// read
+	s.wantRows("SELECT * FROM walkers", "[[2 SNAKE] [3 NEWT]]")
+	// filtered and aliased
+	s.wantRows("SELECT w.name FROM walkers w WHERE w.id = 3", "[[NEWT]]")
+	// column list
+	s.wantRows("SELECT animal FROM kept", "[[snake]]")
+	// view over a view
+	s.wantRows("SELECT * FROM short_walkers", "[[NEWT]]")
+	// in a subquery
+	s.wantRows("SELECT name FROM animals WHERE id NOT IN (SELECT id FROM walkers)", "[[frog]]")
+	// sees later writes
+	s.wantRows("INSERT INTO animals VALUES (4, 'toad'); INSERT INTO keepers VALUES (11, 4); SELECT animal FROM kept", "[[snake] [toad]]")
+	// materialized view keeps its rows
+	s.wantRows("SELECT name FROM snapshot", "[[frog] [snake] [newt]]")
+	// until refreshed
+	s.wantRows("REFRESH MATERIALIZED VIEW snapshot; SELECT name FROM snapshot WHERE id = 4", "[[toad]]")
+	// refresh of a plain view
+	s.wantErr("REFRESH MATERIALIZED VIEW walkers", "refresh: walkers is not a materialized view")
+	// insert into a view
+	s.wantErr("INSERT INTO walkers VALUES (5, 'eel')", "cannot change view walkers")
+	// delete from a materialized view
+	s.wantErr("DELETE FROM snapshot", "cannot change materialized view snapshot")
+	// drop of a base table
+	s.wantErr("DROP TABLE animals", "cannot drop table animals because view")
+	// drop of a table only a subquery reads
+	s.wantErr("DROP TABLE keepers", "cannot drop table keepers because view kept depends on it")
+	// alter of a base table
+	s.wantErr("ALTER TABLE animals ADD COLUMN legs INT", "cannot alter table animals because view")
+	// drop of a view another view reads
+	s.wantErr("DROP VIEW walkers", "cannot drop view walkers because view short_walkers depends on it")
+	// drop in dependency order
+	s.wantRows("DROP VIEW short_walkers; DROP VIEW walkers; DROP VIEW kept; DROP TABLE keepers; DROP VIEW IF EXISTS walkers; SELECT name FROM snapshot WHERE id = 1", "[[frog]]")
+	// dropped view
+	s.wantErr("SELECT * FROM walkers", "table not found: walkers")
+	// column count
+	s.wantErr("CREATE VIEW bad (a, b) AS SELECT id FROM animals", "view bad has 2 columns but its query returns 1")
+	// duplicate column
+	s.wantErr("CREATE VIEW bad AS SELECT id, id FROM animals", "column id specified more than once, use an alias")
+	// name taken
+	s.wantErr("CREATE VIEW animals AS SELECT 1", "table animals already exists")
+	// IF NOT EXISTS
+	s.wantRows("CREATE VIEW IF NOT EXISTS snapshot AS SELECT 1; SELECT COUNT(*) OVER () FROM snapshot WHERE id = 1", "[[1]]")
+}
+
+func TestView_SurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	e := engine.NewEngine(dir)
+	s := newSession(t, e)
+	s.mustExec(viewsSchema)
+	s.ex.Close()
+	e.Close()
+
+	e = engine.NewEngine(dir)
+	t.Cleanup(func() { e.Close() })
+	s = newSession(t, e)
+	if got := s.rows("SELECT * FROM short_walkers") + s.rows("SELECT name FROM snapshot WHERE id = 2"); got != "[[NEWT]][[snake]]" {
+		t.Errorf("Got %s, want [[NEWT]][[snake]]", got)
+	}
+}
@@ -0,0 +1,492 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrderItem is one key of an ORDER BY list.
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+func (o OrderItem) String() string {
+	if o.Desc {
+		return o.Expr.String() + " DESC"
+	}
+	return o.Expr.String()
+}
+
+// Frame bound kinds.
+const (
+	UnboundedPreceding = iota
+	Preceding
+	CurrentRow
+	Following
+	UnboundedFollowing
+)
+
+// FrameBound is one end of a window frame, e.g. "2 PRECEDING".
+type FrameBound struct {
+	Kind   int
+	Offset int // for Preceding and Following
+}
+
+func (b FrameBound) String() string {
+	switch b.Kind {
+	case UnboundedPreceding:
+		return "UNBOUNDED PRECEDING"
+	case Preceding:
+		return strconv.Itoa(b.Offset) + " PRECEDING"
+	case CurrentRow:
+		return "CURRENT ROW"
+	case Following:
+		return strconv.Itoa(b.Offset) + " FOLLOWING"
+	default:
+		return "UNBOUNDED FOLLOWING"
+	}
+}
+
+// Frame is "ROWS|RANGE BETWEEN start AND end". RANGE frames only support
+// UNBOUNDED and CURRENT ROW bounds, where CURRENT ROW includes all peers.
+type Frame struct {
+	Rows  bool
+	Start FrameBound
+	End   FrameBound
+}
+
+func (f *Frame) String() string {
+	mode := "RANGE"
+	if f.Rows {
+		mode = "ROWS"
+	}
+	return fmt.Sprintf("%s BETWEEN %s AND %s", mode, f.Start.String(), f.End.String())
+}
+
+// WindowSpec is the contents of OVER (...).
+type WindowSpec struct {
+	PartitionBy []Expr
+	OrderBy     []OrderItem
+	Frame       *Frame // nil for the default frame
+}
+
+func (w *WindowSpec) String() string {
+	var parts []string
+	if len(w.PartitionBy) > 0 {
+		keys := make([]string, len(w.PartitionBy))
+		for i, e := range w.PartitionBy {
+			keys[i] = e.String()
+		}
+		parts = append(parts, "PARTITION BY "+strings.Join(keys, ", "))
+	}
+	if len(w.OrderBy) > 0 {
+		keys := make([]string, len(w.OrderBy))
+		for i, o := range w.OrderBy {
+			keys[i] = o.String()
+		}
+		parts = append(parts, "ORDER BY "+strings.Join(keys, ", "))
+	}
+	if w.Frame != nil {
+		parts = append(parts, w.Frame.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// WindowFunc is a function evaluated over a window of rows, "name(args) OVER (...)".
+type WindowFunc struct {
+	Name   string // upper case
+	Args   []Expr
+	Star   bool // COUNT(*)
+	Window *WindowSpec
+}
+
+func (w *WindowFunc) String() string {
+	args := "*"
+	if !w.Star {
+		parts := make([]string, len(w.Args))
+		for i, a := range w.Args {
+			parts[i] = a.String()
+		}
+		args = strings.Join(parts, ", ")
+	}
+	return fmt.Sprintf("%s(%s) OVER (%s)", strings.ToLower(w.Name), args, w.Window.String())
+}
+
+// windowArity lists the supported window functions with their min and max argument counts.
+var windowArity = map[string][2]int{
+	"ROW_NUMBER": {0, 0},
+	"RANK":       {0, 0},
+	"DENSE_RANK": {0, 0},
+	"LAG":        {1, 3},
+	"LEAD":       {1, 3},
+	"SUM":        {1, 1},
+	"COUNT":      {0, 1},
+	"MIN":        {1, 1},
+	"MAX":        {1, 1},
+}
+
+// IsWindowFunction reports whether name is a supported window function.
+func IsWindowFunction(name string) bool {
+	_, ok := windowArity[strings.ToUpper(name)]
+	return ok
+}
+
+// CheckWindowFunc validates the name and argument count of a window function call.
+func CheckWindowFunc(w *WindowFunc) error {
+	arity, ok := windowArity[w.Name]
+	if !ok {
+		return fmt.Errorf("function %s is not a window function", strings.ToLower(w.Name))
+	}
+	if w.Star && w.Name != "COUNT" {
+		return fmt.Errorf("%s(*) is not supported", strings.ToLower(w.Name))
+	}
+	if n := len(w.Args); n < arity[0] || n > arity[1] {
+		return fmt.Errorf("function %s takes %d to %d arguments, got %d", strings.ToLower(w.Name), arity[0], arity[1], n)
+	}
+	if f := w.Window.Frame; f != nil && !f.Rows {
+		for _, b := range []FrameBound{f.Start, f.End} {
+			if b.Kind == Preceding || b.Kind == Following {
+				return fmt.Errorf("RANGE frames with offsets are not supported, use ROWS")
+			}
+		}
+	}
+	return nil
+}
+
+func windowFuncsOf(items []SelectItem) []*WindowFunc {
+	var out []*WindowFunc
+	for _, it := range items {
+		walkExpr(it.Expr, func(n Expr) bool {
+			if w, ok := n.(*WindowFunc); ok {
+				out = append(out, w)
+				return false
+			}
+			return true
+		})
+	}
+	return out
+}
+
+func containsWindowFunc(e Expr) bool {
+	found := false
+	walkExpr(e, func(n Expr) bool {
+		if _, ok := n.(*WindowFunc); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// computeWindows evaluates every window function over the filtered rows.
+// Rows are sorted by partition and order keys, each partition is walked in
+// that order, and the results are stored per input row position in
+// ctx.windowValues. It returns the row order of the last window, which is
+// the order the rows are emitted in.
+func (ctx *execContext) computeWindows(funcs []*WindowFunc, scopes []*rowScope) ([]int, error) {
+	var order []int
+	for _, w := range funcs {
+		sorted, parts, err := ctx.sortWindow(w.Window, scopes)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, len(scopes))
+		for _, part := range parts {
+			rows := sorted[part[0]:part[1]]
+			if err := ctx.evalWindowPartition(w, rows, scopes, values); err != nil {
+				return nil, err
+			}
+		}
+		ctx.windowValues[w] = values
+		order = sorted
+	}
+	return order, nil
+}
+
+// windowKeys holds the evaluated partition and order keys of one row.
+type windowKeys struct {
+	partition []any
+	order     []any
+}
+
+// sortWindow returns row positions sorted by partition then order keys, and
+// the [start, end) bounds of each partition within that ordering.
+func (ctx *execContext) sortWindow(spec *WindowSpec, scopes []*rowScope) ([]int, [][2]int, error) {
+	keys := make([]windowKeys, len(scopes))
+	for i, sc := range scopes {
+		for _, e := range spec.PartitionBy {
+			v, err := ctx.eval(e, sc)
+			if err != nil {
+				return nil, nil, err
+			}
+			keys[i].partition = append(keys[i].partition, v)
+		}
+		for _, o := range spec.OrderBy {
+			v, err := ctx.eval(o.Expr, sc)
+			if err != nil {
+				return nil, nil, err
+			}
+			keys[i].order = append(keys[i].order, v)
+		}
+	}
+
+	desc := make([]bool, len(spec.OrderBy))
+	for i, o := range spec.OrderBy {
+		desc[i] = o.Desc
+	}
+
+	sorted := make([]int, len(scopes))
+	for i := range sorted {
+		sorted[i] = i
+	}
+	var sortErr error
+	sort.SliceStable(sorted, func(a, b int) bool {
+		ka, kb := keys[sorted[a]], keys[sorted[b]]
+		cmp, err := compareKeys(ka.partition, kb.partition, nil)
+		if err == nil && cmp == 0 {
+			cmp, err = compareKeys(ka.order, kb.order, desc)
+		}
+		if err != nil && sortErr == nil {
+			sortErr = err
+		}
+		return cmp < 0
+	})
+	if sortErr != nil {
+		return nil, nil, sortErr
+	}
+
+	var parts [][2]int
+	start := 0
+	for i := 1; i <= len(sorted); i++ {
+		if i < len(sorted) {
+			cmp, _ := compareKeys(keys[sorted[i-1]].partition, keys[sorted[i]].partition, nil)
+			if cmp == 0 {
+				continue
+			}
+		}
+		parts = append(parts, [2]int{start, i})
+		start = i
+	}
+
+	// remember order keys for peer detection in RANK and RANGE frames
+	for _, idx := range sorted {
+		scopes[idx].orderKey = keys[idx].order
+	}
+	return sorted, parts, nil
+}
+
+// compareKeys orders two key tuples. NULLs sort after other values in
+// ascending order and before them in descending order.
+func compareKeys(a, b []any, desc []bool) (int, error) {
+	for i := range a {
+		var cmp int
+		switch {
+		case a[i] == nil && b[i] == nil:
+			cmp = 0
+		case a[i] == nil:
+			cmp = 1
+		case b[i] == nil:
+			cmp = -1
+		default:
+			var err error
+			cmp, err = compareValues(a[i], b[i])
+			if err != nil {
+				return 0, err
+			}
+		}
+		if desc != nil && desc[i] {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp, nil
+		}
+	}
+	return 0, nil
+}
+
+func peers(a, b *rowScope) bool {
+	cmp, err := compareKeys(a.orderKey, b.orderKey, nil)
+	return err == nil && cmp == 0
+}
+
+// evalWindowPartition computes w for the rows of one partition, given in window order.
+func (ctx *execContext) evalWindowPartition(w *WindowFunc, rows []int, scopes []*rowScope, out []any) error {
+	switch w.Name {
+	case "ROW_NUMBER":
+		for i, idx := range rows {
+			out[idx] = i + 1
+		}
+
+	case "RANK", "DENSE_RANK":
+		rank, dense := 0, 0
+		for i, idx := range rows {
+			if i == 0 || !peers(scopes[rows[i-1]], scopes[idx]) {
+				rank = i + 1
+				dense++
+			}
+			if w.Name == "RANK" {
+				out[idx] = rank
+			} else {
+				out[idx] = dense
+			}
+		}
+
+	case "LAG", "LEAD":
+		for i, idx := range rows {
+			offset := 1
+			if len(w.Args) > 1 {
+				v, err := ctx.eval(w.Args[1], scopes[idx])
+				if err != nil {
+					return err
+				}
+				n, ok := v.(int)
+				if !ok {
+					return fmt.Errorf("offset of %s must be an integer", strings.ToLower(w.Name))
+				}
+				offset = n
+			}
+			if w.Name == "LAG" {
+				offset = -offset
+			}
+			j := i + offset
+			if j < 0 || j >= len(rows) {
+				if len(w.Args) > 2 {
+					v, err := ctx.eval(w.Args[2], scopes[idx])
+					if err != nil {
+						return err
+					}
+					out[idx] = v
+				} else {
+					out[idx] = nil
+				}
+				continue
+			}
+			v, err := ctx.eval(w.Args[0], scopes[rows[j]])
+			if err != nil {
+				return err
+			}
+			out[idx] = v
+		}
+
+	default:
+		args := make([]any, len(rows))
+		for i, idx := range rows {
+			if w.Star || len(w.Args) == 0 {
+				args[i] = 1 // COUNT(*) counts every row
+				continue
+			}
+			v, err := ctx.eval(w.Args[0], scopes[idx])
+			if err != nil {
+				return err
+			}
+			args[i] = v
+		}
+		for i, idx := range rows {
+			start, end := frameBounds(w.Window, rows, scopes, i)
+			v, err := aggregate(w.Name, args[start:end])
+			if err != nil {
+				return err
+			}
+			out[idx] = v
+		}
+	}
+	return nil
+}
+
+// frameBounds returns the [start, end) positions of the frame of row i
+// within its partition.
+func frameBounds(spec *WindowSpec, rows []int, scopes []*rowScope, i int) (int, int) {
+	frame := spec.Frame
+	if frame == nil {
+		// default: whole partition without ORDER BY, otherwise
+		// RANGE BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW
+		if len(spec.OrderBy) == 0 {
+			return 0, len(rows)
+		}
+		frame = &Frame{Start: FrameBound{Kind: UnboundedPreceding}, End: FrameBound{Kind: CurrentRow}}
+	}
+
+	bound := func(b FrameBound, isStart bool) int {
+		switch b.Kind {
+		case UnboundedPreceding:
+			return 0
+		case UnboundedFollowing:
+			return len(rows)
+		case Preceding:
+			if isStart {
+				return i - b.Offset
+			}
+			return i - b.Offset + 1
+		case Following:
+			if isStart {
+				return i + b.Offset
+			}
+			return i + b.Offset + 1
+		}
+		// CURRENT ROW; in RANGE mode it extends to all peers
+		if frame.Rows {
+			if isStart {
+				return i
+			}
+			return i + 1
+		}
+		j := i
+		if isStart {
+			for j > 0 && peers(scopes[rows[j-1]], scopes[rows[i]]) {
+				j--
+			}
+			return j
+		}
+		for j+1 < len(rows) && peers(scopes[rows[j+1]], scopes[rows[i]]) {
+			j++
+		}
+		return j + 1
+	}
+
+	start, end := bound(frame.Start, true), bound(frame.End, false)
+	start = max(0, min(start, len(rows)))
+	end = max(start, min(end, len(rows)))
+	return start, end
+}
+
+// aggregate folds the non-NULL values of a frame.
+func aggregate(name string, values []any) (any, error) {
+	var acc any
+	count := 0
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		count++
+		switch name {
+		case "SUM":
+			n, ok := v.(int)
+			if !ok {
+				return nil, fmt.Errorf("sum expects INT, got %s", typeName(v))
+			}
+			if acc == nil {
+				acc = 0
+			}
+			acc = acc.(int) + n
+		case "MIN", "MAX":
+			if acc == nil {
+				acc = v
+				continue
+			}
+			cmp, err := compareValues(v, acc)
+			if err != nil {
+				return nil, err
+			}
+			if (name == "MIN" && cmp < 0) || (name == "MAX" && cmp > 0) {
+				acc = v
+			}
+		}
+	}
+	if name == "COUNT" {
+		return count, nil
+	}
+	return acc, nil
+}
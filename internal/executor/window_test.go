@@ -0,0 +1,90 @@
+package executor_test
+
+import "testing"
+
+// newSalesSession has sales of two regions over three days, and returns
+// on days 1 and 3 only.
+func newSalesSession(t *testing.T) *session {
+	s := newSession(t, newTestEngine(t))
+	s.mustExec(
+		"CREATE TABLE sales (region TEXT, day INT, amount INT)",
+		"INSERT INTO sales VALUES ('n', 1, 10)",
+		"INSERT INTO sales VALUES ('n', 2, 20)",
+		"INSERT INTO sales VALUES ('n', 3, 20)",
+		"INSERT INTO sales VALUES ('s', 1, 5)",
+		"INSERT INTO sales VALUES ('s', 2, 0)",
+		"INSERT INTO sales VALUES ('s', 3, 15)",
+		"CREATE TABLE returns (day INT, amount INT)",
+		"INSERT INTO returns VALUES (1, 1)",
+		"INSERT INTO returns VALUES (3, 3)",
+	)
+	return s
+}
+
+// returned is the amount returned on the day of sales row s, NULL on day 2.
+const returned = "(SELECT r.amount FROM returns r WHERE r.day = s.day)"
+
+func TestWindow_Ranking(t *testing.T) {
+	s := newSalesSession(t)
+	// rows come out in partition and window order
+	s.wantRows("SELECT region, day, ROW_NUMBER() OVER (PARTITION BY region ORDER BY day DESC) FROM sales",
+		"[[n 3 1] [n 2 2] [n 1 3] [s 3 1] [s 2 2] [s 1 3]]")
+	// peers share a rank; RANK then skips, DENSE_RANK does not
+	s.wantRows("SELECT amount, RANK() OVER (ORDER BY amount DESC), DENSE_RANK() OVER (ORDER BY amount DESC) FROM sales",
+		"[[20 1 1] [20 1 1] [15 3 2] [10 4 3] [5 5 4] [0 6 5]]")
+	// without ORDER BY every row is a peer
+	s.wantRows("SELECT day, RANK() OVER (PARTITION BY region) FROM sales WHERE region = 'n'", "[[1 1] [2 1] [3 1]]")
+}
+
+func TestWindow_LagLead(t *testing.T) {
+	s := newSalesSession(t)
+	s.wantRows("SELECT day, LAG(amount) OVER (ORDER BY day), LEAD(amount, 2, 0) OVER (ORDER BY day) FROM sales WHERE region = 'n'",
+		"[[1 <nil> 20] [2 10 0] [3 20 0]]")
+	// offsets stay within the partition
+	s.wantRows("SELECT region, day, LAG(day, 1, 0) OVER (PARTITION BY region ORDER BY day) FROM sales WHERE day < 3",
+		"[[n 1 0] [n 2 1] [s 1 0] [s 2 1]]")
+	s.wantErr("SELECT LAG(amount, 'x') OVER (ORDER BY day) FROM sales", "offset of lag must be an integer")
+}
+
+func TestWindow_Frames(t *testing.T) {
+	s := newSalesSession(t)
+	// the default frame runs to the last peer of the current row
+	s.wantRows("SELECT amount, SUM(amount) OVER (ORDER BY amount) FROM sales WHERE region = 'n'", "[[10 10] [20 50] [20 50]]")
+	s.wantRows(`SELECT amount, SUM(amount) OVER (ORDER BY amount ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)
+		FROM sales WHERE region = 'n'`, "[[10 10] [20 30] [20 50]]")
+	s.wantRows(`SELECT day, SUM(amount) OVER (ORDER BY day ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING)
+		FROM sales WHERE region = 'n'`, "[[1 50] [2 40] [3 20]]")
+	// without ORDER BY the frame is the whole partition
+	s.wantRows(`SELECT region, COUNT(*) OVER (PARTITION BY region), MIN(amount) OVER (PARTITION BY region),
+		MAX(amount) OVER (PARTITION BY region) FROM sales WHERE day > 1`,
+		"[[n 2 20 20] [n 2 20 20] [s 2 0 15] [s 2 0 15]]")
+	// a frame ending before it starts is empty
+	s.wantRows("SELECT day, SUM(amount) OVER (ORDER BY day ROWS BETWEEN 3 PRECEDING AND 2 PRECEDING) FROM sales WHERE region = 'n'",
+		"[[1 <nil>] [2 <nil>] [3 10]]")
+}
+
+func TestWindow_NullArguments(t *testing.T) {
+	s := newSalesSession(t)
+	s.wantRows("SELECT day, SUM("+returned+") OVER (ORDER BY day ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING) FROM sales s WHERE region = 'n'",
+		"[[1 1] [2 4] [3 3]]")
+	// a frame of only NULLs sums to NULL but counts 0
+	s.wantRows("SELECT day, SUM("+returned+") OVER (ORDER BY day ROWS BETWEEN CURRENT ROW AND CURRENT ROW) FROM sales s WHERE region = 'n'",
+		"[[1 1] [2 <nil>] [3 3]]")
+	s.wantRows("SELECT day, COUNT("+returned+") OVER (ORDER BY day ROWS BETWEEN CURRENT ROW AND CURRENT ROW) FROM sales s WHERE region = 'n'",
+		"[[1 1] [2 0] [3 1]]")
+}
+
+func TestWindow_Errors(t *testing.T) {
+	s := newSalesSession(t)
+	s.wantErr("SELECT ROW_NUMBER(day) OVER () FROM sales", "function row_number takes 0 to 0 arguments, got 1")
+	s.wantErr("SELECT LAG() OVER () FROM sales", "function lag takes 1 to 3 arguments, got 0")
+	s.wantErr("SELECT SUM(*) OVER () FROM sales", "sum(*) is not supported")
+	s.wantErr("SELECT COUNT(*) FROM sales", "window function COUNT requires an OVER clause")
+	s.wantErr("SELECT SUM(amount) OVER (ORDER BY day RANGE BETWEEN 1 PRECEDING AND CURRENT ROW) FROM sales",
+		"RANGE frames with offsets are not supported, use ROWS")
+	s.wantErr("SELECT SUM(amount) OVER (ORDER BY day ROWS BETWEEN CURRENT ROW AND 1 PRECEDING) FROM sales", "invalid frame")
+	s.wantErr("SELECT SUM(region) OVER () FROM sales", "sum expects INT, got TEXT")
+	s.wantErr("SELECT day FROM sales WHERE ROW_NUMBER() OVER (ORDER BY day) = 1", "window functions are not allowed in WHERE")
+	s.wantErr("SELECT s.day FROM sales s JOIN returns r ON ROW_NUMBER() OVER (ORDER BY r.day) = 1",
+		"window functions are not allowed in JOIN conditions")
+}
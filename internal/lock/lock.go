@@ -0,0 +1,423 @@
+// Package lock is the lock manager. Sessions lock the tables they use in
+// the modes of multiple granularity locking: statements reading or
+// writing rows take the intention modes, which don't conflict with each
+// other, and statements using a table as a whole, such as schema changes,
+// take the shared or exclusive modes. Rows are locked too, by their TID,
+// once the table is locked in an intention mode: statements changing rows
+// and SELECT ... FOR UPDATE lock the rows exclusively, and key checks,
+// such as those of foreign keys, lock the rows holding the key in shared
+// mode, which waits for the transactions writing them. Locks are held
+// until their owner releases them all at once, at the end of a statement
+// or transaction block, so that a schema change waits for the
+// transactions using the table to end and a row stays locked until the
+// transaction that changed it commits or rolls back.
+//
+// Owners waiting for each other in a cycle would wait forever. The
+// manager keeps who waits for whom, the waits-for graph, and checks it
+// each time a request has to wait: a request that would close a cycle
+// fails with ErrDeadlock instead, and its owner, the victim, is expected
+// to give up its transaction and the locks it holds.
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"justasimpletoydb/internal/storage"
+)
+
+// Mode is a lock mode. A stronger mode grants everything a weaker one does.
+type Mode int
+
+const (
+	None                     Mode = iota // no lock
+	IntentionShared                      // IS: rows of the table are read
+	IntentionExclusive                   // IX: rows of the table are written
+	Shared                               // S: the whole table is read
+	SharedIntentionExclusive             // SIX: S and IX together
+	Exclusive                            // X: the table is changed as a whole
+)
+
+func (m Mode) String() string {
+	switch m {
+	case None:
+		return "none"
+	case IntentionShared:
+		return "IS"
+	case IntentionExclusive:
+		return "IX"
+	case Shared:
+		return "S"
+	case SharedIntentionExclusive:
+		return "SIX"
+	case Exclusive:
+		return "X"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// compatible[a][b] reports whether one owner may hold a while another
+// holds b.
+var compatible = [...][6]bool{
+	None:                     {true, true, true, true, true, true},
+	IntentionShared:          {true, true, true, true, true, false},
+	IntentionExclusive:       {true, true, true, false, false, false},
+	Shared:                   {true, true, false, true, false, false},
+	SharedIntentionExclusive: {true, true, false, false, false, false},
+	Exclusive:                {true, false, false, false, false, false},
+}
+
+// Compatible reports whether two owners can hold a and b at the same time.
+func Compatible(a, b Mode) bool {
+	return compatible[a][b]
+}
+
+// Covers reports whether holding a grants everything b does.
+func Covers(a, b Mode) bool {
+	switch a {
+	case Exclusive:
+		return true
+	case SharedIntentionExclusive:
+		return b != Exclusive
+	case Shared:
+		return b == None || b == IntentionShared || b == Shared
+	case IntentionExclusive:
+		return b == None || b == IntentionShared || b == IntentionExclusive
+	case IntentionShared:
+		return b == None || b == IntentionShared
+	}
+	return b == None
+}
+
+// join returns the weakest mode covering both a and b: the mode of an
+// owner holding a that asks for b. IX and S are the only modes neither of
+// which covers the other.
+func join(a, b Mode) Mode {
+	switch {
+	case Covers(a, b):
+		return a
+	case Covers(b, a):
+		return b
+	}
+	return SharedIntentionExclusive
+}
+
+// Owner identifies a session holding locks.
+type Owner uint64
+
+// Wait says what a lock request does when other owners hold the lock in
+// conflicting modes.
+type Wait int
+
+const (
+	Block      Wait = iota // wait for the lock, up to the manager's Timeout
+	NoWait                 // fail with ErrNotAvailable
+	SkipLocked             // give up without the lock
+)
+
+var (
+	// ErrTimeout is returned for a request not granted within the
+	// manager's Timeout.
+	ErrTimeout = errors.New("canceling statement due to lock timeout")
+	// ErrNotAvailable is returned for a NoWait request that would wait.
+	ErrNotAvailable = errors.New("could not obtain lock")
+	// ErrDeadlock is returned for a request that would wait for owners
+	// that wait for its own.
+	ErrDeadlock = errors.New("deadlock detected")
+)
+
+// Stats counts the requests that had to wait, since the manager was made.
+type Stats struct {
+	Waits     uint64 // requests that waited
+	Timeouts  uint64 // of those, requests that gave up after the Timeout
+	Deadlocks uint64 // requests failed with ErrDeadlock
+}
+
+// DefaultTimeout is the Timeout of a new manager.
+const DefaultTimeout = 30 * time.Second
+
+// Manager grants table and row locks. Requests that conflict with the
+// locks granted wait in line: a request is granted once it is compatible
+// with the locks of the other owners and every request before it in line
+// was granted, so a stream of readers can't keep a schema change waiting
+// forever. An owner strengthening a lock it holds goes before the line.
+type Manager struct {
+	// Timeout is how long a request waits before it fails with
+	// ErrTimeout; zero waits forever. It is set before the manager is
+	// used.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	locks   map[resource]*entry
+	held    map[Owner][]resource // resources each owner holds a lock on
+	waiting map[Owner]*request   // the request each waiting owner waits for
+	owners  Owner                // last owner handed out by NewOwner
+	stats   Stats
+}
+
+// resource is what a lock is taken on: a table, or one of its rows.
+type resource struct {
+	table string
+	row   bool
+	tid   storage.TID // of the row
+}
+
+// entry is the state of the locks on one resource.
+type entry struct {
+	granted map[Owner]Mode
+	queue   []*request
+}
+
+// request is a lock an owner waits for; ready is closed once it is granted.
+type request struct {
+	owner Owner
+	res   resource
+	mode  Mode
+	ready chan struct{}
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		Timeout: DefaultTimeout,
+		locks:   make(map[resource]*entry),
+		held:    make(map[Owner][]resource),
+		waiting: make(map[Owner]*request),
+	}
+}
+
+// NewOwner returns the identifier of a new session.
+func (m *Manager) NewOwner() Owner {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.owners++
+	return m.owners
+}
+
+// LockTable locks a table in the given mode for owner, waiting while
+// other owners hold it in conflicting modes. An owner locking a table
+// again ends up holding the join of both modes.
+func (m *Manager) LockTable(owner Owner, table string, mode Mode) error {
+	_, err := m.acquire(owner, resource{table: table}, mode, Block)
+	return err
+}
+
+// LockRow locks the row at tid of a table like LockTable does the table;
+// the owner must hold an intention lock on the table. Rows are locked in
+// the Shared or Exclusive mode. A row locked by another owner is waited
+// for, or not, as wait says; LockRow reports whether the lock was granted,
+// which it is unless wait is SkipLocked.
+func (m *Manager) LockRow(owner Owner, table string, tid storage.TID, mode Mode, wait Wait) (bool, error) {
+	return m.acquire(owner, resource{table: table, row: true, tid: tid}, mode, wait)
+}
+
+func (m *Manager) acquire(owner Owner, res resource, mode Mode, wait Wait) (bool, error) {
+	m.mu.Lock()
+	e, ok := m.locks[res]
+	if !ok {
+		e = &entry{granted: make(map[Owner]Mode)}
+		m.locks[res] = e
+	}
+	held := e.granted[owner]
+	if Covers(held, mode) {
+		m.mu.Unlock()
+		return true, nil
+	}
+	mode = join(held, mode)
+	upgrade := held != None
+	if (upgrade || len(e.queue) == 0) && e.grantable(owner, mode) {
+		m.grant(e, res, owner, mode)
+		m.mu.Unlock()
+		return true, nil
+	}
+	switch wait {
+	case NoWait, SkipLocked:
+		m.mu.Unlock()
+		if wait == NoWait {
+			return false, ErrNotAvailable
+		}
+		return false, nil
+	}
+	req := &request{owner: owner, res: res, mode: mode, ready: make(chan struct{})}
+	if upgrade {
+		e.queue = append([]*request{req}, e.queue...)
+	} else {
+		e.queue = append(e.queue, req)
+	}
+	m.waiting[owner] = req
+	if m.deadlocked(owner) {
+		m.withdraw(e, req)
+		m.stats.Deadlocks++
+		m.mu.Unlock()
+		return false, ErrDeadlock
+	}
+	m.stats.Waits++
+	m.mu.Unlock()
+	return true, m.await(e, req)
+}
+
+// await waits for a request in line to be granted. A request timing out
+// leaves the line, which may let those behind it through.
+func (m *Manager) await(e *entry, req *request) error {
+	if m.Timeout <= 0 {
+		<-req.ready
+		return nil
+	}
+	timer := time.NewTimer(m.Timeout)
+	defer timer.Stop()
+	select {
+	case <-req.ready:
+		return nil
+	case <-timer.C:
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-req.ready: // granted as the timer fired
+		return nil
+	default:
+	}
+	m.withdraw(e, req)
+	m.stats.Timeouts++
+	return ErrTimeout
+}
+
+// withdraw takes a request that won't wait any longer out of line.
+func (m *Manager) withdraw(e *entry, req *request) {
+	e.queue = slices.DeleteFunc(e.queue, func(r *request) bool { return r == req })
+	delete(m.waiting, req.owner)
+	m.wake(e, req.res)
+}
+
+// waitsFor returns the owners a waiting owner waits for: those holding
+// the lock in modes conflicting with its request, and those whose
+// requests are before it in line.
+func (m *Manager) waitsFor(owner Owner) []Owner {
+	req, ok := m.waiting[owner]
+	if !ok {
+		return nil
+	}
+	e := m.locks[req.res]
+	var out []Owner
+	for o, held := range e.granted {
+		if o != owner && !Compatible(held, req.mode) {
+			out = append(out, o)
+		}
+	}
+	for _, r := range e.queue {
+		if r == req {
+			break
+		}
+		out = append(out, r.owner)
+	}
+	return out
+}
+
+// deadlocked reports whether owner, which just started waiting, is on a
+// cycle of the waits-for graph. Every cycle formed goes through the
+// request that formed it, so looking from there finds them all.
+func (m *Manager) deadlocked(owner Owner) bool {
+	seen := map[Owner]bool{owner: true}
+	stack := m.waitsFor(owner)
+	for len(stack) > 0 {
+		o := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if o == owner {
+			return true
+		}
+		if !seen[o] {
+			seen[o] = true
+			stack = append(stack, m.waitsFor(o)...)
+		}
+	}
+	return false
+}
+
+// Stats returns the manager's counters.
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Mode returns the mode owner holds table in, None if it holds no lock.
+func (m *Manager) Mode(owner Owner, table string) Mode {
+	return m.mode(owner, resource{table: table})
+}
+
+// RowMode returns the mode owner holds the row at tid of table in.
+func (m *Manager) RowMode(owner Owner, table string, tid storage.TID) Mode {
+	return m.mode(owner, resource{table: table, row: true, tid: tid})
+}
+
+// RowConflicts reports whether owners other than owner hold the row at
+// tid of table in modes conflicting with mode: whether locking it would
+// wait.
+func (m *Manager) RowConflicts(owner Owner, table string, tid storage.TID, mode Mode) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.locks[resource{table: table, row: true, tid: tid}]
+	return ok && !e.grantable(owner, mode)
+}
+
+func (m *Manager) mode(owner Owner, res resource) Mode {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.locks[res]; ok {
+		return e.granted[owner]
+	}
+	return None
+}
+
+// ReleaseAll releases every lock of owner and grants the requests in line
+// that no longer conflict.
+func (m *Manager) ReleaseAll(owner Owner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	resources := m.held[owner]
+	delete(m.held, owner)
+	for _, res := range resources {
+		e := m.locks[res]
+		delete(e.granted, owner)
+		m.wake(e, res)
+	}
+}
+
+// grantable reports whether owner can hold mode alongside the locks the
+// other owners hold.
+func (e *entry) grantable(owner Owner, mode Mode) bool {
+	for o, held := range e.granted {
+		if o != owner && !Compatible(held, mode) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) grant(e *entry, res resource, owner Owner, mode Mode) {
+	if e.granted[owner] == None {
+		m.held[owner] = append(m.held[owner], res)
+	}
+	e.granted[owner] = mode
+}
+
+// wake grants the requests at the head of a resource's line until one
+// still conflicts, and forgets the resource once no one holds or waits
+// for it.
+func (m *Manager) wake(e *entry, res resource) {
+	for len(e.queue) > 0 {
+		req := e.queue[0]
+		if !e.grantable(req.owner, req.mode) {
+			break
+		}
+		e.queue = e.queue[1:]
+		delete(m.waiting, req.owner)
+		m.grant(e, res, req.owner, req.mode)
+		close(req.ready)
+	}
+	if len(e.granted) == 0 && len(e.queue) == 0 {
+		delete(m.locks, res)
+	}
+}
@@ -0,0 +1,346 @@
+package lock
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"justasimpletoydb/internal/storage"
+)
+
+func TestCompatible_Symmetric(t *testing.T) {
+	for a := None; a <= Exclusive; a++ {
+		for b := None; b <= Exclusive; b++ {
+			if Compatible(a, b) != Compatible(b, a) {
+				t.Errorf("Compatible(%s, %s) != Compatible(%s, %s)", a, b, b, a)
+			}
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct{ a, b, want Mode }{
+		{None, IntentionShared, IntentionShared},
+		{IntentionShared, IntentionExclusive, IntentionExclusive},
+		{IntentionExclusive, Shared, SharedIntentionExclusive},
+		{Shared, IntentionExclusive, SharedIntentionExclusive},
+		{IntentionShared, Shared, Shared},
+		{SharedIntentionExclusive, Exclusive, Exclusive},
+		{Exclusive, IntentionShared, Exclusive},
+	}
+	for _, tt := range tests {
+		if got := join(tt.a, tt.b); got != tt.want {
+			t.Errorf("join(%s, %s) = %s, want %s", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// waitsFor locks table in a goroutine and returns a channel closed once
+// the lock is granted.
+func waitsFor(m *Manager, owner Owner, table string, mode Mode) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		m.LockTable(owner, table, mode)
+		close(done)
+	}()
+	return done
+}
+
+func granted(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+func TestManager_IntentionLocksShare(t *testing.T) {
+	m := NewManager()
+	a, b := m.NewOwner(), m.NewOwner()
+	m.LockTable(a, "t", IntentionExclusive)
+	if !granted(waitsFor(m, b, "t", IntentionExclusive)) {
+		t.Fatal("IX waited for IX")
+	}
+	if m.Mode(a, "t") != IntentionExclusive || m.Mode(b, "t") != IntentionExclusive {
+		t.Errorf("modes = %s, %s, want IX, IX", m.Mode(a, "t"), m.Mode(b, "t"))
+	}
+}
+
+func TestManager_ExclusiveWaits(t *testing.T) {
+	m := NewManager()
+	a, b := m.NewOwner(), m.NewOwner()
+	m.LockTable(a, "t", IntentionShared)
+	done := waitsFor(m, b, "t", Exclusive)
+	if granted(done) {
+		t.Fatal("X granted while IS is held")
+	}
+	m.ReleaseAll(a)
+	if !granted(done) {
+		t.Fatal("X not granted after IS was released")
+	}
+	if m.Mode(a, "t") != None {
+		t.Errorf("released owner still holds %s", m.Mode(a, "t"))
+	}
+}
+
+func TestManager_WaitersInLine(t *testing.T) {
+	m := NewManager()
+	a, b, c := m.NewOwner(), m.NewOwner(), m.NewOwner()
+	m.LockTable(a, "t", IntentionShared)
+	x := waitsFor(m, b, "t", Exclusive)
+	if granted(x) {
+		t.Fatal("X granted while IS is held")
+	}
+	// IS is compatible with the IS held but must not pass the X in line
+	is := waitsFor(m, c, "t", IntentionShared)
+	if granted(is) {
+		t.Fatal("IS went ahead of the X waiting before it")
+	}
+	m.ReleaseAll(a)
+	if !granted(x) {
+		t.Fatal("X not granted")
+	}
+	m.ReleaseAll(b)
+	if !granted(is) {
+		t.Fatal("IS not granted after X was released")
+	}
+}
+
+func TestManager_Upgrade(t *testing.T) {
+	m := NewManager()
+	a, b := m.NewOwner(), m.NewOwner()
+	m.LockTable(a, "t", IntentionShared)
+	m.LockTable(b, "t", IntentionShared)
+	m.LockTable(a, "t", IntentionExclusive)
+	if got := m.Mode(a, "t"); got != IntentionExclusive {
+		t.Fatalf("mode after upgrade = %s, want IX", got)
+	}
+	m.LockTable(a, "t", Shared)
+	if got := m.Mode(a, "t"); got != SharedIntentionExclusive {
+		t.Fatalf("mode after S = %s, want SIX", got)
+	}
+	m.LockTable(a, "t", IntentionShared) // covered, returns at once
+	if got := m.Mode(a, "t"); got != SharedIntentionExclusive {
+		t.Errorf("mode after IS = %s, want SIX", got)
+	}
+
+	// an upgrade waits for the other holders but goes before the line
+	x := waitsFor(m, a, "t", Exclusive)
+	if granted(x) {
+		t.Fatal("X granted while another owner holds IS")
+	}
+	m.ReleaseAll(b)
+	if !granted(x) {
+		t.Fatal("upgrade not granted after the other owner released")
+	}
+}
+
+func TestManager_RowLocks(t *testing.T) {
+	m := NewManager()
+	a, b := m.NewOwner(), m.NewOwner()
+	r1, r2 := storage.TID{PageID: 0, SlotID: 1}, storage.TID{PageID: 0, SlotID: 2}
+	m.LockTable(a, "jobs", IntentionExclusive)
+	m.LockTable(b, "jobs", IntentionExclusive)
+	if ok, err := m.LockRow(a, "jobs", r1, Exclusive, Block); !ok || err != nil {
+		t.Fatalf("LockRow = %v, %v", ok, err)
+	}
+
+	if _, err := m.LockRow(b, "jobs", r1, Exclusive, NoWait); !errors.Is(err, ErrNotAvailable) {
+		t.Errorf("NOWAIT on a locked row: err = %v, want ErrNotAvailable", err)
+	}
+	if ok, err := m.LockRow(b, "jobs", r1, Exclusive, SkipLocked); ok || err != nil {
+		t.Errorf("SKIP LOCKED on a locked row = %v, %v, want false, nil", ok, err)
+	}
+	if ok, err := m.LockRow(b, "jobs", r2, Exclusive, SkipLocked); !ok || err != nil {
+		t.Errorf("SKIP LOCKED on a free row = %v, %v, want true, nil", ok, err)
+	}
+	if !m.RowConflicts(b, "jobs", r1, Shared) || m.RowConflicts(a, "jobs", r1, Shared) {
+		t.Error("RowConflicts should report the row held by the other owner only")
+	}
+	if m.RowConflicts(a, "jobs", storage.TID{SlotID: 9}, Shared) {
+		t.Error("RowConflicts reported an unlocked row")
+	}
+	// the same row of another table is another lock
+	m.LockTable(b, "done", IntentionExclusive)
+	if ok, err := m.LockRow(b, "done", r1, Exclusive, NoWait); !ok || err != nil {
+		t.Errorf("row of another table = %v, %v", ok, err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := m.LockRow(b, "jobs", r1, Exclusive, Block)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("row lock granted while another owner holds it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	m.ReleaseAll(a)
+	if err := <-done; err != nil {
+		t.Fatalf("row lock after release: %v", err)
+	}
+	if got := m.RowMode(b, "jobs", r1); got != Exclusive {
+		t.Errorf("RowMode = %s, want X", got)
+	}
+	m.ReleaseAll(b)
+	if len(m.locks) != 0 {
+		t.Errorf("locks left after release: %v", m.locks)
+	}
+}
+
+func TestManager_Timeout(t *testing.T) {
+	m := NewManager()
+	m.Timeout = 50 * time.Millisecond
+	a, b, c := m.NewOwner(), m.NewOwner(), m.NewOwner()
+	m.LockTable(a, "t", IntentionShared)
+	start := time.Now()
+	if err := m.LockTable(b, "t", Exclusive); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want ErrTimeout", err)
+	}
+	if waited := time.Since(start); waited < m.Timeout {
+		t.Errorf("gave up after %s, before the timeout", waited)
+	}
+	if got := m.Mode(b, "t"); got != None {
+		t.Errorf("timed out owner holds %s", got)
+	}
+	if got := m.Stats(); got != (Stats{Waits: 1, Timeouts: 1}) {
+		t.Errorf("Stats = %+v, want 1 wait that timed out", got)
+	}
+	// the request that timed out no longer keeps the line waiting
+	if err := m.LockTable(c, "t", IntentionShared); err != nil {
+		t.Errorf("IS after the X timed out: %v", err)
+	}
+}
+
+// rowWaiter locks a row in a goroutine and returns a channel receiving
+// the result once the request is granted or fails.
+func rowWaiter(m *Manager, owner Owner, tid storage.TID) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.LockRow(owner, "t", tid, Exclusive, Block)
+		done <- err
+	}()
+	return done
+}
+
+func TestManager_Deadlock(t *testing.T) {
+	m := NewManager()
+	a, b := m.NewOwner(), m.NewOwner()
+	r1, r2 := storage.TID{SlotID: 1}, storage.TID{SlotID: 2}
+	m.LockRow(a, "t", r1, Exclusive, Block)
+	m.LockRow(b, "t", r2, Exclusive, Block)
+
+	first := rowWaiter(m, a, r2)
+	time.Sleep(20 * time.Millisecond)
+	// b waiting for r1 would close the cycle, so b is the victim
+	if _, err := m.LockRow(b, "t", r1, Exclusive, Block); !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("err = %v, want ErrDeadlock", err)
+	}
+	m.ReleaseAll(b)
+	select {
+	case err := <-first:
+		if err != nil {
+			t.Fatalf("a's request after the victim released: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a still waits after the victim released its locks")
+	}
+	if got := m.Stats(); got != (Stats{Waits: 1, Deadlocks: 1}) {
+		t.Errorf("Stats = %+v, want 1 wait and 1 deadlock", got)
+	}
+}
+
+func TestManager_DeadlockOnUpgrade(t *testing.T) {
+	m := NewManager()
+	a, b := m.NewOwner(), m.NewOwner()
+	m.LockTable(a, "t", IntentionShared)
+	m.LockTable(b, "t", IntentionShared)
+	x := waitsFor(m, a, "t", Exclusive)
+	if granted(x) {
+		t.Fatal("X granted while another owner holds IS")
+	}
+	if err := m.LockTable(b, "t", Exclusive); !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("second upgrade: err = %v, want ErrDeadlock", err)
+	}
+	m.ReleaseAll(b)
+	if !granted(x) {
+		t.Fatal("first upgrade not granted after the victim released")
+	}
+}
+
+func TestManager_DeadlockCycleOfThree(t *testing.T) {
+	m := NewManager()
+	owners := []Owner{m.NewOwner(), m.NewOwner(), m.NewOwner()}
+	tids := []storage.TID{{SlotID: 0}, {SlotID: 1}, {SlotID: 2}}
+	for i, o := range owners {
+		m.LockRow(o, "t", tids[i], Exclusive, Block)
+	}
+	// 0 waits for 1, 1 waits for 2: no cycle yet
+	w0 := rowWaiter(m, owners[0], tids[1])
+	w1 := rowWaiter(m, owners[1], tids[2])
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-w0:
+		t.Fatalf("owner 0 stopped waiting: %v", err)
+	case err := <-w1:
+		t.Fatalf("owner 1 stopped waiting: %v", err)
+	default:
+	}
+	if _, err := m.LockRow(owners[2], "t", tids[0], Exclusive, Block); !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("err = %v, want ErrDeadlock", err)
+	}
+	m.ReleaseAll(owners[2])
+	if err := <-w1; err != nil {
+		t.Fatalf("owner 1: %v", err)
+	}
+	m.ReleaseAll(owners[1])
+	if err := <-w0; err != nil {
+		t.Fatalf("owner 0: %v", err)
+	}
+	if got := m.Stats().Deadlocks; got != 1 {
+		t.Errorf("Deadlocks = %d, want 1", got)
+	}
+}
+
+// TestManager_Stress checks under the race detector that exclusive locks
+// exclude everyone and intention locks exclude exclusive ones.
+func TestManager_Stress(t *testing.T) {
+	m := NewManager()
+	tables := []string{"a", "b", "c"}
+	var holders [3]struct{ intent, exclusive atomic.Int32 }
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			owner := m.NewOwner()
+			for i := 0; i < 200; i++ {
+				n := (g + i) % len(tables)
+				h := &holders[n]
+				if (g+i)%7 == 0 {
+					m.LockTable(owner, tables[n], Exclusive)
+					if h.exclusive.Add(1) != 1 || h.intent.Load() != 0 {
+						t.Errorf("X on %s held alongside other locks", tables[n])
+					}
+					h.exclusive.Add(-1)
+				} else {
+					m.LockTable(owner, tables[n], IntentionExclusive)
+					h.intent.Add(1)
+					if h.exclusive.Load() != 0 {
+						t.Errorf("IX on %s held alongside X", tables[n])
+					}
+					h.intent.Add(-1)
+				}
+				m.ReleaseAll(owner)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if len(m.locks) != 0 || len(m.held) != 0 {
+		t.Errorf("locks left after every owner released: %v, %v", m.locks, m.held)
+	}
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+	"strings"
+)
+
+// ParseAlter parses
+//
+//	ALTER TABLE name ADD [COLUMN] col type [DEFAULT expr]
+//	ALTER TABLE name DROP [COLUMN] col
+//	ALTER TABLE name RENAME [COLUMN] col TO new
+//	ALTER TABLE name RENAME TO new
+func (p *Parser) ParseAlter() (*executor.AlterTableStmt, error) {
+	if err := p.expect(KEYWORD, "ALTER"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(KEYWORD, "TABLE"); err != nil {
+		return nil, err
+	}
+	tableTok := p.eat()
+	if tableTok.Type != IDENT {
+		return nil, fmt.Errorf("expected table name")
+	}
+	stmt := &executor.AlterTableStmt{Table: tableTok.Literal}
+
+	action := p.eat()
+	switch strings.ToUpper(action.Literal) {
+	case "ADD":
+		p.skipKeyword("COLUMN")
+		colTok := p.eat()
+		if colTok.Type != IDENT {
+			return nil, fmt.Errorf("expected column name")
+		}
+		typ, err := p.parseColumnType()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Action = executor.AlterAddColumn
+		stmt.Column.Name = colTok.Literal
+		stmt.Column.Type = typ
+		if p.isKeyword("DEFAULT") {
+			p.eat()
+			def, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Default = def
+		}
+
+	case "DROP":
+		p.skipKeyword("COLUMN")
+		colTok := p.eat()
+		if colTok.Type != IDENT {
+			return nil, fmt.Errorf("expected column name")
+		}
+		stmt.Action = executor.AlterDropColumn
+		stmt.Name = colTok.Literal
+
+	case "RENAME":
+		stmt.Action = executor.AlterRenameTable
+		if !p.isKeyword("TO") {
+			p.skipKeyword("COLUMN")
+			colTok := p.eat()
+			if colTok.Type != IDENT {
+				return nil, fmt.Errorf("expected column name")
+			}
+			stmt.Action = executor.AlterRenameColumn
+			stmt.Name = colTok.Literal
+		}
+		if err := p.expect(KEYWORD, "TO"); err != nil {
+			return nil, err
+		}
+		newTok := p.eat()
+		if newTok.Type != IDENT {
+			return nil, fmt.Errorf("expected new name after TO")
+		}
+		stmt.NewName = newTok.Literal
+
+	default:
+		return nil, fmt.Errorf("unexpected ALTER TABLE action: %s", action.Literal)
+	}
+
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return stmt, nil
+}
+
+// skipKeyword consumes the keyword if it is next.
+func (p *Parser) skipKeyword(lit string) {
+	if p.isKeyword(lit) {
+		p.eat()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"justasimpletoydb/internal/catalog"
 	"justasimpletoydb/internal/executor"
+	"strconv"
 	"strings"
 )
 
@@ -21,41 +22,79 @@ func (p *Parser) ParseCreate() (executor.Statement, error) {
 	case "TABLE":
 		return p.parseCreateTable()
 	case "INDEX":
-		return p.parseCreateIndex()
+		return p.parseCreateIndex(false)
+	case "UNIQUE":
+		if err := p.expect(KEYWORD, "INDEX"); err != nil {
+			return nil, err
+		}
+		return p.parseCreateIndex(true)
+	case "SEQUENCE":
+		return p.parseCreateSequence()
+	case "VIEW":
+		return p.parseCreateView(false)
+	case "MATERIALIZED":
+		if err := p.expect(KEYWORD, "VIEW"); err != nil {
+			return nil, err
+		}
+		return p.parseCreateView(true)
 	default:
 		return nil, fmt.Errorf("unexpected CREATE target: %s", next.Literal)
 	}
 }
 
+// parseIfNotExists consumes an optional IF NOT EXISTS.
+func (p *Parser) parseIfNotExists() (bool, error) {
+	if !p.isKeyword("IF") {
+		return false, nil
+	}
+	p.eat()
+	if err := p.expect(KEYWORD, "NOT"); err != nil {
+		return false, err
+	}
+	if err := p.expect(KEYWORD, "EXISTS"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // internal helper for table
 func (p *Parser) parseCreateTable() (*executor.CreateTableStmt, error) {
+	ifNotExists, err := p.parseIfNotExists()
+	if err != nil {
+		return nil, err
+	}
 	nameTok := p.eat()
 	if nameTok.Type != IDENT {
 		return nil, fmt.Errorf("expected table name")
 	}
 	name := nameTok.Literal
 
+	// CREATE TABLE name AS query
+	if p.isKeyword("AS") {
+		p.eat()
+		query, err := p.parseQuery()
+		if err != nil {
+			return nil, err
+		}
+		if p.isSymbol(";") {
+			p.eat()
+		}
+		return &executor.CreateTableStmt{Name: name, IfNotExists: ifNotExists, Query: query}, nil
+	}
+
 	if err := p.expect(SYMBOL, "("); err != nil {
 		return nil, err
 	}
 
-	cols := []catalog.Column{}
+	stmt := &executor.CreateTableStmt{Name: name, IfNotExists: ifNotExists}
 	for {
-		colNameTok := p.eat()
-		if colNameTok.Type != IDENT {
-			return nil, fmt.Errorf("expected column name")
+		if p.isKeyword("CONSTRAINT") || p.isKeyword("CHECK") || p.isKeyword("FOREIGN") {
+			if err := p.parseConstraint(stmt, ""); err != nil {
+				return nil, err
+			}
+		} else if err := p.parseColumnDef(stmt); err != nil {
+			return nil, err
 		}
-		typeTok := p.eat()
-		if typeTok.Type != KEYWORD {
-			return nil, fmt.Errorf("expected column type")
-		}
-
-		typ := catalog.TypeText
-		if strings.ToUpper(typeTok.Literal) == "INT" {
-			typ = catalog.TypeInt
-		}
-
-		cols = append(cols, catalog.Column{Name: colNameTok.Literal, Type: typ})
 
 		cur := p.cur()
 		if cur.Type == SYMBOL && cur.Literal == ")" {
@@ -72,11 +111,320 @@ func (p *Parser) parseCreateTable() (*executor.CreateTableStmt, error) {
 		p.eat()
 	}
 
-	return &executor.CreateTableStmt{Name: name, Columns: cols}, nil
+	return stmt, nil
+}
+
+// parseColumnDef parses "name type { DEFAULT expr | UNIQUE | constraint }",
+// see parseConstraint.
+// SERIAL and its synonym AUTOINCREMENT are INT columns taking their default
+// from a sequence of their own.
+func (p *Parser) parseColumnDef(stmt *executor.CreateTableStmt) error {
+	colNameTok := p.eat()
+	if colNameTok.Type != IDENT {
+		return fmt.Errorf("expected column name")
+	}
+	serial := p.isKeyword("SERIAL") || p.isKeyword("AUTOINCREMENT")
+	typ := catalog.TypeInt
+	var err error
+	if serial {
+		p.eat()
+	} else if typ, err = p.parseColumnType(); err != nil {
+		return err
+	}
+	def := executor.ColumnDef{Column: catalog.Column{Name: colNameTok.Literal, Type: typ}, Serial: serial}
+	for {
+		switch {
+		case p.isKeyword("DEFAULT"):
+			if def.Default != nil {
+				return fmt.Errorf("multiple default values specified for column %s", colNameTok.Literal)
+			}
+			p.eat()
+			if def.Default, err = p.parseExpr(); err != nil {
+				return err
+			}
+		case p.isKeyword("UNIQUE"):
+			p.eat()
+			def.Unique = true
+		case p.isKeyword("CONSTRAINT"), p.isKeyword("CHECK"), p.isKeyword("REFERENCES"):
+			if err := p.parseConstraint(stmt, colNameTok.Literal); err != nil {
+				return err
+			}
+		default:
+			stmt.Columns = append(stmt.Columns, def)
+			return nil
+		}
+	}
+}
+
+// parseConstraint parses a named or unnamed constraint. column is set for
+// a column constraint and empty for a table constraint:
+//
+//	[CONSTRAINT name] CHECK (expr)
+//	[CONSTRAINT name] REFERENCES table (column) [ON DELETE action]       -- column
+//	[CONSTRAINT name] FOREIGN KEY (column) REFERENCES table (column) ... -- table
+func (p *Parser) parseConstraint(stmt *executor.CreateTableStmt, column string) error {
+	name := ""
+	if p.isKeyword("CONSTRAINT") {
+		p.eat()
+		nameTok := p.eat()
+		if nameTok.Type != IDENT {
+			return fmt.Errorf("expected constraint name")
+		}
+		name = nameTok.Literal
+	}
+	if p.isKeyword("CHECK") {
+		check, err := p.parseCheck(name, column)
+		if err != nil {
+			return err
+		}
+		stmt.Checks = append(stmt.Checks, check)
+		return nil
+	}
+	if column == "" {
+		if err := p.expect(KEYWORD, "FOREIGN"); err != nil {
+			return err
+		}
+		if err := p.expect(KEYWORD, "KEY"); err != nil {
+			return err
+		}
+		var err error
+		if column, err = p.parseKeyColumn("column"); err != nil {
+			return err
+		}
+	}
+	fk, err := p.parseReferences(name, column)
+	if err != nil {
+		return err
+	}
+	stmt.ForeignKeys = append(stmt.ForeignKeys, fk)
+	return nil
+}
+
+// parseReferences parses "REFERENCES table (column) [ON DELETE action]
+// [ON UPDATE {NO ACTION | RESTRICT}]", the action being one of NO ACTION,
+// RESTRICT, CASCADE or SET NULL. Referenced keys can't be changed while
+// referenced, so ON UPDATE takes no other action.
+func (p *Parser) parseReferences(name, column string) (executor.ForeignKeyDef, error) {
+	fk := executor.ForeignKeyDef{Name: name, Column: column}
+	if err := p.expect(KEYWORD, "REFERENCES"); err != nil {
+		return fk, err
+	}
+	tableTok := p.eat()
+	if tableTok.Type != IDENT {
+		return fk, fmt.Errorf("expected referenced table name")
+	}
+	fk.RefTable = tableTok.Literal
+	if !p.isSymbol("(") {
+		return fk, fmt.Errorf("expected referenced column of table %s", fk.RefTable)
+	}
+	var err error
+	if fk.RefColumn, err = p.parseKeyColumn("referenced column"); err != nil {
+		return fk, err
+	}
+	for p.isKeyword("ON") {
+		p.eat()
+		switch {
+		case p.isKeyword("DELETE"):
+			p.eat()
+			if fk.OnDelete, err = p.parseRefAction(); err != nil {
+				return fk, err
+			}
+		case p.isKeyword("UPDATE"):
+			p.eat()
+			action, err := p.parseRefAction()
+			if err != nil {
+				return fk, err
+			}
+			if action != catalog.FKRestrict {
+				return fk, fmt.Errorf("ON UPDATE %s is not supported", action)
+			}
+		default:
+			return fk, fmt.Errorf("expected DELETE or UPDATE after ON, got %v", p.cur())
+		}
+	}
+	return fk, nil
+}
+
+func (p *Parser) parseRefAction() (catalog.FKAction, error) {
+	tok := p.eat()
+	switch {
+	case tok.Type == KEYWORD && strings.EqualFold(tok.Literal, "RESTRICT"):
+		return catalog.FKRestrict, nil
+	case tok.Type == KEYWORD && strings.EqualFold(tok.Literal, "CASCADE"):
+		return catalog.FKCascade, nil
+	case tok.Type == KEYWORD && strings.EqualFold(tok.Literal, "NO"):
+		return catalog.FKRestrict, p.expect(KEYWORD, "ACTION")
+	case tok.Type == KEYWORD && strings.EqualFold(tok.Literal, "SET"):
+		return catalog.FKSetNull, p.expect(KEYWORD, "NULL")
+	default:
+		return 0, fmt.Errorf("expected referential action, got %v", tok)
+	}
+}
+
+// parseKeyColumn parses the parenthesized column of a foreign key.
+func (p *Parser) parseKeyColumn(what string) (string, error) {
+	if err := p.expect(SYMBOL, "("); err != nil {
+		return "", err
+	}
+	tok := p.eat()
+	if tok.Type != IDENT {
+		return "", fmt.Errorf("expected %s name", what)
+	}
+	if p.isSymbol(",") {
+		return "", fmt.Errorf("multi-column foreign keys are not supported")
+	}
+	if err := p.expect(SYMBOL, ")"); err != nil {
+		return "", err
+	}
+	return tok.Literal, nil
+}
+
+// parseCheck parses "CHECK (expr)" of a constraint with the given name,
+// empty to generate one.
+func (p *Parser) parseCheck(name, column string) (executor.CheckDef, error) {
+	check := executor.CheckDef{Name: name, Column: column}
+	if err := p.expect(KEYWORD, "CHECK"); err != nil {
+		return check, err
+	}
+	if err := p.expect(SYMBOL, "("); err != nil {
+		return check, err
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return check, err
+	}
+	if err := p.expect(SYMBOL, ")"); err != nil {
+		return check, err
+	}
+	check.Expr = e
+	return check, nil
+}
+
+// parseCreateView parses
+//
+//	CREATE [MATERIALIZED] VIEW [IF NOT EXISTS] name [(columns)] AS query
+func (p *Parser) parseCreateView(materialized bool) (*executor.CreateViewStmt, error) {
+	ifNotExists, err := p.parseIfNotExists()
+	if err != nil {
+		return nil, err
+	}
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected view name")
+	}
+	stmt := &executor.CreateViewStmt{Name: nameTok.Literal, Materialized: materialized, IfNotExists: ifNotExists}
+	if p.isSymbol("(") {
+		p.eat()
+		for {
+			colTok := p.eat()
+			if colTok.Type != IDENT {
+				return nil, fmt.Errorf("expected column name, got %s '%s'", colTok.Type, colTok.Literal)
+			}
+			stmt.Columns = append(stmt.Columns, colTok.Literal)
+			if p.isSymbol(",") {
+				p.eat()
+				continue
+			}
+			break
+		}
+		if err := p.expect(SYMBOL, ")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(KEYWORD, "AS"); err != nil {
+		return nil, err
+	}
+	if stmt.Query, err = p.parseQuery(); err != nil {
+		return nil, err
+	}
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return stmt, nil
+}
+
+// parseCreateSequence parses
+//
+//	CREATE SEQUENCE [IF NOT EXISTS] name [INCREMENT [BY] n] [START [WITH] n]
+func (p *Parser) parseCreateSequence() (*executor.CreateSequenceStmt, error) {
+	ifNotExists, err := p.parseIfNotExists()
+	if err != nil {
+		return nil, err
+	}
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected sequence name")
+	}
+	stmt := &executor.CreateSequenceStmt{Name: nameTok.Literal, Increment: 1, IfNotExists: ifNotExists}
+	for {
+		switch {
+		case p.isKeyword("INCREMENT"):
+			p.eat()
+			p.skipKeyword("BY")
+			n, err := p.parseSignedInt()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Increment = n
+		case p.isKeyword("START"):
+			p.eat()
+			p.skipKeyword("WITH")
+			n, err := p.parseSignedInt()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Start = &n
+		default:
+			if p.isSymbol(";") {
+				p.eat()
+			}
+			return stmt, nil
+		}
+	}
+}
+
+// parseSignedInt parses an integer literal with an optional minus sign.
+func (p *Parser) parseSignedInt() (int, error) {
+	neg := p.isSymbol("-")
+	if neg {
+		p.eat()
+	}
+	tok := p.eat()
+	if tok.Type != INT {
+		return 0, fmt.Errorf("expected integer, got %s '%s'", tok.Type, tok.Literal)
+	}
+	n, err := strconv.Atoi(tok.Literal)
+	if err != nil {
+		return 0, fmt.Errorf("can't convert value to number: %s", tok.Literal)
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+// parseColumnType parses a column type name: INT or TEXT.
+func (p *Parser) parseColumnType() (catalog.ColumnType, error) {
+	typeTok := p.eat()
+	if typeTok.Type != KEYWORD {
+		return 0, fmt.Errorf("expected column type")
+	}
+	switch strings.ToUpper(typeTok.Literal) {
+	case "INT":
+		return catalog.TypeInt, nil
+	case "TEXT":
+		return catalog.TypeText, nil
+	default:
+		return 0, fmt.Errorf("unknown column type %s", typeTok.Literal)
+	}
 }
 
 // internal helper for index
-func (p *Parser) parseCreateIndex() (*executor.CreateIndexStmt, error) {
+func (p *Parser) parseCreateIndex(unique bool) (*executor.CreateIndexStmt, error) {
+	ifNotExists, err := p.parseIfNotExists()
+	if err != nil {
+		return nil, err
+	}
 	idxTok := p.eat()
 	if idxTok.Type != IDENT {
 		return nil, fmt.Errorf("expected index name")
@@ -112,8 +460,10 @@ func (p *Parser) parseCreateIndex() (*executor.CreateIndexStmt, error) {
 	}
 
 	return &executor.CreateIndexStmt{
-		Name:      indexName,
-		TableName: tableName,
-		Column:    column,
+		Name:        indexName,
+		TableName:   tableName,
+		Column:      column,
+		Unique:      unique,
+		IfNotExists: ifNotExists,
 	}, nil
 }
@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+)
+
+// ParseDelete parses
+//
+//	DELETE FROM table [WHERE expr] [RETURNING list]
+func (p *Parser) ParseDelete() (*executor.DeleteStmt, error) {
+	if err := p.expect(KEYWORD, "DELETE"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(KEYWORD, "FROM"); err != nil {
+		return nil, err
+	}
+	tableTok := p.eat()
+	if tableTok.Type != IDENT {
+		return nil, fmt.Errorf("expected table name")
+	}
+	stmt := &executor.DeleteStmt{Table: tableTok.Literal}
+
+	if p.isKeyword("WHERE") {
+		where, err := p.parseWhere()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = where
+	}
+
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Returning = returning
+
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return stmt, nil
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+	"strings"
+)
+
+func (p *Parser) ParseDrop() (executor.Statement, error) {
+	if err := p.expect(KEYWORD, "DROP"); err != nil {
+		return nil, err
+	}
+
+	next := p.eat()
+	if next.Type != KEYWORD {
+		return nil, fmt.Errorf("expected keyword after DROP, got %v", next)
+	}
+
+	var stmt executor.Statement
+	var err error
+	switch strings.ToUpper(next.Literal) {
+	case "TABLE":
+		stmt, err = p.parseDropTable()
+	case "INDEX":
+		stmt, err = p.parseDropIndex()
+	case "SEQUENCE":
+		stmt, err = p.parseDropSequence()
+	case "VIEW":
+		stmt, err = p.parseDropView(false)
+	case "MATERIALIZED":
+		if err = p.expect(KEYWORD, "VIEW"); err == nil {
+			stmt, err = p.parseDropView(true)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected DROP target: %s", next.Literal)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return stmt, nil
+}
+
+// parseIfExists consumes an optional IF EXISTS.
+func (p *Parser) parseIfExists() (bool, error) {
+	if !p.isKeyword("IF") {
+		return false, nil
+	}
+	p.eat()
+	if err := p.expect(KEYWORD, "EXISTS"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *Parser) parseDropTable() (*executor.DropTableStmt, error) {
+	ifExists, err := p.parseIfExists()
+	if err != nil {
+		return nil, err
+	}
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected table name")
+	}
+	return &executor.DropTableStmt{Name: nameTok.Literal, IfExists: ifExists}, nil
+}
+
+func (p *Parser) parseDropSequence() (*executor.DropSequenceStmt, error) {
+	ifExists, err := p.parseIfExists()
+	if err != nil {
+		return nil, err
+	}
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected sequence name")
+	}
+	return &executor.DropSequenceStmt{Name: nameTok.Literal, IfExists: ifExists}, nil
+}
+
+func (p *Parser) parseDropView(materialized bool) (*executor.DropViewStmt, error) {
+	ifExists, err := p.parseIfExists()
+	if err != nil {
+		return nil, err
+	}
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected view name")
+	}
+	return &executor.DropViewStmt{Name: nameTok.Literal, Materialized: materialized, IfExists: ifExists}, nil
+}
+
+func (p *Parser) parseDropIndex() (*executor.DropIndexStmt, error) {
+	ifExists, err := p.parseIfExists()
+	if err != nil {
+		return nil, err
+	}
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected index name")
+	}
+	stmt := &executor.DropIndexStmt{Name: nameTok.Literal, IfExists: ifExists}
+	if p.isKeyword("ON") {
+		p.eat()
+		tableTok := p.eat()
+		if tableTok.Type != IDENT {
+			return nil, fmt.Errorf("expected table name")
+		}
+		stmt.TableName = tableTok.Literal
+	}
+	return stmt, nil
+}
@@ -0,0 +1,607 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Expression grammar, lowest precedence first:
+//
+//	expr      := and { OR and }
+//	and       := not { AND not }
+//	not       := NOT not | predicate
+//	predicate := EXISTS '(' select ')'
+//	           | concat [ cmpOp concat | [NOT] IN '(' select | exprList ')' | IS [NOT] NULL ]
+//	concat    := sum { '||' sum }
+//	sum       := product { ('+' | '-') product }
+//	product   := unary { ('*' | '/' | '%') unary }
+//	unary     := '-' unary | operand
+//	operand   := INT | STRING | PARAM | NULL | TRUE | FALSE | ident [ '.' ident ] | call | case
+//	           | '(' select ')' | '(' expr ')'
+//	case      := CASE [expr] WHEN expr THEN expr { WHEN expr THEN expr } [ELSE expr] END
+//	call      := ident '(' [ '*' | expr { ',' expr } ] ')' OVER '(' window ')'
+func (p *Parser) parseExpr() (executor.Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.eat()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &executor.BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (executor.Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.eat()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &executor.BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseNot() (executor.Expr, error) {
+	if p.isKeyword("NOT") {
+		p.eat()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &executor.UnaryExpr{Op: "NOT", Operand: operand}, nil
+	}
+	return p.parsePredicate()
+}
+
+var comparisonOps = map[string]struct{}{
+	"=": {}, "<>": {}, "!=": {}, "<": {}, "<=": {}, ">": {}, ">=": {},
+}
+
+func (p *Parser) parsePredicate() (executor.Expr, error) {
+	if p.isKeyword("EXISTS") {
+		p.eat()
+		sub, err := p.parseParenSelect()
+		if err != nil {
+			return nil, err
+		}
+		return &executor.ExistsExpr{Subquery: sub}, nil
+	}
+
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+
+	cur := p.cur()
+	if _, ok := comparisonOps[cur.Literal]; ok && cur.Type == SYMBOL {
+		p.eat()
+		right, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		return &executor.BinaryExpr{Op: cur.Literal, Left: left, Right: right}, nil
+	}
+
+	if p.isKeyword("IS") {
+		p.eat()
+		not := false
+		if p.isKeyword("NOT") {
+			p.eat()
+			not = true
+		}
+		if err := p.expect(KEYWORD, "NULL"); err != nil {
+			return nil, err
+		}
+		return &executor.IsNullExpr{Operand: left, Not: not}, nil
+	}
+
+	not := false
+	if p.isKeyword("NOT") && p.peekKeyword(1, "IN") {
+		p.eat()
+		not = true
+	}
+	if p.isKeyword("IN") {
+		p.eat()
+		return p.parseInTail(left, not)
+	}
+	return left, nil
+}
+
+func (p *Parser) parseInTail(left executor.Expr, not bool) (executor.Expr, error) {
+	if p.peekQuery(1) {
+		sub, err := p.parseParenSelect()
+		if err != nil {
+			return nil, err
+		}
+		return &executor.InExpr{Left: left, Subquery: sub, Not: not}, nil
+	}
+
+	if err := p.expect(SYMBOL, "("); err != nil {
+		return nil, err
+	}
+	list := []executor.Expr{}
+	for {
+		item, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+		if p.isSymbol(",") {
+			p.eat()
+			continue
+		}
+		break
+	}
+	if err := p.expect(SYMBOL, ")"); err != nil {
+		return nil, err
+	}
+	return &executor.InExpr{Left: left, List: list, Not: not}, nil
+}
+
+func (p *Parser) parseConcat() (executor.Expr, error) {
+	return p.parseBinaryLevel(p.parseSum, "||")
+}
+
+func (p *Parser) parseSum() (executor.Expr, error) {
+	return p.parseBinaryLevel(p.parseProduct, "+", "-")
+}
+
+func (p *Parser) parseProduct() (executor.Expr, error) {
+	return p.parseBinaryLevel(p.parseUnary, "*", "/", "%")
+}
+
+// parseBinaryLevel parses a left associative chain of the given operators.
+func (p *Parser) parseBinaryLevel(next func() (executor.Expr, error), ops ...string) (executor.Expr, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		cur := p.cur()
+		if cur.Type != SYMBOL || !slices.Contains(ops, cur.Literal) {
+			return left, nil
+		}
+		p.eat()
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &executor.BinaryExpr{Op: cur.Literal, Left: left, Right: right}
+	}
+}
+
+func (p *Parser) parseUnary() (executor.Expr, error) {
+	if !p.isSymbol("-") {
+		return p.parseOperand()
+	}
+	p.eat()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	// fold negative number literals
+	if lit, ok := operand.(*executor.Literal); ok {
+		if v, ok := lit.Value.(int); ok {
+			return &executor.Literal{Value: -v}, nil
+		}
+	}
+	return &executor.UnaryExpr{Op: "-", Operand: operand}, nil
+}
+
+func (p *Parser) parseOperand() (executor.Expr, error) {
+	tok := p.cur()
+	switch {
+	case tok.Type == INT:
+		p.eat()
+		v, err := strconv.Atoi(tok.Literal)
+		if err != nil {
+			return nil, fmt.Errorf("can't convert value to number: %s", tok.Literal)
+		}
+		return &executor.Literal{Value: v}, nil
+
+	case tok.Type == STRING:
+		p.eat()
+		return &executor.Literal{Value: tok.Literal}, nil
+
+	case tok.Type == PARAM:
+		p.eat()
+		return p.param(tok)
+
+	case tok.Type == KEYWORD && strings.ToUpper(tok.Literal) == "NULL":
+		p.eat()
+		return &executor.Literal{Value: nil}, nil
+
+	case tok.Type == KEYWORD && (strings.ToUpper(tok.Literal) == "TRUE" || strings.ToUpper(tok.Literal) == "FALSE"):
+		p.eat()
+		return &executor.Literal{Value: strings.ToUpper(tok.Literal) == "TRUE"}, nil
+
+	case tok.Type == KEYWORD && strings.ToUpper(tok.Literal) == "CASE":
+		return p.parseCase()
+
+	case tok.Type == IDENT && p.peekSymbol(1, "("):
+		return p.parseCall()
+
+	case tok.Type == IDENT:
+		p.eat()
+		if p.isSymbol(".") {
+			p.eat()
+			colTok := p.eat()
+			if colTok.Type != IDENT {
+				return nil, fmt.Errorf("expected column name after '%s.', got %s '%s'", tok.Literal, colTok.Type, colTok.Literal)
+			}
+			return &executor.ColumnRef{Table: tok.Literal, Name: colTok.Literal}, nil
+		}
+		return &executor.ColumnRef{Name: tok.Literal}, nil
+
+	case tok.Type == SYMBOL && tok.Literal == "(":
+		if p.peekQuery(1) {
+			sub, err := p.parseParenSelect()
+			if err != nil {
+				return nil, err
+			}
+			return &executor.SubqueryExpr{Subquery: sub}, nil
+		}
+		p.eat()
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(SYMBOL, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected token in expression: %s '%s'", tok.Type, tok.Literal)
+	}
+}
+
+// param numbers a placeholder: $n explicitly, ? in order of appearance.
+func (p *Parser) param(tok Token) (executor.Expr, error) {
+	if tok.Literal == "?" {
+		if p.dollarParams {
+			return nil, fmt.Errorf("cannot mix ? and $n placeholders")
+		}
+		p.questionMarks++
+		return &executor.Param{Index: p.questionMarks}, nil
+	}
+	if p.questionMarks > 0 {
+		return nil, fmt.Errorf("cannot mix ? and $n placeholders")
+	}
+	n, err := strconv.Atoi(tok.Literal[1:])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("there is no parameter %s", tok.Literal)
+	}
+	p.dollarParams = true
+	return &executor.Param{Index: n}, nil
+}
+
+func (p *Parser) parseCase() (executor.Expr, error) {
+	if err := p.expect(KEYWORD, "CASE"); err != nil {
+		return nil, err
+	}
+	c := &executor.CaseExpr{}
+	if !p.isKeyword("WHEN") {
+		operand, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.Operand = operand
+	}
+	for p.isKeyword("WHEN") {
+		p.eat()
+		cond, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(KEYWORD, "THEN"); err != nil {
+			return nil, err
+		}
+		result, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.Whens = append(c.Whens, executor.WhenClause{Cond: cond, Result: result})
+	}
+	if len(c.Whens) == 0 {
+		return nil, fmt.Errorf("CASE requires at least one WHEN clause")
+	}
+	if p.isKeyword("ELSE") {
+		p.eat()
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.Else = e
+	}
+	if err := p.expect(KEYWORD, "END"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// peekQuery reports whether a query starts n tokens ahead.
+func (p *Parser) peekQuery(n int) bool {
+	return p.peekKeyword(n, "SELECT") || p.peekKeyword(n, "WITH")
+}
+
+// parseParenSelect parses "( query )".
+func (p *Parser) parseParenSelect() (executor.Query, error) {
+	if err := p.expect(SYMBOL, "("); err != nil {
+		return nil, err
+	}
+	sub, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(SYMBOL, ")"); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// parseCall parses a function call: a scalar function, a window function
+// with its OVER clause, or one of the special forms CAST and EXTRACT.
+func (p *Parser) parseCall() (executor.Expr, error) {
+	nameTok := p.eat()
+	name := strings.ToUpper(nameTok.Literal)
+	if err := p.expect(SYMBOL, "("); err != nil {
+		return nil, err
+	}
+	switch name {
+	case "CAST":
+		return p.parseCastTail()
+	case "EXTRACT":
+		return p.parseExtractTail()
+	}
+
+	var args []executor.Expr
+	star := false
+	if p.isSymbol("*") {
+		p.eat()
+		star = true
+	} else if !p.isSymbol(")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.isSymbol(",") {
+				p.eat()
+				continue
+			}
+			break
+		}
+	}
+	if err := p.expect(SYMBOL, ")"); err != nil {
+		return nil, err
+	}
+
+	if p.isKeyword("OVER") {
+		p.eat()
+		spec, err := p.parseWindowSpec()
+		if err != nil {
+			return nil, err
+		}
+		w := &executor.WindowFunc{Name: name, Args: args, Star: star, Window: spec}
+		if err := executor.CheckWindowFunc(w); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+	if executor.IsWindowFunction(name) {
+		return nil, fmt.Errorf("window function %s requires an OVER clause", nameTok.Literal)
+	}
+	if star {
+		return nil, fmt.Errorf("%s(*) is not supported", nameTok.Literal)
+	}
+	f := &executor.FuncCall{Name: name, Args: args}
+	if err := executor.CheckFuncCall(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseCastTail parses "expr AS type )" after "CAST(".
+func (p *Parser) parseCastTail() (executor.Expr, error) {
+	operand, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(KEYWORD, "AS"); err != nil {
+		return nil, err
+	}
+	typ, err := p.parseColumnType()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(SYMBOL, ")"); err != nil {
+		return nil, err
+	}
+	return &executor.CastExpr{Operand: operand, Type: typ}, nil
+}
+
+// parseExtractTail parses "field FROM expr )" after "EXTRACT(", which is
+// shorthand for DATE_PART('field', expr).
+func (p *Parser) parseExtractTail() (executor.Expr, error) {
+	fieldTok := p.eat()
+	if fieldTok.Type != IDENT || !executor.IsDateField(fieldTok.Literal) {
+		return nil, fmt.Errorf("unsupported date field %s", fieldTok.Literal)
+	}
+	if err := p.expect(KEYWORD, "FROM"); err != nil {
+		return nil, err
+	}
+	source, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(SYMBOL, ")"); err != nil {
+		return nil, err
+	}
+	field := &executor.Literal{Value: strings.ToLower(fieldTok.Literal)}
+	return &executor.FuncCall{Name: "DATE_PART", Args: []executor.Expr{field, source}}, nil
+}
+
+// parseWindowSpec parses "( [PARTITION BY exprs] [ORDER BY items] [frame] )".
+func (p *Parser) parseWindowSpec() (*executor.WindowSpec, error) {
+	if err := p.expect(SYMBOL, "("); err != nil {
+		return nil, err
+	}
+	spec := &executor.WindowSpec{}
+
+	if p.isKeyword("PARTITION") {
+		p.eat()
+		if err := p.expect(KEYWORD, "BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			spec.PartitionBy = append(spec.PartitionBy, e)
+			if p.isSymbol(",") {
+				p.eat()
+				continue
+			}
+			break
+		}
+	}
+
+	if p.isKeyword("ORDER") {
+		items, err := p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+		spec.OrderBy = items
+	}
+
+	if p.isKeyword("ROWS") || p.isKeyword("RANGE") {
+		frame, err := p.parseFrame()
+		if err != nil {
+			return nil, err
+		}
+		spec.Frame = frame
+	}
+
+	if err := p.expect(SYMBOL, ")"); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// parseOrderBy parses "ORDER BY expr [ASC|DESC], ...".
+func (p *Parser) parseOrderBy() ([]executor.OrderItem, error) {
+	if err := p.expect(KEYWORD, "ORDER"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(KEYWORD, "BY"); err != nil {
+		return nil, err
+	}
+	var items []executor.OrderItem
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := executor.OrderItem{Expr: e}
+		if p.isKeyword("DESC") {
+			p.eat()
+			item.Desc = true
+		} else if p.isKeyword("ASC") {
+			p.eat()
+		}
+		items = append(items, item)
+		if p.isSymbol(",") {
+			p.eat()
+			continue
+		}
+		return items, nil
+	}
+}
+
+// parseFrame parses "ROWS|RANGE bound" or "ROWS|RANGE BETWEEN bound AND bound".
+func (p *Parser) parseFrame() (*executor.Frame, error) {
+	frame := &executor.Frame{Rows: p.isKeyword("ROWS")}
+	p.eat()
+
+	if !p.isKeyword("BETWEEN") {
+		start, err := p.parseFrameBound()
+		if err != nil {
+			return nil, err
+		}
+		frame.Start = start
+		frame.End = executor.FrameBound{Kind: executor.CurrentRow}
+		return frame, nil
+	}
+	p.eat()
+	start, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(KEYWORD, "AND"); err != nil {
+		return nil, err
+	}
+	end, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	if start.Kind > end.Kind || start.Kind == executor.UnboundedFollowing || end.Kind == executor.UnboundedPreceding {
+		return nil, fmt.Errorf("invalid frame: %s AND %s", start.String(), end.String())
+	}
+	frame.Start, frame.End = start, end
+	return frame, nil
+}
+
+func (p *Parser) parseFrameBound() (executor.FrameBound, error) {
+	switch {
+	case p.isKeyword("UNBOUNDED"):
+		p.eat()
+		if p.isKeyword("PRECEDING") {
+			p.eat()
+			return executor.FrameBound{Kind: executor.UnboundedPreceding}, nil
+		}
+		if err := p.expect(KEYWORD, "FOLLOWING"); err != nil {
+			return executor.FrameBound{}, err
+		}
+		return executor.FrameBound{Kind: executor.UnboundedFollowing}, nil
+
+	case p.isKeyword("CURRENT"):
+		p.eat()
+		if err := p.expect(KEYWORD, "ROW"); err != nil {
+			return executor.FrameBound{}, err
+		}
+		return executor.FrameBound{Kind: executor.CurrentRow}, nil
+
+	case p.cur().Type == INT:
+		n, err := strconv.Atoi(p.eat().Literal)
+		if err != nil {
+			return executor.FrameBound{}, err
+		}
+		if p.isKeyword("PRECEDING") {
+			p.eat()
+			return executor.FrameBound{Kind: executor.Preceding, Offset: n}, nil
+		}
+		if err := p.expect(KEYWORD, "FOLLOWING"); err != nil {
+			return executor.FrameBound{}, err
+		}
+		return executor.FrameBound{Kind: executor.Following, Offset: n}, nil
+	}
+	cur := p.cur()
+	return executor.FrameBound{}, fmt.Errorf("expected frame bound, got %s '%s'", cur.Type, cur.Literal)
+}
@@ -5,6 +5,12 @@ import (
 	"justasimpletoydb/internal/executor"
 )
 
+// ParseInsert parses
+//
+//	INSERT INTO table [ '(' col { ',' col } ')' ] VALUES row { ',' row } [on-conflict] [RETURNING list]
+//	INSERT INTO table [ '(' col { ',' col } ')' ] query [on-conflict] [RETURNING list]
+//
+// where a row is '(' value { ',' value } ')' and a value is an expression or DEFAULT.
 func (p *Parser) ParseInsert() (*executor.InsertStmt, error) {
 	if err := p.expect(KEYWORD, "INSERT"); err != nil {
 		return nil, err
@@ -17,43 +23,165 @@ func (p *Parser) ParseInsert() (*executor.InsertStmt, error) {
 	if tableTok.Type != IDENT {
 		return nil, fmt.Errorf("expected table name")
 	}
+	stmt := &executor.InsertStmt{Table: tableTok.Literal}
 
-	if err := p.expect(KEYWORD, "VALUES"); err != nil {
+	if p.isSymbol("(") && !p.peekQuery(1) {
+		p.eat()
+		for {
+			colTok := p.eat()
+			if colTok.Type != IDENT {
+				return nil, fmt.Errorf("expected column name, got %v", colTok)
+			}
+			stmt.Columns = append(stmt.Columns, colTok.Literal)
+			if p.isSymbol(",") {
+				p.eat()
+				continue
+			}
+			if err := p.expect(SYMBOL, ")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	// INSERT INTO t [(cols)] SELECT ...
+	if !p.isKeyword("VALUES") {
+		query, err := p.parseQuery()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Query = query
+	} else {
+		p.eat()
+		for {
+			row, err := p.parseValuesRow()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Rows = append(stmt.Rows, row)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.eat()
+		}
+	}
+
+	if p.isKeyword("ON") {
+		onConflict, err := p.parseOnConflict()
+		if err != nil {
+			return nil, err
+		}
+		stmt.OnConflict = onConflict
+	}
+
+	returning, err := p.parseReturning()
+	if err != nil {
 		return nil, err
 	}
+	stmt.Returning = returning
+
+	if cur := p.cur(); cur.Type == SYMBOL && cur.Literal == ";" {
+		p.eat()
+	}
+
+	return stmt, nil
+}
+
+// parseValuesRow parses one parenthesized VALUES list.
+func (p *Parser) parseValuesRow() ([]executor.Expr, error) {
 	if err := p.expect(SYMBOL, "("); err != nil {
 		return nil, err
 	}
-
-	vals := []any{}
+	var row []executor.Expr
 	for {
-		tok := p.eat()
-		switch tok.Type {
-		case INT:
-			// convert to int
-			var v int
-			fmt.Sscanf(tok.Literal, "%d", &v)
-			vals = append(vals, v)
-		case STRING:
-			vals = append(vals, tok.Literal)
-		default:
-			return nil, fmt.Errorf("unexpected token in VALUES: %v", tok)
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
 		}
+		row = append(row, v)
 
 		cur := p.cur()
 		if cur.Type == SYMBOL && cur.Literal == ")" {
 			p.eat()
-			break
+			return row, nil
 		} else if cur.Type == SYMBOL && cur.Literal == "," {
 			p.eat()
 		} else {
 			return nil, fmt.Errorf("unexpected token in VALUES list: %v", cur)
 		}
 	}
+}
 
-	if cur := p.cur(); cur.Type == SYMBOL && cur.Literal == ";" {
+// parseOnConflict parses
+//
+//	ON CONFLICT [ '(' col { ',' col } ')' ] DO NOTHING
+//	ON CONFLICT '(' col { ',' col } ')' DO UPDATE SET assignments [WHERE expr]
+func (p *Parser) parseOnConflict() (*executor.OnConflict, error) {
+	if err := p.expect(KEYWORD, "ON"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(KEYWORD, "CONFLICT"); err != nil {
+		return nil, err
+	}
+	oc := &executor.OnConflict{}
+	if p.isSymbol("(") {
+		p.eat()
+		for {
+			colTok := p.eat()
+			if colTok.Type != IDENT {
+				return nil, fmt.Errorf("expected column name, got %v", colTok)
+			}
+			oc.Columns = append(oc.Columns, colTok.Literal)
+			if p.isSymbol(",") {
+				p.eat()
+				continue
+			}
+			if err := p.expect(SYMBOL, ")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if err := p.expect(KEYWORD, "DO"); err != nil {
+		return nil, err
+	}
+	if p.isKeyword("NOTHING") {
 		p.eat()
+		oc.DoNothing = true
+		return oc, nil
 	}
+	if err := p.expect(KEYWORD, "UPDATE"); err != nil {
+		return nil, err
+	}
+	set, err := p.parseSetList()
+	if err != nil {
+		return nil, err
+	}
+	oc.Set = set
+	if p.isKeyword("WHERE") {
+		where, err := p.parseWhere()
+		if err != nil {
+			return nil, err
+		}
+		oc.Where = where
+	}
+	return oc, nil
+}
 
-	return &executor.InsertStmt{Table: tableTok.Literal, Values: vals}, nil
+// parseReturning parses an optional "RETURNING select-list".
+func (p *Parser) parseReturning() ([]executor.SelectItem, error) {
+	if !p.isKeyword("RETURNING") {
+		return nil, nil
+	}
+	p.eat()
+	return p.parseSelectList()
+}
+
+// parseValue parses a value to store in a column: an expression or DEFAULT.
+func (p *Parser) parseValue() (executor.Expr, error) {
+	if p.isKeyword("DEFAULT") {
+		p.eat()
+		return &executor.DefaultValue{}, nil
+	}
+	return p.parseExpr()
 }
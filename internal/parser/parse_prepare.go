@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+	"strings"
+)
+
+// ParsePrepare parses "PREPARE name [(type, ...)] AS statement". Like the
+// transaction statements, PREPARE, EXECUTE and DEALLOCATE are not keywords.
+func (p *Parser) ParsePrepare() (*executor.PrepareStmt, error) {
+	p.eat()
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected prepared statement name")
+	}
+	stmt := &executor.PrepareStmt{Name: nameTok.Literal}
+	if p.isSymbol("(") {
+		p.eat()
+		for {
+			typ, err := p.parseColumnType()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Types = append(stmt.Types, typ)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.eat()
+		}
+		if err := p.expect(SYMBOL, ")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(KEYWORD, "AS"); err != nil {
+		return nil, err
+	}
+	body, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Stmt = body
+	return stmt, nil
+}
+
+// ParseExecute parses "EXECUTE name [(arg, ...)]".
+func (p *Parser) ParseExecute() (*executor.ExecuteStmt, error) {
+	p.eat()
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected prepared statement name")
+	}
+	stmt := &executor.ExecuteStmt{Name: nameTok.Literal}
+	if p.isSymbol("(") {
+		p.eat()
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Args = append(stmt.Args, arg)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.eat()
+		}
+		if err := p.expect(SYMBOL, ")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return stmt, nil
+}
+
+// ParseDeallocate parses "DEALLOCATE [PREPARE] name | ALL".
+func (p *Parser) ParseDeallocate() (*executor.DeallocateStmt, error) {
+	p.eat()
+	if p.isWord("PREPARE") {
+		p.eat()
+	}
+	stmt := &executor.DeallocateStmt{}
+	switch tok := p.eat(); {
+	case tok.Type == KEYWORD && strings.ToUpper(tok.Literal) == "ALL":
+		stmt.All = true
+	case tok.Type == IDENT:
+		stmt.Name = tok.Literal
+	default:
+		return nil, fmt.Errorf("expected prepared statement name")
+	}
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return stmt, nil
+}
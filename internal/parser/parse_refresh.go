@@ -0,0 +1,27 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+)
+
+// ParseRefresh parses "REFRESH MATERIALIZED VIEW name".
+func (p *Parser) ParseRefresh() (*executor.RefreshViewStmt, error) {
+	if err := p.expect(KEYWORD, "REFRESH"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(KEYWORD, "MATERIALIZED"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(KEYWORD, "VIEW"); err != nil {
+		return nil, err
+	}
+	nameTok := p.eat()
+	if nameTok.Type != IDENT {
+		return nil, fmt.Errorf("expected view name")
+	}
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return &executor.RefreshViewStmt{Name: nameTok.Literal}, nil
+}
@@ -3,63 +3,342 @@ package parser
 import (
 	"fmt"
 	"justasimpletoydb/internal/executor"
+	"justasimpletoydb/internal/lock"
+	"strings"
 )
 
-func (p *Parser) ParseSelect() (*executor.SelectStmt, error) {
-	if err := p.expect(KEYWORD, "SELECT"); err != nil {
+func (p *Parser) ParseSelect() (executor.Query, error) {
+	stmt, err := p.parseQuery()
+	if err != nil {
 		return nil, err
 	}
 
-	// Handle '*' or explicit column list
-	var columns []string
-	cur := p.cur()
+	// Optional semicolon
+	if cur := p.cur(); cur.Type == SYMBOL && cur.Literal == ";" {
+		p.eat()
+	}
+
+	return stmt, nil
+}
 
-	if cur.Type == SYMBOL && cur.Literal == "*" {
+// parseQuery parses a query without the trailing semicolon, so it can be
+// used for subqueries and CTE bodies as well:
+//
+//	query   := [WITH [RECURSIVE] ctes] setExpr
+//	setExpr := term { (UNION | EXCEPT) [ALL] term }
+//	term    := primary { INTERSECT [ALL] primary }
+//	primary := select | '(' query ')'
+func (p *Parser) parseQuery() (executor.Query, error) {
+	var with []*executor.CTE
+	recursive := false
+	if p.isKeyword("WITH") {
 		p.eat()
-		columns = []string{"*"}
-	} else if cur.Type == IDENT {
-		// parse list of identifiers separated by commas
-		for {
-			tok := p.eat()
-			if tok.Type != IDENT {
-				return nil, fmt.Errorf("expected column name, got %s '%s'", tok.Type, tok.Literal)
-			}
-			columns = append(columns, tok.Literal)
+		if p.isKeyword("RECURSIVE") {
+			p.eat()
+			recursive = true
+		}
+		var err error
+		with, err = p.parseCTEs()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			if p.cur().Type == SYMBOL && p.cur().Literal == "," {
-				p.eat() // consume comma
-				continue
-			}
-			break
+	q, err := p.parseSetExpr()
+	if err != nil {
+		return nil, err
+	}
+	if len(with) == 0 {
+		return q, nil
+	}
+
+	switch q := q.(type) {
+	case *executor.SelectStmt:
+		if len(q.With) > 0 {
+			return nil, fmt.Errorf("nested WITH clauses are not supported")
 		}
-	} else {
-		return nil, fmt.Errorf("expected '*' or column name, got %s '%s'", cur.Type, cur.Literal)
+		q.With, q.WithRecursive = with, recursive
+	case *executor.SetOpStmt:
+		if len(q.With) > 0 {
+			return nil, fmt.Errorf("nested WITH clauses are not supported")
+		}
+		q.With, q.WithRecursive = with, recursive
 	}
+	return q, nil
+}
 
-	// Expect FROM
-	if err := p.expect(KEYWORD, "FROM"); err != nil {
+func (p *Parser) parseSetExpr() (executor.Query, error) {
+	left, err := p.parseSetTerm()
+	if err != nil {
 		return nil, err
 	}
+	for p.isKeyword("UNION") || p.isKeyword("EXCEPT") {
+		op, all := p.parseSetOp()
+		right, err := p.parseSetTerm()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSetOpLocking(left, right); err != nil {
+			return nil, err
+		}
+		left = &executor.SetOpStmt{Op: op, All: all, Left: left, Right: right}
+	}
+	return left, nil
+}
 
-	// Expect table name
-	tableTok := p.eat()
-	if tableTok.Type != IDENT {
-		return nil, fmt.Errorf("expected table name, got %s '%s'", tableTok.Type, tableTok.Literal)
+func (p *Parser) parseSetTerm() (executor.Query, error) {
+	left, err := p.parseSetPrimary()
+	if err != nil {
+		return nil, err
 	}
+	for p.isKeyword("INTERSECT") {
+		op, all := p.parseSetOp()
+		right, err := p.parseSetPrimary()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSetOpLocking(left, right); err != nil {
+			return nil, err
+		}
+		left = &executor.SetOpStmt{Op: op, All: all, Left: left, Right: right}
+	}
+	return left, nil
+}
 
-	// Optional semicolon
-	if cur := p.cur(); cur.Type == SYMBOL && cur.Literal == ";" {
+// checkSetOpLocking rejects FOR UPDATE on the operands of a set operation,
+// whose rows are no longer rows of a table.
+func checkSetOpLocking(operands ...executor.Query) error {
+	for _, q := range operands {
+		if sel, ok := q.(*executor.SelectStmt); ok && sel.Locking != nil {
+			return fmt.Errorf("FOR UPDATE is not allowed with UNION/INTERSECT/EXCEPT")
+		}
+	}
+	return nil
+}
+
+func (p *Parser) parseSetOp() (string, bool) {
+	op := strings.ToUpper(p.eat().Literal)
+	if p.isKeyword("ALL") {
+		p.eat()
+		return op, true
+	}
+	return op, false
+}
+
+func (p *Parser) parseSetPrimary() (executor.Query, error) {
+	if p.isSymbol("(") && p.peekQuery(1) {
+		return p.parseParenSelect()
+	}
+	return p.parseSelectCore()
+}
+
+// parseSelectCore parses a single SELECT block.
+func (p *Parser) parseSelectCore() (*executor.SelectStmt, error) {
+	if err := p.expect(KEYWORD, "SELECT"); err != nil {
+		return nil, err
+	}
+
+	distinct := false
+	if p.isKeyword("DISTINCT") {
+		p.eat()
+		distinct = true
+	} else if p.isKeyword("ALL") {
 		p.eat()
 	}
 
+	items, err := p.parseSelectList()
+	if err != nil {
+		return nil, err
+	}
+
+	// FROM is optional, e.g. SELECT (SELECT ...)
+	var from *executor.TableRef
+	if p.isKeyword("FROM") {
+		p.eat()
+		from, err = p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		if from.Joins, err = p.parseJoins(); err != nil {
+			return nil, err
+		}
+	}
+
 	cond, err := p.parseWhere()
 	if err != nil {
 		return nil, err
 	}
 
+	locking, err := p.parseLocking()
+	if err != nil {
+		return nil, err
+	}
+
 	return &executor.SelectStmt{
-		Table:   tableTok.Literal,
-		Columns: columns,
-		Where:   cond,
+		Distinct: distinct,
+		Items:    items,
+		From:     from,
+		Where:    cond,
+		Locking:  locking,
 	}, nil
 }
+
+// parseLocking parses an optional "FOR UPDATE [NOWAIT | SKIP LOCKED]".
+func (p *Parser) parseLocking() (*executor.Locking, error) {
+	if !p.isKeyword("FOR") {
+		return nil, nil
+	}
+	p.eat()
+	if err := p.expect(KEYWORD, "UPDATE"); err != nil {
+		return nil, err
+	}
+	locking := &executor.Locking{Wait: lock.Block}
+	switch {
+	case p.isWord("NOWAIT"):
+		p.eat()
+		locking.Wait = lock.NoWait
+	case p.isWord("SKIP"):
+		p.eat()
+		if !p.isWord("LOCKED") {
+			return nil, fmt.Errorf("expected LOCKED after SKIP, got %s '%s'", p.cur().Type, p.cur().Literal)
+		}
+		p.eat()
+		locking.Wait = lock.SkipLocked
+	}
+	return locking, nil
+}
+
+// parseCTEs parses "name [(col, ...)] AS (query), ...".
+func (p *Parser) parseCTEs() ([]*executor.CTE, error) {
+	var ctes []*executor.CTE
+	for {
+		nameTok := p.eat()
+		if nameTok.Type != IDENT {
+			return nil, fmt.Errorf("expected WITH query name, got %s '%s'", nameTok.Type, nameTok.Literal)
+		}
+		cte := &executor.CTE{Name: nameTok.Literal}
+
+		if p.isSymbol("(") {
+			p.eat()
+			for {
+				colTok := p.eat()
+				if colTok.Type != IDENT {
+					return nil, fmt.Errorf("expected column name, got %s '%s'", colTok.Type, colTok.Literal)
+				}
+				cte.Columns = append(cte.Columns, colTok.Literal)
+				if p.isSymbol(",") {
+					p.eat()
+					continue
+				}
+				break
+			}
+			if err := p.expect(SYMBOL, ")"); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := p.expect(KEYWORD, "AS"); err != nil {
+			return nil, err
+		}
+		query, err := p.parseParenSelect()
+		if err != nil {
+			return nil, err
+		}
+		cte.Query = query
+
+		ctes = append(ctes, cte)
+		if p.isSymbol(",") {
+			p.eat()
+			continue
+		}
+		return ctes, nil
+	}
+}
+
+// parseSelectList parses '*' or a comma separated list of expressions,
+// each with an optional alias.
+func (p *Parser) parseSelectList() ([]executor.SelectItem, error) {
+	var items []executor.SelectItem
+	for {
+		cur := p.cur()
+		switch {
+		case cur.Type == SYMBOL && cur.Literal == "*":
+			p.eat()
+			items = append(items, executor.SelectItem{Star: true})
+
+		case cur.Type == IDENT && p.peekSymbol(1, ".") && p.peekSymbol(2, "*"):
+			p.pos += 3
+			items = append(items, executor.SelectItem{Star: true, StarTable: cur.Literal})
+
+		default:
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			alias, err := p.parseAlias()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, executor.SelectItem{Expr: expr, Alias: alias})
+		}
+
+		if p.isSymbol(",") {
+			p.eat() // consume comma
+			continue
+		}
+		return items, nil
+	}
+}
+
+// parseTableRef parses "name [[AS] alias]".
+func (p *Parser) parseTableRef() (*executor.TableRef, error) {
+	tableTok := p.eat()
+	if tableTok.Type != IDENT {
+		return nil, fmt.Errorf("expected table name, got %s '%s'", tableTok.Type, tableTok.Literal)
+	}
+	alias, err := p.parseAlias()
+	if err != nil {
+		return nil, err
+	}
+	return &executor.TableRef{Name: tableTok.Literal, Alias: alias}, nil
+}
+
+// parseJoins parses any number of "[INNER] JOIN table [[AS] alias] ON condition".
+func (p *Parser) parseJoins() ([]*executor.Join, error) {
+	var joins []*executor.Join
+	for p.isKeyword("JOIN") || (p.isKeyword("INNER") && p.peekKeyword(1, "JOIN")) {
+		if p.isKeyword("INNER") {
+			p.eat()
+		}
+		p.eat()
+		ref, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(KEYWORD, "ON"); err != nil {
+			return nil, err
+		}
+		on, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		joins = append(joins, &executor.Join{Table: ref, On: on})
+	}
+	return joins, nil
+}
+
+// parseAlias parses an optional "[AS] name".
+func (p *Parser) parseAlias() (string, error) {
+	if p.isKeyword("AS") {
+		p.eat()
+		tok := p.eat()
+		if tok.Type != IDENT && tok.Type != STRING {
+			return "", fmt.Errorf("expected alias after AS, got %s '%s'", tok.Type, tok.Literal)
+		}
+		return tok.Literal, nil
+	}
+	if p.cur().Type == IDENT {
+		return p.eat().Literal, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,21 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+)
+
+// ParseShow parses "SHOW LOCK STATS".
+func (p *Parser) ParseShow() (*executor.ShowLockStatsStmt, error) {
+	p.eat()
+	for _, word := range []string{"LOCK", "STATS"} {
+		if !p.isWord(word) {
+			return nil, fmt.Errorf("expected SHOW LOCK STATS, got %s '%s'", p.cur().Type, p.cur().Literal)
+		}
+		p.eat()
+	}
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return &executor.ShowLockStatsStmt{}, nil
+}
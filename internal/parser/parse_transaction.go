@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+	"strings"
+)
+
+// ParseTransaction parses the statements controlling a transaction block:
+// "BEGIN [WORK | TRANSACTION]", "START TRANSACTION", "COMMIT | END [WORK |
+// TRANSACTION]" and "ROLLBACK | ABORT [WORK | TRANSACTION]". The words are
+// not keywords, so they stay usable as names.
+func (p *Parser) ParseTransaction() (executor.Statement, error) {
+	var stmt executor.Statement
+	switch first := strings.ToUpper(p.eat().Literal); first {
+	case "BEGIN":
+		stmt = &executor.BeginStmt{}
+	case "START":
+		if !p.isWord("TRANSACTION") {
+			return nil, fmt.Errorf("expected TRANSACTION after START")
+		}
+		stmt = &executor.BeginStmt{}
+	case "COMMIT", "END":
+		stmt = &executor.CommitStmt{}
+	case "ROLLBACK", "ABORT":
+		stmt = &executor.RollbackStmt{}
+	default:
+		return nil, fmt.Errorf("unsupported statement: %s", first)
+	}
+	if p.isWord("WORK") || p.isWord("TRANSACTION") {
+		p.eat()
+	}
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return stmt, nil
+}
+
+// isWord reports whether the current token is the given word, whether or
+// not it is a keyword.
+func (p *Parser) isWord(lit string) bool {
+	cur := p.cur()
+	return (cur.Type == IDENT || cur.Type == KEYWORD) && strings.ToUpper(cur.Literal) == lit
+}
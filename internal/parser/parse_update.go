@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"fmt"
+	"justasimpletoydb/internal/executor"
+)
+
+// ParseUpdate parses
+//
+//	UPDATE table SET col '=' value { ',' col '=' value } [WHERE expr] [RETURNING list]
+//
+// where a value is an expression or DEFAULT.
+func (p *Parser) ParseUpdate() (*executor.UpdateStmt, error) {
+	if err := p.expect(KEYWORD, "UPDATE"); err != nil {
+		return nil, err
+	}
+	tableTok := p.eat()
+	if tableTok.Type != IDENT {
+		return nil, fmt.Errorf("expected table name")
+	}
+	stmt := &executor.UpdateStmt{Table: tableTok.Literal}
+
+	set, err := p.parseSetList()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Set = set
+
+	if p.isKeyword("WHERE") {
+		where, err := p.parseWhere()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = where
+	}
+
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Returning = returning
+
+	if p.isSymbol(";") {
+		p.eat()
+	}
+	return stmt, nil
+}
+
+// parseSetList parses "SET col '=' value { ',' col '=' value }".
+func (p *Parser) parseSetList() ([]executor.Assignment, error) {
+	if err := p.expect(KEYWORD, "SET"); err != nil {
+		return nil, err
+	}
+	var set []executor.Assignment
+	for {
+		colTok := p.eat()
+		if colTok.Type != IDENT {
+			return nil, fmt.Errorf("expected column name, got %v", colTok)
+		}
+		if err := p.expect(SYMBOL, "="); err != nil {
+			return nil, err
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, executor.Assignment{Column: colTok.Literal, Value: v})
+		if !p.isSymbol(",") {
+			return set, nil
+		}
+		p.eat()
+	}
+}
@@ -3,26 +3,82 @@ package parser
 import (
 	"fmt"
 	"justasimpletoydb/internal/executor"
-	"strconv"
 	"strings"
 )
 
 type Parser struct {
 	tokens []Token
 	pos    int
+
+	// placeholders of the current statement: ? ones are numbered in order
+	// and can't be mixed with numbered $n ones
+	questionMarks int
+	dollarParams  bool
 }
 
 func NewParser(tokens []Token) *Parser {
 	return &Parser{tokens: tokens, pos: 0}
 }
 
+// SyntaxError is an error in SQL text, found at or near byte offset Pos.
+type SyntaxError struct {
+	Pos int
+	Err error
+}
+
+func (e *SyntaxError) Error() string { return e.Err.Error() }
+
+func (e *SyntaxError) Unwrap() error { return e.Err }
+
+// syntaxError places an error at the current token.
+func (p *Parser) syntaxError(err error) error {
+	return &SyntaxError{Pos: p.cur().Pos, Err: err}
+}
+
 func Parse(sql string) (executor.Statement, error) {
 	tokens, err := Tokenize(sql)
 	if err != nil {
 		return nil, err
 	}
+	p := NewParser(tokens)
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, p.syntaxError(err)
+	}
+	return stmt, nil
+}
 
+// ParseAll parses a string of statements separated by semicolons, such as
+// a simple query of the wire protocol. Empty statements are skipped, so an
+// empty string gives none.
+func ParseAll(sql string) ([]executor.Statement, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
 	p := NewParser(tokens)
+	var stmts []executor.Statement
+	for {
+		for p.isSymbol(";") {
+			p.eat()
+		}
+		if p.cur().Type == EOF {
+			return stmts, nil
+		}
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, p.syntaxError(err)
+		}
+		stmts = append(stmts, stmt)
+		// statements eat their own semicolon
+		if cur := p.cur(); cur.Type != EOF && !(p.pos > 0 && p.tokens[p.pos-1].Type == SYMBOL && p.tokens[p.pos-1].Literal == ";") {
+			return nil, p.syntaxError(fmt.Errorf("unexpected token after statement: %s '%s'", cur.Type, cur.Literal))
+		}
+	}
+}
+
+func (p *Parser) parseStatement() (executor.Statement, error) {
+	p.questionMarks, p.dollarParams = 0, false
 	first := strings.ToUpper(p.cur().Literal)
 
 	switch first {
@@ -30,16 +86,80 @@ func Parse(sql string) (executor.Statement, error) {
 		return p.ParseCreate()
 	case "INSERT":
 		return p.ParseInsert()
-	case "SELECT":
+	case "UPDATE":
+		return p.ParseUpdate()
+	case "DELETE":
+		return p.ParseDelete()
+	case "DROP":
+		return p.ParseDrop()
+	case "ALTER":
+		return p.ParseAlter()
+	case "REFRESH":
+		return p.ParseRefresh()
+	case "BEGIN", "START", "COMMIT", "END", "ROLLBACK", "ABORT":
+		return p.ParseTransaction()
+	case "PREPARE":
+		return p.ParsePrepare()
+	case "EXECUTE":
+		return p.ParseExecute()
+	case "DEALLOCATE":
+		return p.ParseDeallocate()
+	case "SHOW":
+		return p.ParseShow()
+	case "SELECT", "WITH", "(":
 		return p.ParseSelect()
 	default:
 		return nil, fmt.Errorf("unsupported statement: %s", first)
 	}
 }
 
+func init() {
+	executor.ParseExpr = ParseExpression
+	executor.ParseQuery = ParseQuery
+}
+
+// ParseQuery parses a single query, such as the stored text of a view.
+func ParseQuery(sql string) (executor.Query, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := NewParser(tokens)
+	q, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if cur := p.cur(); cur.Type != EOF {
+		return nil, fmt.Errorf("unexpected token after query: %s '%s'", cur.Type, cur.Literal)
+	}
+	return q, nil
+}
+
+// ParseExpression parses a single expression, such as the stored text of a
+// DEFAULT or CHECK.
+func ParseExpression(sql string) (executor.Expr, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := NewParser(tokens)
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if cur := p.cur(); cur.Type != EOF {
+		return nil, fmt.Errorf("unexpected token after expression: %s '%s'", cur.Type, cur.Literal)
+	}
+	return e, nil
+}
+
 func (p *Parser) cur() Token {
 	if p.pos >= len(p.tokens) {
-		return Token{Type: EOF}
+		end := Token{Type: EOF}
+		if n := len(p.tokens); n > 0 {
+			end.Pos = p.tokens[n-1].Pos
+		}
+		return end
 	}
 	return p.tokens[p.pos]
 }
@@ -59,40 +179,35 @@ func (p *Parser) expect(t TokenType, lit string) error {
 	return nil
 }
 
-func (p *Parser) parseWhere() (*executor.Condition, error) {
-	if err := p.expect(KEYWORD, "WHERE"); err != nil {
-		return nil, nil
-	}
+func (p *Parser) isKeyword(lit string) bool {
+	return p.peekKeyword(0, lit)
+}
 
-	colTok := p.eat()
-	if colTok.Type != IDENT {
-		return nil, fmt.Errorf("expected column name in WHERE")
-	}
+func (p *Parser) isSymbol(lit string) bool {
+	return p.peekSymbol(0, lit)
+}
 
-	opTok := p.eat()
-	if opTok.Type != SYMBOL || opTok.Literal != "=" {
-		return nil, fmt.Errorf("only '=' operator supported for now")
+// peekKeyword reports whether the token n positions ahead is the given keyword.
+func (p *Parser) peekKeyword(n int, lit string) bool {
+	if p.pos+n >= len(p.tokens) {
+		return false
 	}
+	t := p.tokens[p.pos+n]
+	return t.Type == KEYWORD && strings.ToUpper(t.Literal) == lit
+}
 
-	valTok := p.eat()
-	if valTok.Type != INT && valTok.Type != STRING {
-		return nil, fmt.Errorf("expected literal value in WHERE")
+// peekSymbol reports whether the token n positions ahead is the given symbol.
+func (p *Parser) peekSymbol(n int, lit string) bool {
+	if p.pos+n >= len(p.tokens) {
+		return false
 	}
+	t := p.tokens[p.pos+n]
+	return t.Type == SYMBOL && t.Literal == lit
+}
 
-	var val any
-	if valTok.Type == INT {
-		int, err := strconv.ParseInt(valTok.Literal, 6, 12)
-		if err != nil {
-			return nil, fmt.Errorf("can't convert value to number")
-		}
-		val = int
-	} else {
-		val = valTok.Literal
+func (p *Parser) parseWhere() (executor.Expr, error) {
+	if err := p.expect(KEYWORD, "WHERE"); err != nil {
+		return nil, nil
 	}
-
-	return &executor.Condition{
-		Column:   colTok.Literal,
-		Operator: "=",
-		Value:    val,
-	}, nil
+	return p.parseExpr()
 }
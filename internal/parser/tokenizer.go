@@ -16,6 +16,7 @@ const (
 	STRING  // string literals
 	KEYWORD // SQL keyword
 	SYMBOL  // punctuation like (, ), ; *
+	PARAM   // parameter placeholders $1, $2, ... or ?
 )
 
 func (t TokenType) String() string {
@@ -34,6 +35,8 @@ func (t TokenType) String() string {
 		return "KEYWORD"
 	case SYMBOL:
 		return "SYMBOL"
+	case PARAM:
+		return "PARAM"
 	default:
 		return fmt.Sprintf("UNKNOWN(%d)", int(t))
 	}
@@ -42,18 +45,35 @@ func (t TokenType) String() string {
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     int // byte offset of the token in the input
 }
 
 var keywords = map[string]struct{}{
 	"CREATE": {}, "TABLE": {}, "INSERT": {}, "INTO": {}, "VALUES": {},
 	"SELECT": {}, "FROM": {}, "INT": {}, "TEXT": {}, "WHERE": {}, "INDEX": {}, "ON": {},
+	"AND": {}, "OR": {}, "NOT": {}, "IN": {}, "EXISTS": {}, "AS": {}, "NULL": {}, "IS": {},
+	"WITH": {}, "RECURSIVE": {}, "UNION": {}, "ALL": {}, "INTERSECT": {}, "EXCEPT": {}, "JOIN": {}, "INNER": {},
+	"OVER": {}, "PARTITION": {}, "ORDER": {}, "BY": {}, "ASC": {}, "DESC": {},
+	"ROWS": {}, "RANGE": {}, "BETWEEN": {}, "UNBOUNDED": {}, "PRECEDING": {},
+	"FOLLOWING": {}, "CURRENT": {}, "ROW": {},
+	"DISTINCT": {}, "CASE": {}, "WHEN": {}, "THEN": {}, "ELSE": {}, "END": {}, "TRUE": {}, "FALSE": {},
+	"DROP": {}, "IF": {}, "ALTER": {}, "ADD": {}, "COLUMN": {}, "RENAME": {}, "TO": {}, "DEFAULT": {},
+	"CHECK": {}, "CONSTRAINT": {}, "UPDATE": {}, "SET": {}, "FOR": {},
+	"SEQUENCE": {}, "SERIAL": {}, "AUTOINCREMENT": {}, "START": {}, "INCREMENT": {}, "RETURNING": {},
+	"DELETE": {}, "UNIQUE": {}, "CONFLICT": {}, "DO": {}, "NOTHING": {},
+	"REFERENCES": {}, "FOREIGN": {}, "KEY": {}, "CASCADE": {}, "RESTRICT": {}, "NO": {}, "ACTION": {},
+	"VIEW": {}, "MATERIALIZED": {}, "REFRESH": {},
 }
 
+// multi-character operators, checked before single-character symbols
+var operators = []string{"<=", ">=", "<>", "!=", "||"}
+
 func Tokenize(input string) ([]Token, error) {
 	tokens := []Token{}
 	i := 0
 	for i < len(input) {
 		ch := input[i]
+		pos := i
 
 		switch {
 		case unicode.IsSpace(rune(ch)):
@@ -69,14 +89,14 @@ func Tokenize(input string) ([]Token, error) {
 			if _, ok := keywords[strings.ToUpper(lit)]; ok {
 				tokType = KEYWORD
 			}
-			tokens = append(tokens, Token{Type: tokType, Literal: lit})
+			tokens = append(tokens, Token{Type: tokType, Literal: lit, Pos: pos})
 
 		case isDigit(ch):
 			start := i
 			for i < len(input) && isDigit(input[i]) {
 				i++
 			}
-			tokens = append(tokens, Token{Type: INT, Literal: input[start:i]})
+			tokens = append(tokens, Token{Type: INT, Literal: input[start:i], Pos: pos})
 
 		case ch == '\'':
 			i++
@@ -92,11 +112,11 @@ func Tokenize(input string) ([]Token, error) {
 				i++
 			}
 			if i >= len(input) {
-				return nil, fmt.Errorf("unterminated string literal")
+				return nil, &SyntaxError{Pos: pos, Err: fmt.Errorf("unterminated string literal")}
 			}
 			literal := input[start:i]
 			literal = strings.ReplaceAll(literal, "''", "'")
-			tokens = append(tokens, Token{Type: STRING, Literal: literal})
+			tokens = append(tokens, Token{Type: STRING, Literal: literal, Pos: pos})
 			i++
 
 		case ch == '"':
@@ -113,25 +133,54 @@ func Tokenize(input string) ([]Token, error) {
 				i++
 			}
 			if i >= len(input) {
-				return nil, fmt.Errorf("unterminated quoted identifier")
+				return nil, &SyntaxError{Pos: pos, Err: fmt.Errorf("unterminated quoted identifier")}
 			}
 			literal := input[start:i]
 			literal = strings.ReplaceAll(literal, `""`, `"`)
-			tokens = append(tokens, Token{Type: STRING, Literal: literal})
+			tokens = append(tokens, Token{Type: STRING, Literal: literal, Pos: pos})
+			i++
+
+		case ch == '$':
 			i++
+			start := i
+			for i < len(input) && isDigit(input[i]) {
+				i++
+			}
+			if i == start {
+				return nil, &SyntaxError{Pos: pos, Err: fmt.Errorf("illegal character: %c", ch)}
+			}
+			tokens = append(tokens, Token{Type: PARAM, Literal: input[pos:i], Pos: pos})
 
-		case strings.ContainsRune("(),;*=", rune(ch)):
-			tokens = append(tokens, Token{Type: SYMBOL, Literal: string(ch)})
+		case ch == '?':
+			tokens = append(tokens, Token{Type: PARAM, Literal: "?", Pos: pos})
+			i++
+
+		case matchOperator(input[i:]) != "":
+			op := matchOperator(input[i:])
+			tokens = append(tokens, Token{Type: SYMBOL, Literal: op, Pos: pos})
+			i += len(op)
+
+		case strings.ContainsRune("(),;*=.<>+-/%", rune(ch)):
+			tokens = append(tokens, Token{Type: SYMBOL, Literal: string(ch), Pos: pos})
 			i++
 
 		default:
-			return nil, fmt.Errorf("illegal character: %c", ch)
+			return nil, &SyntaxError{Pos: pos, Err: fmt.Errorf("illegal character: %c", ch)}
 		}
 	}
-	tokens = append(tokens, Token{Type: EOF, Literal: ""})
+	tokens = append(tokens, Token{Type: EOF, Literal: "", Pos: len(input)})
 	return tokens, nil
 }
 
+func matchOperator(input string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(input, op) {
+			return op
+		}
+	}
+	return ""
+}
+
 func isLetter(ch byte) bool {
 	return unicode.IsLetter(rune(ch))
 }
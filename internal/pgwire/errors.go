@@ -0,0 +1,88 @@
+package pgwire
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"justasimpletoydb/internal/sqlstate"
+)
+
+// SQLSTATE codes of errors of the protocol itself and of parameter values.
+const (
+	codeInvalidText     = "22P02"
+	codeUndefinedCursor = "34000"
+	codeDuplicateCursor = "42P03"
+)
+
+const (
+	severityError   = "ERROR"
+	severityFatal   = "FATAL"
+	severityWarning = "WARNING"
+)
+
+// pgError is an error with the SQLSTATE code to send it with.
+type pgError struct {
+	Code     string
+	Err      error
+	Fatal    bool // the connection can't go on and is closed
+	Position int  // 1-based character position in the query, 0 if none
+}
+
+func (e *pgError) Error() string { return e.Err.Error() }
+
+func (e *pgError) Unwrap() error { return e.Err }
+
+func errorf(code, format string, args ...any) error {
+	return &pgError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+func protocolErrorf(format string, args ...any) error {
+	return errorf(sqlstate.ProtocolViolation, format, args...)
+}
+
+// fatalErrorf returns an error of a client the server lost track of, such
+// as one sending a message it can't parse.
+func fatalErrorf(format string, args ...any) error {
+	return &pgError{Code: sqlstate.ProtocolViolation, Err: fmt.Errorf(format, args...), Fatal: true}
+}
+
+// queryError places an error in parsing sql at the character it was found.
+func queryError(sql string, err error) error {
+	pos := sqlstate.Position(err)
+	if pos < 0 || pos > len(sql) {
+		return err
+	}
+	return &pgError{Code: sqlstate.Of(err), Err: err, Position: utf8.RuneCountInString(sql[:pos]) + 1}
+}
+
+// errorMessage builds the ErrorResponse of an error.
+func errorMessage(err error) *message {
+	var pgErr *pgError
+	if !errors.As(err, &pgErr) {
+		pgErr = &pgError{Code: sqlstate.Of(err), Err: err}
+	}
+	severity := severityError
+	if pgErr.Fatal {
+		severity = severityFatal
+	}
+	m := newMessage(msgErrorResponse).
+		byte('S').string(severity).
+		byte('V').string(severity).
+		byte('C').string(pgErr.Code).
+		byte('M').string(err.Error())
+	if pgErr.Position > 0 {
+		m.byte('P').string(strconv.Itoa(pgErr.Position))
+	}
+	return m.byte(0)
+}
+
+func noticeMessage(text string) *message {
+	return newMessage(msgNoticeResponse).
+		byte('S').string(severityWarning).
+		byte('V').string(severityWarning).
+		byte('C').string(sqlstate.Warning).
+		byte('M').string(text).
+		byte(0)
+}
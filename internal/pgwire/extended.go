@@ -0,0 +1,257 @@
+package pgwire
+
+import (
+	"justasimpletoydb/internal/executor"
+	"justasimpletoydb/internal/parser"
+	"justasimpletoydb/internal/sqlstate"
+)
+
+// prepared is a statement prepared by a Parse message, typed against the
+// catalog. A nil stmt is an empty query.
+type prepared struct {
+	stmt executor.Statement
+	prep *executor.Prepared
+}
+
+// portal is a prepared statement bound by a Bind message, ready to run.
+// It runs on its first Execute; later ones send the rows left.
+type portal struct {
+	stmt    executor.Statement // bound to the parameter values
+	formats []int16            // result format of each column, set once described
+	codes   []int16            // result format codes of the Bind message
+	res     *executor.ExecResult
+	sent    int // rows of res sent so far
+}
+
+func parseStatements(sql string) ([]executor.Statement, error) {
+	stmts, err := parser.ParseAll(sql)
+	if err != nil {
+		return nil, queryError(sql, err)
+	}
+	return stmts, nil
+}
+
+// parse handles Parse: statement name, query, parameter type OIDs. The
+// parameter types are inferred from the query; the ones the client gives
+// are not used, it learns the inferred ones from Describe.
+func (c *conn) parse(body *reader) error {
+	name := body.string()
+	sql := body.string()
+	for n := body.int16(); n > 0; n-- {
+		body.int32()
+	}
+	stmts, err := parseStatements(sql)
+	if err != nil {
+		return err
+	}
+	if len(stmts) > 1 {
+		return errorf(sqlstate.SyntaxError, "cannot insert multiple commands into a prepared statement")
+	}
+	if _, ok := c.prepared[name]; ok && name != "" {
+		return &executor.PreparedError{Name: name, Exists: true}
+	}
+	p := &prepared{}
+	if len(stmts) == 1 {
+		prep, err := c.ex.Prepare(stmts[0])
+		if err != nil {
+			return err
+		}
+		p.stmt, p.prep = stmts[0], prep
+	}
+	c.prepared[name] = p
+	c.send(newMessage(msgParseComplete))
+	return nil
+}
+
+// bind handles Bind: portal and statement names, parameter formats and
+// values, result formats.
+func (c *conn) bind(body *reader) error {
+	name := body.string()
+	stmtName := body.string()
+	paramCodes := make([]int16, body.count())
+	for i := range paramCodes {
+		paramCodes[i] = body.int16()
+	}
+	values := make([][]byte, body.count())
+	for i := range values {
+		values[i] = body.value()
+	}
+	codes := make([]int16, body.count())
+	for i := range codes {
+		codes[i] = body.int16()
+	}
+	if body.err != nil {
+		return nil
+	}
+	p, ok := c.prepared[stmtName]
+	if !ok {
+		return &executor.PreparedError{Name: stmtName}
+	}
+	var types []string
+	if p.prep != nil {
+		types = p.prep.ParamTypes()
+	}
+	if len(values) != len(types) {
+		return protocolErrorf("bind message supplies %d parameters, but prepared statement requires %d", len(values), len(types))
+	}
+	formats, err := paramFormats(paramCodes, len(values))
+	if err != nil {
+		return err
+	}
+	args := make([]any, len(values))
+	for i, v := range values {
+		if args[i], err = decodeValue(v, types[i], formats[i]); err != nil {
+			return err
+		}
+	}
+	if _, ok := c.portals[name]; ok && name != "" {
+		return errorf(codeDuplicateCursor, "portal %q already exists", name)
+	}
+	pt := &portal{codes: codes}
+	if p.prep != nil {
+		if pt.stmt, err = p.prep.Bind(args); err != nil {
+			return err
+		}
+	}
+	c.portals[name] = pt
+	c.send(newMessage(msgBindComplete))
+	return nil
+}
+
+// describe handles Describe of a prepared statement ('S') or a portal
+// ('P').
+func (c *conn) describe(body *reader) error {
+	kind := body.byte()
+	name := body.string()
+	switch kind {
+	case 'S':
+		return c.describeStatement(name)
+	case 'P':
+		return c.describePortal(name)
+	default:
+		return protocolErrorf("invalid describe target %q", kind)
+	}
+}
+
+// describeStatement sends the parameter types of a prepared statement and
+// the columns it returns, as text since no formats are bound yet.
+func (c *conn) describeStatement(name string) error {
+	p, ok := c.prepared[name]
+	if !ok {
+		return &executor.PreparedError{Name: name}
+	}
+	if p.prep == nil {
+		c.send(newMessage(msgParameterDescription).int16(0))
+		c.send(newMessage(msgNoData))
+		return nil
+	}
+	types := p.prep.ParamTypes()
+	m := newMessage(msgParameterDescription).int16(len(types))
+	for _, typ := range types {
+		oid, _ := typeOID(typ)
+		m.int32(oid)
+	}
+	c.send(m)
+	desc, err := c.ex.DescribePrepared(p.prep)
+	if err != nil {
+		return err
+	}
+	if desc == nil {
+		c.send(newMessage(msgNoData))
+		return nil
+	}
+	c.send(rowDescription(desc, nil))
+	return nil
+}
+
+// describePortal sends the columns a portal returns in the formats it was
+// bound with.
+func (c *conn) describePortal(name string) error {
+	pt := c.portals[name]
+	if pt == nil {
+		return errorf(codeUndefinedCursor, "portal %q does not exist", name)
+	}
+	if pt.stmt == nil {
+		c.send(newMessage(msgNoData))
+		return nil
+	}
+	desc, err := c.ex.Describe(pt.stmt)
+	if err != nil {
+		return err
+	}
+	if desc == nil {
+		c.send(newMessage(msgNoData))
+		return nil
+	}
+	if pt.formats, err = resultFormats(pt.codes, len(desc.Columns)); err != nil {
+		return err
+	}
+	c.send(rowDescription(desc, pt.formats))
+	return nil
+}
+
+// execute handles Execute: portal name and the most rows to send, 0 for
+// all. A portal with rows left is suspended.
+func (c *conn) execute(body *reader) error {
+	name := body.string()
+	maxRows := int(body.int32())
+	pt := c.portals[name]
+	if pt == nil {
+		return errorf(codeUndefinedCursor, "portal %q does not exist", name)
+	}
+	if pt.stmt == nil {
+		c.send(newMessage(msgEmptyQueryResponse))
+		return nil
+	}
+	if pt.res == nil {
+		res, err := c.ex.Execute(pt.stmt)
+		if err != nil {
+			return err
+		}
+		if pt.formats == nil {
+			if pt.formats, err = resultFormats(pt.codes, len(res.Columns)); err != nil {
+				return err
+			}
+		}
+		pt.res = res
+	}
+	to := len(pt.res.Rows)
+	if maxRows > 0 && pt.sent+maxRows < to {
+		to = pt.sent + maxRows
+	}
+	if pt.sent > 0 {
+		// a notice goes with the first batch only
+		pt.res.Notice = ""
+	}
+	c.sendResult(pt.stmt, pt.res, pt.formats, pt.sent, to)
+	pt.sent = to
+	if to < len(pt.res.Rows) {
+		c.send(newMessage(msgPortalSuspended))
+	}
+	return nil
+}
+
+// close handles Close of a prepared statement or a portal; closing one
+// that doesn't exist is not an error.
+func (c *conn) close(body *reader) error {
+	kind := body.byte()
+	name := body.string()
+	switch kind {
+	case 'S':
+		delete(c.prepared, name)
+	case 'P':
+		delete(c.portals, name)
+	default:
+		return protocolErrorf("invalid close target %q", kind)
+	}
+	c.send(newMessage(msgCloseComplete))
+	return nil
+}
+
+// sync handles Sync, which ends an extended query. Portals don't outlive
+// it: without cursors there is no transaction to keep them open in.
+func (c *conn) sync() {
+	c.skipping = false
+	clear(c.portals)
+	c.readyForQuery()
+}
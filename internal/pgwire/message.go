@@ -0,0 +1,212 @@
+package pgwire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Messages sent by the frontend after startup.
+const (
+	msgQuery     = 'Q'
+	msgParse     = 'P'
+	msgBind      = 'B'
+	msgDescribe  = 'D'
+	msgExecute   = 'E'
+	msgSync      = 'S'
+	msgClose     = 'C'
+	msgFlush     = 'H'
+	msgTerminate = 'X'
+)
+
+// Messages sent by the backend.
+const (
+	msgAuthentication       = 'R'
+	msgParameterStatus      = 'S'
+	msgBackendKeyData       = 'K'
+	msgReadyForQuery        = 'Z'
+	msgRowDescription       = 'T'
+	msgDataRow              = 'D'
+	msgCommandComplete      = 'C'
+	msgEmptyQueryResponse   = 'I'
+	msgErrorResponse        = 'E'
+	msgNoticeResponse       = 'N'
+	msgParseComplete        = '1'
+	msgBindComplete         = '2'
+	msgCloseComplete        = '3'
+	msgNoData               = 'n'
+	msgParameterDescription = 't'
+	msgPortalSuspended      = 's'
+	msgNegotiateProtocol    = 'v'
+)
+
+// Request codes of startup packets, sent in place of a protocol version.
+const (
+	protocolVersion = 3 << 16
+	cancelRequest   = 1234<<16 | 5678
+	sslRequest      = 1234<<16 | 5679
+	gssEncRequest   = 1234<<16 | 5680
+)
+
+// maxMessageSize bounds the length a client may announce for a message.
+const maxMessageSize = 64 << 20
+
+var errMalformed = errors.New("malformed message")
+
+// readStartup reads a startup packet, which has a length but no type.
+func readStartup(r *bufio.Reader) (code uint32, body *reader, err error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[0:4])
+	if n < 8 || n > maxMessageSize {
+		return 0, nil, fmt.Errorf("invalid startup packet length %d", n)
+	}
+	buf := make([]byte, n-8)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint32(hdr[4:8]), &reader{buf: buf}, nil
+}
+
+// readMessage reads a typed message.
+func readMessage(r *bufio.Reader) (typ byte, body *reader, err error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:5])
+	if n < 4 || n > maxMessageSize {
+		return 0, nil, fmt.Errorf("invalid message length %d", n)
+	}
+	buf := make([]byte, n-4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], &reader{buf: buf}, nil
+}
+
+// reader decodes the body of a message. The first read past the end sets
+// err; later reads return zero values.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.buf) {
+		r.err = errMalformed
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) int16() int16 {
+	if b := r.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *reader) int32() int32 {
+	if b := r.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+// count reads the int16 length of an array that follows; a negative one
+// is malformed and gives 0.
+func (r *reader) count() int {
+	n := r.int16()
+	if n < 0 {
+		r.err = errMalformed
+		return 0
+	}
+	return int(n)
+}
+
+// string reads a NUL-terminated string.
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = errMalformed
+	return ""
+}
+
+// value reads a length-prefixed value; length -1 is NULL, which gives nil.
+func (r *reader) value() []byte {
+	n := r.int32()
+	if n == -1 || r.err != nil {
+		return nil
+	}
+	if b := r.take(int(n)); b != nil {
+		return append([]byte{}, b...)
+	}
+	return nil
+}
+
+// message builds a backend message; its length is filled in by bytes.
+type message struct {
+	buf []byte
+}
+
+func newMessage(typ byte) *message {
+	return &message{buf: []byte{typ, 0, 0, 0, 0}}
+}
+
+func (m *message) byte(b byte) *message {
+	m.buf = append(m.buf, b)
+	return m
+}
+
+func (m *message) int16(v int) *message {
+	m.buf = binary.BigEndian.AppendUint16(m.buf, uint16(v))
+	return m
+}
+
+func (m *message) int32(v int) *message {
+	m.buf = binary.BigEndian.AppendUint32(m.buf, uint32(v))
+	return m
+}
+
+// string appends a NUL-terminated string.
+func (m *message) string(s string) *message {
+	m.buf = append(append(m.buf, s...), 0)
+	return m
+}
+
+// value appends a length-prefixed value, with length -1 for NULL.
+func (m *message) value(b []byte) *message {
+	if b == nil {
+		return m.int32(-1)
+	}
+	m.int32(len(b))
+	m.buf = append(m.buf, b...)
+	return m
+}
+
+func (m *message) bytes() []byte {
+	binary.BigEndian.PutUint32(m.buf[1:5], uint32(len(m.buf)-1))
+	return m.buf
+}
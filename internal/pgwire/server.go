@@ -0,0 +1,339 @@
+// Package pgwire serves the database over version 3 of the PostgreSQL
+// frontend/backend protocol, so that psql and PostgreSQL drivers can
+// connect to it. Every connection is a session with an executor of its
+// own; authentication is not supported and every login is accepted.
+package pgwire
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"justasimpletoydb/internal/engine"
+	"justasimpletoydb/internal/executor"
+	"justasimpletoydb/internal/sqlstate"
+)
+
+// serverVersion is reported to clients, which use it to pick features.
+const serverVersion = "14.0"
+
+type Server struct {
+	engine *engine.Engine
+	nextID atomic.Int32 // process ID reported to the next connection
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{} // connections being served
+	shutdown bool
+	wg       sync.WaitGroup // done as each connection's session ends
+}
+
+func NewServer(e *engine.Engine) *Server {
+	return &Server{engine: e, conns: make(map[net.Conn]struct{})}
+}
+
+// Shutdown closes the connections being served and waits for their
+// sessions to end: a running statement finishes first, and an open
+// transaction block is rolled back. Connections accepted later are
+// closed at once.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	s.shutdown = true
+	for nc := range s.conns {
+		nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// track adds a connection to those served, unless the server is shutting
+// down.
+func (s *Server) track(nc net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return false
+	}
+	s.conns[nc] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(nc net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, nc)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// Serve accepts connections on ln until it is closed, serving each in a
+// goroutine of its own.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		if !s.track(nc) {
+			nc.Close()
+			continue
+		}
+		go func() {
+			defer s.untrack(nc)
+			s.serveConn(nc)
+		}()
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer nc.Close()
+	c := &conn{
+		r:        bufio.NewReader(nc),
+		w:        bufio.NewWriter(nc),
+		ex:       executor.NewExecutor(s.engine),
+		prepared: make(map[string]*prepared),
+		portals:  make(map[string]*portal),
+	}
+	// a transaction block left open by the client is rolled back
+	defer func() {
+		if err := c.ex.Close(); err != nil {
+			log.Printf("pgwire: closing session of %s: %v", nc.RemoteAddr(), err)
+		}
+	}()
+	ok, err := c.startup(int(s.nextID.Add(1)))
+	if err != nil || !ok {
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Printf("pgwire: startup from %s: %v", nc.RemoteAddr(), err)
+		}
+		return
+	}
+	// connections closed by Shutdown end with net.ErrClosed
+	if err := c.serve(); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		log.Printf("pgwire: connection from %s: %v", nc.RemoteAddr(), err)
+	}
+}
+
+// conn is the state of one client connection.
+type conn struct {
+	r        *bufio.Reader
+	w        *bufio.Writer
+	ex       *executor.Executor
+	prepared map[string]*prepared
+	portals  map[string]*portal
+	// skipping is set by an error in an extended query; messages are
+	// ignored up to the next Sync.
+	skipping bool
+}
+
+// startup answers the startup packets up to the StartupMessage and logs
+// the client in. It returns false if the client only asked for a cancel,
+// which is not supported.
+func (c *conn) startup(pid int) (bool, error) {
+	for {
+		code, body, err := readStartup(c.r)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case code == sslRequest || code == gssEncRequest:
+			// no encryption: the client goes on in the clear or gives up
+			if err := c.w.WriteByte('N'); err != nil {
+				return false, err
+			}
+			if err := c.w.Flush(); err != nil {
+				return false, err
+			}
+			continue
+		case code == cancelRequest:
+			return false, nil
+		case code>>16 != protocolVersion>>16:
+			c.send(errorMessage(&pgError{
+				Code:  sqlstate.FeatureNotSupported,
+				Err:   fmt.Errorf("unsupported frontend protocol %s", versionString(code)),
+				Fatal: true,
+			}))
+			return false, c.w.Flush()
+		}
+
+		// parameters come as name/value pairs up to an empty name; options
+		// of newer protocol versions are named _pq_.*
+		var unknown []string
+		for {
+			name := body.string()
+			if name == "" || body.err != nil {
+				break
+			}
+			body.string()
+			if strings.HasPrefix(name, "_pq_.") {
+				unknown = append(unknown, name)
+			}
+		}
+		if body.err != nil {
+			return false, body.err
+		}
+		if code != protocolVersion || len(unknown) > 0 {
+			m := newMessage(msgNegotiateProtocol).int32(protocolVersion & 0xffff).int32(len(unknown))
+			for _, name := range unknown {
+				m.string(name)
+			}
+			c.send(m)
+		}
+
+		c.send(newMessage(msgAuthentication).int32(0))
+		for _, p := range [][2]string{
+			{"server_version", serverVersion},
+			{"server_encoding", "UTF8"},
+			{"client_encoding", "UTF8"},
+			{"DateStyle", "ISO, MDY"},
+			{"integer_datetimes", "on"},
+			{"standard_conforming_strings", "on"},
+		} {
+			c.send(newMessage(msgParameterStatus).string(p[0]).string(p[1]))
+		}
+		c.send(newMessage(msgBackendKeyData).int32(pid).int32(int(rand.Int32())))
+		c.readyForQuery()
+		return true, c.w.Flush()
+	}
+}
+
+func versionString(code uint32) string {
+	return fmt.Sprintf("%d.%d", code>>16, code&0xffff)
+}
+
+// serve reads messages until the client terminates.
+func (c *conn) serve() error {
+	for {
+		typ, body, err := readMessage(c.r)
+		if err != nil {
+			return err
+		}
+		if typ == msgTerminate {
+			return nil
+		}
+		if err := c.handle(typ, body); err != nil {
+			c.send(errorMessage(err))
+			var pgErr *pgError
+			if errors.As(err, &pgErr) && pgErr.Fatal {
+				c.w.Flush()
+				return err
+			}
+		}
+		if typ == msgQuery || typ == msgSync || typ == msgFlush {
+			if err := c.w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *conn) handle(typ byte, body *reader) error {
+	if typ == msgQuery {
+		sql := body.string()
+		if body.err != nil {
+			return fatalErrorf("message %q: %v", typ, body.err)
+		}
+		c.simpleQuery(sql)
+		return nil
+	}
+	if typ == msgSync {
+		c.sync()
+		return nil
+	}
+	if c.skipping {
+		return nil
+	}
+	var err error
+	switch typ {
+	case msgParse:
+		err = c.parse(body)
+	case msgBind:
+		err = c.bind(body)
+	case msgDescribe:
+		err = c.describe(body)
+	case msgExecute:
+		err = c.execute(body)
+	case msgClose:
+		err = c.close(body)
+	case msgFlush:
+	default:
+		return fatalErrorf("unsupported message type %q", typ)
+	}
+	if err == nil && body.err != nil {
+		err = fatalErrorf("message %q: %v", typ, body.err)
+	}
+	if err != nil {
+		c.skipping = true
+	}
+	return err
+}
+
+// simpleQuery runs the statements of a Query message in order, stopping at
+// the first error.
+func (c *conn) simpleQuery(sql string) {
+	defer c.readyForQuery()
+	stmts, err := parseStatements(sql)
+	if err != nil {
+		c.send(errorMessage(err))
+		return
+	}
+	if len(stmts) == 0 {
+		c.send(newMessage(msgEmptyQueryResponse))
+		return
+	}
+	for _, stmt := range stmts {
+		res, err := c.ex.Execute(stmt)
+		if err != nil {
+			c.send(errorMessage(err))
+			return
+		}
+		// Types is set for the statements returning rows
+		if res.Types != nil {
+			c.send(rowDescription(res, nil))
+		}
+		c.sendResult(stmt, res, nil, 0, len(res.Rows))
+	}
+}
+
+// sendResult sends rows [from, to) of a result, and a CommandComplete if
+// they are the last.
+func (c *conn) sendResult(stmt executor.Statement, res *executor.ExecResult, formats []int16, from, to int) {
+	if res.Notice != "" {
+		c.send(noticeMessage(res.Notice))
+	}
+	for _, row := range res.Rows[from:to] {
+		c.send(dataRow(row, formats))
+	}
+	if to == len(res.Rows) {
+		c.send(newMessage(msgCommandComplete).string(commandTag(c.ex.PreparedStmt(stmt), res)))
+	}
+}
+
+func (c *conn) readyForQuery() {
+	status := byte('I')
+	switch c.ex.TxState() {
+	case executor.TxActive:
+		status = 'T'
+	case executor.TxFailed:
+		status = 'E'
+	}
+	c.send(newMessage(msgReadyForQuery).byte(status))
+}
+
+// send buffers a message; it is written when the buffer fills or at the
+// next flush. A write error shows up again on the next read.
+func (c *conn) send(m *message) {
+	c.w.Write(m.bytes())
+}
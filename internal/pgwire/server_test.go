@@ -0,0 +1,379 @@
+package pgwire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"justasimpletoydb/internal/engine"
+)
+
+// testClient speaks the protocol to a server on a loopback listener.
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+// newTestServer serves a new database until the test ends.
+func newTestServer(t *testing.T) net.Addr {
+	e := engine.NewEngine(t.TempDir())
+	s := NewServer(e)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ln) }()
+	t.Cleanup(func() {
+		ln.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+		s.Shutdown()
+		e.Close()
+	})
+	return ln.Addr()
+}
+
+func dial(t *testing.T, addr net.Addr) *testClient {
+	nc, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	nc.SetDeadline(time.Now().Add(10 * time.Second))
+	return &testClient{t: t, nc: nc, r: bufio.NewReader(nc)}
+}
+
+// connect dials a new server and logs in.
+func connect(t *testing.T) *testClient {
+	c := dial(t, newTestServer(t))
+	c.startup(protocolVersion, "user", "test")
+	if got := c.replies(); !strings.HasSuffix(got, "K Z(I)") {
+		t.Fatalf("startup: got %s", got)
+	}
+	return c
+}
+
+// startup sends a startup packet; params are name/value pairs, nil for a
+// request without any.
+func (c *testClient) startup(code uint32, params ...string) {
+	buf := binary.BigEndian.AppendUint32(make([]byte, 4), code)
+	if params != nil {
+		for _, p := range params {
+			buf = append(append(buf, p...), 0)
+		}
+		buf = append(buf, 0)
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)))
+	c.write(buf)
+}
+
+func (c *testClient) write(b []byte) {
+	c.t.Helper()
+	if _, err := c.nc.Write(b); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) send(msgs ...*message) {
+	c.t.Helper()
+	for _, m := range msgs {
+		c.write(m.bytes())
+	}
+}
+
+// replies reads the messages up to a ReadyForQuery and summarizes them.
+func (c *testClient) replies() string {
+	c.t.Helper()
+	var out []string
+	for {
+		typ, body, err := readMessage(c.r)
+		if err != nil {
+			c.t.Fatalf("after %v: %v", out, err)
+		}
+		out = append(out, summarize(typ, body))
+		if typ == msgReadyForQuery {
+			return strings.Join(out, " ")
+		}
+	}
+}
+
+// query runs sql with a Query message and summarizes the replies.
+func (c *testClient) query(sql string) string {
+	c.t.Helper()
+	c.send(newMessage(msgQuery).string(sql))
+	return c.replies()
+}
+
+func (c *testClient) wantQuery(sql, want string) {
+	c.t.Helper()
+	if got := c.query(sql); got != want {
+		c.t.Errorf("%s:\n got %s\nwant %s", sql, got, want)
+	}
+}
+
+// summarize describes a backend message in a line: its type followed by
+// the parts of its body tests look at.
+func summarize(typ byte, body *reader) string {
+	var parts []string
+	switch typ {
+	case msgAuthentication, msgNegotiateProtocol:
+		parts = append(parts, fmt.Sprint(body.int32()))
+	case msgParameterStatus:
+		parts = append(parts, body.string()+"="+body.string())
+	case msgReadyForQuery:
+		parts = append(parts, string(body.byte()))
+	case msgCommandComplete:
+		parts = append(parts, body.string())
+	case msgRowDescription:
+		for n := body.int16(); n > 0; n-- {
+			name := body.string()
+			body.int32()
+			body.int16()
+			oid := body.int32()
+			body.int16()
+			body.int32()
+			col := fmt.Sprintf("%s:%d", name, oid)
+			if body.int16() == formatBinary {
+				col += ":binary"
+			}
+			parts = append(parts, col)
+		}
+	case msgDataRow:
+		for n := body.int16(); n > 0; n-- {
+			if v := body.value(); v != nil {
+				parts = append(parts, fmt.Sprintf("%q", v))
+			} else {
+				parts = append(parts, "NULL")
+			}
+		}
+	case msgParameterDescription:
+		for n := body.int16(); n > 0; n-- {
+			parts = append(parts, fmt.Sprint(body.int32()))
+		}
+	case msgErrorResponse, msgNoticeResponse:
+		fields := make(map[byte]string)
+		for f := body.byte(); f != 0 && body.err == nil; f = body.byte() {
+			fields[f] = body.string()
+		}
+		parts = append(parts, fields['S'], fields['C'], fields['M'])
+		if p, ok := fields['P']; ok {
+			parts = append(parts, "at "+p)
+		}
+	default:
+		return string(typ)
+	}
+	if body.err != nil {
+		parts = append(parts, body.err.Error())
+	}
+	return string(typ) + "(" + strings.Join(parts, " ") + ")"
+}
+
+func parseMsg(name, sql string) *message {
+	return newMessage(msgParse).string(name).string(sql).int16(0)
+}
+
+// bindMsg binds a prepared statement to text parameter values, asking for
+// results in the given formats.
+func bindMsg(portal, stmt string, values []string, resultCodes ...int) *message {
+	m := newMessage(msgBind).string(portal).string(stmt).int16(0).int16(len(values))
+	for _, v := range values {
+		m.value([]byte(v))
+	}
+	m.int16(len(resultCodes))
+	for _, f := range resultCodes {
+		m.int16(f)
+	}
+	return m
+}
+
+func describeMsg(kind byte, name string) *message {
+	return newMessage(msgDescribe).byte(kind).string(name)
+}
+
+func executeMsg(portal string, maxRows int) *message {
+	return newMessage(msgExecute).string(portal).int32(maxRows)
+}
+
+func syncMsg() *message { return newMessage(msgSync) }
+
+func TestStartup(t *testing.T) {
+	c := dial(t, newTestServer(t))
+	// encryption is refused with a single byte, then the client goes on
+	c.startup(sslRequest)
+	if b, err := c.r.ReadByte(); err != nil || b != 'N' {
+		t.Fatalf("SSLRequest: got %q, %v", b, err)
+	}
+	c.startup(protocolVersion, "user", "test", "database", "test")
+	want := "R(0) S(server_version=14.0) S(server_encoding=UTF8) S(client_encoding=UTF8) " +
+		"S(DateStyle=ISO, MDY) S(integer_datetimes=on) S(standard_conforming_strings=on) K Z(I)"
+	if got := c.replies(); got != want {
+		t.Errorf("startup:\n got %s\nwant %s", got, want)
+	}
+	c.wantQuery("CREATE TABLE t (id INT)", "C(CREATE TABLE) Z(I)")
+}
+
+func TestStartup_ProtocolVersion(t *testing.T) {
+	addr := newTestServer(t)
+	// a newer minor version and its options are negotiated down
+	c := dial(t, addr)
+	c.startup(protocolVersion|2, "user", "test", "_pq_.opt", "1")
+	if got := c.replies(); !strings.HasPrefix(got, "v(0) R(0) ") {
+		t.Errorf("protocol 3.2: got %s", got)
+	}
+	c = dial(t, addr)
+	c.startup(2<<16, "user", "test")
+	typ, body, err := readMessage(c.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := summarize(typ, body), "E(FATAL 0A000 unsupported frontend protocol 2.0)"; got != want {
+		t.Errorf("protocol 2.0: got %s, want %s", got, want)
+	}
+}
+
+func TestSimpleQuery(t *testing.T) {
+	c := connect(t)
+	c.wantQuery("CREATE TABLE t (id INT, name TEXT)", "C(CREATE TABLE) Z(I)")
+	c.wantQuery("INSERT INTO t VALUES (1, 'a'), (2, 'b')", "C(INSERT 0 2) Z(I)")
+	c.wantQuery("SELECT id, name FROM t",
+		`T(id:20 name:25) D("1" "a") D("2" "b") C(SELECT 2) Z(I)`)
+	c.wantQuery("SELECT id FROM t WHERE id > 5", "T(id:20) C(SELECT 0) Z(I)")
+	// the statements of a query run in order, each with its own reply
+	c.wantQuery("UPDATE t SET name = 'c' WHERE id = 2; DELETE FROM t WHERE id = 1; SELECT name FROM t",
+		`C(UPDATE 1) C(DELETE 1) T(name:25) D("c") C(SELECT 1) Z(I)`)
+	c.wantQuery("", "I Z(I)")
+	c.wantQuery("BEGIN", "C(BEGIN) Z(T)")
+	c.wantQuery("BEGIN", "N(WARNING 01000 there is already a transaction in progress) C(BEGIN) Z(T)")
+	c.wantQuery("COMMIT", "C(COMMIT) Z(I)")
+}
+
+func TestExtendedQuery(t *testing.T) {
+	c := connect(t)
+	c.wantQuery("CREATE TABLE t (id INT, name TEXT)", "C(CREATE TABLE) Z(I)")
+	c.wantQuery("INSERT INTO t VALUES (1, 'a'), (2, 'b'), (3, 'c')", "C(INSERT 0 3) Z(I)")
+
+	c.send(parseMsg("byid", "SELECT name FROM t WHERE id = $1"), describeMsg('S', "byid"), syncMsg())
+	if got, want := c.replies(), "1 t(20) T(name:25) Z(I)"; got != want {
+		t.Errorf("Parse, Describe: got %s, want %s", got, want)
+	}
+	c.send(bindMsg("", "byid", []string{"2"}), describeMsg('P', ""), executeMsg("", 0), syncMsg())
+	if got, want := c.replies(), `2 T(name:25) D("b") C(SELECT 1) Z(I)`; got != want {
+		t.Errorf("Bind, Execute: got %s, want %s", got, want)
+	}
+	// the prepared statement outlives the Sync and binds again
+	c.send(bindMsg("", "byid", []string{"3"}), executeMsg("", 0), syncMsg())
+	if got, want := c.replies(), `2 D("c") C(SELECT 1) Z(I)`; got != want {
+		t.Errorf("second Bind: got %s, want %s", got, want)
+	}
+
+	// a row limit suspends the portal until the next Execute
+	c.send(parseMsg("", "SELECT id FROM t"), bindMsg("p", "", nil),
+		executeMsg("p", 2), executeMsg("p", 2), syncMsg())
+	if got, want := c.replies(), `1 2 D("1") D("2") s D("3") C(SELECT 3) Z(I)`; got != want {
+		t.Errorf("row limit: got %s, want %s", got, want)
+	}
+	// portals end at Sync
+	c.send(executeMsg("p", 0), syncMsg())
+	if got, want := c.replies(), `E(ERROR 34000 portal "p" does not exist) Z(I)`; got != want {
+		t.Errorf("Execute after Sync: got %s, want %s", got, want)
+	}
+
+	c.send(parseMsg("ins", "INSERT INTO t VALUES ($1, $2)"), bindMsg("", "ins", []string{"4", "d"}),
+		describeMsg('P', ""), executeMsg("", 0), syncMsg())
+	if got, want := c.replies(), "1 2 n C(INSERT 0 1) Z(I)"; got != want {
+		t.Errorf("INSERT: got %s, want %s", got, want)
+	}
+	c.send(newMessage(msgClose).byte('S').string("ins"), syncMsg())
+	if got, want := c.replies(), "3 Z(I)"; got != want {
+		t.Errorf("Close: got %s, want %s", got, want)
+	}
+	c.wantQuery("SELECT name FROM t WHERE id = 4", `T(name:25) D("d") C(SELECT 1) Z(I)`)
+}
+
+func TestErrors(t *testing.T) {
+	c := connect(t)
+	c.wantQuery("SELECT * FROM missing", "E(ERROR XX000 table not found: missing) Z(I)")
+	c.wantQuery("SELECT id FROM", "E(ERROR 42601 expected table name, got EOF '' at 15) Z(I)")
+	c.wantQuery("CREATE TABLE t (id INT UNIQUE)", "C(CREATE TABLE) Z(I)")
+	// a query stops at its first failing statement
+	c.wantQuery("INSERT INTO t VALUES (1); INSERT INTO t VALUES (1); INSERT INTO t VALUES (2)",
+		"C(INSERT 0 1) E(ERROR 23505 duplicate key value violates unique constraint \"t_id_key\") Z(I)")
+	c.wantQuery("SELECT id FROM t", `T(id:20) D("1") C(SELECT 1) Z(I)`)
+
+	// in a transaction block the error aborts the transaction
+	c.wantQuery("BEGIN", "C(BEGIN) Z(T)")
+	c.wantQuery("SELECT * FROM missing", "E(ERROR XX000 table not found: missing) Z(E)")
+	c.wantQuery("SELECT id FROM t",
+		"E(ERROR 25P02 current transaction is aborted, commands ignored until end of transaction block) Z(E)")
+	c.wantQuery("ROLLBACK", "C(ROLLBACK) Z(I)")
+
+	// after an error in an extended query messages are skipped up to Sync
+	c.send(parseMsg("", "SELECT id FROM missing"), bindMsg("", "", nil), executeMsg("", 0), syncMsg())
+	if got, want := c.replies(), "E(ERROR XX000 table not found: missing) Z(I)"; got != want {
+		t.Errorf("failing Parse: got %s, want %s", got, want)
+	}
+	c.send(parseMsg("byid", "SELECT id FROM t WHERE id = $1"), bindMsg("", "byid", nil), executeMsg("", 0), syncMsg())
+	if got, want := c.replies(), "1 E(ERROR 08P01 bind message supplies 0 parameters, but prepared statement requires 1) Z(I)"; got != want {
+		t.Errorf("Bind without parameters: got %s, want %s", got, want)
+	}
+	c.send(bindMsg("", "byid", []string{"x"}), executeMsg("", 0), syncMsg())
+	if got, want := c.replies(), `E(ERROR 22P02 invalid input syntax for type bigint: "x") Z(I)`; got != want {
+		t.Errorf("Bind of bad integer: got %s, want %s", got, want)
+	}
+	c.send(parseMsg("byid", "SELECT 1"), syncMsg())
+	if got, want := c.replies(), `E(ERROR 42P05 prepared statement "byid" already exists) Z(I)`; got != want {
+		t.Errorf("Parse of existing name: got %s, want %s", got, want)
+	}
+	c.send(bindMsg("", "byid", []string{"1"}), executeMsg("", 0), syncMsg())
+	if got, want := c.replies(), `2 D("1") C(SELECT 1) Z(I)`; got != want {
+		t.Errorf("after errors: got %s, want %s", got, want)
+	}
+
+	// a message the server can't parse ends the connection
+	c.send(newMessage('?'))
+	typ, body, err := readMessage(c.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := summarize(typ, body), `E(FATAL 08P01 unsupported message type '?')`; got != want {
+		t.Errorf("unknown message: got %s, want %s", got, want)
+	}
+	if _, _, err := readMessage(c.r); err == nil {
+		t.Error("connection still open after a fatal error")
+	}
+}
+
+func TestTypes(t *testing.T) {
+	c := connect(t)
+	c.wantQuery("CREATE TABLE v (i INT, s TEXT)", "C(CREATE TABLE) Z(I)")
+	c.wantQuery("INSERT INTO v VALUES (-5, 'x y'), (3, ''), (NULL, NULL)", "C(INSERT 0 3) Z(I)")
+	// INT is sent as int8, BOOLEAN as bool, TEXT and untyped NULL as text
+	c.wantQuery("SELECT i, s, i < 0 AS b, NULL AS n FROM v",
+		`T(i:20 s:25 b:16 n:25) D("-5" "x y" "t" NULL) D("3" "" "f" NULL) D(NULL NULL NULL NULL) C(SELECT 3) Z(I)`)
+
+	// parameters are inferred and decoded by type; results may be binary
+	c.send(parseMsg("", "SELECT i, i < 0 AS b, s FROM v WHERE (i < 0) = $1 AND s = $2"), describeMsg('S', ""),
+		bindMsg("", "", []string{"on", "x y"}, formatBinary, formatBinary, formatText),
+		describeMsg('P', ""), executeMsg("", 0), syncMsg())
+	want := `1 t(16 25) T(i:20 b:16 s:25) 2 T(i:20:binary b:16:binary s:25) ` +
+		`D("\xff\xff\xff\xff\xff\xff\xff\xfb" "\x01" "x y") C(SELECT 1) Z(I)`
+	if got := c.replies(); got != want {
+		t.Errorf("binary results:\n got %s\nwant %s", got, want)
+	}
+
+	// a binary int4 parameter, and NULL
+	m := newMessage(msgBind).string("").string("ins").int16(1).int16(formatBinary).int16(2).
+		value(binary.BigEndian.AppendUint32(nil, 7)).value(nil).int16(0)
+	c.send(parseMsg("ins", "INSERT INTO v VALUES ($1, $2)"), m, executeMsg("", 0), syncMsg())
+	if got, want := c.replies(), "1 2 C(INSERT 0 1) Z(I)"; got != want {
+		t.Errorf("binary parameters: got %s, want %s", got, want)
+	}
+	c.wantQuery("SELECT i, s FROM v WHERE i = 7", `T(i:20 s:25) D("7" NULL) C(SELECT 1) Z(I)`)
+}
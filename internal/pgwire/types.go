@@ -0,0 +1,218 @@
+package pgwire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"justasimpletoydb/internal/executor"
+)
+
+// Type OIDs of the PostgreSQL types values are sent as. INT is 64 bits,
+// like the Go int the executor produces.
+const (
+	oidBool = 16
+	oidInt8 = 20
+	oidText = 25
+)
+
+// Format codes of parameters and results.
+const (
+	formatText   = 0
+	formatBinary = 1
+)
+
+// typeOID returns the OID and size of an executor column type. Columns of
+// unknown type, such as a bare NULL, are sent as text.
+func typeOID(typ string) (oid, size int) {
+	switch typ {
+	case "INT":
+		return oidInt8, 8
+	case "BOOLEAN":
+		return oidBool, 1
+	default:
+		return oidText, -1
+	}
+}
+
+// encodeValue encodes a value in the given format; NULL gives nil.
+func encodeValue(v any, format int16) []byte {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case int:
+		if format == formatBinary {
+			return binary.BigEndian.AppendUint64(nil, uint64(v))
+		}
+		return strconv.AppendInt(nil, int64(v), 10)
+	case bool:
+		switch {
+		case format == formatBinary && v:
+			return []byte{1}
+		case format == formatBinary:
+			return []byte{0}
+		case v:
+			return []byte("t")
+		default:
+			return []byte("f")
+		}
+	case string:
+		return []byte(v)
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// decodeValue decodes a parameter value of an executor type sent in the
+// given format; nil is NULL. Binary integers may be 2, 4 or 8 bytes, as
+// clients send them for the integer type they hold.
+func decodeValue(b []byte, typ string, format int16) (any, error) {
+	if b == nil {
+		return nil, nil
+	}
+	switch typ {
+	case "INT":
+		if format == formatBinary {
+			switch len(b) {
+			case 2:
+				return int(int16(binary.BigEndian.Uint16(b))), nil
+			case 4:
+				return int(int32(binary.BigEndian.Uint32(b))), nil
+			case 8:
+				return int(int64(binary.BigEndian.Uint64(b))), nil
+			}
+			return nil, protocolErrorf("incorrect binary data format for an integer of %d bytes", len(b))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, errorf(codeInvalidText, "invalid input syntax for type bigint: %q", b)
+		}
+		return n, nil
+	case "BOOLEAN":
+		if format == formatBinary {
+			if len(b) != 1 {
+				return nil, protocolErrorf("incorrect binary data format for a boolean of %d bytes", len(b))
+			}
+			return b[0] != 0, nil
+		}
+		switch strings.ToLower(strings.TrimSpace(string(b))) {
+		case "t", "true", "yes", "on", "1":
+			return true, nil
+		case "f", "false", "no", "off", "0":
+			return false, nil
+		}
+		return nil, errorf(codeInvalidText, "invalid input syntax for type boolean: %q", b)
+	default:
+		return string(b), nil
+	}
+}
+
+// paramFormats expands the parameter format codes of a Bind message to
+// one per parameter, like resultFormats.
+func paramFormats(codes []int16, n int) ([]int16, error) {
+	if len(codes) > 1 && len(codes) != n {
+		return nil, protocolErrorf("bind message has %d parameter formats but %d parameters", len(codes), n)
+	}
+	return resultFormats(codes, n)
+}
+
+// resultFormats expands the result format codes of a Bind message to one
+// per column: none means text, a single code applies to every column.
+func resultFormats(codes []int16, n int) ([]int16, error) {
+	formats := make([]int16, n)
+	switch len(codes) {
+	case 0:
+	case 1:
+		for i := range formats {
+			formats[i] = codes[0]
+		}
+	case n:
+		copy(formats, codes)
+	default:
+		return nil, protocolErrorf("bind message has %d result formats but query has %d columns", len(codes), n)
+	}
+	for _, f := range formats {
+		if f != formatText && f != formatBinary {
+			return nil, protocolErrorf("unsupported format code: %d", f)
+		}
+	}
+	return formats, nil
+}
+
+// rowDescription describes the columns of a result.
+func rowDescription(desc *executor.ExecResult, formats []int16) *message {
+	m := newMessage(msgRowDescription).int16(len(desc.Columns))
+	for i, name := range desc.Columns {
+		typ := ""
+		if i < len(desc.Types) {
+			typ = desc.Types[i]
+		}
+		oid, size := typeOID(typ)
+		format := int16(formatText)
+		if formats != nil {
+			format = formats[i]
+		}
+		m.string(name).int32(0).int16(0).int32(oid).int16(size).int32(-1).int16(int(format))
+	}
+	return m
+}
+
+func dataRow(row []any, formats []int16) *message {
+	m := newMessage(msgDataRow).int16(len(row))
+	for i, v := range row {
+		format := int16(formatText)
+		if formats != nil {
+			format = formats[i]
+		}
+		m.value(encodeValue(v, format))
+	}
+	return m
+}
+
+// commandTag returns the tag of the CommandComplete message for a
+// statement that ran.
+func commandTag(stmt executor.Statement, res *executor.ExecResult) string {
+	switch s := stmt.(type) {
+	case *executor.SelectStmt, *executor.SetOpStmt:
+		return fmt.Sprintf("SELECT %d", len(res.Rows))
+	case *executor.InsertStmt:
+		return fmt.Sprintf("INSERT 0 %d", res.Affected)
+	case *executor.UpdateStmt:
+		return fmt.Sprintf("UPDATE %d", res.Affected)
+	case *executor.DeleteStmt:
+		return fmt.Sprintf("DELETE %d", res.Affected)
+	case *executor.CreateTableStmt:
+		if s.Query != nil {
+			return fmt.Sprintf("SELECT %d", res.Affected)
+		}
+		return "CREATE TABLE"
+	case *executor.CreateViewStmt:
+		if s.Materialized {
+			return fmt.Sprintf("SELECT %d", res.Affected)
+		}
+		return "CREATE VIEW"
+	case *executor.CreateIndexStmt:
+		return "CREATE INDEX"
+	case *executor.CreateSequenceStmt:
+		return "CREATE SEQUENCE"
+	case *executor.RefreshViewStmt:
+		return "REFRESH MATERIALIZED VIEW"
+	case *executor.DropTableStmt:
+		return "DROP TABLE"
+	case *executor.DropIndexStmt:
+		return "DROP INDEX"
+	case *executor.DropSequenceStmt:
+		return "DROP SEQUENCE"
+	case *executor.DropViewStmt:
+		if s.Materialized {
+			return "DROP MATERIALIZED VIEW"
+		}
+		return "DROP VIEW"
+	case *executor.AlterTableStmt:
+		return "ALTER TABLE"
+	default:
+		// BEGIN, COMMIT and ROLLBACK report what they did
+		return res.Message
+	}
+}
@@ -14,5 +14,23 @@ func (qp *QueryProcessor) RunQuery(sql string) (*executor.ExecResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	return stmt.Execute(qp.Exec)
+	return qp.Exec.Execute(stmt)
+}
+
+// RunAll runs the statements of sql in order and returns their results,
+// stopping at the first error.
+func (qp *QueryProcessor) RunAll(sql string) ([]*executor.ExecResult, error) {
+	stmts, err := parser.ParseAll(sql)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*executor.ExecResult, 0, len(stmts))
+	for _, stmt := range stmts {
+		res, err := qp.Exec.Execute(stmt)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
 }
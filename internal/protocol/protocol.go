@@ -0,0 +1,476 @@
+// Package protocol is the client protocol of cmd/server.
+//
+// Every message is a frame: a type byte, the length of the body as a
+// big-endian uint32, and the body. A session opens with a Hello from the
+// client naming the protocol version, answered by a Hello from the server
+// and a Ready. The client then sends Query messages. The server answers
+// each statement of a query with a Header and RowBatch messages if it
+// returns rows, then a Complete; it stops at the first Error, and ends
+// every query with a Ready.
+package protocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version is the version of the protocol this package speaks.
+const Version = 1
+
+// magic opens every Hello, telling the protocol apart from others.
+const magic = "TOYDB"
+
+// maxFrameSize bounds the length a peer may announce for a message body.
+const maxFrameSize = 64 << 20
+
+// Message types.
+const (
+	TypeHello     = 'H'
+	TypeQuery     = 'Q'
+	TypeTerminate = 'X'
+	TypeHeader    = 'T'
+	TypeRowBatch  = 'D'
+	TypeError     = 'E'
+	TypeNotice    = 'N'
+	TypeComplete  = 'C'
+	TypeReady     = 'Z'
+)
+
+// Transaction states reported by Ready.
+const (
+	TxIdle   = 'I' // not in a transaction block
+	TxActive = 'T' // in a transaction block
+	TxFailed = 'E' // in a failed transaction block, until it ends
+)
+
+// Message is a message of the protocol.
+type Message interface {
+	Type() byte
+	encode(e *encoder)
+	decode(d *decoder)
+}
+
+// Hello opens a session, from the client and back from the server.
+type Hello struct {
+	Version uint16
+}
+
+// Query asks the server to run SQL text of one or more statements.
+type Query struct {
+	SQL string
+}
+
+// Terminate ends a session.
+type Terminate struct{}
+
+// Header names and types the columns of the rows a statement returns.
+// Types are INT, TEXT, BOOLEAN or unknown.
+type Header struct {
+	Columns []string
+	Types   []string
+}
+
+// RowBatch carries rows of a result. Values are int, string, bool or nil.
+type RowBatch struct {
+	Rows [][]any
+}
+
+// Error reports a failed statement, or a session the server refuses.
+type Error struct {
+	Code     string // SQLSTATE code
+	Message  string
+	Position int // byte offset in the query of a syntax error, or -1
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (SQLSTATE %s)", e.Message, e.Code)
+}
+
+// Notice is a warning about a statement that still ran.
+type Notice struct {
+	Message string
+}
+
+// Complete ends the answer to one statement.
+type Complete struct {
+	Message  string
+	Affected int
+}
+
+// Ready ends the answer to a query with the transaction state of the
+// session.
+type Ready struct {
+	TxState byte
+}
+
+func (*Hello) Type() byte     { return TypeHello }
+func (*Query) Type() byte     { return TypeQuery }
+func (*Terminate) Type() byte { return TypeTerminate }
+func (*Header) Type() byte    { return TypeHeader }
+func (*RowBatch) Type() byte  { return TypeRowBatch }
+func (*Error) Type() byte     { return TypeError }
+func (*Notice) Type() byte    { return TypeNotice }
+func (*Complete) Type() byte  { return TypeComplete }
+func (*Ready) Type() byte     { return TypeReady }
+
+// newMessage returns an empty message of a type, or nil if it is unknown.
+func newMessage(typ byte) Message {
+	switch typ {
+	case TypeHello:
+		return &Hello{}
+	case TypeQuery:
+		return &Query{}
+	case TypeTerminate:
+		return &Terminate{}
+	case TypeHeader:
+		return &Header{}
+	case TypeRowBatch:
+		return &RowBatch{}
+	case TypeError:
+		return &Error{}
+	case TypeNotice:
+		return &Notice{}
+	case TypeComplete:
+		return &Complete{}
+	case TypeReady:
+		return &Ready{}
+	}
+	return nil
+}
+
+// Conn reads and writes messages on a connection. Sent messages are
+// buffered until Flush.
+type Conn struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{r: bufio.NewReader(rw), w: bufio.NewWriter(rw)}
+}
+
+func (c *Conn) Send(m Message) error {
+	e := &encoder{buf: []byte{m.Type(), 0, 0, 0, 0}}
+	m.encode(e)
+	binary.BigEndian.PutUint32(e.buf[1:5], uint32(len(e.buf)-5))
+	_, err := c.w.Write(e.buf)
+	return err
+}
+
+func (c *Conn) Flush() error {
+	return c.w.Flush()
+}
+
+// Receive reads the next message.
+func (c *Conn) Receive() (Message, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	m := newMessage(hdr[0])
+	if m == nil {
+		return nil, fmt.Errorf("unknown message type %q", hdr[0])
+	}
+	n := binary.BigEndian.Uint32(hdr[1:5])
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("message of %d bytes is too large", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	d := &decoder{buf: body}
+	m.decode(d)
+	if d.err == nil && len(d.buf) > 0 {
+		d.err = fmt.Errorf("%d trailing bytes", len(d.buf))
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("malformed message %q: %w", hdr[0], d.err)
+	}
+	return m, nil
+}
+
+// Handshake opens a session from the client side. A server refusing it
+// answers with an *Error.
+func (c *Conn) Handshake() error {
+	if err := c.Send(&Hello{Version: Version}); err != nil {
+		return err
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	m, err := c.Receive()
+	if err != nil {
+		return err
+	}
+	switch m := m.(type) {
+	case *Hello:
+		if m.Version != Version {
+			return fmt.Errorf("server answered with protocol version %d, want %d", m.Version, Version)
+		}
+		return nil
+	case *Error:
+		return m
+	default:
+		return fmt.Errorf("unexpected message %q in handshake", m.Type())
+	}
+}
+
+// Accept answers the Hello of a client, refusing versions other than
+// Version with an Error.
+func (c *Conn) Accept() error {
+	m, err := c.Receive()
+	if err != nil {
+		return err
+	}
+	hello, ok := m.(*Hello)
+	if !ok {
+		return fmt.Errorf("expected hello, got message %q", m.Type())
+	}
+	if hello.Version != Version {
+		refusal := &Error{
+			Code:     "08P01", // protocol violation
+			Message:  fmt.Sprintf("unsupported protocol version %d, server speaks %d", hello.Version, Version),
+			Position: -1,
+		}
+		c.Send(refusal)
+		c.Flush()
+		return refusal
+	}
+	return c.Send(&Hello{Version: Version})
+}
+
+var errShort = errors.New("message too short")
+
+// encoder appends the parts of a message body.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint8(v byte) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.buf = binary.BigEndian.AppendUint16(e.buf, v)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) int64(v int64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uint32(uint32(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+// Tags of values in rows.
+const (
+	valueNull = iota
+	valueInt
+	valueText
+	valueBool
+)
+
+func (e *encoder) value(v any) {
+	switch v := v.(type) {
+	case nil:
+		e.uint8(valueNull)
+	case int:
+		e.uint8(valueInt)
+		e.int64(int64(v))
+	case string:
+		e.uint8(valueText)
+		e.string(v)
+	case bool:
+		e.uint8(valueBool)
+		if v {
+			e.uint8(1)
+		} else {
+			e.uint8(0)
+		}
+	default:
+		e.uint8(valueText)
+		e.string(fmt.Sprint(v))
+	}
+}
+
+// decoder reads the parts of a message body. The first read past the end
+// sets err; later reads return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = errShort
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) uint8() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	return string(d.take(int(d.uint32())))
+}
+
+// count reads the length of a list, each of whose items takes at least
+// min bytes, so that a bad length can't make a huge allocation.
+func (d *decoder) count(min int) int {
+	n := int(d.uint32())
+	if n*min > len(d.buf) {
+		d.err = errShort
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) strings() []string {
+	ss := make([]string, d.count(4))
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
+
+func (d *decoder) value() any {
+	switch tag := d.uint8(); tag {
+	case valueNull:
+		return nil
+	case valueInt:
+		return int(d.int64())
+	case valueText:
+		return d.string()
+	case valueBool:
+		return d.uint8() != 0
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown value tag %d", tag)
+		}
+		return nil
+	}
+}
+
+func (m *Hello) encode(e *encoder) {
+	e.buf = append(e.buf, magic...)
+	e.uint16(m.Version)
+}
+
+func (m *Hello) decode(d *decoder) {
+	if string(d.take(len(magic))) != magic && d.err == nil {
+		d.err = errors.New("not a hello of this protocol")
+	}
+	m.Version = d.uint16()
+}
+
+func (m *Query) encode(e *encoder) { e.string(m.SQL) }
+func (m *Query) decode(d *decoder) { m.SQL = d.string() }
+
+func (m *Terminate) encode(e *encoder) {}
+func (m *Terminate) decode(d *decoder) {}
+
+func (m *Header) encode(e *encoder) {
+	e.strings(m.Columns)
+	e.strings(m.Types)
+}
+
+func (m *Header) decode(d *decoder) {
+	m.Columns = d.strings()
+	m.Types = d.strings()
+}
+
+func (m *RowBatch) encode(e *encoder) {
+	e.uint32(uint32(len(m.Rows)))
+	for _, row := range m.Rows {
+		e.uint32(uint32(len(row)))
+		for _, v := range row {
+			e.value(v)
+		}
+	}
+}
+
+func (m *RowBatch) decode(d *decoder) {
+	m.Rows = make([][]any, d.count(4))
+	for i := range m.Rows {
+		row := make([]any, d.count(1))
+		for j := range row {
+			row[j] = d.value()
+		}
+		m.Rows[i] = row
+	}
+}
+
+func (m *Error) encode(e *encoder) {
+	e.string(m.Code)
+	e.string(m.Message)
+	e.uint32(uint32(int32(m.Position)))
+}
+
+func (m *Error) decode(d *decoder) {
+	m.Code = d.string()
+	m.Message = d.string()
+	m.Position = int(int32(d.uint32()))
+}
+
+func (m *Notice) encode(e *encoder) { e.string(m.Message) }
+func (m *Notice) decode(d *decoder) { m.Message = d.string() }
+
+func (m *Complete) encode(e *encoder) {
+	e.string(m.Message)
+	e.int64(int64(m.Affected))
+}
+
+func (m *Complete) decode(d *decoder) {
+	m.Message = d.string()
+	m.Affected = int(d.int64())
+}
+
+func (m *Ready) encode(e *encoder) { e.uint8(m.TxState) }
+func (m *Ready) decode(d *decoder) { m.TxState = d.uint8() }
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConn_RoundTrip(t *testing.T) {
+	messages := []Message{
+		&Hello{Version: Version},
+		&Query{SQL: "SELECT 1;\nSELECT 'two\nlines';"},
+		&Terminate{},
+		&Header{Columns: []string{"id", "name", "ok", "n"}, Types: []string{"INT", "TEXT", "BOOLEAN", "unknown"}},
+		&RowBatch{Rows: [][]any{{1, "a", true, nil}, {-7, "", false, nil}}},
+		&RowBatch{Rows: [][]any{}},
+		&Error{Code: "42601", Message: "illegal character: $", Position: 7},
+		&Error{Code: "XX000", Message: "boom", Position: -1},
+		&Notice{Message: "there is no transaction in progress"},
+		&Complete{Message: "UPDATE 2", Affected: 2},
+		&Ready{TxState: TxActive},
+	}
+	var buf bytes.Buffer
+	conn := NewConn(&buf)
+	for _, m := range messages {
+		if err := conn.Send(m); err != nil {
+			t.Fatalf("Failed to send %T: %v", m, err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	for _, want := range messages {
+		got, err := conn.Receive()
+		if err != nil {
+			t.Fatalf("Failed to receive %T: %v", want, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %#v, got %#v", want, got)
+		}
+	}
+}
+
+func TestConn_Receive_RejectsBadFrames(t *testing.T) {
+	frames := map[string][]byte{
+		"unknown type":   {'?', 0, 0, 0, 0},
+		"too large":      {TypeQuery, 0xff, 0xff, 0xff, 0xff},
+		"short body":     {TypeQuery, 0, 0, 0, 4, 0, 0, 0, 9},
+		"trailing bytes": {TypeReady, 0, 0, 0, 2, 'I', 'I'},
+		"huge count":     {TypeRowBatch, 0, 0, 0, 4, 0xff, 0xff, 0xff, 0xff},
+		"bad value tag":  {TypeRowBatch, 0, 0, 0, 9, 0, 0, 0, 1, 0, 0, 0, 1, 9},
+		"not a hello":    {TypeHello, 0, 0, 0, 7, 'H', 'E', 'L', 'L', 'O', 0, 1},
+	}
+	for name, frame := range frames {
+		conn := NewConn(bytes.NewBuffer(frame))
+		if m, err := conn.Receive(); err == nil {
+			t.Errorf("%s: expected error, got %#v", name, m)
+		}
+	}
+}
+
+// pipe is one end of a connection: it reads what the other end wrote.
+type pipe struct {
+	in, out *bytes.Buffer
+}
+
+func (p pipe) Read(b []byte) (int, error)  { return p.in.Read(b) }
+func (p pipe) Write(b []byte) (int, error) { return p.out.Write(b) }
+
+func TestConn_Handshake(t *testing.T) {
+	var toServer, toClient bytes.Buffer
+	client := NewConn(pipe{in: &toClient, out: &toServer})
+	server := NewConn(pipe{in: &toServer, out: &toClient})
+
+	if err := client.Send(&Hello{Version: Version + 1}); err != nil {
+		t.Fatalf("Failed to send hello: %v", err)
+	}
+	client.Flush()
+	var refusal *Error
+	if err := server.Accept(); !errors.As(err, &refusal) {
+		t.Fatalf("Expected the server to refuse version %d, got %v", Version+1, err)
+	}
+	if m, err := client.Receive(); err != nil || m.(*Error).Code != "08P01" {
+		t.Fatalf("Expected a protocol violation error, got %#v, %v", m, err)
+	}
+
+	// the server answers the client's hello as soon as it is flushed
+	if err := client.Send(&Hello{Version: Version}); err != nil {
+		t.Fatalf("Failed to send hello: %v", err)
+	}
+	client.Flush()
+	if err := server.Accept(); err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	server.Flush()
+	m, err := client.Receive()
+	if err != nil {
+		t.Fatalf("Failed to receive hello: %v", err)
+	}
+	if hello, ok := m.(*Hello); !ok || hello.Version != Version {
+		t.Errorf("Expected hello with version %d, got %#v", Version, m)
+	}
+}
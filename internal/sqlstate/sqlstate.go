@@ -0,0 +1,75 @@
+// Package sqlstate gives errors the SQLSTATE codes of PostgreSQL, which
+// the client protocols report errors with.
+package sqlstate
+
+import (
+	"errors"
+
+	"justasimpletoydb/internal/executor"
+	"justasimpletoydb/internal/lock"
+	"justasimpletoydb/internal/parser"
+	"justasimpletoydb/internal/storage"
+)
+
+const (
+	Warning              = "01000"
+	FeatureNotSupported  = "0A000"
+	ProtocolViolation    = "08P01"
+	UniqueViolation      = "23505"
+	ForeignKeyViolation  = "23503"
+	CheckViolation       = "23514"
+	ActiveTransaction    = "25001"
+	FailedTransaction    = "25P02"
+	UndefinedPrepared    = "26000"
+	SerializationFailure = "40001"
+	DeadlockDetected     = "40P01"
+	SyntaxError          = "42601"
+	DuplicatePrepared    = "42P05"
+	LockNotAvailable     = "55P03"
+	InternalError        = "XX000"
+)
+
+// Of returns the code of an error, InternalError for those without one.
+func Of(err error) string {
+	var syntax *parser.SyntaxError
+	var unique *storage.UniqueViolation
+	var fk *executor.ForeignKeyViolation
+	var check *executor.CheckViolation
+	var prepared *executor.PreparedError
+	switch {
+	case errors.As(err, &syntax):
+		return SyntaxError
+	case errors.As(err, &unique):
+		return UniqueViolation
+	case errors.As(err, &fk):
+		return ForeignKeyViolation
+	case errors.As(err, &check):
+		return CheckViolation
+	case errors.As(err, &prepared) && prepared.Exists:
+		return DuplicatePrepared
+	case errors.As(err, &prepared):
+		return UndefinedPrepared
+	case errors.Is(err, executor.ErrTxAborted):
+		return FailedTransaction
+	case errors.Is(err, executor.ErrSchemaChangeInTx):
+		return ActiveTransaction
+	case errors.Is(err, lock.ErrTimeout), errors.Is(err, lock.ErrNotAvailable):
+		return LockNotAvailable
+	case errors.Is(err, executor.ErrConcurrentUpdate):
+		return SerializationFailure
+	case errors.Is(err, lock.ErrDeadlock):
+		return DeadlockDetected
+	default:
+		return InternalError
+	}
+}
+
+// Position returns the byte offset in the SQL text a syntax error was
+// found at, or -1 for other errors.
+func Position(err error) int {
+	var syntax *parser.SyntaxError
+	if errors.As(err, &syntax) {
+		return syntax.Pos
+	}
+	return -1
+}
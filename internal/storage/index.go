@@ -33,6 +33,7 @@ func NewIndex(pager *Pager) (*Index, error) {
 	idx := &Index{
 		Pager: pager,
 	}
+	defer pager.latch(0)()
 	// If no pages, allocate root
 	numPages, err := pager.NumPages()
 	if err != nil {
@@ -56,8 +57,11 @@ func NewIndex(pager *Pager) (*Index, error) {
 	return idx, nil
 }
 
-// Insert a key + TID into the index
+// Insert a key + TID into the index. Every search and insert goes
+// through the root, so the root's latch is held exclusively for the whole
+// insert and shared by searches: splits never happen under a reader.
 func (idx *Index) Insert(key IndexKey, tid TID) error {
+	defer idx.Pager.latch(idx.RootPageID)()
 	root, err := idx.readNode(idx.RootPageID)
 	if err != nil {
 		return err
@@ -67,8 +71,20 @@ func (idx *Index) Insert(key IndexKey, tid TID) error {
 		return err
 	}
 	if newRoot != nil {
-		// root split, assign new root page
-		idx.RootPageID = newRoot.PageID
+		// root split: NewIndex finds the root on its page, so the left half
+		// moves to the page allocated for the new root and the new root
+		// takes the root's page
+		left, err := idx.readNode(idx.RootPageID)
+		if err != nil {
+			return err
+		}
+		left.PageID = newRoot.PageID
+		newRoot.PageID = idx.RootPageID
+		newRoot.Children[0] = left.PageID
+		if err := idx.writeNode(left); err != nil {
+			return err
+		}
+		return idx.writeNode(newRoot)
 	}
 	return nil
 }
@@ -196,6 +212,7 @@ func (idx *Index) splitInternal(node *IndexNode) (*IndexNode, error) {
 
 // Search for a key, returns empty slice if not found
 func (idx *Index) Search(key IndexKey) ([]TID, error) {
+	defer idx.Pager.rlatch(idx.RootPageID)()
 	node, err := idx.readNode(idx.RootPageID)
 	if err != nil {
 		return nil, err
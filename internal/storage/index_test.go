@@ -310,6 +310,44 @@ func TestIndex_ManyKeys_TriggersSplit(t *testing.T) {
 	}
 }
 
+func TestIndex_ManyKeys_Persistence(t *testing.T) {
+	tmpDir := t.TempDir()
+	indexPath := filepath.Join(tmpDir, "split.idx")
+	numKeys := MaxKeysPerNode * 3
+	key := func(i int) IndexKey {
+		return IndexKey{0, 0, 0, 0, byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)}
+	}
+
+	pager := NewPager(indexPath)
+	idx, err := NewIndex(pager)
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for i := 0; i < numKeys; i++ {
+		if err := idx.Insert(key(i), TID{PageID: uint64(i), SlotID: uint32(i)}); err != nil {
+			t.Fatalf("Failed to insert key %d: %v", i, err)
+		}
+	}
+	pager.Close()
+
+	// the root moved by the splits must be found again on reopen
+	pager = NewPager(indexPath)
+	defer pager.Close()
+	idx, err = NewIndex(pager)
+	if err != nil {
+		t.Fatalf("Failed to reopen index: %v", err)
+	}
+	for i := 0; i < numKeys; i++ {
+		results, err := idx.Search(key(i))
+		if err != nil {
+			t.Fatalf("Failed to search for key %d: %v", i, err)
+		}
+		if len(results) != 1 || results[0] != (TID{PageID: uint64(i), SlotID: uint32(i)}) {
+			t.Fatalf("Key %d: unexpected TIDs after reopen: %v", i, results)
+		}
+	}
+}
+
 func TestIndex_InsertOrder_DoesNotMatter(t *testing.T) {
 	idx, _ := setupTestIndex(t)
 	defer idx.Pager.Close()
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// latches are the page latches of one file. Concurrent statements mostly
+// share the handles the engine caches on a table, and with them its
+// pagers, but a file may still be open in several pagers at once: a table
+// evicted by a schema change stays open until the statements using it
+// release it, while the next statement opens it anew. The latches are
+// shared by every pager open on the file so that all of them exclude each
+// other. Page latches are short: they are held while a page is read or
+// rewritten, never while waiting for a lock. A goroutine holding several
+// takes them in page order.
+type latches struct {
+	refs int // pagers open on the file, guarded by fileLatches
+
+	// extend is held by writers appending to the file, the only ones
+	// adding pages to it.
+	extend sync.Mutex
+
+	mu    sync.Mutex
+	pages map[uint64]*sync.RWMutex
+}
+
+// fileLatches holds the latches of the files open, by absolute path.
+var fileLatches = struct {
+	sync.Mutex
+	files map[string]*latches
+}{files: make(map[string]*latches)}
+
+// openLatches returns the latches of the file at path for a new pager.
+func openLatches(path string) (*latches, string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	fileLatches.Lock()
+	defer fileLatches.Unlock()
+	l, ok := fileLatches.files[path]
+	if !ok {
+		l = &latches{pages: make(map[uint64]*sync.RWMutex)}
+		fileLatches.files[path] = l
+	}
+	l.refs++
+	return l, path
+}
+
+// closeLatches drops the latches of a file once no pager uses them.
+func closeLatches(key string) {
+	fileLatches.Lock()
+	defer fileLatches.Unlock()
+	l := fileLatches.files[key]
+	l.refs--
+	if l.refs == 0 {
+		delete(fileLatches.files, key)
+	}
+}
+
+func (l *latches) page(id uint64) *sync.RWMutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pl, ok := l.pages[id]
+	if !ok {
+		pl = new(sync.RWMutex)
+		l.pages[id] = pl
+	}
+	return pl
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"justasimpletoydb/internal/catalog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// openShared opens a table handle of its own on the file at path, as the
+// engine does for every statement.
+func openShared(t *testing.T, path string, schema *catalog.TableSchema) *Table {
+	t.Helper()
+	table, err := NewTable("test", path, schema)
+	if err != nil {
+		t.Fatalf("Failed to open table: %v", err)
+	}
+	return table
+}
+
+func uniqueSchema() *catalog.TableSchema {
+	return &catalog.TableSchema{
+		Name: "test",
+		Columns: []catalog.Column{
+			{Name: "id", Type: catalog.TypeInt},
+			{Name: "name", Type: catalog.TypeText},
+		},
+		Indexes: map[string]*catalog.Index{
+			"id_idx":   {Name: "id_idx", ColumnName: "id", Unique: true},
+			"name_idx": {Name: "name_idx", ColumnName: "name"},
+		},
+	}
+}
+
+// TestLatches_ConcurrentWriters runs writers and readers on handles of
+// their own; run it with -race. Every row must be stored once and be
+// found through the index.
+func TestLatches_ConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tbl")
+	schema := uniqueSchema()
+	const writers, batches, perBatch = 8, 40, 3
+	padding := strings.Repeat("x", 100) // rows span many pages
+
+	var wg, readers sync.WaitGroup
+	errs := make(chan error, writers+2)
+	for w := 0; w < writers; w++ {
+		table := openShared(t, path, schema)
+		defer table.Close()
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for b := 0; b < batches; b++ {
+				rows := make([][]any, perBatch)
+				for i := range rows {
+					id := (w*batches+b)*perBatch + i
+					rows[i] = []any{id, fmt.Sprintf("%d-%s", id, padding)}
+				}
+				if err := table.InsertRows(rows); err != nil {
+					errs <- err
+					return
+				}
+			}
+			// rewrite the first row of the writer, a tuple on an early page
+			id := w * batches * perBatch
+			found, err := table.IndexLookup("id_idx", id)
+			if err != nil || len(found) != 1 {
+				errs <- fmt.Errorf("lookup of %d: %v, %v", id, found, err)
+				return
+			}
+			if err := table.ReplaceRows([]TID{found[0].TID}, [][]any{{id, "updated"}}); err != nil {
+				errs <- err
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	for r := 0; r < 2; r++ {
+		table := openShared(t, path, schema)
+		defer table.Close()
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := table.ScanRows(); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := table.IndexLookup("id_idx", 0); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	table := openShared(t, path, schema)
+	defer table.Close()
+	rows, err := table.ScanRows()
+	if err != nil {
+		t.Fatalf("Failed to scan rows: %v", err)
+	}
+	if len(rows) != writers*batches*perBatch {
+		t.Fatalf("Expected %d rows, got %d", writers*batches*perBatch, len(rows))
+	}
+	for id := 0; id < writers*batches*perBatch; id++ {
+		found, err := table.IndexLookup("id_idx", id)
+		if err != nil {
+			t.Fatalf("Failed to look up %d: %v", id, err)
+		}
+		if len(found) != 1 || found[0].Values[0] != id {
+			t.Fatalf("Lookup of %d found %v", id, found)
+		}
+		if id%(batches*perBatch) == 0 && found[0].Values[1] != "updated" {
+			t.Errorf("Row %d was not updated: %v", id, found[0].Values)
+		}
+	}
+}
+
+// countRows counts the rows of the table at path through a new handle.
+func countRows(path string, schema *catalog.TableSchema) int {
+	table, err := NewTable("test", path, schema)
+	if err != nil {
+		return 0
+	}
+	defer table.Close()
+	rows, _ := table.ScanRows()
+	return len(rows)
+}
+
+func TestLatches_ConcurrentDuplicateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tbl")
+	schema := uniqueSchema()
+	const writers = 8
+
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for w := 0; w < writers; w++ {
+		table := openShared(t, path, schema)
+		defer table.Close()
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			errs[w] = table.InsertRow([]any{42, fmt.Sprint(w)})
+		}(w)
+	}
+	wg.Wait()
+
+	inserted := 0
+	for _, err := range errs {
+		var violation *UniqueViolation
+		switch {
+		case err == nil:
+			inserted++
+		case !errors.As(err, &violation):
+			t.Fatalf("Expected a unique violation, got %v", err)
+		}
+	}
+	if inserted != 1 {
+		t.Errorf("Expected one insert of the key to succeed, got %d", inserted)
+	}
+	if n := countRows(path, schema); n != 1 {
+		t.Errorf("Expected 1 row, got %d", n)
+	}
+}
+
+func TestLatches_ReleasedOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tbl")
+	first := openShared(t, path, uniqueSchema())
+	second := openShared(t, path, uniqueSchema())
+	if first.pager.latches != second.pager.latches {
+		t.Fatal("Handles on the same file don't share latches")
+	}
+	first.Close()
+	second.Close()
+	fileLatches.Lock()
+	defer fileLatches.Unlock()
+	if _, ok := fileLatches.files[second.pager.latchKey]; ok {
+		t.Error("Latches of the file kept after every pager was closed")
+	}
+}
@@ -7,8 +7,10 @@ import (
 )
 
 type Pager struct {
-	file *os.File
-	path string
+	file     *os.File
+	path     string
+	latches  *latches // shared with the other pagers open on the file
+	latchKey string
 }
 
 func NewPager(path string) *Pager {
@@ -20,7 +22,30 @@ func NewPager(path string) *Pager {
 	if err != nil {
 		panic(fmt.Sprintf("failed to open pager file: %v", err))
 	}
-	return &Pager{file: f, path: path}
+	l, key := openLatches(path)
+	return &Pager{file: f, path: path, latches: l, latchKey: key}
+}
+
+// rlatch takes the shared latch of a page, held while reading it. The
+// returned function releases it.
+func (p *Pager) rlatch(id uint64) func() {
+	l := p.latches.page(id)
+	l.RLock()
+	return l.RUnlock
+}
+
+// latch takes the exclusive latch of a page, held while rewriting it.
+func (p *Pager) latch(id uint64) func() {
+	l := p.latches.page(id)
+	l.Lock()
+	return l.Unlock
+}
+
+// lockExtend takes the latch of the end of the file, held while appending
+// pages to it.
+func (p *Pager) lockExtend() func() {
+	p.latches.extend.Lock()
+	return p.latches.extend.Unlock
 }
 
 func (p *Pager) WritePage(page *Page) error {
@@ -56,6 +81,15 @@ func (p *Pager) NumPages() (uint64, error) {
 	return uint64(size / PageSize), nil
 }
 
+// Sync flushes the writes to the file to disk.
+func (p *Pager) Sync() error {
+	return p.file.Sync()
+}
+
 func (p *Pager) Close() error {
+	if p.latches != nil {
+		closeLatches(p.latchKey)
+		p.latches = nil
+	}
 	return p.file.Close()
 }
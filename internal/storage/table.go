@@ -1,19 +1,53 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"justasimpletoydb/internal/catalog"
 	"justasimpletoydb/internal/engine/rowcodec"
+	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 )
 
 type Table struct {
 	name    string
 	schema  *catalog.TableSchema
 	pager   *Pager
-	Indexes map[string]*Index
-	dataDir string // directory where table and index files are stored
+	Indexes map[string]*Index // guarded by indexMu
+	dataDir string            // directory where table and index files are stored
+	changes *Changes
+
+	// indexMu is shared by the handles of the table, as is Indexes; loading
+	// an index adds it for all of them
+	indexMu *sync.Mutex
+	release func() // set on handles, called by the first Close instead of closing the files
+}
+
+// Changes records the tuples written and deleted through a table handle,
+// so that a transaction can undo them.
+type Changes struct {
+	Inserted []TID
+	Deleted  []TID
+
+	// OnInsert, if set, is called with the tuples written while their page
+	// is still latched, before other handles can read them. An error fails
+	// the write, which is undone.
+	OnInsert func(tids []TID) error
+
+	// Busy, if set, reports whether another transaction holds a tuple:
+	// one it wrote or deleted and may still roll back. Key checks don't
+	// decide on such a tuple holding the key but call Wait, which returns
+	// once the transaction has ended, and look again.
+	Busy func(tid TID) bool
+	Wait func(tid TID) error
+}
+
+// Track makes the table record its writes in c.
+func (t *Table) Track(c *Changes) {
+	t.changes = c
 }
 
 // NewTable opens/creates a table file and returns Table
@@ -26,6 +60,7 @@ func NewTable(name string, path string, schema *catalog.TableSchema) (*Table, er
 		schema:  schema,
 		Indexes: make(map[string]*Index),
 		dataDir: dataDir,
+		indexMu: new(sync.Mutex),
 	}
 	// Load existing indexes
 	if err := t.loadIndexes(); err != nil {
@@ -37,7 +72,7 @@ func NewTable(name string, path string, schema *catalog.TableSchema) (*Table, er
 // loadIndexes loads all indexes defined in the schema
 func (t *Table) loadIndexes() error {
 	for indexName := range t.schema.Indexes {
-		indexPath := filepath.Join(t.dataDir, fmt.Sprintf("%s_%s.idx", t.name, indexName))
+		indexPath := IndexPath(t.dataDir, t.name, indexName)
 		pager := NewPager(indexPath)
 		idx, err := NewIndex(pager)
 		if err != nil {
@@ -55,78 +90,395 @@ func (t *Table) loadIndexes() error {
 	return nil
 }
 
-// close underlying pager
+// IndexPath returns the file an index of a table is stored in.
+func IndexPath(dataDir, table, index string) string {
+	return filepath.Join(dataDir, fmt.Sprintf("%s_%s.idx", table, index))
+}
+
+// Handle returns another handle on the open files of the table, for a
+// user of its own: the handle records its writes in the Changes it
+// tracks, and closing it calls release instead of closing the files.
+func (t *Table) Handle(release func()) *Table {
+	h := *t
+	h.changes = nil
+	h.release = release
+	return &h
+}
+
+// Close closes the table file and the files of all loaded indexes. Closing
+// a handle releases it, once.
 func (t *Table) Close() error {
-	return t.pager.Close()
+	if t.release != nil {
+		release := t.release
+		t.release = func() {}
+		release()
+		return nil
+	}
+	err := t.pager.Close()
+	t.indexMu.Lock()
+	defer t.indexMu.Unlock()
+	for _, idx := range t.Indexes {
+		if cerr := idx.Pager.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Sync flushes the table file and the files of all loaded indexes to disk.
+func (t *Table) Sync() error {
+	err := t.pager.Sync()
+	t.indexMu.Lock()
+	defer t.indexMu.Unlock()
+	for _, idx := range t.Indexes {
+		if serr := idx.Pager.Sync(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// DropIndex closes the index, if loaded, and deletes its file.
+// The caller removes the index from the catalog first.
+func (t *Table) DropIndex(name string) error {
+	t.indexMu.Lock()
+	if idx, ok := t.Indexes[name]; ok {
+		idx.Pager.Close()
+		delete(t.Indexes, name)
+	}
+	t.indexMu.Unlock()
+	return removeFile(IndexPath(t.dataDir, t.name, name))
+}
+
+// Drop closes the table and deletes its data file and all index files.
+// The table must not be used afterwards.
+func (t *Table) Drop() error {
+	names := make(map[string]struct{})
+	t.indexMu.Lock()
+	for name := range t.Indexes {
+		names[name] = struct{}{}
+	}
+	t.indexMu.Unlock()
+	for name := range t.schema.Indexes {
+		names[name] = struct{}{}
+	}
+	t.Close()
+	t.Indexes = make(map[string]*Index)
+
+	errs := []error{removeFile(t.pager.path)}
+	for name := range names {
+		errs = append(errs, removeFile(IndexPath(t.dataDir, t.name, name)))
+	}
+	return errors.Join(errs...)
+}
+
+// RenameTableFiles moves the data file and the given index files of a
+// table to a new table name. On failure the files already moved are moved back.
+func RenameTableFiles(dataDir, oldName, newName string, indexes []string) error {
+	type move struct{ from, to string }
+	moves := []move{{filepath.Join(dataDir, oldName+".tbl"), filepath.Join(dataDir, newName+".tbl")}}
+	for _, name := range indexes {
+		moves = append(moves, move{IndexPath(dataDir, oldName, name), IndexPath(dataDir, newName, name)})
+	}
+	for i, m := range moves {
+		err := os.Rename(m.from, m.to)
+		if err == nil || (os.IsNotExist(err) && i > 0) {
+			continue // index files are created lazily and may not exist yet
+		}
+		for j := i - 1; j >= 0; j-- {
+			os.Rename(moves[j].to, moves[j].from)
+		}
+		return err
+	}
+	return nil
+}
+
+// removeFile deletes path; a file that is already gone is not an error.
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 // InsertRow appends a row into last page or allocates a new page
 func (t *Table) InsertRow(values []any) error {
-	data, err := rowcodec.EncodeRow(t.schema, values)
+	return t.InsertRows([][]any{values})
+}
+
+// InsertRows appends rows, filling the last page and allocating new pages
+// as needed. Every row is encoded and checked against the unique indexes
+// before anything is written, and each page is written once after all its
+// rows are placed.
+func (t *Table) InsertRows(rows [][]any) error {
+	return t.ReplaceRows(nil, rows)
+}
+
+// ReplaceRows writes rows and then deletes the rows at old, the versions
+// they replace. The old rows don't count as duplicates in unique indexes.
+// Writers hold the latch of the end of the table from the unique checks
+// to the index entries, so that two of them can't both add a key; a busy
+// tuple holding a key is waited for without the latch. If a write fails,
+// those already done are undone, so the table is left as it was.
+func (t *Table) ReplaceRows(old []TID, rows [][]any) error {
+	if len(rows) == 0 {
+		return t.DeleteRows(old)
+	}
+	encoded := make([][]byte, len(rows))
+	for i, values := range rows {
+		data, err := rowcodec.EncodeRow(t.schema, values)
+		if err != nil {
+			return err
+		}
+		if len(data)+tupleHdrSize+slotEntrySz > PageSize-pageHdrSize {
+			return fmt.Errorf("row of %d bytes does not fit in a page", len(data))
+		}
+		encoded[i] = data
+	}
+	for {
+		busy, err := t.writeRows(old, rows, encoded)
+		if err != nil || busy == nil {
+			return err
+		}
+		// the latch isn't held while waiting: the transaction waited for
+		// may need it to end
+		if err := t.changes.Wait(*busy); err != nil {
+			return err
+		}
+	}
+}
+
+// writeRows does the writes of ReplaceRows under the latch of the end of
+// the table, unless the unique checks find a busy tuple holding one of
+// the keys, which it returns to wait for.
+func (t *Table) writeRows(old []TID, rows [][]any, encoded [][]byte) (*TID, error) {
+	defer t.pager.lockExtend()()
+	busy, err := t.checkUnique(rows, old)
+	if err != nil || busy != nil {
+		return busy, err
+	}
+
+	var done Changes
+	if err := t.replace(old, rows, encoded, &done); err != nil {
+		if uerr := t.Undo(&done); uerr != nil {
+			return nil, errors.Join(err, fmt.Errorf("undo partial write: %w", uerr))
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+// replace does the writes of ReplaceRows, recording them in done as they
+// are made.
+func (t *Table) replace(old []TID, rows [][]any, encoded [][]byte, done *Changes) error {
+	tids, err := t.appendTuples(encoded, done)
 	if err != nil {
 		return err
 	}
+	for i, values := range rows {
+		if err := t.indexRow(values, tids[i]); err != nil {
+			return err
+		}
+	}
+	// a failed delete may have written some of the pages
+	done.Deleted = old
+	return t.DeleteRows(old)
+}
 
+// appendTuples adds encoded rows to the last page and to new pages after
+// it, writing each page once. The caller holds the latch of the end of
+// the table. Each page is latched while it is filled, as readers may
+// already see pages past the old end. The tuples of each page written are
+// recorded in done.
+func (t *Table) appendTuples(encoded [][]byte, done *Changes) ([]TID, error) {
 	numPages, err := t.pager.NumPages()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var page *Page
-	if numPages == 0 {
-		page = NewEmptyPage(0)
-	} else {
-		pageID := numPages - 1
-		pg, err := t.pager.ReadPage(pageID)
-		if err != nil {
-			page = NewEmptyPage(pageID)
-		} else {
+	var pageID uint64
+	if numPages > 0 {
+		pageID = numPages - 1
+	}
+	unlatch := t.pager.latch(pageID)
+	defer func() { unlatch() }()
+	page := NewEmptyPage(pageID)
+	if numPages > 0 {
+		if pg, err := t.pager.ReadPage(pageID); err == nil {
 			page = pg
 		}
 	}
 
-	if !page.CanInsert(len(data) + tupleHdrSize) {
-		newPageID := numPages
-		page = NewEmptyPage(newPageID)
+	tids := make([]TID, len(encoded))
+	written := 0
+	for i, data := range encoded {
+		if !page.CanInsert(len(data)+tupleHdrSize) && page.getSlotCount() > 0 {
+			if err := t.pager.WritePage(page); err != nil {
+				return nil, err
+			}
+			if err := t.recordInserted(tids[written:i], done); err != nil {
+				return nil, err
+			}
+			written = i
+			unlatch()
+			page = NewEmptyPage(page.ID + 1)
+			unlatch = t.pager.latch(page.ID)
+		}
+
+		// Insert row as tuple
+		slotID, err := page.InsertTouple(data, 0, TupleFlagNormal, uint16(t.schema.Version))
+		if err != nil {
+			return nil, err
+		}
+		tids[i] = TID{PageID: page.ID, SlotID: uint32(slotID)}
+	}
+	if err := t.pager.WritePage(page); err != nil {
+		return nil, err
+	}
+	if err := t.recordInserted(tids[written:], done); err != nil {
+		return nil, err
+	}
+	return tids, nil
+}
+
+// UniqueViolation is returned when a row would duplicate a key of a unique index.
+type UniqueViolation struct {
+	Index string
+	Value any
+}
+
+func (e *UniqueViolation) Error() string {
+	return fmt.Sprintf("duplicate key value violates unique constraint %q", e.Index)
+}
+
+// checkUnique looks up the keys of new rows in every unique index. Rows
+// at the TIDs in replaced are about to be deleted and don't conflict. A
+// busy tuple holding a key, even a deleted one whose delete may be rolled
+// back, is returned to be waited for.
+func (t *Table) checkUnique(rows [][]any, replaced []TID) (*TID, error) {
+	for name, def := range t.schema.Indexes {
+		if !def.Unique {
+			continue
+		}
+		colIdx, err := t.ResolveColumn(def.ColumnName)
+		if err != nil {
+			continue
+		}
+		seen := make(map[any]bool)
+		for _, values := range rows {
+			v := values[colIdx]
+			if v == nil {
+				continue // NULLs are never equal, so they never conflict
+			}
+			if seen[v] {
+				return nil, &UniqueViolation{Index: name, Value: v}
+			}
+			seen[v] = true
+			live, busy, err := t.lookup(name, v, true)
+			if err != nil || busy != nil {
+				return busy, err
+			}
+			for _, row := range live {
+				if !slices.Contains(replaced, row.TID) {
+					return nil, &UniqueViolation{Index: name, Value: v}
+				}
+			}
+		}
 	}
+	return nil, nil
+}
 
-	// Insert row as tuple
-	slotID, err := page.InsertTouple(data, 0, TupleFlagNormal)
-	if err != nil {
-		return err
+// IndexLookup returns the live rows whose indexed column equals value,
+// found through the index's B-tree.
+func (t *Table) IndexLookup(indexName string, value any) ([]Row, error) {
+	rows, _, err := t.lookup(indexName, value, false)
+	return rows, err
+}
+
+// LookupKey is IndexLookup for checking a key, such as a foreign key: the
+// busy tuples holding the key are waited for first, deleted ones too.
+func (t *Table) LookupKey(indexName string, value any) ([]Row, error) {
+	for {
+		rows, busy, err := t.lookup(indexName, value, true)
+		if err != nil || busy == nil {
+			return rows, err
+		}
+		if err := t.changes.Wait(*busy); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	if err := t.pager.WritePage(page); err != nil {
-		return err
+// lookup returns the live rows whose indexed column equals value. With
+// checkBusy set, it returns instead the first busy tuple holding the
+// value, if any.
+func (t *Table) lookup(indexName string, value any, checkBusy bool) ([]Row, *TID, error) {
+	def, ok := t.schema.Indexes[indexName]
+	if !ok {
+		return nil, nil, fmt.Errorf("index %s not found on table %s", indexName, t.name)
+	}
+	colIdx, err := t.ResolveColumn(def.ColumnName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if value == nil {
+		return nil, nil, nil
+	}
+	idx, err := t.GetIndex(indexName)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := rowcodec.EncodeValue(t.schema, colIdx, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	tids, err := idx.Search(key)
+	if err != nil {
+		return nil, nil, err
 	}
+	var rows []Row
+	for _, tid := range tids {
+		if checkBusy && t.busy(tid) {
+			return nil, &tid, nil
+		}
+		tup, err := t.GetTupleByTID(tid)
+		if err != nil {
+			return nil, nil, err
+		}
+		// index entries of deleted rows are kept
+		if tup.Flags&TupleFlagDeleted != 0 {
+			continue
+		}
+		values, err := t.decodeTuple(tup)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, Row{TID: tid, Values: values})
+	}
+	return rows, nil, nil
+}
 
-	// Build TID for this row
-	tid := TID{PageID: page.ID, SlotID: uint32(slotID)}
+// busy reports whether another transaction holds a tuple, as far as the
+// handle's Changes tell.
+func (t *Table) busy(tid TID) bool {
+	return t.changes != nil && t.changes.Busy != nil && t.changes.Busy(tid)
+}
 
-	// Update indexes
+// indexRow adds a stored row to every index of the table.
+func (t *Table) indexRow(values []any, tid TID) error {
 	for indexName, idx := range t.schema.Indexes {
 		colIdx, err := t.ResolveColumn(idx.ColumnName)
 		if err != nil {
 			continue
 		}
-		// Get or create index
-		index, ok := t.Indexes[indexName]
-		if !ok {
-			// Index not loaded, try to load it
-			// This can happen if loadIndexes() skipped it or if it was added after table was opened
-			indexPath := filepath.Join(t.dataDir, fmt.Sprintf("%s_%s.idx", t.name, indexName))
-			pager := NewPager(indexPath)
-			var loadErr error
-			index, loadErr = NewIndex(pager)
-			if loadErr != nil {
-				// NewIndex failed - this could be because:
-				// 1. File is corrupted (size not multiple of PageSize)
-				// 2. Some other I/O error
-				// For now, we'll return an error rather than silently failing
-				pager.Close() // Close pager before returning error to avoid resource leak
-				return fmt.Errorf("failed to load index %q: %v", indexName, loadErr)
-			}
-			t.Indexes[indexName] = index
+		// loaded if loadIndexes() skipped it or it was added after the
+		// table was opened
+		index, err := t.GetIndex(indexName)
+		if err != nil {
+			return fmt.Errorf("failed to load index %q: %v", indexName, err)
+		}
+		if values[colIdx] == nil {
+			continue // NULL never matches a key lookup, so it isn't indexed
 		}
 		b, err := rowcodec.EncodeValue(t.schema, colIdx, values[colIdx])
 		if err != nil {
@@ -136,40 +488,222 @@ func (t *Table) InsertRow(values []any) error {
 			return fmt.Errorf("failed to insert into index %q: %v", indexName, err)
 		}
 	}
-
 	return nil
 }
 
-// ReadAllRows iterates all pages and returns all rows in order
+// ReadAllRows iterates all pages and returns all live rows in order
 func (t *Table) ReadAllRows() ([][]any, error) {
+	rows, err := t.ScanRows()
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]any, len(rows))
+	for i, r := range rows {
+		out[i] = r.Values
+	}
+	return out, nil
+}
+
+// Row is a live row together with its location.
+type Row struct {
+	TID    TID
+	Values []any
+}
+
+// ScanRows returns all live rows in order with their TIDs, skipping
+// deleted tuples.
+func (t *Table) ScanRows() ([]Row, error) {
+	out := make([]Row, 0, 64)
+	err := t.scan(func(tid TID, tup *Tuple) error {
+		if tup.Flags&TupleFlagDeleted != 0 {
+			return nil
+		}
+		data, err := t.decodeTuple(tup)
+		if err != nil {
+			return err
+		}
+		out = append(out, Row{TID: tid, Values: data})
+		return nil
+	})
+	return out, err
+}
+
+// ScanMatching returns the live rows match accepts, like ScanRows, for
+// checking keys without an index: the busy tuples match accepts are
+// waited for first, deleted ones too.
+func (t *Table) ScanMatching(match func(values []any) bool) ([]Row, error) {
+	for {
+		var out []Row
+		var busy TID
+		err := t.scan(func(tid TID, tup *Tuple) error {
+			data, err := t.decodeTuple(tup)
+			if err != nil || !match(data) {
+				return err
+			}
+			if t.busy(tid) {
+				busy = tid
+				return errBusy
+			}
+			if tup.Flags&TupleFlagDeleted == 0 {
+				out = append(out, Row{TID: tid, Values: data})
+			}
+			return nil
+		})
+		if err != errBusy {
+			return out, err
+		}
+		if err := t.changes.Wait(busy); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// errBusy stops a scan at a busy tuple.
+var errBusy = errors.New("busy tuple")
+
+// scan calls fn with every tuple of the table in order, deleted ones
+// included, reading each page under its latch.
+func (t *Table) scan(fn func(tid TID, tup *Tuple) error) error {
 	numPages, err := t.pager.NumPages()
 	if err != nil {
 		// if file doesn't exist or empty, return empty result
 		if err == io.EOF {
-			return nil, nil
+			return nil
 		}
-		return nil, err
+		return err
 	}
-	out := make([][]any, 0, 64)
 	for i := uint64(0); i < numPages; i++ {
+		unlatch := t.pager.rlatch(i)
 		pg, err := t.pager.ReadPage(i)
+		unlatch()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		slots := int(pg.getSlotCount())
 		for s := 0; s < slots; s++ {
-			rec, err := pg.GetRecord(s)
+			tup, err := pg.GetTuple(s)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			data, err := rowcodec.DecodeRow(t.schema, rec)
-			if err != nil {
-				return nil, err
+			if err := fn(TID{PageID: i, SlotID: uint32(s)}, tup); err != nil {
+				return err
 			}
-			out = append(out, data)
 		}
 	}
-	return out, nil
+	return nil
+}
+
+func (t *Table) recordInserted(tids []TID, done *Changes) error {
+	done.Inserted = append(done.Inserted, tids...)
+	if t.changes == nil {
+		return nil
+	}
+	t.changes.Inserted = append(t.changes.Inserted, tids...)
+	if t.changes.OnInsert != nil {
+		return t.changes.OnInsert(tids)
+	}
+	return nil
+}
+
+// DeleteRows marks the tuples as deleted, writing each touched page once.
+// Index entries are left in place; lookups must skip deleted tuples.
+func (t *Table) DeleteRows(tids []TID) error {
+	if err := t.setFlags(tids, TupleFlagDeleted); err != nil {
+		return err
+	}
+	if t.changes != nil {
+		t.changes.Deleted = append(t.changes.Deleted, tids...)
+	}
+	return nil
+}
+
+// Live reports whether none of the tuples is deleted, reading each page
+// once.
+func (t *Table) Live(tids []TID) (bool, error) {
+	var order []uint64
+	for _, tid := range tids {
+		order = append(order, tid.PageID)
+	}
+	slices.Sort(order)
+	order = slices.Compact(order)
+	pages := make(map[uint64]*Page, len(order))
+	for _, id := range order {
+		unlatch := t.pager.rlatch(id)
+		pg, err := t.pager.ReadPage(id)
+		unlatch()
+		if err != nil {
+			return false, fmt.Errorf("read page %d: %w", id, err)
+		}
+		pages[id] = pg
+	}
+	for _, tid := range tids {
+		tup, err := pages[tid.PageID].GetTuple(int(tid.SlotID))
+		if err != nil {
+			return false, err
+		}
+		if tup.Flags&TupleFlagDeleted != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Undo reverts the changes recorded in c: the tuples written are deleted
+// and the tuples deleted are live again, except those c also wrote.
+func (t *Table) Undo(c *Changes) error {
+	if err := t.setFlags(c.Inserted, TupleFlagDeleted); err != nil {
+		return err
+	}
+	inserted := make(map[TID]bool, len(c.Inserted))
+	for _, tid := range c.Inserted {
+		inserted[tid] = true
+	}
+	var restored []TID
+	for _, tid := range c.Deleted {
+		if !inserted[tid] {
+			restored = append(restored, tid)
+		}
+	}
+	return t.setFlags(restored, TupleFlagNormal)
+}
+
+// setFlags sets the flags of the tuples, writing each touched page once.
+// The pages are latched in order until all are written.
+func (t *Table) setFlags(tids []TID, flags uint16) error {
+	var order []uint64
+	for _, tid := range tids {
+		order = append(order, tid.PageID)
+	}
+	slices.Sort(order)
+	order = slices.Compact(order)
+	for _, id := range order {
+		defer t.pager.latch(id)()
+	}
+
+	pages := make(map[uint64]*Page, len(order))
+	for _, id := range order {
+		pg, err := t.pager.ReadPage(id)
+		if err != nil {
+			return fmt.Errorf("read page %d: %w", id, err)
+		}
+		pages[id] = pg
+	}
+	for _, tid := range tids {
+		if err := pages[tid.PageID].setTupleFlags(int(tid.SlotID), flags); err != nil {
+			return err
+		}
+	}
+	for _, id := range order {
+		if err := t.pager.WritePage(pages[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeTuple decodes a row under the schema version it was written with.
+func (t *Table) decodeTuple(tup *Tuple) ([]any, error) {
+	return rowcodec.DecodeRowVersion(t.schema, int(tup.Version), tup.Data)
 }
 
 func (t *Table) ResolveColumns(requested []string) ([]int, []string, error) {
@@ -212,14 +746,16 @@ func (t *Table) ResolveColumn(column string) (int, error) {
 }
 
 func (t *Table) GetTupleByTID(tid TID) (*Tuple, error) {
+	unlatch := t.pager.rlatch(tid.PageID)
 	pg, err := t.pager.ReadPage(tid.PageID)
+	unlatch()
 	if err != nil {
 		return nil, err
 	}
 	return pg.GetTuple(int(tid.SlotID))
 }
 
-func (t *Table) CreateIndex(name, column string) error {
+func (t *Table) CreateIndex(name, column string) (err error) {
 	colIdx := -1
 	for i, c := range t.schema.Columns {
 		if c.Name == column {
@@ -231,11 +767,26 @@ func (t *Table) CreateIndex(name, column string) error {
 		return fmt.Errorf("column %q does not exist", column)
 	}
 
-	indexPath := filepath.Join(t.dataDir, fmt.Sprintf("%s_%s.idx", t.name, name))
+	// the index is unique if the catalog says so
+	unique := t.schema.Indexes[name] != nil && t.schema.Indexes[name].Unique
+	t.indexMu.Lock()
+	if loaded, ok := t.Indexes[name]; ok {
+		loaded.Pager.Close()
+		delete(t.Indexes, name)
+	}
+	t.indexMu.Unlock()
+
+	indexPath := IndexPath(t.dataDir, t.name, name)
 	pager := NewPager(indexPath)
+	// the index is cached once it is complete; until then it is closed
+	// on any error
+	defer func() {
+		if err != nil {
+			pager.Close()
+		}
+	}()
 	idx, err := NewIndex(pager)
 	if err != nil {
-		pager.Close() // Close pager before returning error to avoid resource leak
 		return err
 	}
 
@@ -245,34 +796,48 @@ func (t *Table) CreateIndex(name, column string) error {
 	if err != nil {
 		if err == io.EOF {
 			// Empty table, just store the empty index
-			t.Indexes[name] = idx
+			t.addIndex(name, idx)
 			return nil
 		}
 		return fmt.Errorf("failed to get page count: %w", err)
 	}
 
 	for pageID := uint64(0); pageID < numPages; pageID++ {
+		unlatch := t.pager.rlatch(pageID)
 		pg, err := t.pager.ReadPage(pageID)
+		unlatch()
 		if err != nil {
 			return fmt.Errorf("failed to read page %d: %w", pageID, err)
 		}
 		slots := int(pg.getSlotCount())
 		for slotID := 0; slotID < slots; slotID++ {
-			rec, err := pg.GetRecord(slotID)
-			if err != nil {
-				// Skip corrupted records
+			tup, err := pg.GetTuple(slotID)
+			if err != nil || tup.Flags&TupleFlagDeleted != 0 {
+				// Skip corrupted and deleted records
 				continue
 			}
-			row, err := rowcodec.DecodeRow(t.schema, rec)
+			row, err := t.decodeTuple(tup)
 			if err != nil {
 				// Skip rows that can't be decoded
 				continue
 			}
+			if row[colIdx] == nil {
+				continue
+			}
 			tid := TID{PageID: pageID, SlotID: uint32(slotID)}
 			b, err := rowcodec.EncodeValue(t.schema, colIdx, row[colIdx])
 			if err != nil {
 				return fmt.Errorf("failed to encode value: %w", err)
 			}
+			if unique {
+				dups, err := idx.Search(b)
+				if err != nil {
+					return fmt.Errorf("failed to search index: %w", err)
+				}
+				if len(dups) > 0 {
+					return fmt.Errorf("could not create unique index %q: key (%s)=(%v) is duplicated", name, column, row[colIdx])
+				}
+			}
 			if err := idx.Insert(b, tid); err != nil {
 				return fmt.Errorf("failed to insert into index: %w", err)
 			}
@@ -280,17 +845,25 @@ func (t *Table) CreateIndex(name, column string) error {
 	}
 
 	// Store index in cache
-	t.Indexes[name] = idx
+	t.addIndex(name, idx)
 	return nil
 }
 
+func (t *Table) addIndex(name string, idx *Index) {
+	t.indexMu.Lock()
+	defer t.indexMu.Unlock()
+	t.Indexes[name] = idx
+}
+
 func (t *Table) GetIndex(name string) (*Index, error) {
+	t.indexMu.Lock()
+	defer t.indexMu.Unlock()
 	// Check cache first
 	if idx, ok := t.Indexes[name]; ok {
 		return idx, nil
 	}
 	// Try to load it
-	indexPath := filepath.Join(t.dataDir, fmt.Sprintf("%s_%s.idx", t.name, name))
+	indexPath := IndexPath(t.dataDir, t.name, name)
 	pager := NewPager(indexPath)
 	idx, err := NewIndex(pager)
 	if err != nil {
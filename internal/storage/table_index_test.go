@@ -2,6 +2,7 @@ package storage
 
 import (
 	"justasimpletoydb/internal/catalog"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -306,3 +307,56 @@ func TestTable_GetIndex_LoadsIfNotCached(t *testing.T) {
 	}
 }
 
+func TestTable_DropIndex_RemovesFileAndCache(t *testing.T) {
+	table, tmpDir := setupTestTable(t)
+	defer table.Close()
+
+	if err := table.CreateIndex("id_idx", "id"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	indexPath := IndexPath(tmpDir, "test", "id_idx")
+	if _, err := os.Stat(indexPath); err != nil {
+		t.Fatalf("Index file not created: %v", err)
+	}
+
+	if err := table.DropIndex("id_idx"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, ok := table.Indexes["id_idx"]; ok {
+		t.Error("Dropped index still cached")
+	}
+	if _, err := os.Stat(indexPath); !os.IsNotExist(err) {
+		t.Errorf("Index file still exists: %v", err)
+	}
+
+	// Dropping an index whose file is already gone is not an error
+	if err := table.DropIndex("id_idx"); err != nil {
+		t.Errorf("Expected no error for missing index file, got %v", err)
+	}
+}
+
+func TestTable_Drop_RemovesAllFiles(t *testing.T) {
+	table, tmpDir := setupTestTable(t)
+
+	if err := table.InsertRow([]any{1, "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if err := table.CreateIndex("id_idx", "id"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := table.CreateIndex("name_idx", "name"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	if err := table.Drop(); err != nil {
+		t.Fatalf("Failed to drop table: %v", err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	for _, e := range entries {
+		t.Errorf("Unexpected file left after drop: %s", e.Name())
+	}
+}
@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"errors"
+	"justasimpletoydb/internal/catalog"
+	"justasimpletoydb/internal/engine/rowcodec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTable_ReadAllRows_AfterSchemaChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	cat := catalog.NewCatalog(filepath.Join(tmpDir, "catalog.json"))
+	schema := &catalog.TableSchema{
+		Name: "test",
+		Columns: []catalog.Column{
+			{Name: "id", Type: catalog.TypeInt},
+			{Name: "name", Type: catalog.TypeText},
+		},
+		Indexes: make(map[string]*catalog.Index),
+	}
+	if err := cat.CreateTable(schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	table, err := NewTable("test", filepath.Join(tmpDir, "test.tbl"), schema)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	defer table.Close()
+
+	if err := table.InsertRow([]any{1, "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if err := cat.AddColumn("test", catalog.Column{Name: "age", Type: catalog.TypeInt, Missing: 30}); err != nil {
+		t.Fatalf("Failed to add column: %v", err)
+	}
+	if err := table.InsertRow([]any{2, "Bob", 40}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if _, err := cat.DropColumn("test", "name"); err != nil {
+		t.Fatalf("Failed to drop column: %v", err)
+	}
+	if err := table.InsertRow([]any{3, 50}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	rows, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	expected := [][]any{{1, 30}, {2, 40}, {3, 50}}
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d rows, got %d", len(expected), len(rows))
+	}
+	for i, row := range rows {
+		if len(row) != 2 || row[0] != expected[i][0] || row[1] != expected[i][1] {
+			t.Errorf("Row %d: expected %v, got %v", i, expected[i], row)
+		}
+	}
+}
+
+func TestTable_InsertRows_SpansPagesAndIndexes(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+
+	if err := table.CreateIndex("id_idx", "id"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	table.schema.Indexes["id_idx"] = &catalog.Index{Name: "id_idx", ColumnName: "id"}
+
+	// ~1KB rows, so the batch needs several 16KB pages
+	name := string(make([]byte, 1000))
+	rows := make([][]any, 100)
+	for i := range rows {
+		rows[i] = []any{i, name}
+	}
+	if err := table.InsertRows(rows); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+
+	numPages, err := table.pager.NumPages()
+	if err != nil {
+		t.Fatalf("Failed to get page count: %v", err)
+	}
+	if numPages < 2 {
+		t.Errorf("Expected rows to span several pages, got %d", numPages)
+	}
+
+	read, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(read) != len(rows) {
+		t.Fatalf("Expected %d rows, got %d", len(rows), len(read))
+	}
+	for i, row := range read {
+		if row[0] != i {
+			t.Errorf("Row %d: expected id %d, got %v", i, i, row[0])
+		}
+	}
+
+	idx, err := table.GetIndex("id_idx")
+	if err != nil {
+		t.Fatalf("Failed to get index: %v", err)
+	}
+	key, _ := rowcodec.EncodeValue(table.schema, 0, 99)
+	tids, err := idx.Search(key)
+	if err != nil {
+		t.Fatalf("Failed to search index: %v", err)
+	}
+	if len(tids) != 1 || tids[0].PageID != numPages-1 {
+		t.Errorf("Expected last row on last page, got %v", tids)
+	}
+}
+
+func TestTable_InsertRows_EncodeErrorWritesNothing(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+
+	err := table.InsertRows([][]any{{1, "ok"}, {"bad", "row"}})
+	if err == nil {
+		t.Fatal("Expected encode error")
+	}
+	rows, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("Expected no rows after failed batch, got %d", len(rows))
+	}
+}
+
+func TestTable_InsertRows_OversizedRowWritesNothing(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+
+	huge := string(make([]byte, PageSize))
+	err := table.InsertRows([][]any{{1, "ok"}, {2, huge}})
+	if err == nil {
+		t.Fatal("Expected error for a row larger than a page")
+	}
+	rows, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("Expected no rows after failed batch, got %d", len(rows))
+	}
+}
+
+func TestTable_DeleteRows_HidesRows(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+
+	for i := 1; i <= 4; i++ {
+		if err := table.InsertRow([]any{i, "x"}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+	rows, err := table.ScanRows()
+	if err != nil {
+		t.Fatalf("Failed to scan rows: %v", err)
+	}
+	if err := table.DeleteRows([]TID{rows[1].TID, rows[3].TID}); err != nil {
+		t.Fatalf("Failed to delete rows: %v", err)
+	}
+
+	remaining, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(remaining) != 2 || remaining[0][0] != 1 || remaining[1][0] != 3 {
+		t.Errorf("Expected rows 1 and 3, got %v", remaining)
+	}
+
+	tup, err := table.GetTupleByTID(rows[1].TID)
+	if err != nil {
+		t.Fatalf("Failed to get tuple: %v", err)
+	}
+	if tup.Flags&TupleFlagDeleted == 0 {
+		t.Error("Expected deleted flag on tuple")
+	}
+}
+
+func TestTable_UniqueIndex_RejectsDuplicates(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+	table.schema.Indexes["id_key"] = &catalog.Index{Name: "id_key", ColumnName: "id", Unique: true}
+	if err := table.CreateIndex("id_key", "id"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	if err := table.InsertRows([][]any{{1, "a"}, {2, "b"}, {nil, "c"}, {nil, "d"}}); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+	var violation *UniqueViolation
+	if err := table.InsertRow([]any{1, "dup"}); !errors.As(err, &violation) || violation.Index != "id_key" {
+		t.Errorf("Expected unique violation on id_key, got %v", err)
+	}
+	if err := table.InsertRows([][]any{{3, "x"}, {3, "y"}}); !errors.As(err, &violation) {
+		t.Errorf("Expected unique violation within the batch, got %v", err)
+	}
+
+	rows, err := table.IndexLookup("id_key", 2)
+	if err != nil {
+		t.Fatalf("Failed to look up key: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Values[1] != "b" {
+		t.Fatalf("Expected the row with id 2, got %v", rows)
+	}
+
+	// replacing a row may keep its key
+	if err := table.ReplaceRows([]TID{rows[0].TID}, [][]any{{2, "b2"}}); err != nil {
+		t.Fatalf("Failed to replace row: %v", err)
+	}
+	rows, err = table.IndexLookup("id_key", 2)
+	if err != nil {
+		t.Fatalf("Failed to look up key: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Values[1] != "b2" {
+		t.Errorf("Expected only the new version of id 2, got %v", rows)
+	}
+
+	all, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("Expected 4 rows, got %d", len(all))
+	}
+}
+
+func TestTable_CreateUniqueIndex_DuplicateKeysFail(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+	if err := table.InsertRows([][]any{{1, "a"}, {1, "b"}}); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+	table.schema.Indexes["id_key"] = &catalog.Index{Name: "id_key", ColumnName: "id", Unique: true}
+	if err := table.CreateIndex("id_key", "id"); err == nil {
+		t.Error("Expected error creating a unique index over duplicate keys")
+	}
+}
+
+func TestTable_Undo_RevertsTrackedChanges(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+
+	if err := table.InsertRows([][]any{{1, "a"}, {2, "b"}}); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+	before, err := table.ScanRows()
+	if err != nil {
+		t.Fatalf("Failed to scan rows: %v", err)
+	}
+
+	var changes Changes
+	table.Track(&changes)
+	if err := table.ReplaceRows([]TID{before[0].TID}, [][]any{{1, "changed"}}); err != nil {
+		t.Fatalf("Failed to replace row: %v", err)
+	}
+	if err := table.InsertRow([]any{3, "c"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	rows, err := table.ScanRows()
+	if err != nil {
+		t.Fatalf("Failed to scan rows: %v", err)
+	}
+	// delete a row written under tracking; undo must not bring it back
+	if err := table.DeleteRows([]TID{rows[2].TID}); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	if len(changes.Inserted) != 2 || len(changes.Deleted) != 2 {
+		t.Fatalf("Expected 2 inserted and 2 deleted tuples, got %+v", changes)
+	}
+
+	table.Track(nil)
+	if err := table.Undo(&changes); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+	after, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(after) != 2 || after[0][1] != "a" || after[1][1] != "b" {
+		t.Errorf("Expected the rows before tracking, got %v", after)
+	}
+}
+
+func TestTable_Track_OnInsertAndLive(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+
+	var seen []TID
+	changes := Changes{OnInsert: func(tids []TID) error {
+		seen = append(seen, tids...)
+		return nil
+	}}
+	table.Track(&changes)
+	if err := table.InsertRows([][]any{{1, "a"}, {2, "b"}}); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+	table.Track(nil)
+	if len(seen) != 2 || seen[0] != changes.Inserted[0] || seen[1] != changes.Inserted[1] {
+		t.Fatalf("OnInsert saw %v, want %v", seen, changes.Inserted)
+	}
+
+	if live, err := table.Live(seen); err != nil || !live {
+		t.Fatalf("Live = %v, %v, want true", live, err)
+	}
+	if err := table.DeleteRows(seen[1:]); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	if live, err := table.Live(seen); err != nil || live {
+		t.Errorf("Live with a deleted tuple = %v, %v, want false", live, err)
+	}
+	if live, err := table.Live(seen[:1]); err != nil || !live {
+		t.Errorf("Live of the remaining tuple = %v, %v, want true", live, err)
+	}
+}
+
+func TestTable_Track_OnInsertErrorUndoesWrite(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+	if err := table.InsertRows([][]any{{1, "a"}}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	refused := errors.New("refused")
+	table.Track(&Changes{OnInsert: func(tids []TID) error { return refused }})
+	if err := table.InsertRows([][]any{{2, "b"}, {3, "c"}}); !errors.Is(err, refused) {
+		t.Fatalf("Expected the error of OnInsert, got %v", err)
+	}
+	table.Track(nil)
+	rows, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 1 || rows[0][1] != "a" {
+		t.Errorf("Expected only the row before tracking, got %v", rows)
+	}
+}
+
+func TestTable_Handle_SharesFilesAndReleases(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+
+	released := 0
+	h := table.Handle(func() { released++ })
+	var changes Changes
+	h.Track(&changes)
+	if err := h.InsertRows([][]any{{1, "a"}}); err != nil {
+		t.Fatalf("Failed to insert through handle: %v", err)
+	}
+	if err := h.Close(); err != nil || released != 1 {
+		t.Fatalf("Close = %v, released %d times, want once", err, released)
+	}
+	h.Close()
+	if released != 1 {
+		t.Errorf("Closing a handle again released it %d times", released)
+	}
+	if len(changes.Inserted) != 1 {
+		t.Errorf("Handle tracked %d inserts, want 1", len(changes.Inserted))
+	}
+
+	// the table's files are still open and hold the handle's row
+	rows, err := table.ScanRows()
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("ScanRows = %d rows, %v, want 1", len(rows), err)
+	}
+	if err := table.Sync(); err != nil {
+		t.Errorf("Failed to sync: %v", err)
+	}
+}
+
+func TestTable_InsertRows_IndexFailureUndoesBatch(t *testing.T) {
+	table, _ := setupTestTable(t)
+	defer table.Close()
+	if err := table.CreateIndex("name_idx", "name"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	table.schema.Indexes["name_idx"] = &catalog.Index{Name: "name_idx", ColumnName: "name"}
+	if err := table.InsertRows([][]any{{1, "kept"}}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	// two keys this long don't fit in one index page, so indexing the
+	// third row fails after the batch was appended
+	long := strings.Repeat("x", PageSize*2/3)
+	var changes Changes
+	table.Track(&changes)
+	err := table.InsertRows([][]any{{2, "short"}, {3, long + "a"}, {4, long + "b"}})
+	table.Track(nil)
+	if err == nil {
+		t.Fatal("Expected indexing the batch to fail")
+	}
+
+	rows, err := table.ReadAllRows()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 1 || rows[0][0] != 1 {
+		t.Errorf("Expected only the row before the batch, got %v", rows)
+	}
+	if found, err := table.IndexLookup("name_idx", "short"); err != nil || len(found) != 0 {
+		t.Errorf("Expected the undone row not to be found, got %v, %v", found, err)
+	}
+	if err := table.Undo(&changes); err != nil {
+		t.Errorf("Failed to undo the transaction's changes after the batch: %v", err)
+	}
+}
@@ -5,22 +5,25 @@ import (
 	"fmt"
 )
 
-const tupleHdrSize = 12 // 8 (xmin) + 2 (flags) + 2 (reserved)
+const tupleHdrSize = 12 // 8 (xmin) + 2 (flags) + 2 (schema version)
 
 type Tuple struct {
-	Xmin  uint64
-	Flags uint16
-	Data  []byte
+	Xmin    uint64
+	Flags   uint16
+	Version uint16 // schema version the row was encoded with
+	Data    []byte
 }
 
-func encodeTupleHeader(buf []byte, xmin uint64, flags uint16) {
+func encodeTupleHeader(buf []byte, xmin uint64, flags uint16, version uint16) {
 	binary.LittleEndian.PutUint64(buf[0:8], xmin)
 	binary.LittleEndian.PutUint16(buf[8:10], flags)
+	binary.LittleEndian.PutUint16(buf[10:12], version)
 }
 
-func decodeTupleHeader(buf []byte) (xmin uint64, flags uint16) {
+func decodeTupleHeader(buf []byte) (xmin uint64, flags uint16, version uint16) {
 	xmin = binary.LittleEndian.Uint64(buf[0:8])
 	flags = binary.LittleEndian.Uint16(buf[8:10])
+	version = binary.LittleEndian.Uint16(buf[10:12])
 	return
 }
 
@@ -39,14 +42,14 @@ func (p *Page) GetTuple(slotIdx int) (*Tuple, error) {
 	if length < tupleHdrSize {
 		return nil, fmt.Errorf("tuple too small")
 	}
-	xmin, flags := decodeTupleHeader(p.Data[hdrOff : hdrOff+tupleHdrSize])
+	xmin, flags, version := decodeTupleHeader(p.Data[hdrOff : hdrOff+tupleHdrSize])
 	payloadLen := length - tupleHdrSize
 	out := make([]byte, payloadLen)
 	copy(out, p.Data[hdrOff+tupleHdrSize:hdrOff+tupleHdrSize+payloadLen])
-	return &Tuple{Xmin: xmin, Flags: flags, Data: out}, nil
+	return &Tuple{Xmin: xmin, Flags: flags, Version: version, Data: out}, nil
 }
 
-func (p *Page) InsertTouple(payload []byte, xmin uint64, flags uint16) (int, error) {
+func (p *Page) InsertTouple(payload []byte, xmin uint64, flags uint16, version uint16) (int, error) {
 	n := len(payload) + tupleHdrSize
 	if !p.CanInsert(n) {
 		return -1, fmt.Errorf("not enough space in page %d: need %d, have %d", p.ID, n+slotEntrySz, p.availableSpace())
@@ -54,7 +57,7 @@ func (p *Page) InsertTouple(payload []byte, xmin uint64, flags uint16) (int, err
 
 	dataEnd := int(p.getDataEnd())
 
-	encodeTupleHeader(p.Data[dataEnd:dataEnd+tupleHdrSize], xmin, flags)
+	encodeTupleHeader(p.Data[dataEnd:dataEnd+tupleHdrSize], xmin, flags, version)
 
 	copy(p.Data[dataEnd+tupleHdrSize:dataEnd+tupleHdrSize+len(payload)], payload)
 	newDataEnd := dataEnd + n
@@ -68,3 +71,18 @@ func (p *Page) InsertTouple(payload []byte, xmin uint64, flags uint16) (int, err
 	p.setSlotCount(uint32(slotCount + 1))
 	return slotCount, nil
 }
+
+// setTupleFlags overwrites the flags in the header of a stored tuple.
+func (p *Page) setTupleFlags(slotIdx int, flags uint16) error {
+	slotCount := int(p.getSlotCount())
+	if slotIdx < 0 || slotIdx >= slotCount {
+		return fmt.Errorf("slot index out of range")
+	}
+	slotOffset := PageSize - ((slotIdx + 1) * slotEntrySz)
+	offset := int(binary.LittleEndian.Uint32(p.Data[slotOffset : slotOffset+4]))
+	if offset+tupleHdrSize > PageSize {
+		return fmt.Errorf("corrupt slot (out of bounds)")
+	}
+	binary.LittleEndian.PutUint16(p.Data[offset+8:offset+10], flags)
+	return nil
+}
@@ -0,0 +1,343 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"justasimpletoydb/internal/protocol"
+)
+
+// conn is a session on the server. database/sql uses it from one goroutine
+// at a time.
+type conn struct {
+	nc      net.Conn
+	pc      *protocol.Conn
+	txState byte
+	rows    *rows // rows still streaming from the server, if any
+	stmts   int   // statements prepared on the server so far, to name them
+	// broken is set once the connection can't be used any more, such as
+	// after a context was cancelled while waiting for the server.
+	broken atomic.Bool
+}
+
+var (
+	_ driver.Conn               = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.Validator          = (*conn)(nil)
+	_ driver.SessionResetter    = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext prepares a query with placeholders on the server, which
+// keeps it parsed and typed for the session. A query without placeholders
+// is sent whole on every run instead, so it can be any statement.
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	n, err := countPlaceholders(query)
+	if err != nil {
+		return nil, err
+	}
+	s := &stmt{c: c, query: query, numInput: n}
+	if n == 0 {
+		return s, nil
+	}
+	c.stmts++
+	s.name = fmt.Sprintf("sqldriver_%d", c.stmts)
+	if _, err := c.exec(ctx, "PREPARE "+s.name+" AS "+query); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *conn) Close() error {
+	if !c.broken.Load() {
+		c.pc.Send(&protocol.Terminate{})
+		c.pc.Flush()
+	}
+	c.broken.Store(true)
+	return c.nc.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a transaction block. The server has one isolation level,
+// and no read-only transactions.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.Isolation != driver.IsolationLevel(0) {
+		return nil, errors.New("sqldriver: isolation levels are not supported")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sqldriver: read-only transactions are not supported")
+	}
+	if _, err := c.exec(ctx, "BEGIN"); err != nil {
+		return nil, err
+	}
+	return &tx{c: c}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	sql, err := bind(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.exec(ctx, sql)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	sql, err := bind(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.query(ctx, sql)
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	_, err := c.exec(ctx, "")
+	return err
+}
+
+func (c *conn) IsValid() bool {
+	return !c.broken.Load()
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if c.broken.Load() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// result is the result of Exec: the rows affected by the last statement.
+type result struct {
+	affected int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, errors.New("sqldriver: LastInsertId is not supported, use RETURNING")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+// exec runs a query and reads its answers to the end. The first error
+// of a statement is returned.
+func (c *conn) exec(ctx context.Context, sql string) (driver.Result, error) {
+	var res result
+	err := c.request(ctx, sql, func() error {
+		var firstErr error
+		for {
+			m, err := c.pc.Receive()
+			if err != nil {
+				return err
+			}
+			switch m := m.(type) {
+			case *protocol.Complete:
+				res.affected = int64(m.Affected)
+			case *protocol.Error:
+				if firstErr == nil {
+					firstErr = m
+				}
+			case *protocol.Ready:
+				c.txState = m.TxState
+				return firstErr
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// query runs a query and returns its rows as they arrive; answers to the
+// statements after the first are read and dropped when they are closed.
+func (c *conn) query(ctx context.Context, sql string) (driver.Rows, error) {
+	r := &rows{c: c, ctx: ctx}
+	err := c.request(ctx, sql, func() error {
+		return r.start()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !r.done {
+		c.rows = r
+	}
+	return r, nil
+}
+
+// request sends a query and calls read to read the answers, giving up
+// when ctx is done. Rows of an earlier query still streaming are read to
+// the end first, and stay readable.
+func (c *conn) request(ctx context.Context, sql string, read func() error) error {
+	if c.broken.Load() {
+		return driver.ErrBadConn
+	}
+	return wrapError(c.withContext(ctx, func() error {
+		if c.rows != nil {
+			if err := c.rows.buffer(); err != nil {
+				return err
+			}
+		}
+		if err := c.pc.Send(&protocol.Query{SQL: sql}); err != nil {
+			return err
+		}
+		if err := c.pc.Flush(); err != nil {
+			return err
+		}
+		return read()
+	}))
+}
+
+// withContext runs fn, which talks to the server, and interrupts it when
+// ctx is done. The server can't cancel a statement, so the connection is
+// then broken and dropped.
+func (c *conn) withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	interrupted := make(chan struct{})
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.broken.Store(true)
+				c.nc.SetDeadline(time.Unix(1, 0))
+				close(interrupted)
+			case <-stop:
+			}
+		}()
+	}
+	err := fn()
+	close(stop)
+	select {
+	case <-interrupted:
+		return ctx.Err()
+	default:
+	}
+	if err != nil {
+		var serverErr *protocol.Error
+		if !errors.As(err, &serverErr) {
+			// the session is out of step with the server
+			c.broken.Store(true)
+		}
+	}
+	return err
+}
+
+// awaitReady reads up to the Ready ending a query.
+func (c *conn) awaitReady() (byte, error) {
+	for {
+		m, err := c.pc.Receive()
+		if err != nil {
+			return 0, err
+		}
+		if ready, ok := m.(*protocol.Ready); ok {
+			c.txState = ready.TxState
+			return ready.TxState, nil
+		}
+	}
+}
+
+// tx is a transaction block.
+type tx struct {
+	c *conn
+}
+
+// Commit ends the transaction block. A block a statement failed in is
+// rolled back instead, which is reported as an error.
+func (t *tx) Commit() error {
+	failed := t.c.txState == protocol.TxFailed
+	if _, err := t.c.exec(context.Background(), "COMMIT"); err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("sqldriver: transaction rolled back after an error")
+	}
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	_, err := t.c.exec(context.Background(), "ROLLBACK")
+	return err
+}
+
+// stmt is a prepared query. One with placeholders is prepared on the
+// server as name and run with EXECUTE; others are sent whole on every run.
+type stmt struct {
+	c        *conn
+	query    string
+	name     string
+	numInput int
+}
+
+var (
+	_ driver.StmtExecContext  = (*stmt)(nil)
+	_ driver.StmtQueryContext = (*stmt)(nil)
+)
+
+func (s *stmt) Close() error {
+	if s.name == "" || s.c.broken.Load() {
+		return nil
+	}
+	_, err := s.c.exec(context.Background(), "DEALLOCATE "+s.name)
+	return err
+}
+
+func (s *stmt) NumInput() int { return s.numInput }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.name == "" {
+		return s.c.ExecContext(ctx, s.query, args)
+	}
+	sql, err := execute(s.name, s.numInput, args)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.exec(ctx, sql)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if s.name == "" {
+		return s.c.QueryContext(ctx, s.query, args)
+	}
+	sql, err := execute(s.name, s.numInput, args)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.query(ctx, sql)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+func errorf(format string, args ...any) error {
+	return fmt.Errorf("sqldriver: "+format, args...)
+}
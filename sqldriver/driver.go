@@ -0,0 +1,95 @@
+// Package sqldriver is a database/sql driver for JustASimpleToyDB, talking
+// to cmd/server over its client protocol. It registers itself as "toydb":
+//
+//	db, err := sql.Open("toydb", "localhost:4000")
+//
+// The data source name is the host:port of the server; an empty one means
+// localhost:4000. Queries take ? or $1 placeholders, whose arguments are
+// sent as quoted literals. INT columns scan as int64, TEXT as string and
+// BOOLEAN as bool.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net"
+
+	"justasimpletoydb/internal/protocol"
+)
+
+// DefaultAddr is the address of a server when the data source name is
+// empty.
+const DefaultAddr = "localhost:4000"
+
+func init() {
+	sql.Register("toydb", &Driver{})
+}
+
+// Driver is the database/sql driver.
+type Driver struct{}
+
+// Open opens a connection to the server at the address name.
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	c, _ := d.OpenConnector(name)
+	return c.Connect(context.Background())
+}
+
+// OpenConnector returns a connector to the server at the address name, as
+// sql.OpenDB takes.
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	if name == "" {
+		name = DefaultAddr
+	}
+	return &Connector{Addr: name}, nil
+}
+
+// Connector opens connections to a server.
+type Connector struct {
+	Addr string
+}
+
+// Connect dials the server and opens a session, giving up when ctx is done.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var dialer net.Dialer
+	nc, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{nc: nc, pc: protocol.NewConn(nc)}
+	err = cn.withContext(ctx, func() error {
+		if err := cn.pc.Handshake(); err != nil {
+			return err
+		}
+		_, err := cn.awaitReady()
+		return err
+	})
+	if err != nil {
+		nc.Close()
+		return nil, wrapError(err)
+	}
+	return cn, nil
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// Error is an error the server reported for a statement.
+type Error struct {
+	Code     string // SQLSTATE code, e.g. 23505 for a unique violation
+	Message  string
+	Position int // byte offset in the query of a syntax error, or -1
+}
+
+func (e *Error) Error() string {
+	return e.Message + " (SQLSTATE " + e.Code + ")"
+}
+
+// wrapError turns errors of the server into *Error.
+func wrapError(err error) error {
+	if e, ok := err.(*protocol.Error); ok {
+		return &Error{Code: e.Code, Message: e.Message, Position: e.Position}
+	}
+	return err
+}
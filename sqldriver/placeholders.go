@@ -0,0 +1,158 @@
+package sqldriver
+
+import (
+	"database/sql/driver"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// placeholder is a ? or $n in a query, outside quotes.
+type placeholder struct {
+	start, end int // byte range in the query
+	n          int // 1-based number of the argument
+}
+
+// placeholders finds the placeholders of a query. A query uses either ?,
+// numbered in order, or $n, and not both.
+func placeholders(query string) ([]placeholder, error) {
+	var found []placeholder
+	var quote byte
+	positional, numbered := false, false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			// a doubled quote is an escaped one, and keeps the quote open
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?':
+			positional = true
+			found = append(found, placeholder{start: i, end: i + 1, n: len(found) + 1})
+		case ch == '$':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n, err := strconv.Atoi(query[i+1 : j])
+			if err != nil || n < 1 {
+				return nil, errorf("invalid placeholder at offset %d", i)
+			}
+			numbered = true
+			found = append(found, placeholder{start: i, end: j, n: n})
+			i = j - 1
+		}
+	}
+	if positional && numbered {
+		return nil, errorf("query mixes ? and $n placeholders")
+	}
+	return found, nil
+}
+
+// countPlaceholders returns the number of arguments a query takes.
+func countPlaceholders(query string) (int, error) {
+	found, err := placeholders(query)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, p := range found {
+		n = max(n, p.n)
+	}
+	return n, nil
+}
+
+// bind replaces the placeholders of a query with the literals of args.
+func bind(query string, args []driver.NamedValue) (string, error) {
+	found, err := placeholders(query)
+	if err != nil {
+		return "", err
+	}
+	want := 0
+	for _, p := range found {
+		want = max(want, p.n)
+	}
+	if len(args) != want {
+		return "", errorf("query takes %d arguments, got %d", want, len(args))
+	}
+	if len(args) == 0 {
+		return query, nil
+	}
+	literals, err := literals(args)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	last := 0
+	for _, p := range found {
+		b.WriteString(query[last:p.start])
+		b.WriteString(literals[p.n-1])
+		last = p.end
+	}
+	b.WriteString(query[last:])
+	return b.String(), nil
+}
+
+// execute returns the EXECUTE of a statement prepared on the server as
+// name, taking numInput arguments, with the literals of args.
+func execute(name string, numInput int, args []driver.NamedValue) (string, error) {
+	if len(args) != numInput {
+		return "", errorf("query takes %d arguments, got %d", numInput, len(args))
+	}
+	literals, err := literals(args)
+	if err != nil {
+		return "", err
+	}
+	if len(literals) == 0 {
+		return "EXECUTE " + name, nil
+	}
+	return "EXECUTE " + name + "(" + strings.Join(literals, ", ") + ")", nil
+}
+
+// literals writes args as SQL, in the order of their ordinals.
+func literals(args []driver.NamedValue) ([]string, error) {
+	out := make([]string, len(args))
+	for _, arg := range args {
+		if arg.Name != "" {
+			return nil, errorf("named arguments are not supported: %s", arg.Name)
+		}
+		var err error
+		if out[arg.Ordinal-1], err = literal(arg.Value); err != nil {
+			return nil, errorf("argument %d: %v", arg.Ordinal, err)
+		}
+	}
+	return out, nil
+}
+
+// literal writes a value as SQL. Negative numbers are parenthesized, so
+// that no operator before them runs into their sign.
+func literal(v driver.Value) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		switch {
+		case v == math.MinInt64:
+			// its magnitude doesn't fit in a literal
+			return "(-9223372036854775807 - 1)", nil
+		case v < 0:
+			return "(" + strconv.FormatInt(v, 10) + ")", nil
+		default:
+			return strconv.FormatInt(v, 10), nil
+		}
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case []byte:
+		return literal(string(v))
+	default:
+		return "", errorf("unsupported type %T", v)
+	}
+}
@@ -0,0 +1,82 @@
+package sqldriver
+
+import (
+	"database/sql/driver"
+	"math"
+	"testing"
+)
+
+func args(values ...driver.Value) []driver.NamedValue {
+	return namedValues(values)
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []driver.NamedValue
+		want  string
+	}{
+		{"SELECT 1", nil, "SELECT 1"},
+		{"SELECT ?, ?", args(int64(1), "a"), "SELECT 1, 'a'"},
+		{"SELECT $2, $1, $2", args(true, nil), "SELECT NULL, TRUE, NULL"},
+		{"SELECT 3 - ?", args(int64(-2)), "SELECT 3 - (-2)"},
+		{"SELECT ?", args(int64(math.MinInt64)), "SELECT (-9223372036854775807 - 1)"},
+		{"SELECT ?", args("it's; DROP TABLE t"), "SELECT 'it''s; DROP TABLE t'"},
+		{"SELECT '?', \"$1\", 'it''s ?', ?", args([]byte("b")), "SELECT '?', \"$1\", 'it''s ?', 'b'"},
+	}
+	for _, tt := range tests {
+		got, err := bind(tt.query, tt.args)
+		if err != nil {
+			t.Errorf("bind(%q): %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("bind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestBind_Errors(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []driver.NamedValue
+	}{
+		{"SELECT ?, $1", args(int64(1))},
+		{"SELECT $0", args(int64(1))},
+		{"SELECT ?, ?", args(int64(1))},
+		{"SELECT $2", args(int64(1))},
+		{"SELECT ?", args(1.5)},
+		{"SELECT ?", []driver.NamedValue{{Name: "id", Ordinal: 1, Value: int64(1)}}},
+	}
+	for _, tt := range tests {
+		if got, err := bind(tt.query, tt.args); err == nil {
+			t.Errorf("bind(%q): expected error, got %q", tt.query, got)
+		}
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	tests := map[string]int{
+		"SELECT 1":             0,
+		"SELECT ?, ?":          2,
+		"SELECT $3, $1":        3,
+		"SELECT '$1', ?":       1,
+		"SELECT \"a?\" FROM t": 0,
+		"SELECT 'x''?''y', $1": 1,
+	}
+	for query, want := range tests {
+		if got, err := countPlaceholders(query); err != nil || got != want {
+			t.Errorf("countPlaceholders(%q) = %d, %v; want %d", query, got, err, want)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	got, err := execute("s1", 2, args("it's", int64(-1)))
+	if want := "EXECUTE s1('it''s', (-1))"; err != nil || got != want {
+		t.Errorf("execute = %q, %v; want %q", got, err, want)
+	}
+	if _, err := execute("s1", 2, args(int64(1))); err == nil {
+		t.Error("execute: expected error for a missing argument")
+	}
+}
@@ -0,0 +1,192 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"reflect"
+
+	"justasimpletoydb/internal/protocol"
+)
+
+// rows are the rows of the first statement of a query, read from the
+// server as they are scanned.
+type rows struct {
+	c       *conn
+	ctx     context.Context // of the query, which reading the rows honors
+	columns []string
+	types   []string
+	buf     [][]any
+	done    bool  // all rows of the statement are read
+	ready   bool  // all answers to the query are read
+	err     error // error of a later statement, reported after the rows
+}
+
+var (
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+)
+
+// start reads the answers up to the first rows. A statement failing before
+// any rows is returned as the query's error.
+func (r *rows) start() error {
+	for {
+		m, err := r.c.pc.Receive()
+		if err != nil {
+			return err
+		}
+		switch m := m.(type) {
+		case *protocol.Header:
+			r.columns, r.types = m.Columns, m.Types
+			return nil
+		case *protocol.Complete:
+			r.done = true
+			if err := r.finish(); err != nil {
+				return err
+			}
+			return r.err
+		case *protocol.Error:
+			r.done = true
+			if err := r.finish(); err != nil {
+				return err
+			}
+			return m
+		case *protocol.Ready:
+			r.c.txState = m.TxState
+			r.done, r.ready = true, true
+			return nil
+		}
+	}
+}
+
+// receive reads answers until more rows arrive or the statement is
+// complete.
+func (r *rows) receive() error {
+	for !r.done && len(r.buf) == 0 {
+		m, err := r.c.pc.Receive()
+		if err != nil {
+			return err
+		}
+		switch m := m.(type) {
+		case *protocol.RowBatch:
+			r.buf = m.Rows
+		case *protocol.Complete:
+			r.done = true
+			return r.finish()
+		case *protocol.Error:
+			r.done = true
+			r.err = m
+			return r.finish()
+		}
+	}
+	return nil
+}
+
+// finish reads the answers to the later statements up to the Ready,
+// keeping the first error.
+func (r *rows) finish() error {
+	for !r.ready {
+		m, err := r.c.pc.Receive()
+		if err != nil {
+			return err
+		}
+		switch m := m.(type) {
+		case *protocol.Error:
+			if r.err == nil {
+				r.err = m
+			}
+		case *protocol.Ready:
+			r.c.txState = m.TxState
+			r.ready = true
+		}
+	}
+	if r.c.rows == r {
+		r.c.rows = nil
+	}
+	return nil
+}
+
+// buffer reads the rows left into memory, freeing the connection for the
+// next query.
+func (r *rows) buffer() error {
+	for !r.done {
+		more := r.buf
+		r.buf = nil
+		if err := r.receive(); err != nil {
+			return err
+		}
+		r.buf = append(more, r.buf...)
+	}
+	return r.finish()
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+// Close drops the rows left.
+func (r *rows) Close() error {
+	if r.ready {
+		return nil
+	}
+	err := r.c.withContext(r.ctx, func() error {
+		for !r.done {
+			r.buf = nil
+			if err := r.receive(); err != nil {
+				return err
+			}
+		}
+		return r.finish()
+	})
+	r.buf = nil
+	if err != nil {
+		// the connection is left in the middle of the answers
+		r.c.broken.Store(true)
+		return err
+	}
+	return wrapError(r.err)
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.buf) == 0 && !r.done {
+		if err := r.c.withContext(r.ctx, r.receive); err != nil {
+			r.c.broken.Store(true)
+			return err
+		}
+	}
+	if len(r.buf) == 0 {
+		if r.err != nil {
+			return wrapError(r.err)
+		}
+		return io.EOF
+	}
+	row := r.buf[0]
+	r.buf = r.buf[1:]
+	for i, v := range row {
+		if n, ok := v.(int); ok {
+			v = int64(n)
+		}
+		dest[i] = v
+	}
+	return nil
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(i int) string {
+	if r.types[i] == "unknown" {
+		return ""
+	}
+	return r.types[i]
+}
+
+func (r *rows) ColumnTypeScanType(i int) reflect.Type {
+	switch r.types[i] {
+	case "INT":
+		return reflect.TypeOf(int64(0))
+	case "TEXT":
+		return reflect.TypeOf("")
+	case "BOOLEAN":
+		return reflect.TypeOf(false)
+	default:
+		return reflect.TypeOf((*any)(nil)).Elem()
+	}
+}
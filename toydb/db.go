@@ -0,0 +1,268 @@
+// Package toydb runs JustASimpleToyDB inside the calling process, without
+// cmd/server:
+//
+//	db, err := toydb.Open("data")
+//	defer db.Close()
+//	_, err = db.Exec("CREATE TABLE animals (id INT, name TEXT)")
+//	rows, err := db.Query("SELECT id, name FROM animals WHERE id > ?", 1)
+//	for rows.Next() {
+//		var id int
+//		var name string
+//		err = rows.Scan(&id, &name)
+//	}
+//
+// Arguments are bound to the $1 or ? placeholders of a statement as typed
+// values, never spliced into its text. Statements run one at a time. A transaction has the database to itself
+// until it ends: statements outside it wait, so a goroutine holding a
+// transaction must not use the DB directly.
+package toydb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"justasimpletoydb/internal/engine"
+	"justasimpletoydb/internal/executor"
+	"justasimpletoydb/internal/parser"
+	"justasimpletoydb/internal/processor"
+)
+
+// ErrClosed is returned when using a closed DB or a finished Tx.
+var ErrClosed = errors.New("toydb: database or transaction is closed")
+
+// DB is a database stored in a directory.
+type DB struct {
+	// mu is held for each statement, and for the whole of a transaction
+	mu     sync.Mutex
+	engine *engine.Engine
+	qp     processor.QueryProcessor
+	closed bool
+}
+
+// Open opens the database in dir, creating the directory if needed.
+func Open(dir string) (*DB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("toydb: %w", err)
+	}
+	e := engine.NewEngine(dir)
+	return &DB{engine: e, qp: processor.QueryProcessor{Exec: executor.NewExecutor(e)}}, nil
+}
+
+// Close closes the database, once running statements and any open
+// transaction are done, and flushes its files to disk.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	return errors.Join(db.qp.Exec.Close(), db.engine.Close())
+}
+
+// Result reports what a statement changed.
+type Result struct {
+	RowsAffected int
+	Message      string // e.g. "UPDATE 2", or "View v created"
+}
+
+// Exec runs one or more statements separated by semicolons and returns
+// the result of the last. Statements after one that fails don't run. With
+// args there must be one statement, whose parameters they are.
+func (db *DB) Exec(sql string, args ...any) (Result, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return Result{}, ErrClosed
+	}
+	return db.exec(sql, args)
+}
+
+// Query runs a statement returning rows, such as a SELECT or a statement
+// with RETURNING, with args for its parameters.
+func (db *DB) Query(sql string, args ...any) (*Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	return db.query(sql, args)
+}
+
+// Prepare parses a statement and types its parameters once, to run it
+// many times with Stmt.Exec or Stmt.Query.
+func (db *DB) Prepare(sql string) (*Stmt, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	p, err := db.prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{db: db, prep: p}, nil
+}
+
+// Begin starts a transaction, waiting for the one open to end. Writes of
+// the transaction are undone by Rollback; the catalog can't be changed
+// while it is open.
+func (db *DB) Begin() (*Tx, error) {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if _, err := db.exec("BEGIN", nil); err != nil {
+		db.mu.Unlock()
+		return nil, err
+	}
+	return &Tx{db: db}, nil
+}
+
+func (db *DB) exec(sql string, args []any) (Result, error) {
+	if len(args) > 0 {
+		p, err := db.prepare(sql)
+		if err != nil {
+			return Result{}, err
+		}
+		return db.execPrepared(p, args)
+	}
+	results, err := db.qp.RunAll(sql)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(results) == 0 {
+		return Result{}, nil
+	}
+	last := results[len(results)-1]
+	return Result{RowsAffected: last.Affected, Message: last.Message}, nil
+}
+
+func (db *DB) query(sql string, args []any) (*Rows, error) {
+	p, err := db.prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	return db.queryPrepared(p, args)
+}
+
+func (db *DB) prepare(sql string) (*executor.Prepared, error) {
+	stmts, err := parser.ParseAll(sql)
+	if err != nil {
+		return nil, err
+	}
+	if len(stmts) != 1 {
+		return nil, fmt.Errorf("toydb: expected one statement, got %d", len(stmts))
+	}
+	return db.qp.Exec.Prepare(stmts[0])
+}
+
+// bind binds args to the parameters of p, converting Go integers of every
+// size to int and []byte to string.
+func bind(p *executor.Prepared, args []any) (executor.Statement, error) {
+	values := make([]any, len(args))
+	for i, a := range args {
+		v, err := convertArg(a)
+		if err != nil {
+			return nil, fmt.Errorf("toydb: argument %d: %w", i+1, err)
+		}
+		values[i] = v
+	}
+	return p.Bind(values)
+}
+
+func (db *DB) execPrepared(p *executor.Prepared, args []any) (Result, error) {
+	stmt, err := bind(p, args)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := db.qp.Exec.Execute(stmt)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{RowsAffected: res.Affected, Message: res.Message}, nil
+}
+
+func (db *DB) queryPrepared(p *executor.Prepared, args []any) (*Rows, error) {
+	// refuse statements without rows before they change anything
+	desc, err := db.qp.Exec.DescribePrepared(p)
+	if err != nil {
+		return nil, err
+	}
+	if desc == nil {
+		return nil, errors.New("toydb: statement returns no rows, use Exec")
+	}
+	stmt, err := bind(p, args)
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.qp.Exec.Execute(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{columns: res.Columns, types: res.Types, rows: res.Rows, pos: -1}, nil
+}
+
+// Tx is an open transaction. It ends with Commit or Rollback, after which
+// it can't be used.
+type Tx struct {
+	db   *DB
+	mu   sync.Mutex
+	done bool
+}
+
+func (tx *Tx) Exec(sql string, args ...any) (Result, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return Result{}, ErrClosed
+	}
+	return tx.db.exec(sql, args)
+}
+
+func (tx *Tx) Query(sql string, args ...any) (*Rows, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, ErrClosed
+	}
+	return tx.db.query(sql, args)
+}
+
+// Stmt returns s to run in the transaction. Run on the DB, it would wait
+// for the transaction to end.
+func (tx *Tx) Stmt(s *Stmt) *Stmt {
+	return &Stmt{db: tx.db, tx: tx, prep: s.prep}
+}
+
+// Commit makes the writes of the transaction stay. A transaction a
+// statement failed in is rolled back instead, and Commit says so.
+func (tx *Tx) Commit() error {
+	return tx.end("COMMIT")
+}
+
+// Rollback undoes the writes of the transaction.
+func (tx *Tx) Rollback() error {
+	return tx.end("ROLLBACK")
+}
+
+func (tx *Tx) end(sql string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrClosed
+	}
+	tx.done = true
+	defer tx.db.mu.Unlock()
+	res, err := tx.db.exec(sql, nil)
+	if err != nil {
+		return err
+	}
+	if sql == "COMMIT" && res.Message == "ROLLBACK" {
+		return errors.New("toydb: transaction rolled back after an error")
+	}
+	return nil
+}
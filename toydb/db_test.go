@@ -0,0 +1,272 @@
+package toydb
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) (*DB, string) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("CREATE TABLE animals (id INT UNIQUE, name TEXT); INSERT INTO animals VALUES (1, 'frog'), (2, NULL)"); err != nil {
+		t.Fatalf("Failed to set up table: %v", err)
+	}
+	return db, dir
+}
+
+func countAnimals(t *testing.T, db *DB) int {
+	rows, err := db.Query("SELECT id FROM animals")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n
+}
+
+// scanOne scans the first row a query returns.
+func scanOne(db *DB, sql string, dest ...any) error {
+	rows, err := db.Query(sql)
+	if err != nil {
+		return err
+	}
+	if !rows.Next() {
+		return errors.New("no rows")
+	}
+	return rows.Scan(dest...)
+}
+
+func TestDB_ExecAndQuery(t *testing.T) {
+	db, dir := openTestDB(t)
+
+	res, err := db.Exec("UPDATE animals SET name = 'toad' WHERE id = 1")
+	if err != nil || res.RowsAffected != 1 {
+		t.Fatalf("Expected one row updated, got %+v, %v", res, err)
+	}
+	rows, err := db.Query("SELECT id, name, id = 1 AS first FROM animals")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if got := rows.Types(); len(got) != 3 || got[0] != "INT" || got[1] != "TEXT" || got[2] != "BOOLEAN" {
+		t.Errorf("Unexpected column types %v", got)
+	}
+	names := make(map[int]sql.NullString)
+	for rows.Next() {
+		var id int
+		var name sql.NullString
+		var first bool
+		if err := rows.Scan(&id, &name, &first); err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		if first != (id == 1) {
+			t.Errorf("Expected first to be %v for id %d", id == 1, id)
+		}
+		names[id] = name
+	}
+	if len(names) != 2 || names[1].String != "toad" || names[2].Valid {
+		t.Errorf("Unexpected rows %v", names)
+	}
+
+	rows, _ = db.Query("SELECT name FROM animals WHERE id = 2")
+	rows.Next()
+	var name string
+	if err := rows.Scan(&name); err == nil {
+		t.Error("Expected error scanning NULL into *string")
+	}
+	if _, err := db.Query("INSERT INTO animals VALUES (3, 'newt')"); err == nil {
+		t.Error("Expected error querying a statement without rows")
+	}
+	if _, err := db.Query("SELECT 1; SELECT 2"); err == nil {
+		t.Error("Expected error querying two statements")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := db.Exec("SELECT 1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer reopened.Close()
+	if n := countAnimals(t, reopened); n != 2 {
+		t.Errorf("Expected 2 rows after reopening, got %d", n)
+	}
+}
+
+func TestTx_CommitAndRollback(t *testing.T) {
+	db, _ := openTestDB(t)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM animals; INSERT INTO animals VALUES (3, 'newt')"); err != nil {
+		t.Fatalf("Failed to exec: %v", err)
+	}
+	if _, err := tx.Exec("CREATE TABLE other (id INT)"); err == nil {
+		t.Error("Expected error changing the schema in a transaction")
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("Expected commit of a failed transaction to report the rollback")
+	}
+	if n := countAnimals(t, db); n != 2 {
+		t.Errorf("Expected the rolled back delete to leave 2 rows, got %d", n)
+	}
+	if _, err := tx.Exec("SELECT 1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from a finished transaction, got %v", err)
+	}
+
+	tx, _ = db.Begin()
+	tx.Exec("INSERT INTO animals VALUES (3, 'newt')")
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	tx, _ = db.Begin()
+	tx.Exec("INSERT INTO animals VALUES (4, 'toad')")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if n := countAnimals(t, db); n != 3 {
+		t.Errorf("Expected 3 rows, got %d", n)
+	}
+}
+
+func TestTx_StatementsOutsideWait(t *testing.T) {
+	db, _ := openTestDB(t)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	tx.Exec("DELETE FROM animals")
+	done := make(chan int)
+	go func() {
+		// t.Fatal can't be called off the test goroutine
+		rows, err := db.Query("SELECT id FROM animals")
+		if err != nil {
+			done <- -1
+			return
+		}
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		t.Fatalf("Query outside the transaction ran while it was open, saw %d rows", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+	tx.Rollback()
+	if n := <-done; n != 2 {
+		t.Errorf("Expected 2 rows after the rollback, got %d", n)
+	}
+}
+
+func TestDB_PreparedStatements(t *testing.T) {
+	db, _ := openTestDB(t)
+
+	insert, err := db.Prepare("INSERT INTO animals VALUES ($1, $2)")
+	if err != nil {
+		t.Fatalf("Failed to prepare: %v", err)
+	}
+	for i, name := range []string{"newt", "it's'; DROP TABLE animals"} {
+		if _, err := insert.Exec(int64(i+3), name); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+	if _, err := insert.Exec("5", "toad"); err == nil {
+		t.Error("Expected error binding TEXT to an INT parameter")
+	}
+	if _, err := insert.Exec(5); err == nil {
+		t.Error("Expected error for a missing argument")
+	}
+	if n := countAnimals(t, db); n != 4 {
+		t.Fatalf("Expected 4 animals, got %d", n)
+	}
+
+	rows, err := db.Query("SELECT name FROM animals WHERE id = ?", 4)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	var name string
+	if !rows.Next() || rows.Scan(&name) != nil || name != "it's'; DROP TABLE animals" {
+		t.Errorf("Expected the name to be stored as given, got %q", name)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if _, err := tx.Stmt(insert).Exec(6, nil); err != nil {
+		t.Fatalf("Failed to insert in transaction: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if n := countAnimals(t, db); n != 4 {
+		t.Errorf("Expected the insert to be rolled back, got %d animals", n)
+	}
+}
+
+func TestDB_SchemaChangesAndReopen(t *testing.T) {
+	db, dir := openTestDB(t)
+
+	// each change is seen by the statements after it, which find the
+	// table already open
+	for _, sql := range []string{
+		"ALTER TABLE animals ADD COLUMN legs INT DEFAULT 4",
+		"CREATE INDEX animals_legs ON animals (legs)",
+		"INSERT INTO animals VALUES (3, 'snake', 0)",
+		"ALTER TABLE animals RENAME TO pets",
+		"CREATE TABLE animals (id INT)",
+		"INSERT INTO animals VALUES (7)",
+		"DROP TABLE animals",
+		"CREATE TABLE animals (id INT, name TEXT)",
+		"INSERT INTO animals VALUES (8, 'owl')",
+	} {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatalf("Failed to exec %q: %v", sql, err)
+		}
+	}
+	var id int
+	var name string
+	if err := scanOne(db, "SELECT id, name FROM pets WHERE legs = 0", &id, &name); err != nil || id != 3 || name != "snake" {
+		t.Errorf("Expected the snake by index, got %d %q, %v", id, name, err)
+	}
+	if n := countAnimals(t, db); n != 1 {
+		t.Errorf("Expected the new table's row only, got %d", n)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := db.Exec("SELECT 1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Expected closing again to do nothing, got %v", err)
+	}
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer db.Close()
+	var legs int
+	if err := scanOne(db, "SELECT legs FROM pets WHERE id = 1", &legs); err != nil || legs != 4 {
+		t.Errorf("Expected the default for an old row after reopening, got %d, %v", legs, err)
+	}
+}
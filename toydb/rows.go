@@ -0,0 +1,105 @@
+package toydb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Rows iterates over the rows a query returned:
+//
+//	for rows.Next() {
+//		err := rows.Scan(&id, &name)
+//	}
+type Rows struct {
+	columns []string
+	types   []string
+	rows    [][]any
+	pos     int
+}
+
+// Columns returns the names of the columns.
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Types returns the types of the columns: INT, TEXT, BOOLEAN, or unknown
+// for a column that is always NULL.
+func (r *Rows) Types() []string {
+	return r.types
+}
+
+// Next advances to the next row, reporting false after the last.
+func (r *Rows) Next() bool {
+	if r.pos < len(r.rows) {
+		r.pos++
+	}
+	return r.pos < len(r.rows)
+}
+
+// Values returns the values of the current row: int, string, bool or nil.
+func (r *Rows) Values() []any {
+	if r.pos < 0 || r.pos >= len(r.rows) {
+		return nil
+	}
+	return r.rows[r.pos]
+}
+
+// Scan copies the values of the current row into dest, one pointer per
+// column: *int, *int64, *string, *bool or *any, or an sql.Scanner such as
+// sql.NullString to receive NULL.
+func (r *Rows) Scan(dest ...any) error {
+	row := r.Values()
+	if row == nil {
+		return errors.New("toydb: Scan called without a current row")
+	}
+	if len(dest) != len(row) {
+		return fmt.Errorf("toydb: Scan expected %d destinations, got %d", len(row), len(dest))
+	}
+	for i, v := range row {
+		if err := scanValue(dest[i], v); err != nil {
+			return fmt.Errorf("toydb: column %s: %w", r.columns[i], err)
+		}
+	}
+	return nil
+}
+
+func scanValue(dest any, v any) error {
+	if s, ok := dest.(sql.Scanner); ok {
+		// scanners take the types database/sql drivers produce
+		if n, ok := v.(int); ok {
+			return s.Scan(int64(n))
+		}
+		return s.Scan(v)
+	}
+	if d, ok := dest.(*any); ok {
+		*d = v
+		return nil
+	}
+	if v == nil {
+		return fmt.Errorf("cannot scan NULL into %T", dest)
+	}
+	switch d := dest.(type) {
+	case *int:
+		if n, ok := v.(int); ok {
+			*d = n
+			return nil
+		}
+	case *int64:
+		if n, ok := v.(int); ok {
+			*d = int64(n)
+			return nil
+		}
+	case *string:
+		if s, ok := v.(string); ok {
+			*d = s
+			return nil
+		}
+	case *bool:
+		if b, ok := v.(bool); ok {
+			*d = b
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot scan %T into %T", v, dest)
+}
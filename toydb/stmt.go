@@ -0,0 +1,92 @@
+package toydb
+
+import (
+	"fmt"
+	"math"
+
+	"justasimpletoydb/internal/executor"
+)
+
+// Stmt is a statement prepared by DB.Prepare. Its parameters were typed
+// against the catalog when it was prepared: INT ones take Go integers,
+// TEXT ones strings or []byte, BOOLEAN ones bools; nil is NULL.
+type Stmt struct {
+	db   *DB
+	tx   *Tx // set for a statement run in a transaction by Tx.Stmt
+	prep *executor.Prepared
+}
+
+// Exec runs the statement with args for its parameters.
+func (s *Stmt) Exec(args ...any) (Result, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Result{}, err
+	}
+	defer unlock()
+	return s.db.execPrepared(s.prep, args)
+}
+
+// Query runs a statement returning rows with args for its parameters.
+func (s *Stmt) Query(args ...any) (*Rows, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.db.queryPrepared(s.prep, args)
+}
+
+// lock takes the lock of the DB or transaction the statement runs in.
+func (s *Stmt) lock() (func(), error) {
+	if s.tx != nil {
+		s.tx.mu.Lock()
+		if s.tx.done {
+			s.tx.mu.Unlock()
+			return nil, ErrClosed
+		}
+		return s.tx.mu.Unlock, nil
+	}
+	s.db.mu.Lock()
+	if s.db.closed {
+		s.db.mu.Unlock()
+		return nil, ErrClosed
+	}
+	return s.db.mu.Unlock, nil
+}
+
+// convertArg converts an argument to a value of the executor: int, string,
+// bool or nil.
+func convertArg(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, int, string, bool:
+		return v, nil
+	case int8:
+		return int(v), nil
+	case int16:
+		return int(v), nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint8:
+		return int(v), nil
+	case uint16:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	case uint:
+		if v > math.MaxInt {
+			return nil, fmt.Errorf("%d is out of range for INT", v)
+		}
+		return int(v), nil
+	case uint64:
+		if v > math.MaxInt {
+			return nil, fmt.Errorf("%d is out of range for INT", v)
+		}
+		return int(v), nil
+	case []byte:
+		return string(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}